@@ -1,10 +1,13 @@
 package agent
 
 import (
+	"sync"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/telegraf/selfstat"
 )
 
 type MetricMaker interface {
@@ -123,36 +126,91 @@ func (ac *accumulator) getTime(t []time.Time) time.Time {
 }
 
 func (ac *accumulator) WithTracking(maxTracked int) telegraf.TrackingAccumulator {
-	return &trackingAccumulator{
+	acc := &trackingAccumulator{
 		Accumulator: ac,
 		delivered:   make(chan telegraf.DeliveryInfo, maxTracked),
+		undelivered: make(map[telegraf.TrackingID]int64),
 	}
+	if input, ok := ac.maker.(*models.RunningInput); ok {
+		acc.undeliveredBytes = input.UndeliveredBytes
+	}
+	return acc
 }
 
+// trackingAccumulator pauses the input while the memory budget is exceeded,
+// the input stops consuming until its metrics are written.
 type trackingAccumulator struct {
 	telegraf.Accumulator
 	delivered chan telegraf.DeliveryInfo
+
+	mu               sync.Mutex
+	bytes            int64
+	undelivered      map[telegraf.TrackingID]int64
+	undeliveredBytes selfstat.Stat
 }
 
 func (a *trackingAccumulator) AddTrackingMetric(m telegraf.Metric) telegraf.TrackingID {
+	models.GlobalMemory.Wait()
+
+	var size int64
+	if models.GlobalMemory.Limited() {
+		size = models.MetricSize(m)
+	}
 	dm, id := metric.WithTracking(m, a.onDelivery)
+	a.track(id, size)
 	a.AddMetric(dm)
 	return id
 }
 
 func (a *trackingAccumulator) AddTrackingMetricGroup(group []telegraf.Metric) telegraf.TrackingID {
+	models.GlobalMemory.Wait()
+
+	var size int64
+	if models.GlobalMemory.Limited() {
+		for _, m := range group {
+			size += models.MetricSize(m)
+		}
+	}
 	db, id := metric.WithGroupTracking(group, a.onDelivery)
+	a.track(id, size)
 	for _, m := range db {
 		a.AddMetric(m)
 	}
 	return id
 }
 
+// track accounts the bytes of the metrics until their delivery.
+func (a *trackingAccumulator) track(id telegraf.TrackingID, size int64) {
+	if size == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.undelivered[id] += size
+	a.addBytes(size)
+}
+
+func (a *trackingAccumulator) addBytes(n int64) {
+	a.bytes += n
+	if a.undeliveredBytes != nil {
+		a.undeliveredBytes.Set(a.bytes)
+	}
+}
+
 func (a *trackingAccumulator) Delivered() <-chan telegraf.DeliveryInfo {
 	return a.delivered
 }
 
 func (a *trackingAccumulator) onDelivery(info telegraf.DeliveryInfo) {
+	a.mu.Lock()
+	if size, ok := a.undelivered[info.ID()]; ok {
+		delete(a.undelivered, info.ID())
+		a.addBytes(-size)
+	}
+	a.mu.Unlock()
+
 	select {
 	case a.delivered <- info:
 	default:
@@ -161,3 +219,86 @@ func (a *trackingAccumulator) onDelivery(info telegraf.DeliveryInfo) {
 		panic("channel is full")
 	}
 }
+
+// abandonableAccumulator is the accumulator of a gather with a timeout.  Once
+// the gather timed out, the metrics and errors it still adds are discarded,
+// the timeout is reported instead.
+type abandonableAccumulator struct {
+	telegraf.Accumulator
+
+	mu        sync.RWMutex
+	abandoned bool
+}
+
+func newAbandonableAccumulator(acc telegraf.Accumulator) *abandonableAccumulator {
+	return &abandonableAccumulator{Accumulator: acc}
+}
+
+// abandon discards everything added from now on.
+func (a *abandonableAccumulator) abandon() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.abandoned = true
+}
+
+// do calls add unless the gather was abandoned.
+func (a *abandonableAccumulator) do(add func()) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if !a.abandoned {
+		add()
+	}
+}
+
+func (a *abandonableAccumulator) AddFields(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.do(func() { a.Accumulator.AddFields(measurement, fields, tags, t...) })
+}
+
+func (a *abandonableAccumulator) AddGauge(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.do(func() { a.Accumulator.AddGauge(measurement, fields, tags, t...) })
+}
+
+func (a *abandonableAccumulator) AddCounter(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.do(func() { a.Accumulator.AddCounter(measurement, fields, tags, t...) })
+}
+
+func (a *abandonableAccumulator) AddSummary(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.do(func() { a.Accumulator.AddSummary(measurement, fields, tags, t...) })
+}
+
+func (a *abandonableAccumulator) AddHistogram(
+	measurement string,
+	fields map[string]interface{},
+	tags map[string]string,
+	t ...time.Time,
+) {
+	a.do(func() { a.Accumulator.AddHistogram(measurement, fields, tags, t...) })
+}
+
+func (a *abandonableAccumulator) AddMetric(m telegraf.Metric) {
+	a.do(func() { a.Accumulator.AddMetric(m) })
+}
+
+func (a *abandonableAccumulator) AddError(err error) {
+	a.do(func() { a.Accumulator.AddError(err) })
+}
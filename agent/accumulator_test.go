@@ -10,6 +10,7 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -140,6 +141,60 @@ func TestAddTrackingMetricGroupEmpty(t *testing.T) {
 	}
 }
 
+func TestTrackingUndeliveredBytes(t *testing.T) {
+	models.GlobalMemory.SetLimit(1 << 40)
+	defer models.GlobalMemory.SetLimit(0)
+
+	input := models.NewRunningInput(&blockingInput{}, &models.InputConfig{Name: "undelivered_bytes_test"})
+	ch := make(chan telegraf.Metric, 10)
+	acc := NewAccumulator(input, ch).WithTracking(2)
+
+	m := testutil.TestMetric(1)
+	size := models.MetricSize(m)
+	acc.AddTrackingMetric(m)
+	acc.AddTrackingMetricGroup([]telegraf.Metric{testutil.TestMetric(2), testutil.TestMetric(3)})
+	require.Equal(t, 3*size, input.UndeliveredBytes.Get())
+
+	(<-ch).Accept()
+	<-acc.Delivered()
+	require.Equal(t, 2*size, input.UndeliveredBytes.Get())
+
+	(<-ch).Accept()
+	(<-ch).Reject()
+	<-acc.Delivered()
+	require.Equal(t, int64(0), input.UndeliveredBytes.Get())
+}
+
+func TestTrackingWaitsForMemory(t *testing.T) {
+	defer models.GlobalMemory.SetLimit(0)
+
+	ch := make(chan telegraf.Metric, 10)
+	acc := NewAccumulator(&TestMetricMaker{}, ch).WithTracking(1)
+
+	models.GlobalMemory.SetLimit(1 << 40)
+	buf := models.NewBuffer("tracking_memory_test", "", 10)
+	for i := 0; i < 10; i++ {
+		buf.Add(testutil.TestMetric(i))
+	}
+	models.GlobalMemory.SetLimit(models.GlobalMemory.MemoryUsed.Get() - 1)
+
+	added := make(chan struct{})
+	go func() {
+		defer close(added)
+		acc.AddTrackingMetric(testutil.TestMetric(2))
+	}()
+
+	select {
+	case <-added:
+		t.Fatal("metric added while the memory budget is exceeded")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	buf.Accept(buf.Batch(10))
+	<-added
+	require.Len(t, ch, 1)
+}
+
 type TestMetricMaker struct {
 }
 
@@ -156,5 +211,5 @@ func (tm *TestMetricMaker) MakeMetric(metric telegraf.Metric) telegraf.Metric {
 }
 
 func (tm *TestMetricMaker) Log() telegraf.Logger {
-	return models.NewLogger("TestPlugin", "test", "")
+	return models.NewLogger("TestPlugin", "test", "", "")
 }
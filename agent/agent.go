@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -44,6 +45,10 @@ func NewAgent(config *config.Config) (*Agent, error) {
 type inputUnit struct {
 	dst    chan<- telegraf.Metric
 	inputs []*models.RunningInput
+
+	// retry contains the service inputs failing to start with the "retry"
+	// startup error behavior.  They are started in the background.
+	retry map[*models.RunningInput]bool
 }
 
 //  ______     ┌───────────┐     ______
@@ -89,11 +94,27 @@ type aggregatorUnit struct {
 //                       │    ┌────────┐
 //                       └──▶ │ Output │
 //                            └────────┘
+//
+// Routers add an output per value of their routing tag, the outputs are
+// started on their first metric and stopped when idle.
 type outputUnit struct {
 	src     <-chan telegraf.Metric
 	outputs []*models.RunningOutput
+	routers []*models.OutputRouter
+
+	// retry contains the outputs failing to connect with the "retry" startup
+	// error behavior.  They are connected in the background and buffer the
+	// metrics until then.
+	retry map[*models.RunningOutput]bool
 }
 
+// Delays between the attempts to start plugins with the "retry" startup error
+// behavior, the delay doubles after each failed attempt.
+var (
+	startupRetryMin = 15 * time.Second
+	startupRetryMax = 5 * time.Minute
+)
+
 // Run starts and runs the Agent until the context is done.
 func (a *Agent) Run(ctx context.Context) error {
 	log.Printf("I! [agent] Config: Interval:%s, Quiet:%#v, Hostname:%#v, "+
@@ -107,10 +128,20 @@ func (a *Agent) Run(ctx context.Context) error {
 		return err
 	}
 
+	if a.Config.Agent.SelfMetricsListen != "" {
+		srv, err := startSelfMetrics(a.Config.Agent.SelfMetricsListen)
+		if err != nil {
+			return err
+		}
+		defer srv.Close()
+	}
+
+	a.startMemoryBudget(ctx)
+
 	startTime := time.Now()
 
 	log.Printf("D! [agent] Connecting outputs")
-	next, ou, err := a.startOutputs(ctx, a.Config.Outputs)
+	next, ou, err := a.startOutputs(ctx, a.Config.Outputs, a.Config.OutputRouters)
 	if err != nil {
 		return err
 	}
@@ -201,6 +232,22 @@ func (a *Agent) Run(ctx context.Context) error {
 	return err
 }
 
+// startMemoryBudget applies the max_memory limit to the buffered metrics until
+// the context is done.  The limit is lifted on shutdown, so the inputs waiting
+// for memory can stop.
+func (a *Agent) startMemoryBudget(ctx context.Context) {
+	limit := a.Config.Agent.MaxMemory.Size
+	if limit <= 0 {
+		return
+	}
+
+	models.GlobalMemory.SetLimit(limit)
+	go func() {
+		<-ctx.Done()
+		models.GlobalMemory.SetLimit(0)
+	}()
+}
+
 // initPlugins runs the Init function on plugins.
 func (a *Agent) initPlugins() error {
 	for _, input := range a.Config.Inputs {
@@ -248,30 +295,27 @@ func (a *Agent) startInputs(
 	log.Printf("D! [agent] Starting service inputs")
 
 	unit := &inputUnit{
-		dst: dst,
+		dst:   dst,
+		retry: make(map[*models.RunningInput]bool),
 	}
 
 	for _, input := range inputs {
-		if si, ok := input.Input.(telegraf.ServiceInput); ok {
-			// Service input plugins are not normally subject to timestamp
-			// rounding except for when precision is set on the input plugin.
-			//
-			// This only applies to the accumulator passed to Start(), the
-			// Gather() accumulator does apply rounding according to the
-			// precision and interval agent/plugin settings.
-			var interval time.Duration
-			var precision time.Duration
-			if input.Config.Precision != 0 {
-				precision = input.Config.Precision
-			}
-
-			acc := NewAccumulator(input, dst)
-			acc.SetPrecision(getPrecision(precision, interval))
-
-			err := si.Start(acc)
+		if _, ok := input.Input.(telegraf.ServiceInput); ok {
+			err := a.startServiceInput(input, dst)
 			if err != nil {
-				stopServiceInputs(unit.inputs)
-				return nil, fmt.Errorf("starting input %s: %w", input.LogName(), err)
+				switch input.Config.StartupErrorBehavior {
+				case "retry":
+					log.Printf("E! [agent] Starting input %s failed, retrying in the background: %v",
+						input.LogName(), err)
+					unit.retry[input] = true
+				case "ignore":
+					log.Printf("E! [agent] Starting input %s failed, input disabled: %v",
+						input.LogName(), err)
+					continue
+				default:
+					stopServiceInputs(unit.startedInputs())
+					return nil, fmt.Errorf("starting input %s: %w", input.LogName(), err)
+				}
 			}
 		}
 		unit.inputs = append(unit.inputs, input)
@@ -280,6 +324,64 @@ func (a *Agent) startInputs(
 	return unit, nil
 }
 
+// startServiceInput calls Start on the service input.
+func (a *Agent) startServiceInput(input *models.RunningInput, dst chan<- telegraf.Metric) error {
+	// Service input plugins are not normally subject to timestamp
+	// rounding except for when precision is set on the input plugin.
+	//
+	// This only applies to the accumulator passed to Start(), the
+	// Gather() accumulator does apply rounding according to the
+	// precision and interval agent/plugin settings.
+	var interval time.Duration
+	var precision time.Duration
+	if input.Config.Precision != 0 {
+		precision = input.Config.Precision
+	}
+
+	acc := NewAccumulator(input, dst)
+	acc.SetPrecision(getPrecision(precision, interval))
+
+	err := input.Input.(telegraf.ServiceInput).Start(acc)
+	if err != nil {
+		input.StartupErrors.Incr(1)
+	}
+	return err
+}
+
+// startedInputs returns the inputs without the inputs still to be started.
+func (u *inputUnit) startedInputs() []*models.RunningInput {
+	inputs := make([]*models.RunningInput, 0, len(u.inputs))
+	for _, input := range u.inputs {
+		if !u.retry[input] {
+			inputs = append(inputs, input)
+		}
+	}
+	return inputs
+}
+
+// retryStartup calls start until it succeeds or the context is done.  It
+// returns false if the context is done first.
+func retryStartup(ctx context.Context, name string, start func() error) bool {
+	delay := startupRetryMin
+	for {
+		if err := internal.SleepContext(ctx, delay); err != nil {
+			return false
+		}
+
+		err := start()
+		if err == nil {
+			log.Printf("I! [agent] Successfully started %s after startup error", name)
+			return true
+		}
+
+		delay *= 2
+		if delay > startupRetryMax {
+			delay = startupRetryMax
+		}
+		log.Printf("E! [agent] Starting %s failed, retrying in %s: %v", name, delay, err)
+	}
+}
+
 // runInputs starts and triggers the periodic gather for Inputs.
 //
 // When the context is done the timers are stopped and this function returns
@@ -310,7 +412,9 @@ func (a *Agent) runInputs(
 		}
 
 		var ticker Ticker
-		if a.Config.Agent.RoundInterval {
+		if input.Config.Schedule != nil {
+			ticker = NewCronTicker(input.Config.Schedule, jitter, input.NextRun)
+		} else if a.Config.Agent.RoundInterval {
 			ticker = NewAlignedTicker(startTime, interval, jitter)
 		} else {
 			ticker = NewUnalignedTicker(interval, jitter)
@@ -323,6 +427,17 @@ func (a *Agent) runInputs(
 		wg.Add(1)
 		go func(input *models.RunningInput) {
 			defer wg.Done()
+
+			if unit.retry[input] {
+				started := retryStartup(ctx, input.LogName(), func() error {
+					return a.startServiceInput(input, unit.dst)
+				})
+				if !started {
+					return
+				}
+				defer input.Input.(telegraf.ServiceInput).Stop()
+			}
+
 			a.gatherLoop(ctx, acc, input, ticker, interval)
 		}(input)
 	}
@@ -330,7 +445,7 @@ func (a *Agent) runInputs(
 	wg.Wait()
 
 	log.Printf("D! [agent] Stopping service inputs")
-	stopServiceInputs(unit.inputs)
+	stopServiceInputs(unit.startedInputs())
 
 	close(unit.dst)
 	log.Printf("D! [agent] Input channel closed")
@@ -430,6 +545,9 @@ func (a *Agent) testRunInputs(
 
 	internal.SleepContext(ctx, wait)
 
+	// Release the inputs waiting for memory, so they can stop.
+	models.GlobalMemory.SetLimit(0)
+
 	log.Printf("D! [agent] Stopping service inputs")
 	stopServiceInputs(unit.inputs)
 
@@ -458,13 +576,77 @@ func (a *Agent) gatherLoop(
 ) {
 	defer panicRecover(input)
 
+	if input.Config.OverlapPolicy == "concurrent" {
+		a.gatherConcurrent(ctx, acc, input, ticker, interval)
+		return
+	}
+
+	var running, queued bool
+	done := make(chan error, 1)
+	gather := func() {
+		running = true
+		go func() {
+			done <- a.gatherOnce(ctx, acc, input, interval)
+		}()
+	}
+
 	for {
 		select {
 		case <-ticker.Elapsed():
-			err := a.gatherOnce(acc, input, ticker, interval)
+			switch {
+			case !running:
+				gather()
+			case input.Config.OverlapPolicy == "queue" && !queued:
+				log.Printf("D! [%s] Previous collection has not completed; scheduled collection queued",
+					input.LogName())
+				queued = true
+			default:
+				log.Printf("D! [%s] Previous collection has not completed; scheduled collection skipped",
+					input.LogName())
+				input.GatherSkipped.Incr(1)
+			}
+		case err := <-done:
+			running = false
 			if err != nil {
 				acc.AddError(err)
 			}
+			if queued {
+				queued = false
+				gather()
+			}
+		case <-ctx.Done():
+			if running {
+				if err := <-done; err != nil {
+					acc.AddError(err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// gatherConcurrent starts a gather for each tick, without waiting for the
+// previous gathers to complete.
+func (a *Agent) gatherConcurrent(
+	ctx context.Context,
+	acc telegraf.Accumulator,
+	input *models.RunningInput,
+	ticker Ticker,
+	interval time.Duration,
+) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ticker.Elapsed():
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := a.gatherOnce(ctx, acc, input, interval); err != nil {
+					acc.AddError(err)
+				}
+			}()
 		case <-ctx.Done():
 			return
 		}
@@ -473,15 +655,44 @@ func (a *Agent) gatherLoop(
 
 // gatherOnce runs the input's Gather function once, logging a warning each
 // interval it fails to complete before.
+//
+// The context of the gather is cancelled when the agent stops or the gather
+// does not complete within the gather timeout of the input.  A timeout is
+// reported as an error and anything the gather adds afterwards is discarded.
+// Inputs without context support cannot be interrupted, so the gather is
+// still awaited: the input stays running and is not gathered again before
+// the gather returns.
 func (a *Agent) gatherOnce(
+	ctx context.Context,
 	acc telegraf.Accumulator,
 	input *models.RunningInput,
-	ticker Ticker,
 	interval time.Duration,
 ) error {
-	done := make(chan error)
+	if !input.Config.IgnoreMaxMemory && models.GlobalMemory.Exceeded() {
+		log.Printf("D! [%s] Buffered metrics exceed max_memory; scheduled collection skipped",
+			input.LogName())
+		input.GatherSkipped.Incr(1)
+		return nil
+	}
+
+	gatherCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timeout := input.Config.GatherTimeout
+	if timeout > 0 {
+		gatherCtx, cancel = context.WithTimeout(gatherCtx, timeout)
+		defer cancel()
+	}
+
+	var gatherAcc telegraf.Accumulator = acc
+	var abandonable *abandonableAccumulator
+	if timeout > 0 {
+		abandonable = newAbandonableAccumulator(acc)
+		gatherAcc = abandonable
+	}
+
+	done := make(chan error, 1)
 	go func() {
-		done <- input.Gather(acc)
+		done <- input.GatherContext(gatherCtx, gatherAcc)
 	}()
 
 	// Only warn after interval seconds, even if the interval is started late.
@@ -490,16 +701,26 @@ func (a *Agent) gatherOnce(
 	slowWarning := time.NewTicker(interval)
 	defer slowWarning.Stop()
 
+	cancelled := gatherCtx.Done()
 	for {
 		select {
 		case err := <-done:
+			// The timeout was already reported and cancelling on shutdown
+			// is no error.
+			if gatherCtx.Err() != nil && errors.Is(err, gatherCtx.Err()) {
+				return nil
+			}
 			return err
 		case <-slowWarning.C:
 			log.Printf("W! [%s] Collection took longer than expected; not complete after interval of %s",
 				input.LogName(), interval)
-		case <-ticker.Elapsed():
-			log.Printf("D! [%s] Previous collection has not completed; scheduled collection skipped",
-				input.LogName())
+		case <-cancelled:
+			cancelled = nil
+			if gatherCtx.Err() == context.DeadlineExceeded {
+				input.GatherTimeouts.Incr(1)
+				acc.AddError(fmt.Errorf("collection timed out after %s", timeout))
+				abandonable.abandon()
+			}
 		}
 	}
 }
@@ -682,7 +903,7 @@ func (a *Agent) push(
 			aggregator.Push(acc)
 			break
 		case <-ctx.Done():
-			aggregator.Push(acc)
+			aggregator.PushAll(acc)
 			return
 		}
 	}
@@ -693,16 +914,34 @@ func (a *Agent) push(
 func (a *Agent) startOutputs(
 	ctx context.Context,
 	outputs []*models.RunningOutput,
+	routers []*models.OutputRouter,
 ) (chan<- telegraf.Metric, *outputUnit, error) {
 	src := make(chan telegraf.Metric, 100)
-	unit := &outputUnit{src: src}
+	unit := &outputUnit{
+		src:     src,
+		routers: routers,
+		retry:   make(map[*models.RunningOutput]bool),
+	}
 	for _, output := range outputs {
 		err := a.connectOutput(ctx, output)
 		if err != nil {
-			for _, output := range unit.outputs {
-				output.Close()
+			switch output.Config.StartupErrorBehavior {
+			case "retry":
+				log.Printf("E! [agent] Connecting output %s failed, buffering metrics and retrying in the background: %v",
+					output.LogName(), err)
+				unit.retry[output] = true
+			case "ignore":
+				log.Printf("E! [agent] Connecting output %s failed, output disabled: %v",
+					output.LogName(), err)
+				continue
+			default:
+				for _, output := range unit.outputs {
+					if !unit.retry[output] {
+						output.Close()
+					}
+				}
+				return nil, nil, fmt.Errorf("connecting output %s: %w", output.LogName(), err)
 			}
-			return nil, nil, fmt.Errorf("connecting output %s: %w", output.LogName(), err)
 		}
 
 		unit.outputs = append(unit.outputs, output)
@@ -716,6 +955,12 @@ func (a *Agent) connectOutput(ctx context.Context, output *models.RunningOutput)
 	log.Printf("D! [agent] Attempting connection to [%s]", output.LogName())
 	err := output.Output.Connect()
 	if err != nil {
+		output.StartupErrors.Incr(1)
+		switch output.Config.StartupErrorBehavior {
+		case "retry", "ignore":
+			return err
+		}
+
 		log.Printf("E! [agent] Failed to connect to [%s], retrying in 15s, "+
 			"error was '%s'", output.LogName(), err)
 
@@ -726,6 +971,7 @@ func (a *Agent) connectOutput(ctx context.Context, output *models.RunningOutput)
 
 		err = output.Output.Connect()
 		if err != nil {
+			output.StartupErrors.Incr(1)
 			return fmt.Errorf("Error connecting to output %q: %w", output.LogName(), err)
 		}
 	}
@@ -735,57 +981,183 @@ func (a *Agent) connectOutput(ctx context.Context, output *models.RunningOutput)
 
 // runOutputs begins processing metrics and returns until the source channel is
 // closed and all metrics have been written.  On shutdown metrics will be
-// written one last time and dropped if unsuccessful.
+// written one last time and dropped if unsuccessful, then the outputs are
+// closed.
 func (a *Agent) runOutputs(
 	unit *outputUnit,
 ) error {
 	var wg sync.WaitGroup
 
-	// Start flush loop
-	interval := a.Config.Agent.FlushInterval.Duration
-	jitter := a.Config.Agent.FlushJitter.Duration
-
 	ctx, cancel := context.WithCancel(context.Background())
 
 	for _, output := range unit.outputs {
-		interval := interval
-		// Overwrite agent flush_interval if this plugin has its own.
-		if output.Config.FlushInterval != 0 {
-			interval = output.Config.FlushInterval
-		}
-
-		jitter := jitter
-		// Overwrite agent flush_jitter if this plugin has its own.
-		if output.Config.FlushJitter != 0 {
-			jitter = output.Config.FlushJitter
-		}
-
 		wg.Add(1)
 		go func(output *models.RunningOutput) {
 			defer wg.Done()
 
-			ticker := NewRollingTicker(interval, jitter)
+			if unit.retry[output] {
+				connected := retryStartup(ctx, output.LogName(), func() error {
+					err := output.Output.Connect()
+					if err != nil {
+						output.StartupErrors.Incr(1)
+					}
+					return err
+				})
+				if !connected {
+					log.Printf("W! [agent] Output %s was never connected, dropping %d buffered metrics",
+						output.LogName(), output.BufferLength())
+					return
+				}
+			}
+
+			// Only connected outputs are closed, as in startOutputs.
+			defer output.Close()
+
+			ticker := a.newFlushTicker(output)
 			defer ticker.Stop()
 
 			a.flushLoop(ctx, output, ticker)
 		}(output)
 	}
 
-	for metric := range unit.src {
-		for i, output := range unit.outputs {
-			if i == len(a.Config.Outputs)-1 {
-				output.AddMetric(metric)
-			} else {
-				output.AddMetric(metric.Copy())
+	// Routed outputs are stopped by canceling their context, they are
+	// flushed one last time and closed.
+	stopRouted := make(map[*models.RunningOutput]context.CancelFunc)
+	startRouted := func(output *models.RunningOutput) {
+		routedCtx, stop := context.WithCancel(ctx)
+		stopRouted[output] = stop
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer output.Close()
+			defer func() {
+				// Evicted outputs are discarded, release the memory
+				// of the metrics they failed to write.
+				if ctx.Err() == nil {
+					output.DropBuffer()
+				}
+			}()
+
+			log.Printf("D! [agent] Attempting connection to [%s]", output.LogName())
+			if err := output.Output.Connect(); err != nil {
+				output.StartupErrors.Incr(1)
+				log.Printf("E! [agent] Connecting output %s failed, buffering metrics and retrying in the background: %v",
+					output.LogName(), err)
+				connected := retryStartup(routedCtx, output.LogName(), func() error {
+					err := output.Output.Connect()
+					if err != nil {
+						output.StartupErrors.Incr(1)
+					}
+					return err
+				})
+				if !connected {
+					log.Printf("W! [agent] Output %s was never connected, dropping %d buffered metrics",
+						output.LogName(), output.BufferLength())
+					return
+				}
+			}
+
+			ticker := a.newFlushTicker(output)
+			defer ticker.Stop()
+
+			a.flushLoop(routedCtx, output, ticker)
+		}()
+	}
+
+	var evict <-chan time.Time
+	if len(unit.routers) != 0 {
+		ticker := time.NewTicker(routeEvictInterval(unit.routers))
+		defer ticker.Stop()
+		evict = ticker.C
+	}
+
+	targets := len(unit.outputs) + len(unit.routers)
+	for {
+		var metric telegraf.Metric
+		select {
+		case m, ok := <-unit.src:
+			if !ok {
+				log.Println("I! [agent] Hang on, flushing any cached metrics before shutdown")
+				cancel()
+				wg.Wait()
+				return nil
+			}
+			metric = m
+		case now := <-evict:
+			for _, router := range unit.routers {
+				for _, output := range router.Evict(now) {
+					log.Printf("D! [agent] Stopping idle output %s", output.LogName())
+					output.Unregister()
+					stopRouted[output]()
+					delete(stopRouted, output)
+				}
+			}
+			continue
+		}
+
+		if targets == 0 {
+			metric.Drop()
+			continue
+		}
+
+		// The last target takes the metric, the others a copy.
+		target := 0
+		next := func() telegraf.Metric {
+			target++
+			if target == targets {
+				return metric
+			}
+			return metric.Copy()
+		}
+		for _, output := range unit.outputs {
+			output.AddMetric(next())
+		}
+		for _, router := range unit.routers {
+			m := next()
+			output, created, err := router.Route(m, time.Now())
+			if err != nil {
+				log.Printf("E! [agent] Error routing metric to %s: %v", router.LogName(), err)
 			}
+			if output == nil {
+				continue
+			}
+			if created {
+				startRouted(output)
+			}
+			output.AddMetric(m)
 		}
 	}
+}
 
-	log.Println("I! [agent] Hang on, flushing any cached metrics before shutdown")
-	cancel()
-	wg.Wait()
+// newFlushTicker returns the ticker of the flush loop of the output.
+func (a *Agent) newFlushTicker(output *models.RunningOutput) Ticker {
+	interval := a.Config.Agent.FlushInterval.Duration
+	jitter := a.Config.Agent.FlushJitter.Duration
 
-	return nil
+	// Overwrite agent flush_interval if this plugin has its own.
+	if output.Config.FlushInterval != 0 {
+		interval = output.Config.FlushInterval
+	}
+
+	// Overwrite agent flush_jitter if this plugin has its own.
+	if output.Config.FlushJitter != 0 {
+		jitter = output.Config.FlushJitter
+	}
+
+	return NewRollingTicker(interval, jitter)
+}
+
+// routeEvictInterval returns the interval of the checks for idle routed
+// outputs, outputs are stopped at most one idle timeout late.
+func routeEvictInterval(routers []*models.OutputRouter) time.Duration {
+	interval := routers[0].Config.RouteIdleTimeout
+	for _, router := range routers[1:] {
+		if router.Config.RouteIdleTimeout < interval {
+			interval = router.Config.RouteIdleTimeout
+		}
+	}
+	return interval
 }
 
 // flushLoop runs an output's flush function periodically until the context is
@@ -1002,6 +1374,11 @@ func (a *Agent) Once(ctx context.Context, wait time.Duration) error {
 	for _, output := range a.Config.Outputs {
 		unsent += output.BufferLength()
 	}
+	for _, router := range a.Config.OutputRouters {
+		for _, output := range router.Outputs() {
+			unsent += output.BufferLength()
+		}
+	}
 	if unsent != 0 {
 		return fmt.Errorf("output plugins unable to send %d metrics", unsent)
 	}
@@ -1018,10 +1395,12 @@ func (a *Agent) once(ctx context.Context, wait time.Duration) error {
 		return err
 	}
 
+	a.startMemoryBudget(ctx)
+
 	startTime := time.Now()
 
 	log.Printf("D! [agent] Connecting outputs")
-	next, ou, err := a.startOutputs(ctx, a.Config.Outputs)
+	next, ou, err := a.startOutputs(ctx, a.Config.Outputs, a.Config.OutputRouters)
 	if err != nil {
 		return err
 	}
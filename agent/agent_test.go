@@ -1,12 +1,21 @@
 package agent
 
 import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/models"
 	_ "github.com/influxdata/telegraf/plugins/inputs/all"
 	_ "github.com/influxdata/telegraf/plugins/outputs/all"
+	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -166,3 +175,490 @@ func TestWindow(t *testing.T) {
 		})
 	}
 }
+
+// manualTicker delivers a tick for each send on the channel.
+type manualTicker struct {
+	ch chan time.Time
+}
+
+func (t *manualTicker) Elapsed() <-chan time.Time {
+	return t.ch
+}
+
+func (t *manualTicker) Stop() {}
+
+// blockingInput blocks each Gather until it is released, then adds a metric.
+type blockingInput struct {
+	gathers int64
+	release chan struct{}
+}
+
+func (i *blockingInput) SampleConfig() string {
+	return ""
+}
+
+func (i *blockingInput) Description() string {
+	return ""
+}
+
+func (i *blockingInput) Gather(acc telegraf.Accumulator) error {
+	atomic.AddInt64(&i.gathers, 1)
+	<-i.release
+	acc.AddFields("blocking", map[string]interface{}{"value": 1}, nil)
+	return nil
+}
+
+// contextInput blocks each gather until its context is done.
+type contextInput struct {
+	blockingInput
+}
+
+func (i *contextInput) GatherContext(ctx context.Context, acc telegraf.Accumulator) error {
+	atomic.AddInt64(&i.gathers, 1)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func runGatherLoop(ctx context.Context, input *models.RunningInput, acc telegraf.Accumulator) (*manualTicker, chan struct{}) {
+	ticker := &manualTicker{ch: make(chan time.Time)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a := &Agent{}
+		a.gatherLoop(ctx, acc, input, ticker, time.Hour)
+	}()
+	return ticker, done
+}
+
+func TestGatherTimeout(t *testing.T) {
+	input := &contextInput{}
+	ri := models.NewRunningInput(input, &models.InputConfig{
+		Name:          "gather_timeout",
+		GatherTimeout: 10 * time.Millisecond,
+	})
+	acc := &testutil.Accumulator{}
+	timeouts := ri.GatherTimeouts.Get()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ticker, done := runGatherLoop(ctx, ri, acc)
+
+	ticker.ch <- time.Now()
+	acc.WaitError(1)
+	require.Eventually(t, func() bool {
+		return ri.GatherTimeouts.Get()-timeouts == 1
+	}, time.Second, time.Millisecond)
+
+	// The input is gathered again after the timed out gather returned.
+	require.Eventually(t, func() bool {
+		select {
+		case ticker.ch <- time.Now():
+		default:
+		}
+		return atomic.LoadInt64(&input.gathers) == 2
+	}, time.Second, time.Millisecond)
+	acc.WaitError(2)
+
+	cancel()
+	<-done
+
+	// The context error of the gathers is not reported again.
+	require.Len(t, acc.Errors, 2)
+	for _, err := range acc.Errors {
+		require.EqualError(t, err, "collection timed out after 10ms")
+	}
+}
+
+func TestGatherTimeoutWithoutContext(t *testing.T) {
+	input := &blockingInput{release: make(chan struct{})}
+	ri := models.NewRunningInput(input, &models.InputConfig{
+		Name:          "gather_timeout_without_context",
+		GatherTimeout: 10 * time.Millisecond,
+	})
+	acc := &testutil.Accumulator{}
+	skipped := ri.GatherSkipped.Get()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ticker, done := runGatherLoop(ctx, ri, acc)
+
+	ticker.ch <- time.Now()
+	acc.WaitError(1)
+	require.EqualError(t, acc.FirstError(), "collection timed out after 10ms")
+
+	// The input is not gathered again while the timed out gather runs.
+	ticker.ch <- time.Now()
+	require.Eventually(t, func() bool {
+		return ri.GatherSkipped.Get()-skipped == 1
+	}, time.Second, time.Millisecond)
+	require.Equal(t, int64(1), atomic.LoadInt64(&input.gathers))
+
+	// The agent waits for the timed out gather to stop, its metrics are
+	// discarded.
+	cancel()
+	select {
+	case <-done:
+		t.Fatal("gather loop stopped before the gather returned")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(input.release)
+	<-done
+	require.Equal(t, uint64(0), acc.NMetrics())
+	require.Len(t, acc.Errors, 1)
+}
+
+func TestGatherOverlapPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		gathers int64
+		skipped int64
+	}{
+		{policy: "", gathers: 1, skipped: 2},
+		{policy: "skip", gathers: 1, skipped: 2},
+		{policy: "queue", gathers: 2, skipped: 1},
+		{policy: "concurrent", gathers: 3, skipped: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			input := &blockingInput{release: make(chan struct{})}
+			ri := models.NewRunningInput(input, &models.InputConfig{
+				Name:          "overlap_policy_" + tt.policy,
+				OverlapPolicy: tt.policy,
+			})
+			acc := &testutil.Accumulator{}
+			skipped := ri.GatherSkipped.Get()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			ticker, done := runGatherLoop(ctx, ri, acc)
+
+			for i := 0; i < 3; i++ {
+				ticker.ch <- time.Now()
+			}
+			require.Eventually(t, func() bool {
+				return ri.GatherSkipped.Get()-skipped == tt.skipped
+			}, time.Second, time.Millisecond)
+
+			// Release the blocked and the queued gathers.
+			close(input.release)
+			require.Eventually(t, func() bool {
+				return atomic.LoadInt64(&input.gathers) == tt.gathers
+			}, time.Second, time.Millisecond)
+
+			cancel()
+			<-done
+			require.Equal(t, tt.gathers, atomic.LoadInt64(&input.gathers))
+			require.Empty(t, acc.Errors)
+		})
+	}
+}
+
+func TestGatherSkippedOverMemory(t *testing.T) {
+	defer models.GlobalMemory.SetLimit(0)
+
+	input := &blockingInput{release: make(chan struct{})}
+	close(input.release)
+	ri := models.NewRunningInput(input, &models.InputConfig{Name: "memory_skip_test"})
+	skipped := ri.GatherSkipped.Get()
+	acc := testutil.Accumulator{}
+	a := &Agent{}
+
+	models.GlobalMemory.SetLimit(1 << 40)
+	buf := models.NewBuffer("memory_skip_test", "", 10)
+	buf.Add(testutil.TestMetric(1))
+	models.GlobalMemory.SetLimit(models.GlobalMemory.MemoryUsed.Get() - 1)
+
+	require.NoError(t, a.gatherOnce(context.Background(), &acc, ri, time.Hour))
+	require.Equal(t, int64(0), atomic.LoadInt64(&input.gathers))
+	require.Equal(t, int64(1), ri.GatherSkipped.Get()-skipped)
+
+	// inputs ignoring the budget are still gathered
+	ri.Config.IgnoreMaxMemory = true
+	require.NoError(t, a.gatherOnce(context.Background(), &acc, ri, time.Hour))
+	require.Equal(t, int64(1), atomic.LoadInt64(&input.gathers))
+	ri.Config.IgnoreMaxMemory = false
+
+	models.GlobalMemory.SetLimit(0)
+	require.NoError(t, a.gatherOnce(context.Background(), &acc, ri, time.Hour))
+	require.Equal(t, int64(2), atomic.LoadInt64(&input.gathers))
+	buf.Drop()
+}
+
+// flakyOutput fails to connect the given number of times.
+type flakyOutput struct {
+	sync.Mutex
+	failures int
+	connects int
+	closes   int
+	metrics  []telegraf.Metric
+}
+
+func (o *flakyOutput) SampleConfig() string {
+	return ""
+}
+
+func (o *flakyOutput) Description() string {
+	return ""
+}
+
+func (o *flakyOutput) Connect() error {
+	o.Lock()
+	defer o.Unlock()
+	o.connects++
+	if o.connects <= o.failures {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (o *flakyOutput) Close() error {
+	o.Lock()
+	defer o.Unlock()
+	o.closes++
+	return nil
+}
+
+func (o *flakyOutput) Write(metrics []telegraf.Metric) error {
+	o.Lock()
+	defer o.Unlock()
+	if o.connects <= o.failures {
+		return errors.New("not connected")
+	}
+	o.metrics = append(o.metrics, metrics...)
+	return nil
+}
+
+func (o *flakyOutput) written() int {
+	o.Lock()
+	defer o.Unlock()
+	return len(o.metrics)
+}
+
+func (o *flakyOutput) closed() bool {
+	o.Lock()
+	defer o.Unlock()
+	return o.closes != 0
+}
+
+// flakyServiceInput fails to start the given number of times.
+type flakyServiceInput struct {
+	blockingInput
+	failures int32
+	starts   int32
+	stops    int32
+}
+
+func (i *flakyServiceInput) Start(acc telegraf.Accumulator) error {
+	if atomic.AddInt32(&i.starts, 1) <= i.failures {
+		return errors.New("address already in use")
+	}
+	return nil
+}
+
+func (i *flakyServiceInput) Gather(acc telegraf.Accumulator) error {
+	atomic.AddInt64(&i.gathers, 1)
+	return nil
+}
+
+func (i *flakyServiceInput) Stop() {
+	atomic.AddInt32(&i.stops, 1)
+}
+
+// shortStartupRetry shortens the startup retry delays until the returned
+// function is called.
+func shortStartupRetry() func() {
+	min, max := startupRetryMin, startupRetryMax
+	startupRetryMin, startupRetryMax = time.Millisecond, 5*time.Millisecond
+	return func() {
+		startupRetryMin, startupRetryMax = min, max
+	}
+}
+
+func TestStartupErrorBehaviorOutputs(t *testing.T) {
+	defer shortStartupRetry()()
+
+	c := config.NewConfig()
+	c.Agent.FlushInterval = internal.Duration{Duration: 10 * time.Millisecond}
+	a := &Agent{Config: c}
+
+	retried := &flakyOutput{failures: 3}
+	ignored := &flakyOutput{failures: 1}
+	healthy := &flakyOutput{}
+	unreachable := &flakyOutput{failures: math.MaxInt32}
+	outputs := []*models.RunningOutput{
+		models.NewRunningOutput("retried", retried, &models.OutputConfig{
+			Name:                 "startup_retried",
+			StartupErrorBehavior: "retry",
+		}, 0, 0),
+		models.NewRunningOutput("unreachable", unreachable, &models.OutputConfig{
+			Name:                 "startup_unreachable",
+			StartupErrorBehavior: "retry",
+		}, 0, 0),
+		models.NewRunningOutput("ignored", ignored, &models.OutputConfig{
+			Name:                 "startup_ignored",
+			StartupErrorBehavior: "ignore",
+		}, 0, 0),
+		models.NewRunningOutput("healthy", healthy, &models.OutputConfig{
+			Name: "startup_healthy",
+		}, 0, 0),
+	}
+	startupErrors := outputs[0].StartupErrors.Get()
+
+	src, unit, err := a.startOutputs(context.Background(), outputs, nil)
+	require.NoError(t, err)
+	require.Len(t, unit.outputs, 3)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, a.runOutputs(unit))
+	}()
+
+	src <- testutil.TestMetric(1)
+	require.Eventually(t, func() bool {
+		return retried.written() == 1 && healthy.written() == 1
+	}, 5*time.Second, time.Millisecond)
+	close(src)
+	<-done
+
+	require.Equal(t, 4, retried.connects)
+	require.Equal(t, int64(3), outputs[0].StartupErrors.Get()-startupErrors)
+	require.Equal(t, 1, ignored.connects)
+	require.Equal(t, 0, ignored.written())
+
+	// outputs that never connected are not closed
+	require.True(t, retried.closed())
+	require.True(t, healthy.closed())
+	require.False(t, unreachable.closed())
+	require.False(t, ignored.closed())
+}
+
+func TestRoutedOutputs(t *testing.T) {
+	defer shortStartupRetry()()
+
+	c := config.NewConfig()
+	c.Agent.FlushInterval = internal.Duration{Duration: 10 * time.Millisecond}
+	a := &Agent{Config: c}
+
+	var mu sync.Mutex
+	instances := make(map[string]*flakyOutput)
+	instance := func(value string) *flakyOutput {
+		mu.Lock()
+		defer mu.Unlock()
+		return instances[value]
+	}
+	router := models.NewOutputRouter(&models.OutputConfig{
+		Name:             "routed",
+		RouteTag:         "tenant",
+		RouteIdleTimeout: 50 * time.Millisecond,
+	}, func(value string) (*models.RunningOutput, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		// the first instance fails to connect once and buffers meanwhile
+		output := &flakyOutput{}
+		if len(instances) == 0 {
+			output.failures = 1
+		}
+		instances[value] = output
+		return models.NewRunningOutput("routed", output, &models.OutputConfig{
+			Name:       "routed",
+			RouteTag:   "tenant",
+			RouteValue: value,
+		}, 0, 0), nil
+	})
+	healthy := &flakyOutput{}
+	outputs := []*models.RunningOutput{
+		models.NewRunningOutput("healthy", healthy, &models.OutputConfig{
+			Name: "routed_healthy",
+		}, 0, 0),
+	}
+
+	unrouted := router.MetricsUnrouted.Get()
+
+	src, unit, err := a.startOutputs(context.Background(), outputs, []*models.OutputRouter{router})
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, a.runOutputs(unit))
+	}()
+
+	src <- testutil.MustMetric("cpu", map[string]string{"tenant": "a"}, map[string]interface{}{"value": 1}, time.Unix(0, 0))
+	src <- testutil.MustMetric("cpu", map[string]string{"tenant": "b"}, map[string]interface{}{"value": 2}, time.Unix(0, 0))
+	src <- testutil.MustMetric("cpu", map[string]string{"tenant": "b"}, map[string]interface{}{"value": 3}, time.Unix(0, 0))
+	src <- testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"value": 4}, time.Unix(0, 0))
+	require.Eventually(t, func() bool {
+		return instance("a") != nil && instance("a").written() == 1 &&
+			instance("b") != nil && instance("b").written() == 2 &&
+			healthy.written() == 4
+	}, 5*time.Second, time.Millisecond)
+
+	// idle instances are closed
+	require.Eventually(t, func() bool {
+		return instance("a").closed() && instance("b").closed()
+	}, 5*time.Second, time.Millisecond)
+	require.False(t, healthy.closed())
+
+	close(src)
+	<-done
+	require.Equal(t, int64(1), router.MetricsUnrouted.Get()-unrouted)
+}
+
+func TestStartupErrorBehaviorInputs(t *testing.T) {
+	defer shortStartupRetry()()
+
+	c := config.NewConfig()
+	c.Agent.Interval = internal.Duration{Duration: 10 * time.Millisecond}
+	c.Agent.RoundInterval = false
+	a := &Agent{Config: c}
+
+	retried := &flakyServiceInput{failures: 2}
+	ignored := &flakyServiceInput{failures: 1}
+	inputs := []*models.RunningInput{
+		models.NewRunningInput(retried, &models.InputConfig{
+			Name:                 "startup_retried",
+			StartupErrorBehavior: "retry",
+		}),
+		models.NewRunningInput(ignored, &models.InputConfig{
+			Name:                 "startup_ignored",
+			StartupErrorBehavior: "ignore",
+		}),
+	}
+
+	dst := make(chan telegraf.Metric, 10)
+	unit, err := a.startInputs(dst, inputs)
+	require.NoError(t, err)
+	require.Len(t, unit.inputs, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, a.runInputs(ctx, time.Now(), unit))
+	}()
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(&retried.gathers) > 0
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	<-done
+
+	require.Equal(t, int32(3), atomic.LoadInt32(&retried.starts))
+	require.Equal(t, int32(1), atomic.LoadInt32(&retried.stops))
+	require.Equal(t, int32(1), atomic.LoadInt32(&ignored.starts))
+	require.Equal(t, int32(0), atomic.LoadInt32(&ignored.stops))
+	require.Equal(t, int64(0), atomic.LoadInt64(&ignored.gathers))
+}
+
+func TestStartupErrorBehaviorInputError(t *testing.T) {
+	a := &Agent{Config: config.NewConfig()}
+
+	started := &flakyServiceInput{}
+	failed := &flakyServiceInput{failures: 1}
+	inputs := []*models.RunningInput{
+		models.NewRunningInput(started, &models.InputConfig{Name: "startup_started"}),
+		models.NewRunningInput(failed, &models.InputConfig{Name: "startup_failed"}),
+	}
+
+	_, err := a.startInputs(make(chan telegraf.Metric, 10), inputs)
+	require.Error(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&started.stops))
+}
@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/influxdata/telegraf/plugins/serializers/prometheus"
+	"github.com/influxdata/telegraf/selfstat"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// selfMetricsPath is the path of the self-metrics endpoint.
+const selfMetricsPath = "/metrics"
+
+// startSelfMetrics starts the listener exposing the selfstat values in the
+// Prometheus format.  The values are read directly from selfstat, so the
+// endpoint keeps working when the metric pipeline or the outputs are stuck.
+func startSelfMetrics(address string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("listening for self-metrics on %s failed: %w", address, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(selfMetricsPath, serveSelfMetrics)
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("E! [agent] Serving self-metrics failed: %v", err)
+		}
+	}()
+
+	log.Printf("I! [agent] Serving self-metrics on http://%s%s", listener.Addr(), selfMetricsPath)
+	return srv, nil
+}
+
+func serveSelfMetrics(w http.ResponseWriter, r *http.Request) {
+	format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+	w.Header().Set("Content-Type", string(format))
+
+	enc := expfmt.NewEncoder(w, format)
+	for _, mf := range selfMetricFamilies(selfstat.Snapshot()) {
+		if err := enc.Encode(mf); err != nil {
+			log.Printf("E! [agent] Encoding self-metrics failed: %v", err)
+			return
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("E! [agent] Encoding self-metrics failed: %v", err)
+		}
+	}
+}
+
+// selfMetricFamilies converts the selfstat samples into metric families named
+// "<measurement>_<field>".  Stats are untyped, histograms keep their buckets.
+func selfMetricFamilies(samples []selfstat.Sample) []*dto.MetricFamily {
+	families := make(map[string]*dto.MetricFamily)
+	for _, s := range samples {
+		name, ok := prometheus.SanitizeMetricName(s.Measurement + "_" + s.Field)
+		if !ok {
+			continue
+		}
+
+		typ := dto.MetricType_UNTYPED
+		m := &dto.Metric{Label: selfMetricLabels(s.Tags)}
+		if s.Histogram != nil {
+			typ = dto.MetricType_HISTOGRAM
+			h := &dto.Histogram{
+				SampleCount: proto.Uint64(s.Histogram.Count),
+				SampleSum:   proto.Float64(s.Histogram.Sum),
+			}
+			for i, upper := range s.Histogram.Buckets {
+				h.Bucket = append(h.Bucket, &dto.Bucket{
+					UpperBound:      proto.Float64(upper),
+					CumulativeCount: proto.Uint64(s.Histogram.Counts[i]),
+				})
+			}
+			m.Histogram = h
+		} else {
+			m.Untyped = &dto.Untyped{Value: proto.Float64(float64(s.Value))}
+		}
+
+		mf, ok := families[name]
+		if !ok {
+			mf = &dto.MetricFamily{Name: proto.String(name), Type: typ.Enum()}
+			families[name] = mf
+		}
+		if mf.GetType() != typ {
+			continue
+		}
+		mf.Metric = append(mf.Metric, m)
+	}
+
+	result := make([]*dto.MetricFamily, 0, len(families))
+	for _, mf := range families {
+		sort.Slice(mf.Metric, func(i, j int) bool {
+			return labelsKey(mf.Metric[i].Label) < labelsKey(mf.Metric[j].Label)
+		})
+		result = append(result, mf)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetName() < result[j].GetName()
+	})
+	return result
+}
+
+func selfMetricLabels(tags map[string]string) []*dto.LabelPair {
+	labels := make([]*dto.LabelPair, 0, len(tags))
+	for k, v := range tags {
+		name, ok := prometheus.SanitizeLabelName(k)
+		if !ok {
+			continue
+		}
+		labels = append(labels, &dto.LabelPair{Name: proto.String(name), Value: proto.String(v)})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].GetName() < labels[j].GetName()
+	})
+	return labels
+}
+
+func labelsKey(labels []*dto.LabelPair) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.GetName())
+		b.WriteByte('=')
+		b.WriteString(l.GetValue())
+		b.WriteByte(',')
+	}
+	return b.String()
+}
@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/telegraf/selfstat"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeSelfMetrics(t *testing.T) {
+	tags := map[string]string{"input": "self_metrics_test"}
+	selfstat.Register("gather", "metrics_gathered", tags).Set(42)
+	selfstat.RegisterHistogram("gather", "gather_duration_seconds", tags, 0.1, 1).Observe(0.5)
+
+	req := httptest.NewRequest("GET", selfMetricsPath, nil)
+	rec := httptest.NewRecorder()
+	serveSelfMetrics(rec, req)
+
+	require.Equal(t, string(expfmt.FmtText), rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	require.Contains(t, body, "# TYPE internal_gather_gather_duration_seconds histogram\n")
+	require.Contains(t, body, `internal_gather_gather_duration_seconds_bucket{input="self_metrics_test",le="0.1"} 0`+"\n")
+	require.Contains(t, body, `internal_gather_gather_duration_seconds_bucket{input="self_metrics_test",le="1"} 1`+"\n")
+	require.Contains(t, body, `internal_gather_gather_duration_seconds_count{input="self_metrics_test"} 1`+"\n")
+	require.Contains(t, body, `internal_gather_metrics_gathered{input="self_metrics_test"} 42`+"\n")
+
+	req = httptest.NewRequest("GET", selfMetricsPath, nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+	rec = httptest.NewRecorder()
+	serveSelfMetrics(rec, req)
+
+	require.Equal(t, string(expfmt.FmtOpenMetrics), rec.Header().Get("Content-Type"))
+	require.True(t, strings.HasSuffix(rec.Body.String(), "# EOF\n"))
+}
+
+func TestStartSelfMetricsInvalidAddress(t *testing.T) {
+	_, err := startSelfMetrics("localhost:-1")
+	require.Error(t, err)
+}
@@ -2,11 +2,14 @@ package agent
 
 import (
 	"context"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/benbjohnson/clock"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/selfstat"
+	"github.com/robfig/cron/v3"
 )
 
 type empty struct{}
@@ -273,3 +276,96 @@ func (t *RollingTicker) Stop() {
 	t.cancel()
 	t.wg.Wait()
 }
+
+// CronTicker delivers ticks at the times of a cron schedule plus an optional
+// jitter.  The next time is calculated from the schedule after each tick, so
+// changes to the system clock are handled at the next tick.
+//
+// The first tick is emitted at the next scheduled time.
+//
+// Ticks are dropped for slow consumers.
+//
+// The time of the next tick, without jitter, is set as the Unix time in
+// seconds on the optional nextRun stat.
+type CronTicker struct {
+	schedule cron.Schedule
+	jitter   time.Duration
+	nextRun  selfstat.Stat
+	ch       chan time.Time
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	// scheduled is the time of the next tick without jitter.
+	scheduled time.Time
+}
+
+func NewCronTicker(schedule cron.Schedule, jitter time.Duration, nextRun selfstat.Stat) *CronTicker {
+	return newCronTicker(schedule, jitter, nextRun, clock.New())
+}
+
+func newCronTicker(schedule cron.Schedule, jitter time.Duration, nextRun selfstat.Stat, clock clock.Clock) *CronTicker {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &CronTicker{
+		schedule: schedule,
+		jitter:   jitter,
+		nextRun:  nextRun,
+		ch:       make(chan time.Time, 1),
+		cancel:   cancel,
+	}
+
+	d := t.next(clock.Now())
+	timer := clock.Timer(d)
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.run(ctx, timer, clock)
+	}()
+
+	return t
+}
+
+func (t *CronTicker) next(now time.Time) time.Duration {
+	// Start after the previous scheduled time, in case the timer fired before
+	// it, to avoid scheduling the same time twice.
+	from := now
+	if t.scheduled.After(from) {
+		from = t.scheduled
+	}
+	t.scheduled = t.schedule.Next(from)
+	if t.scheduled.IsZero() {
+		// The schedule has no further times.
+		return time.Duration(math.MaxInt64)
+	}
+	if t.nextRun != nil {
+		t.nextRun.Set(t.scheduled.Unix())
+	}
+	return t.scheduled.Sub(now) + internal.RandomDuration(t.jitter)
+}
+
+func (t *CronTicker) run(ctx context.Context, timer *clock.Timer, clock clock.Clock) {
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case now := <-timer.C:
+			select {
+			case t.ch <- now:
+			default:
+			}
+
+			d := t.next(clock.Now())
+			timer.Reset(d)
+		}
+	}
+}
+
+func (t *CronTicker) Elapsed() <-chan time.Time {
+	return t.ch
+}
+
+func (t *CronTicker) Stop() {
+	t.cancel()
+	t.wg.Wait()
+}
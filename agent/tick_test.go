@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"github.com/influxdata/telegraf/selfstat"
+	"github.com/robfig/cron/v3"
 	"github.com/stretchr/testify/require"
 )
 
@@ -258,3 +260,68 @@ func simulatedDist(ticker Ticker, clock *clock.Mock) Distribution {
 
 	return dist
 }
+
+func TestCronTicker(t *testing.T) {
+	schedule, err := cron.ParseStandard("*/15 9-10 * * *")
+	require.NoError(t, err)
+
+	clock := clock.NewMock()
+	clock.Set(time.Date(2021, 1, 1, 8, 0, 0, 0, time.UTC))
+	nextRun := selfstat.Register("test", "next_run", map[string]string{"ticker": "cron"})
+
+	ticker := newCronTicker(schedule, 0, nextRun, clock)
+	defer ticker.Stop()
+	require.Equal(t, time.Date(2021, 1, 1, 9, 0, 0, 0, time.UTC).Unix(), nextRun.Get())
+
+	expected := []time.Time{
+		time.Date(2021, 1, 1, 9, 0, 0, 0, time.UTC),
+		time.Date(2021, 1, 1, 9, 15, 0, 0, time.UTC),
+		time.Date(2021, 1, 1, 9, 30, 0, 0, time.UTC),
+		time.Date(2021, 1, 1, 9, 45, 0, 0, time.UTC),
+		time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC),
+		time.Date(2021, 1, 1, 10, 15, 0, 0, time.UTC),
+		time.Date(2021, 1, 1, 10, 30, 0, 0, time.UTC),
+		time.Date(2021, 1, 1, 10, 45, 0, 0, time.UTC),
+		time.Date(2021, 1, 2, 9, 0, 0, 0, time.UTC),
+	}
+
+	actual := []time.Time{}
+	until := time.Date(2021, 1, 2, 9, 0, 0, 0, time.UTC)
+	for !clock.Now().After(until) {
+		clock.Add(5 * time.Minute)
+		select {
+		case tm := <-ticker.Elapsed():
+			actual = append(actual, tm.UTC())
+		default:
+		}
+	}
+
+	require.Equal(t, expected, actual)
+	require.Equal(t, time.Date(2021, 1, 2, 9, 15, 0, 0, time.UTC).Unix(), nextRun.Get())
+}
+
+func TestCronTickerJitter(t *testing.T) {
+	schedule, err := cron.ParseStandard("@hourly")
+	require.NoError(t, err)
+
+	clock := clock.NewMock()
+	clock.Set(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	ticker := newCronTicker(schedule, 10*time.Minute, nil, clock)
+	defer ticker.Stop()
+
+	scheduled := time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		var tm time.Time
+		for tm.IsZero() {
+			clock.Add(time.Minute)
+			select {
+			case tm = <-ticker.Elapsed():
+			default:
+			}
+		}
+		require.False(t, tm.Before(scheduled), tm.String())
+		require.False(t, tm.After(scheduled.Add(10*time.Minute)), tm.String())
+		scheduled = scheduled.Add(time.Hour)
+	}
+}
@@ -135,7 +135,7 @@ func runAgent(ctx context.Context,
 			return err
 		}
 	}
-	if !*fTest && len(c.Outputs) == 0 {
+	if !*fTest && len(c.Outputs) == 0 && len(c.OutputRouters) == 0 {
 		return errors.New("Error: no outputs found, did you provide a valid config file?")
 	}
 	if *fPlugins == "" && len(c.Inputs) == 0 {
@@ -162,6 +162,7 @@ func runAgent(ctx context.Context,
 		Debug:               ag.Config.Agent.Debug || *fDebug,
 		Quiet:               ag.Config.Agent.Quiet || *fQuiet,
 		LogTarget:           ag.Config.Agent.LogTarget,
+		LogFormat:           ag.Config.Agent.LogFormat,
 		Logfile:             ag.Config.Agent.Logfile,
 		RotationInterval:    ag.Config.Agent.LogfileRotationInterval,
 		RotationMaxSize:     ag.Config.Agent.LogfileRotationMaxSize,
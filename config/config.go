@@ -25,10 +25,12 @@ import (
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
+	"github.com/influxdata/telegraf/plugins/parsers/json_v2"
 	"github.com/influxdata/telegraf/plugins/processors"
 	"github.com/influxdata/telegraf/plugins/serializers"
 	"github.com/influxdata/toml"
 	"github.com/influxdata/toml/ast"
+	"github.com/robfig/cron/v3"
 )
 
 var (
@@ -64,6 +66,8 @@ type Config struct {
 	Inputs      []*models.RunningInput
 	Outputs     []*models.RunningOutput
 	Aggregators []*models.RunningAggregator
+	// OutputRouters are the outputs instantiated per value of a routing tag
+	OutputRouters []*models.OutputRouter
 	// Processors have a slice wrapper type because they need to be sorted
 	Processors    models.RunningProcessors
 	AggProcessors models.RunningProcessors
@@ -170,6 +174,18 @@ type AgentConfig struct {
 	// If set to -1, no archives are removed.
 	LogfileRotationMaxArchives int `toml:"logfile_rotation_max_archives"`
 
+	// Log format is "text" for plain-text lines or "json" for one JSON
+	// record per line.
+	LogFormat string `toml:"log_format"`
+
+	// Address of the listener exposing the internal metrics of the agent in
+	// the Prometheus format, disabled if empty.
+	SelfMetricsListen string `toml:"self_metrics_listen"`
+
+	// MaxMemory is the budget of the approximate memory of the metrics in the
+	// output buffers, inputs are paused while it is exceeded.
+	MaxMemory internal.Size `toml:"max_memory"`
+
 	Hostname     string
 	OmitHostname bool
 }
@@ -207,6 +223,9 @@ func (c *Config) OutputNames() []string {
 	for _, output := range c.Outputs {
 		name = append(name, output.Config.Name)
 	}
+	for _, router := range c.OutputRouters {
+		name = append(name, router.Config.Name)
+	}
 	return name
 }
 
@@ -268,6 +287,12 @@ var agentConfig = `
   ## cost of higher maximum memory usage.
   metric_buffer_limit = 10000
 
+  ## Maximum approximate memory of the metrics in the output buffers, such as
+  ## "512MiB".  When exceeded, inputs using delivery tracking, like
+  ## kafka_consumer, pause consumption and other inputs skip their gathers
+  ## until the buffers are back below 90% of the limit.  Disabled by default.
+  # max_memory = "0B"
+
   ## Collection jitter is used to jitter the collection by a random amount.
   ## Each plugin will sleep for a random time within jitter before collecting.
   ## This can be used to avoid many plugins querying things like sysfs at the
@@ -318,6 +343,17 @@ var agentConfig = `
   ## If set to -1, no archives are removed.
   # logfile_rotation_max_archives = 5
 
+  ## Log format is "text" for plain-text lines or "json" for one JSON record
+  ## per line with the time, level, message and the plugin type, name and
+  ## alias of plugin messages.
+  # log_format = "text"
+
+  ## Address of a listener exposing the internal metrics of the agent, as
+  ## collected by inputs.internal, in the Prometheus format on "/metrics".
+  ## The endpoint is served outside of the metric pipeline, so it keeps
+  ## working when outputs are stuck.
+  # self_metrics_listen = "localhost:9274"
+
   ## Override default hostname, if empty use os.Hostname()
   hostname = ""
   ## If set to true, do no set the "host" tag in the telegraf agent.
@@ -724,6 +760,16 @@ func (c *Config) LoadConfigData(data []byte) error {
 		}
 	}
 
+	switch c.Agent.LogFormat {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("unknown log_format %q", c.Agent.LogFormat)
+	}
+
+	if c.Agent.MaxMemory.Size < 0 {
+		return fmt.Errorf("max_memory must not be negative")
+	}
+
 	if !c.Agent.OmitHostname {
 		if c.Agent.Hostname == "" {
 			hostname, err := os.Hostname()
@@ -927,7 +973,16 @@ func (c *Config) addAggregator(name string, table *ast.Table) error {
 		return err
 	}
 
-	c.Aggregators = append(c.Aggregators, models.NewRunningAggregator(aggregator, conf))
+	ra := models.NewRunningAggregator(aggregator, conf)
+	if conf.Windowed() {
+		// each window aggregates with its own instance
+		ra.NewAggregator = func() (telegraf.Aggregator, error) {
+			aggregator := creator()
+			err := toml.UnmarshalTable(table, aggregator)
+			return aggregator, err
+		}
+	}
+	c.Aggregators = append(c.Aggregators, ra)
 	return nil
 }
 
@@ -984,9 +1039,61 @@ func (c *Config) addOutput(name string, table *ast.Table) error {
 	if len(c.OutputFilters) > 0 && !sliceContains(name, c.OutputFilters) {
 		return nil
 	}
+
+	if _, ok := table.Fields["route_tag"]; ok {
+		return c.addOutputRouter(name, table)
+	}
+
+	output, outputConfig, err := buildOutputPlugin(name, table)
+	if err != nil {
+		return err
+	}
+
+	ro := models.NewRunningOutput(name, output, outputConfig,
+		c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+	c.Outputs = append(c.Outputs, ro)
+	return nil
+}
+
+// addOutputRouter adds an output instantiated per value of its routing tag.
+// The settings of the output are kept as a template and rendered for every
+// instance.
+func (c *Config) addOutputRouter(name string, table *ast.Table) error {
+	// Render the templates once to report the errors when loading, the
+	// output config does not depend on the routing tag value.
+	tbl, err := renderRouteTable(table, routeData{check: true})
+	if err != nil {
+		return fmt.Errorf("output %s: %v", name, err)
+	}
+	_, outputConfig, err := buildOutputPlugin(name, tbl)
+	if err != nil {
+		return err
+	}
+
+	batchSize := c.Agent.MetricBatchSize
+	bufferLimit := c.Agent.MetricBufferLimit
+	newOutput := func(value string) (*models.RunningOutput, error) {
+		tbl, err := renderRouteTable(table, routeData{Tag: outputConfig.RouteTag, Value: value})
+		if err != nil {
+			return nil, err
+		}
+		output, config, err := buildOutputPlugin(name, tbl)
+		if err != nil {
+			return nil, err
+		}
+		config.RouteValue = value
+		return models.NewRunningOutput(name, output, config, batchSize, bufferLimit), nil
+	}
+
+	c.OutputRouters = append(c.OutputRouters, models.NewOutputRouter(outputConfig, newOutput))
+	return nil
+}
+
+// buildOutputPlugin creates the output and its config from the plugin table.
+func buildOutputPlugin(name string, table *ast.Table) (telegraf.Output, *models.OutputConfig, error) {
 	creator, ok := outputs.Outputs[name]
 	if !ok {
-		return fmt.Errorf("Undefined but requested output: %s", name)
+		return nil, nil, fmt.Errorf("Undefined but requested output: %s", name)
 	}
 	output := creator()
 
@@ -996,24 +1103,20 @@ func (c *Config) addOutput(name string, table *ast.Table) error {
 	case serializers.SerializerOutput:
 		serializer, err := buildSerializer(name, table)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		t.SetSerializer(serializer)
 	}
 
 	outputConfig, err := buildOutput(name, table)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	if err := toml.UnmarshalTable(table, output); err != nil {
-		return err
+		return nil, nil, err
 	}
-
-	ro := models.NewRunningOutput(name, output, outputConfig,
-		c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
-	c.Outputs = append(c.Outputs, ro)
-	return nil
+	return output, outputConfig, nil
 }
 
 func (c *Config) addInput(name string, table *ast.Table) error {
@@ -1083,6 +1186,10 @@ func buildAggregator(name string, tbl *ast.Table) (*models.AggregatorConfig, err
 		return nil, err
 	}
 
+	if err := getLogLevel(tbl, &conf.LogLevel); err != nil {
+		return nil, fmt.Errorf("aggregator %s: %v", name, err)
+	}
+
 	if err := getConfigDuration(tbl, "delay", &conf.Delay); err != nil {
 		return nil, err
 	}
@@ -1091,6 +1198,37 @@ func buildAggregator(name string, tbl *ast.Table) (*models.AggregatorConfig, err
 		return nil, err
 	}
 
+	if err := getConfigDuration(tbl, "window", &conf.Window); err != nil {
+		return nil, err
+	}
+
+	if err := getConfigDuration(tbl, "watermark", &conf.Watermark); err != nil {
+		return nil, err
+	}
+
+	conf.TimeMode = models.TimeModeProcessing
+	if node, ok := tbl.Fields["time_mode"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				conf.TimeMode = str.Value
+			}
+		}
+	}
+	delete(tbl.Fields, "time_mode")
+
+	switch {
+	case conf.TimeMode != models.TimeModeProcessing && conf.TimeMode != models.TimeModeEvent:
+		return nil, fmt.Errorf("aggregator %s: unknown time_mode %q", name, conf.TimeMode)
+	case conf.Window != 0 && conf.Window < conf.Period:
+		return nil, fmt.Errorf("aggregator %s: window must not be shorter than period", name)
+	case conf.Watermark < 0:
+		return nil, fmt.Errorf("aggregator %s: watermark must not be negative", name)
+	case conf.Watermark != 0 && conf.TimeMode != models.TimeModeEvent:
+		return nil, fmt.Errorf("aggregator %s: watermark requires time_mode = \"event\"", name)
+	case conf.Grace != 0 && conf.Windowed():
+		return nil, fmt.Errorf("aggregator %s: grace is not supported with windows longer than period or event time", name)
+	}
+
 	if node, ok := tbl.Fields["drop_original"]; ok {
 		if kv, ok := node.(*ast.KeyValue); ok {
 			if b, ok := kv.Value.(*ast.Boolean); ok {
@@ -1184,6 +1322,10 @@ func buildProcessor(name string, tbl *ast.Table) (*models.ProcessorConfig, error
 		}
 	}
 
+	if err := getLogLevel(tbl, &conf.LogLevel); err != nil {
+		return nil, fmt.Errorf("processor %s: %v", name, err)
+	}
+
 	delete(tbl.Fields, "alias")
 	delete(tbl.Fields, "order")
 	var err error
@@ -1349,6 +1491,73 @@ func buildInput(name string, tbl *ast.Table) (*models.InputConfig, error) {
 		return nil, err
 	}
 
+	if err := getConfigDuration(tbl, "gather_timeout", &cp.GatherTimeout); err != nil {
+		return nil, err
+	}
+
+	if node, ok := tbl.Fields["overlap_policy"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				cp.OverlapPolicy = str.Value
+			}
+		}
+	}
+	switch cp.OverlapPolicy {
+	case "", "skip", "queue", "concurrent":
+	default:
+		return nil, fmt.Errorf("input %s: unknown overlap_policy %q", name, cp.OverlapPolicy)
+	}
+
+	// The internal input reports the memory budget, so it is gathered while
+	// the budget is exceeded unless configured otherwise.
+	cp.IgnoreMaxMemory = name == "internal"
+	if node, ok := tbl.Fields["ignore_max_memory"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if b, ok := kv.Value.(*ast.Boolean); ok {
+				var err error
+				cp.IgnoreMaxMemory, err = strconv.ParseBool(b.Value)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing boolean value for %s: %s", name, err)
+				}
+			}
+		}
+	}
+
+	if err := getStartupErrorBehavior(tbl, &cp.StartupErrorBehavior); err != nil {
+		return nil, fmt.Errorf("input %s: %v", name, err)
+	}
+
+	if err := getLogLevel(tbl, &cp.LogLevel); err != nil {
+		return nil, fmt.Errorf("input %s: %v", name, err)
+	}
+
+	var schedule, timezone string
+	if node, ok := tbl.Fields["schedule"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				schedule = str.Value
+			}
+		}
+	}
+
+	if node, ok := tbl.Fields["schedule_timezone"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				timezone = str.Value
+			}
+		}
+	}
+
+	if schedule != "" {
+		var err error
+		cp.Schedule, err = parseSchedule(schedule, timezone)
+		if err != nil {
+			return nil, fmt.Errorf("input %s: %v", name, err)
+		}
+	} else if timezone != "" {
+		return nil, fmt.Errorf("input %s: schedule_timezone requires schedule", name)
+	}
+
 	if node, ok := tbl.Fields["name_prefix"]; ok {
 		if kv, ok := node.(*ast.KeyValue); ok {
 			if str, ok := kv.Value.(*ast.String); ok {
@@ -1390,6 +1599,10 @@ func buildInput(name string, tbl *ast.Table) (*models.InputConfig, error) {
 		}
 	}
 
+	delete(tbl.Fields, "overlap_policy")
+	delete(tbl.Fields, "ignore_max_memory")
+	delete(tbl.Fields, "schedule")
+	delete(tbl.Fields, "schedule_timezone")
 	delete(tbl.Fields, "name_prefix")
 	delete(tbl.Fields, "name_suffix")
 	delete(tbl.Fields, "name_override")
@@ -1403,6 +1616,28 @@ func buildInput(name string, tbl *ast.Table) (*models.InputConfig, error) {
 	return cp, nil
 }
 
+// parseSchedule parses a cron expression with five fields or a descriptor
+// such as "@daily".  The schedule uses the timezone if set, otherwise the
+// local time.
+func parseSchedule(spec, timezone string) (cron.Schedule, error) {
+	expr := spec
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("invalid schedule_timezone %q: %v", timezone, err)
+		}
+		expr = "CRON_TZ=" + timezone + " " + spec
+	}
+
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %v", spec, err)
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs", spec)
+	}
+	return schedule, nil
+}
+
 // buildParser grabs the necessary entries from the ast.Table for creating
 // a parsers.Parser object, and creates it, which can then be added onto
 // an Input object.
@@ -1822,6 +2057,18 @@ func getParserConfig(name string, tbl *ast.Table) (*parsers.Config, error) {
 		}
 	}
 
+	if node, ok := tbl.Fields["json_v2"]; ok {
+		if subtbls, ok := node.([]*ast.Table); ok {
+			for _, subtbl := range subtbls {
+				var jc json_v2.Config
+				if err := toml.UnmarshalTable(subtbl, &jc); err != nil {
+					return nil, fmt.Errorf("E! parsing json_v2 configuration: %v", err)
+				}
+				c.JSONV2Config = append(c.JSONV2Config, jc)
+			}
+		}
+	}
+
 	c.MetricName = name
 
 	delete(tbl.Fields, "data_format")
@@ -1866,6 +2113,7 @@ func getParserConfig(name string, tbl *ast.Table) (*parsers.Config, error) {
 	delete(tbl.Fields, "csv_timezone")
 	delete(tbl.Fields, "csv_trim_space")
 	delete(tbl.Fields, "form_urlencoded_tag_keys")
+	delete(tbl.Fields, "json_v2")
 
 	return c, nil
 }
@@ -2123,6 +2371,14 @@ func buildOutput(name string, tbl *ast.Table) (*models.OutputConfig, error) {
 		return nil, err
 	}
 
+	if err := getStartupErrorBehavior(tbl, &oc.StartupErrorBehavior); err != nil {
+		return nil, fmt.Errorf("output %s: %v", name, err)
+	}
+
+	if err := getLogLevel(tbl, &oc.LogLevel); err != nil {
+		return nil, fmt.Errorf("output %s: %v", name, err)
+	}
+
 	if node, ok := tbl.Fields["metric_buffer_limit"]; ok {
 		if kv, ok := node.(*ast.KeyValue); ok {
 			if integer, ok := kv.Value.(*ast.Integer); ok {
@@ -2179,12 +2435,51 @@ func buildOutput(name string, tbl *ast.Table) (*models.OutputConfig, error) {
 		}
 	}
 
+	if node, ok := tbl.Fields["route_tag"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				oc.RouteTag = str.Value
+			}
+		}
+	}
+
+	if err := getConfigDuration(tbl, "route_idle_timeout", &oc.RouteIdleTimeout); err != nil {
+		return nil, err
+	}
+
+	if node, ok := tbl.Fields["max_routes"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if integer, ok := kv.Value.(*ast.Integer); ok {
+				v, err := integer.Int()
+				if err != nil {
+					return nil, err
+				}
+				oc.MaxRoutes = int(v)
+			}
+		}
+	}
+
+	switch {
+	case oc.RouteTag == "" && tbl.Fields["route_tag"] != nil:
+		return nil, fmt.Errorf("output %s: route_tag must not be empty", name)
+	case oc.RouteIdleTimeout < 0:
+		return nil, fmt.Errorf("output %s: route_idle_timeout must not be negative", name)
+	case oc.RouteIdleTimeout != 0 && oc.RouteTag == "":
+		return nil, fmt.Errorf("output %s: route_idle_timeout requires route_tag", name)
+	case oc.MaxRoutes < 0:
+		return nil, fmt.Errorf("output %s: max_routes must not be negative", name)
+	case oc.MaxRoutes != 0 && oc.RouteTag == "":
+		return nil, fmt.Errorf("output %s: max_routes requires route_tag", name)
+	}
+
 	delete(tbl.Fields, "metric_buffer_limit")
 	delete(tbl.Fields, "metric_batch_size")
 	delete(tbl.Fields, "alias")
 	delete(tbl.Fields, "name_override")
 	delete(tbl.Fields, "name_suffix")
 	delete(tbl.Fields, "name_prefix")
+	delete(tbl.Fields, "route_tag")
+	delete(tbl.Fields, "max_routes")
 
 	return oc, nil
 }
@@ -2196,6 +2491,40 @@ type unwrappable interface {
 	Unwrap() telegraf.Processor
 }
 
+func getLogLevel(tbl *ast.Table, target *string) error {
+	if node, ok := tbl.Fields["log_level"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				switch str.Value {
+				case "error", "warn", "info", "debug":
+				default:
+					return fmt.Errorf("unknown log_level %q", str.Value)
+				}
+				delete(tbl.Fields, "log_level")
+				*target = str.Value
+			}
+		}
+	}
+	return nil
+}
+
+func getStartupErrorBehavior(tbl *ast.Table, target *string) error {
+	if node, ok := tbl.Fields["startup_error_behavior"]; ok {
+		if kv, ok := node.(*ast.KeyValue); ok {
+			if str, ok := kv.Value.(*ast.String); ok {
+				switch str.Value {
+				case "error", "retry", "ignore":
+				default:
+					return fmt.Errorf("unknown startup_error_behavior %q", str.Value)
+				}
+				delete(tbl.Fields, "startup_error_behavior")
+				*target = str.Value
+			}
+		}
+	}
+	return nil
+}
+
 func getConfigDuration(tbl *ast.Table, key string, target *time.Duration) error {
 	if node, ok := tbl.Fields[key]; ok {
 		if kv, ok := node.(*ast.KeyValue); ok {
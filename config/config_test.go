@@ -1,12 +1,14 @@
 package config
 
 import (
+	"io/ioutil"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/models"
+	_ "github.com/influxdata/telegraf/plugins/aggregators/minmax"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/inputs/exec"
 	"github.com/influxdata/telegraf/plugins/inputs/http_listener_v2"
@@ -14,6 +16,9 @@ import (
 	"github.com/influxdata/telegraf/plugins/inputs/procstat"
 	httpOut "github.com/influxdata/telegraf/plugins/outputs/http"
 	"github.com/influxdata/telegraf/plugins/parsers"
+	"github.com/influxdata/telegraf/plugins/parsers/json_v2"
+	_ "github.com/influxdata/telegraf/plugins/processors/rename"
+	"github.com/influxdata/toml/ast"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -257,3 +262,289 @@ func TestConfig_BadOrdering(t *testing.T) {
 	require.Error(t, err, "bad ordering")
 	assert.Equal(t, "Error loading config file ./testdata/non_slice_slice.toml: Error parsing http array, line 4: cannot unmarshal TOML array into string (need slice)", err.Error())
 }
+
+func TestConfig_JSONV2Parser(t *testing.T) {
+	contents, err := ioutil.ReadFile("./testdata/json_v2.toml")
+	require.NoError(t, err)
+	tbl, err := parseConfig(contents)
+	require.NoError(t, err)
+
+	inputs := tbl.Fields["inputs"].(*ast.Table)
+	file := inputs.Fields["file"].([]*ast.Table)[0]
+
+	pc, err := getParserConfig("file", file)
+	require.NoError(t, err)
+	require.Equal(t, "json_v2", pc.DataFormat)
+	require.Len(t, pc.JSONV2Config, 1)
+
+	jc := pc.JSONV2Config[0]
+	require.Equal(t, "sensor", jc.MeasurementName)
+	require.Equal(t, "timestamp", jc.TimestampPath)
+	require.Equal(t, "unix", jc.TimestampFormat)
+	require.Equal(t, []json_v2.DataSet{{Path: "site"}}, jc.Tags)
+	require.Len(t, jc.Objects, 1)
+	require.Equal(t, "devices", jc.Objects[0].Path)
+	require.Equal(t, []string{"name"}, jc.Objects[0].Tags)
+	require.Equal(t, map[string]string{"humidity": "int"}, jc.Objects[0].Fields)
+
+	_, ok := file.Fields["json_v2"]
+	require.False(t, ok)
+
+	_, err = parsers.NewParser(pc)
+	require.NoError(t, err)
+}
+
+func TestConfig_InputSchedule(t *testing.T) {
+	c := NewConfig()
+	err := c.LoadConfigData([]byte(`
+[[inputs.memcached]]
+  schedule = "0 2 * * *"
+  schedule_timezone = "America/New_York"
+`))
+	require.NoError(t, err)
+	require.Len(t, c.Inputs, 1)
+
+	schedule := c.Inputs[0].Config.Schedule
+	require.NotNil(t, schedule)
+	require.NotNil(t, c.Inputs[0].NextRun)
+
+	// 02:00 in New York is 07:00 UTC during standard time.
+	next := schedule.Next(time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC))
+	require.True(t, next.Equal(time.Date(2021, 1, 2, 7, 0, 0, 0, time.UTC)), next.String())
+}
+
+func TestConfig_InputScheduleErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{
+			name:   "invalid expression",
+			config: `schedule = "0 25 * * *"`,
+		},
+		{
+			name: "invalid timezone",
+			config: `schedule = "0 2 * * *"
+  schedule_timezone = "Mars/Olympus_Mons"`,
+		},
+		{
+			name:   "timezone without schedule",
+			config: `schedule_timezone = "UTC"`,
+		},
+		{
+			name:   "never runs",
+			config: `schedule = "0 0 30 2 *"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConfig()
+			err := c.LoadConfigData([]byte("[[inputs.memcached]]\n  " + tt.config + "\n"))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestConfig_InputGatherOptions(t *testing.T) {
+	c := NewConfig()
+	err := c.LoadConfigData([]byte(`
+[[inputs.memcached]]
+  gather_timeout = "30s"
+  overlap_policy = "queue"
+`))
+	require.NoError(t, err)
+	require.Len(t, c.Inputs, 1)
+	require.Equal(t, 30*time.Second, c.Inputs[0].Config.GatherTimeout)
+	require.Equal(t, "queue", c.Inputs[0].Config.OverlapPolicy)
+
+	c = NewConfig()
+	err = c.LoadConfigData([]byte(`
+[[inputs.memcached]]
+  overlap_policy = "parallel"
+`))
+	require.Error(t, err)
+}
+
+func TestConfig_StartupErrorBehavior(t *testing.T) {
+	c := NewConfig()
+	err := c.LoadConfigData([]byte(`
+[[inputs.http_listener_v2]]
+  startup_error_behavior = "retry"
+
+[[outputs.http]]
+  url = "http://localhost:8080"
+  startup_error_behavior = "ignore"
+`))
+	require.NoError(t, err)
+	require.Equal(t, "retry", c.Inputs[0].Config.StartupErrorBehavior)
+	require.Equal(t, "ignore", c.Outputs[0].Config.StartupErrorBehavior)
+
+	c = NewConfig()
+	err = c.LoadConfigData([]byte(`
+[[outputs.http]]
+  url = "http://localhost:8080"
+  startup_error_behavior = "disable"
+`))
+	require.Error(t, err)
+}
+
+func TestConfig_LogOptions(t *testing.T) {
+	c := NewConfig()
+	err := c.LoadConfigData([]byte(`
+[agent]
+  log_format = "json"
+
+[[inputs.http_listener_v2]]
+  log_level = "debug"
+
+[[processors.rename]]
+  log_level = "warn"
+
+[[aggregators.minmax]]
+  log_level = "info"
+
+[[outputs.http]]
+  url = "http://localhost:8080"
+  log_level = "error"
+`))
+	require.NoError(t, err)
+	require.Equal(t, "json", c.Agent.LogFormat)
+	require.Equal(t, "debug", c.Inputs[0].Config.LogLevel)
+	require.Equal(t, "warn", c.Processors[0].Config.LogLevel)
+	require.Equal(t, "info", c.Aggregators[0].Config.LogLevel)
+	require.Equal(t, "error", c.Outputs[0].Config.LogLevel)
+
+	c = NewConfig()
+	err = c.LoadConfigData([]byte(`
+[[inputs.http_listener_v2]]
+  log_level = "trace"
+`))
+	require.Error(t, err)
+
+	c = NewConfig()
+	err = c.LoadConfigData([]byte(`
+[agent]
+  log_format = "xml"
+`))
+	require.Error(t, err)
+}
+
+func TestConfig_AggregatorWindows(t *testing.T) {
+	c := NewConfig()
+	err := c.LoadConfigData([]byte(`
+[[aggregators.minmax]]
+  period = "1m"
+  window = "5m"
+
+[[aggregators.minmax]]
+  period = "1m"
+  time_mode = "event"
+  watermark = "30s"
+
+[[aggregators.minmax]]
+  period = "1m"
+`))
+	require.NoError(t, err)
+	require.Len(t, c.Aggregators, 3)
+
+	require.Equal(t, 5*time.Minute, c.Aggregators[0].Config.Window)
+	require.Equal(t, models.TimeModeProcessing, c.Aggregators[0].Config.TimeMode)
+	require.NotNil(t, c.Aggregators[0].NewAggregator)
+
+	require.Equal(t, models.TimeModeEvent, c.Aggregators[1].Config.TimeMode)
+	require.Equal(t, 30*time.Second, c.Aggregators[1].Config.Watermark)
+	a, err := c.Aggregators[1].NewAggregator()
+	require.NoError(t, err)
+	require.NotSame(t, c.Aggregators[1].Aggregator, a)
+
+	require.Nil(t, c.Aggregators[2].NewAggregator)
+
+	for _, data := range []string{
+		"period = \"1m\"\n  window = \"30s\"",
+		"time_mode = \"stream\"",
+		"watermark = \"30s\"",
+		"time_mode = \"event\"\n  watermark = \"-1s\"",
+		"window = \"5m\"\n  grace = \"10s\"",
+	} {
+		c = NewConfig()
+		err = c.LoadConfigData([]byte("[[aggregators.minmax]]\n  " + data + "\n"))
+		require.Error(t, err, data)
+	}
+}
+
+func TestConfig_OutputRouter(t *testing.T) {
+	require.NoError(t, os.Setenv("ROUTER_TEST_TOKEN_A", "secret-a"))
+	defer os.Unsetenv("ROUTER_TEST_TOKEN_A")
+
+	c := NewConfig()
+	err := c.LoadConfigData([]byte(`
+[[outputs.http]]
+  route_tag = "tenant"
+  route_idle_timeout = "10m"
+  max_routes = 100
+  url = "http://localhost/{% .Value %}/write?tag={% .Tag %}"
+  data_format = "json"
+  [outputs.http.headers]
+    Authorization = '{% env "ROUTER_TEST_TOKEN_" (upper .Value) %}'
+`))
+	require.NoError(t, err)
+	require.Len(t, c.Outputs, 0)
+	require.Len(t, c.OutputRouters, 1)
+	require.Equal(t, []string{"http"}, c.OutputNames())
+
+	router := c.OutputRouters[0]
+	require.Equal(t, "tenant", router.Config.RouteTag)
+	require.Equal(t, 10*time.Minute, router.Config.RouteIdleTimeout)
+	require.Equal(t, 100, router.Config.MaxRoutes)
+
+	ro, err := router.NewOutput("a")
+	require.NoError(t, err)
+	require.Equal(t, "a", ro.Config.RouteValue)
+	require.Equal(t, "outputs.http::tenant=a", ro.LogName())
+	output, ok := ro.Output.(*httpOut.HTTP)
+	require.True(t, ok)
+	require.Equal(t, "http://localhost/a/write?tag=tenant", output.URL)
+	require.Equal(t, map[string]string{"Authorization": "secret-a"}, output.Headers)
+
+	// the environment variable of the token of "b" is not set
+	_, err = router.NewOutput("b")
+	require.Error(t, err)
+
+	for _, data := range []string{
+		`route_tag = ""`,
+		`route_idle_timeout = "10m"`,
+		`route_tag = "tenant"` + "\n  route_idle_timeout = \"-1m\"",
+		`max_routes = 10`,
+		`route_tag = "tenant"` + "\n  max_routes = -1",
+		`route_tag = "tenant"` + "\n  url = \"http://{% .Value \"",
+		`route_tag = "tenant"` + "\n  url = \"http://{% .Unknown %}\"",
+	} {
+		c = NewConfig()
+		err = c.LoadConfigData([]byte("[[outputs.http]]\n  " + data + "\n"))
+		require.Error(t, err, data)
+	}
+}
+
+func TestConfig_MaxMemory(t *testing.T) {
+	c := NewConfig()
+	require.NoError(t, c.LoadConfigData([]byte("[agent]\n  max_memory = \"64MiB\"\n")))
+	require.Equal(t, int64(64*1024*1024), c.Agent.MaxMemory.Size)
+
+	c = NewConfig()
+	require.Error(t, c.LoadConfigData([]byte("[agent]\n  max_memory = -1\n")))
+
+	// only the internal input is gathered over max_memory by default
+	cp, err := buildInput("internal", &ast.Table{Fields: map[string]interface{}{}})
+	require.NoError(t, err)
+	require.True(t, cp.IgnoreMaxMemory)
+
+	c = NewConfig()
+	require.NoError(t, c.LoadConfigData([]byte(`
+[[inputs.memcached]]
+[[inputs.memcached]]
+  ignore_max_memory = true
+`)))
+	require.Len(t, c.Inputs, 2)
+	require.False(t, c.Inputs[0].Config.IgnoreMaxMemory)
+	require.True(t, c.Inputs[1].Config.IgnoreMaxMemory)
+}
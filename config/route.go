@@ -0,0 +1,116 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/influxdata/toml/ast"
+)
+
+// Delimiters of the templates in the settings of routed outputs, several
+// outputs already use "{{" in their own settings.
+const (
+	routeTemplateLeft  = "{%"
+	routeTemplateRight = "%}"
+)
+
+// routeData is the data of the templates in the settings of routed outputs.
+type routeData struct {
+	Tag   string
+	Value string
+
+	// check renders the templates without failing on unset environment
+	// variables, it is used to validate the templates when loading.
+	check bool
+}
+
+func (d routeData) funcs() template.FuncMap {
+	return template.FuncMap{
+		// env returns the environment variable named by the concatenation
+		// of the arguments
+		"env": func(parts ...string) (string, error) {
+			key := strings.Join(parts, "")
+			value, ok := os.LookupEnv(key)
+			if !ok && !d.check {
+				return "", fmt.Errorf("environment variable %s is not set", key)
+			}
+			return value, nil
+		},
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+	}
+}
+
+// renderRouteTable returns a copy of the plugin table with the templates in
+// the string values rendered.  The table is copied completely, as building a
+// plugin deletes the fields it consumed.
+func renderRouteTable(tbl *ast.Table, data routeData) (*ast.Table, error) {
+	fields := make(map[string]interface{}, len(tbl.Fields))
+	for key, field := range tbl.Fields {
+		var err error
+		switch f := field.(type) {
+		case *ast.Table:
+			fields[key], err = renderRouteTable(f, data)
+		case []*ast.Table:
+			tables := make([]*ast.Table, len(f))
+			for i, t := range f {
+				if tables[i], err = renderRouteTable(t, data); err != nil {
+					break
+				}
+			}
+			fields[key] = tables
+		case *ast.KeyValue:
+			var value ast.Value
+			value, err = renderRouteValue(f.Value, data)
+			fields[key] = &ast.KeyValue{Key: f.Key, Value: value, Line: f.Line}
+		default:
+			fields[key] = field
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rendering %s: %w", key, err)
+		}
+	}
+
+	t := *tbl
+	t.Fields = fields
+	return &t, nil
+}
+
+func renderRouteValue(value ast.Value, data routeData) (ast.Value, error) {
+	switch v := value.(type) {
+	case *ast.String:
+		if !strings.Contains(v.Value, routeTemplateLeft) {
+			return v, nil
+		}
+		tmpl, err := template.New("").
+			Delims(routeTemplateLeft, routeTemplateRight).
+			Funcs(data.funcs()).
+			Option("missingkey=error").
+			Parse(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		s := *v
+		s.Value = b.String()
+		return &s, nil
+	case *ast.Array:
+		a := *v
+		a.Value = make([]ast.Value, len(v.Value))
+		for i, elem := range v.Value {
+			var err error
+			if a.Value[i], err = renderRouteValue(elem, data); err != nil {
+				return nil, err
+			}
+		}
+		return &a, nil
+	case *ast.Table:
+		return renderRouteTable(v, data)
+	}
+	return value, nil
+}
@@ -1,5 +1,7 @@
 package telegraf
 
+import "context"
+
 type Input interface {
 	PluginDescriber
 
@@ -8,6 +10,17 @@ type Input interface {
 	Gather(Accumulator) error
 }
 
+// ContextInput is an Input whose Gather can be cancelled.  Inputs implementing
+// it are gathered with GatherContext instead of Gather.
+type ContextInput interface {
+	Input
+
+	// GatherContext is Gather with a context that is done when the gather
+	// times out or the agent stops.  The gather should return as soon as
+	// possible once the context is done.
+	GatherContext(context.Context, Accumulator) error
+}
+
 type ServiceInput interface {
 	Input
 
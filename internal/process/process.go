@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"os/exec"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -25,11 +27,21 @@ type Process struct {
 	RestartDelay time.Duration
 	Log          telegraf.Logger
 
+	// Env holds additional environment variables of the process.
+	Env []string
+	// ControlFn is called for every started process with two extra pipes,
+	// passed to the process as the file descriptors 3 (read by the process)
+	// and 4 (written by the process).  Not supported on Windows.
+	ControlFn func(r io.Reader, w io.Writer)
+
 	name       string
 	args       []string
 	pid        int32
 	cancel     context.CancelFunc
 	mainLoopWg sync.WaitGroup
+
+	controlR *os.File
+	controlW *os.File
 }
 
 // New creates a new process wrapper
@@ -102,15 +114,54 @@ func (p *Process) cmdStart() error {
 		return fmt.Errorf("error opening stderr pipe: %w", err)
 	}
 
+	if len(p.Env) > 0 {
+		p.Cmd.Env = append(os.Environ(), p.Env...)
+	}
+
+	var childR, childW *os.File
+	if p.ControlFn != nil {
+		if runtime.GOOS == "windows" {
+			return errors.New("control channel is not supported on Windows")
+		}
+		if childR, p.controlW, err = os.Pipe(); err != nil {
+			return fmt.Errorf("error opening control pipe: %w", err)
+		}
+		if p.controlR, childW, err = os.Pipe(); err != nil {
+			childR.Close()
+			p.controlW.Close()
+			return fmt.Errorf("error opening control pipe: %w", err)
+		}
+		p.Cmd.ExtraFiles = []*os.File{childR, childW}
+	}
+
 	p.Log.Infof("Starting process: %s %s", p.name, p.args)
 
-	if err := p.Cmd.Start(); err != nil {
+	err = p.Cmd.Start()
+	if p.ControlFn != nil {
+		// the process holds its own copies of the pipe ends
+		childR.Close()
+		childW.Close()
+		if err != nil {
+			p.controlR.Close()
+			p.controlW.Close()
+		}
+	}
+	if err != nil {
 		return fmt.Errorf("error starting process: %s", err)
 	}
 	atomic.StoreInt32(&p.pid, int32(p.Cmd.Process.Pid))
 	return nil
 }
 
+// Kill terminates the running process, it is restarted after the restart
+// delay.
+func (p *Process) Kill() error {
+	if p.Cmd == nil || p.Cmd.Process == nil {
+		return nil
+	}
+	return p.Cmd.Process.Kill()
+}
+
 func (p *Process) Pid() int {
 	pid := atomic.LoadInt32(&p.pid)
 	return int(pid)
@@ -166,6 +217,14 @@ func (p *Process) cmdWait(ctx context.Context) error {
 		wg.Done()
 	}()
 
+	if p.ControlFn != nil {
+		wg.Add(1)
+		go func() {
+			p.ControlFn(p.controlR, p.controlW)
+			wg.Done()
+		}()
+	}
+
 	wg.Add(1)
 	go func() {
 		select {
@@ -178,7 +237,15 @@ func (p *Process) cmdWait(ctx context.Context) error {
 
 	err := p.Cmd.Wait()
 	processCancel()
+	if p.ControlFn != nil {
+		// unblock pending writes, the reader sees EOF once the process and
+		// its children closed the channel
+		p.controlW.Close()
+	}
 	wg.Wait()
+	if p.ControlFn != nil {
+		p.controlR.Close()
+	}
 	return err
 }
 
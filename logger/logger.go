@@ -1,11 +1,15 @@
 package logger
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
 	"log"
 	"os"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/influxdata/telegraf/internal"
@@ -15,11 +19,20 @@ import (
 
 var prefixRegex = regexp.MustCompile("^[DIWE]!")
 
+// sourceRegex matches the "[source] " of a message such as "[agent] " or
+// "[inputs.cpu::alias] ".
+var sourceRegex = regexp.MustCompile(`^\[([^\]\s]+)\] `)
+
 const (
 	LogTargetFile   = "file"
 	LogTargetStderr = "stderr"
 )
 
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
 // LogConfig contains the log configuration settings
 type LogConfig struct {
 	// will set the log level to DEBUG
@@ -38,6 +51,8 @@ type LogConfig struct {
 	RotationMaxSize internal.Size
 	// maximum rotated files to keep (older ones will be deleted)
 	RotationMaxArchives int
+	// text or json, empty is interpreted as text
+	LogFormat string
 }
 
 type LoggerCreator interface {
@@ -54,18 +69,122 @@ func registerLogger(name string, loggerCreator LoggerCreator) {
 }
 
 type telegrafLog struct {
-	writer         io.Writer
 	internalWriter io.Writer
+	json           bool
+
+	mu sync.Mutex
 }
 
+// Entry is a log message of a plugin.
+type Entry struct {
+	Level       wlog.Level
+	PluginType  string
+	PluginName  string
+	PluginAlias string
+	Message     string
+}
+
+// source returns the log-friendly name of the plugin.
+func (e *Entry) source() string {
+	if e.PluginType == "" {
+		return e.PluginName
+	}
+	if e.PluginAlias == "" {
+		return e.PluginType + "." + e.PluginName
+	}
+	return e.PluginType + "." + e.PluginName + "::" + e.PluginAlias
+}
+
+// record is a log message in the json log format.
+type record struct {
+	Time        string `json:"time"`
+	Level       string `json:"level"`
+	Source      string `json:"source,omitempty"`
+	PluginType  string `json:"plugin_type,omitempty"`
+	PluginName  string `json:"plugin_name,omitempty"`
+	PluginAlias string `json:"plugin_alias,omitempty"`
+	Message     string `json:"message"`
+}
+
+var levelNames = map[wlog.Level]string{
+	wlog.DEBUG: "debug",
+	wlog.INFO:  "info",
+	wlog.WARN:  "warn",
+	wlog.ERROR: "error",
+}
+
+// Write writes a message of the log package.  Messages without a level
+// prefix are logged at info level, messages below the global log level are
+// dropped.
 func (t *telegrafLog) Write(b []byte) (n int, err error) {
-	var line []byte
-	if !prefixRegex.Match(b) {
-		line = append([]byte(time.Now().UTC().Format(time.RFC3339)+" I! "), b...)
-	} else {
-		line = append([]byte(time.Now().UTC().Format(time.RFC3339)+" "), b...)
+	level := wlog.INFO
+	msg := b
+	if prefixRegex.Match(b) {
+		level = wlog.Levels[b[0]]
+		msg = bytes.TrimLeft(b[2:], " ")
+	}
+	if level < wlog.LogLevel() {
+		return len(b), nil
+	}
+
+	if !t.json {
+		var line []byte
+		if !prefixRegex.Match(b) {
+			line = append([]byte(time.Now().UTC().Format(time.RFC3339)+" I! "), b...)
+		} else {
+			line = append([]byte(time.Now().UTC().Format(time.RFC3339)+" "), b...)
+		}
+		return len(b), t.write(line)
+	}
+
+	e := &Entry{Level: level, Message: strings.TrimRight(string(msg), "\n")}
+	var source string
+	if m := sourceRegex.FindStringSubmatch(e.Message); m != nil {
+		source = m[1]
+		e.Message = e.Message[len(m[0]):]
+		if i := strings.IndexByte(source, '.'); i > 0 {
+			e.PluginType = source[:i]
+			e.PluginName = source[i+1:]
+			if j := strings.Index(e.PluginName, "::"); j >= 0 {
+				e.PluginAlias = e.PluginName[j+2:]
+				e.PluginName = e.PluginName[:j]
+			}
+			source = ""
+		}
 	}
-	return t.writer.Write(line)
+	return len(b), t.writeJSON(e, source)
+}
+
+// writeEntry writes the log entry of a plugin.
+func (t *telegrafLog) writeEntry(e *Entry) error {
+	if t.json {
+		return t.writeJSON(e, "")
+	}
+	line := time.Now().UTC().Format(time.RFC3339) + " " + string(wlog.ReverseLevels[e.Level]) + "! [" + e.source() + "] " + strings.TrimRight(e.Message, "\n") + "\n"
+	return t.write([]byte(line))
+}
+
+func (t *telegrafLog) writeJSON(e *Entry, source string) error {
+	line, err := json.Marshal(&record{
+		Time:        time.Now().UTC().Format(time.RFC3339Nano),
+		Level:       levelNames[e.Level],
+		Source:      source,
+		PluginType:  e.PluginType,
+		PluginName:  e.PluginName,
+		PluginAlias: e.PluginAlias,
+		Message:     strings.TrimRight(e.Message, "\n"),
+	})
+	if err != nil {
+		return err
+	}
+	return t.write(append(line, '\n'))
+}
+
+func (t *telegrafLog) write(line []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.internalWriter.Write(line)
+	return err
 }
 
 func (t *telegrafLog) Close() error {
@@ -83,10 +202,31 @@ func (t *telegrafLog) Close() error {
 }
 
 // newTelegrafWriter returns a logging-wrapped writer.
-func newTelegrafWriter(w io.Writer) io.Writer {
+func newTelegrafWriter(w io.Writer, format string) io.Writer {
 	return &telegrafLog{
-		writer:         wlog.NewWriter(w),
 		internalWriter: w,
+		json:           format == LogFormatJSON,
+	}
+}
+
+// WritePluginEntry writes the log entry of a plugin.  Unless ownLevel is
+// set, because the plugin filtered the entry by its own log level, entries
+// below the global log level are dropped.
+func WritePluginEntry(e *Entry, ownLevel bool) {
+	if !ownLevel && e.Level < wlog.LogLevel() {
+		return
+	}
+
+	actualMu.RLock()
+	t, ok := actualLogger.(*telegrafLog)
+	actualMu.RUnlock()
+	if !ok {
+		// logging is not set up or the target filters the messages itself
+		log.Print(string(wlog.ReverseLevels[e.Level]) + "! [" + e.source() + "] " + e.Message)
+		return
+	}
+	if err := t.writeEntry(e); err != nil {
+		log.Printf("E! Writing log entry failed: %v", err)
 	}
 }
 
@@ -120,12 +260,13 @@ func (t *telegrafLogCreator) CreateLogger(config LogConfig) (io.Writer, error) {
 		writer = defaultWriter
 	}
 
-	return newTelegrafWriter(writer), nil
+	return newTelegrafWriter(writer, config.LogFormat), nil
 }
 
 // Keep track what is actually set as a log output, because log package doesn't provide a getter.
 // It allows closing previous writer if re-set and have possibility to test what is actually set
 var actualLogger io.Writer
+var actualMu sync.RWMutex
 
 func newLogWriter(config LogConfig) io.Writer {
 	log.SetFlags(0)
@@ -146,11 +287,13 @@ func newLogWriter(config LogConfig) io.Writer {
 		logWriter, _ = (&telegrafLogCreator{}).CreateLogger(config)
 	}
 
+	actualMu.Lock()
 	if closer, isCloser := actualLogger.(io.Closer); isCloser {
 		closer.Close()
 	}
 	log.SetOutput(logWriter)
 	actualLogger = logWriter
+	actualMu.Unlock()
 
 	return logWriter
 }
@@ -2,14 +2,17 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/wlog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -134,10 +137,57 @@ func TestLogTargetSettings(t *testing.T) {
 	assert.Equal(t, logger.internalWriter, os.Stderr)
 }
 
+func TestWriteJSONLogToFile(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer func() { os.Remove(tmpfile.Name()) }()
+	config := createBasicLogConfig(tmpfile.Name())
+	config.LogFormat = LogFormatJSON
+	SetupLogging(config)
+	log.Printf("W! [agent] TEST")
+	log.Printf("D! TEST") // <- should be ignored
+	log.Printf("E! [inputs.cpu::usage] TEST")
+	log.Printf("TEST")
+
+	f, err := ioutil.ReadFile(tmpfile.Name())
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(f)), "\n")
+	require.Len(t, lines, 3)
+
+	var records []map[string]string
+	for _, line := range lines {
+		var r map[string]string
+		require.NoError(t, json.Unmarshal([]byte(line), &r))
+		require.NotEmpty(t, r["time"])
+		delete(r, "time")
+		records = append(records, r)
+	}
+	require.Equal(t, []map[string]string{
+		{"level": "warn", "source": "agent", "message": "TEST"},
+		{"level": "error", "plugin_type": "inputs", "plugin_name": "cpu", "plugin_alias": "usage", "message": "TEST"},
+		{"level": "info", "message": "TEST"},
+	}, records)
+}
+
+func TestWritePluginEntry(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer func() { os.Remove(tmpfile.Name()) }()
+	config := createBasicLogConfig(tmpfile.Name())
+	SetupLogging(config)
+
+	WritePluginEntry(&Entry{Level: wlog.DEBUG, PluginType: "inputs", PluginName: "cpu", Message: "ignored"}, false)
+	WritePluginEntry(&Entry{Level: wlog.DEBUG, PluginType: "inputs", PluginName: "snmp", Message: "TEST"}, true)
+
+	f, err := ioutil.ReadFile(tmpfile.Name())
+	require.NoError(t, err)
+	require.Equal(t, "Z D! [inputs.snmp] TEST\n", string(f[19:]))
+}
+
 func BenchmarkTelegrafLogWrite(b *testing.B) {
 	var msg = []byte("test")
 	var buf bytes.Buffer
-	w := newTelegrafWriter(&buf)
+	w := newTelegrafWriter(&buf, LogFormatText)
 	for i := 0; i < b.N; i++ {
 		buf.Reset()
 		w.Write(msg)
@@ -24,11 +24,19 @@ type Buffer struct {
 	batchFirst int // index of the first metric in the batch
 	batchSize  int // number of metrics currently in the batch
 
+	// sizes holds the approximate bytes of the metrics in buf and batchSizes
+	// the ones of the metrics in the batch, as accounted when they were added.
+	// The sizes are zero while the memory budget is not limited.
+	sizes      []int64
+	batchSizes []int64
+	bytes      int64 // approximate bytes of the metrics in the buffer and batch
+
 	MetricsAdded   selfstat.Stat
 	MetricsWritten selfstat.Stat
 	MetricsDropped selfstat.Stat
 	BufferSize     selfstat.Stat
 	BufferLimit    selfstat.Stat
+	BufferBytes    selfstat.Stat
 }
 
 // NewBuffer returns a new empty Buffer with the given capacity.
@@ -37,9 +45,14 @@ func NewBuffer(name string, alias string, capacity int) *Buffer {
 	if alias != "" {
 		tags["alias"] = alias
 	}
+	return newBuffer(tags, capacity)
+}
 
+// newBuffer returns a Buffer registering its statistics with the tags.
+func newBuffer(tags map[string]string, capacity int) *Buffer {
 	b := &Buffer{
 		buf:   make([]telegraf.Metric, capacity),
+		sizes: make([]int64, capacity),
 		first: 0,
 		last:  0,
 		size:  0,
@@ -70,8 +83,14 @@ func NewBuffer(name string, alias string, capacity int) *Buffer {
 			"buffer_limit",
 			tags,
 		),
+		BufferBytes: selfstat.Register(
+			"write",
+			"buffer_bytes",
+			tags,
+		),
 	}
 	b.BufferSize.Set(int64(0))
+	b.BufferBytes.Set(int64(0))
 	b.BufferLimit.Set(int64(capacity))
 	return b
 }
@@ -88,27 +107,56 @@ func (b *Buffer) length() int {
 	return min(b.size+b.batchSize, b.cap)
 }
 
-func (b *Buffer) metricAdded() {
+// Bytes returns the approximate bytes of the metrics currently in the buffer.
+func (b *Buffer) Bytes() int64 {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.bytes
+}
+
+func (b *Buffer) metricAdded(metric telegraf.Metric, size int64) {
 	b.MetricsAdded.Incr(1)
+	b.bytes += size
 }
 
-func (b *Buffer) metricWritten(metric telegraf.Metric) {
+func (b *Buffer) metricWritten(metric telegraf.Metric, size int64) {
 	AgentMetricsWritten.Incr(1)
 	b.MetricsWritten.Incr(1)
+	b.bytes -= size
 	metric.Accept()
 }
 
-func (b *Buffer) metricDropped(metric telegraf.Metric) {
+func (b *Buffer) metricDropped(metric telegraf.Metric, size int64) {
 	AgentMetricsDropped.Incr(1)
 	b.MetricsDropped.Incr(1)
+	b.bytes -= size
 	metric.Reject()
 }
 
-func (b *Buffer) add(m telegraf.Metric) int {
+// updateStats sets the buffer statistics and accounts the change of the bytes
+// since the start of the operation in the memory budget.
+func (b *Buffer) updateStats(bytes int64) {
+	b.BufferSize.Set(int64(b.length()))
+	b.BufferBytes.Set(b.bytes)
+	if b.bytes != bytes {
+		GlobalMemory.Add(b.bytes - bytes)
+	}
+}
+
+// batchMetricSize returns the size of the metric at the index of the batch.
+func (b *Buffer) batchMetricSize(i int) int64 {
+	if i < len(b.batchSizes) {
+		return b.batchSizes[i]
+	}
+	return 0
+}
+
+func (b *Buffer) add(m telegraf.Metric, size int64) int {
 	dropped := 0
 	// Check if Buffer is full
 	if b.size == b.cap {
-		b.metricDropped(b.buf[b.last])
+		b.metricDropped(b.buf[b.last], b.sizes[b.last])
 		dropped++
 
 		if b.batchSize > 0 {
@@ -117,9 +165,10 @@ func (b *Buffer) add(m telegraf.Metric) int {
 		}
 	}
 
-	b.metricAdded()
+	b.metricAdded(m, size)
 
 	b.buf[b.last] = m
+	b.sizes[b.last] = size
 	b.last = b.next(b.last)
 
 	if b.size == b.cap {
@@ -132,17 +181,24 @@ func (b *Buffer) add(m telegraf.Metric) int {
 
 // Add adds metrics to the buffer and returns number of dropped metrics.
 func (b *Buffer) Add(metrics ...telegraf.Metric) int {
+	limited := GlobalMemory.Limited()
+
 	b.Lock()
 	defer b.Unlock()
 
+	bytes := b.bytes
 	dropped := 0
 	for i := range metrics {
-		if n := b.add(metrics[i]); n != 0 {
+		var size int64
+		if limited {
+			size = MetricSize(metrics[i])
+		}
+		if n := b.add(metrics[i], size); n != 0 {
 			dropped += n
 		}
 	}
 
-	b.BufferSize.Set(int64(b.length()))
+	b.updateStats(bytes)
 	return dropped
 }
 
@@ -161,11 +217,14 @@ func (b *Buffer) Batch(batchSize int) []telegraf.Metric {
 
 	b.batchFirst = b.first
 	b.batchSize = outLen
+	b.batchSizes = make([]int64, outLen)
 
 	batchIndex := b.batchFirst
 	for i := range out {
 		out[i] = b.buf[batchIndex]
+		b.batchSizes[i] = b.sizes[batchIndex]
 		b.buf[batchIndex] = nil
+		b.sizes[batchIndex] = 0
 		batchIndex = b.next(batchIndex)
 	}
 
@@ -179,12 +238,13 @@ func (b *Buffer) Accept(batch []telegraf.Metric) {
 	b.Lock()
 	defer b.Unlock()
 
-	for _, m := range batch {
-		b.metricWritten(m)
+	bytes := b.bytes
+	for i, m := range batch {
+		b.metricWritten(m, b.batchMetricSize(i))
 	}
 
 	b.resetBatch()
-	b.BufferSize.Set(int64(b.length()))
+	b.updateStats(bytes)
 }
 
 // Reject returns the batch, acquired from Batch(), to the buffer and marks it
@@ -207,17 +267,38 @@ func (b *Buffer) Reject(batch []telegraf.Metric) {
 	re := b.first
 
 	// Copy metrics from the batch back into the buffer
+	bytes := b.bytes
 	for i := range batch {
 		if i < skip {
-			b.metricDropped(batch[i])
+			b.metricDropped(batch[i], b.batchMetricSize(i))
 		} else {
 			b.buf[re] = batch[i]
+			b.sizes[re] = b.batchMetricSize(i)
 			re = b.next(re)
 		}
 	}
 
 	b.resetBatch()
-	b.BufferSize.Set(int64(b.length()))
+	b.updateStats(bytes)
+}
+
+// Drop drops all the metrics in the buffer, the buffer must not have an
+// unfinished batch.
+func (b *Buffer) Drop() int {
+	b.Lock()
+	defer b.Unlock()
+
+	bytes := b.bytes
+	dropped := b.size
+	for ; b.size > 0; b.size-- {
+		b.metricDropped(b.buf[b.first], b.sizes[b.first])
+		b.buf[b.first] = nil
+		b.sizes[b.first] = 0
+		b.first = b.next(b.first)
+	}
+
+	b.updateStats(bytes)
+	return dropped
 }
 
 // dist returns the distance between two indexes.  Because this data structure
@@ -270,6 +351,7 @@ func (b *Buffer) prevby(index, count int) int {
 func (b *Buffer) resetBatch() {
 	b.batchFirst = 0
 	b.batchSize = 0
+	b.batchSizes = nil
 }
 
 func min(a, b int) int {
@@ -726,3 +726,45 @@ func TestBuffer_RejectEmptyBatch(t *testing.T) {
 		require.NotNil(t, m)
 	}
 }
+
+func TestBuffer_Bytes(t *testing.T) {
+	// metrics are only accounted while the memory budget is limited
+	unlimited := setup(NewBuffer("test", "", 2))
+	unlimited.Add(Metric())
+	require.Equal(t, int64(0), unlimited.Bytes())
+
+	GlobalMemory.SetLimit(1 << 40)
+	defer GlobalMemory.SetLimit(0)
+
+	b := setup(NewBuffer("test", "", 2))
+	size := MetricSize(Metric())
+	used := GlobalMemory.used
+
+	b.Add(Metric(), Metric())
+	require.Equal(t, 2*size, b.Bytes())
+	require.Equal(t, 2*size, b.BufferBytes.Get())
+	require.Equal(t, used+2*size, GlobalMemory.used)
+
+	// overwriting the oldest metric keeps the size
+	b.Add(Metric())
+	require.Equal(t, 2*size, b.Bytes())
+
+	batch := b.Batch(1)
+	b.Reject(batch)
+	require.Equal(t, 2*size, b.Bytes())
+
+	batch = b.Batch(1)
+	b.Accept(batch)
+	require.Equal(t, size, b.Bytes())
+
+	// the size accounted when the metric was added is released
+	batch = b.Batch(1)
+	batch[0].AddTag("grown", "after adding")
+	b.Reject(batch)
+
+	require.Equal(t, 1, b.Drop())
+	require.Equal(t, 0, b.Len())
+	require.Equal(t, int64(0), b.Bytes())
+	require.Equal(t, int64(0), b.BufferBytes.Get())
+	require.Equal(t, used, GlobalMemory.used)
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Error classes of the per-plugin error counters.
+const (
+	errorClassTimeout    = "timeout"
+	errorClassNetwork    = "network"
+	errorClassPermission = "permission"
+	errorClassNotFound   = "not_found"
+	errorClassParse      = "parse"
+	errorClassOther      = "other"
+)
+
+// errorClass returns the class of the error.  Only errors wrapped with %w are
+// unwrapped, so errors formatted into a new error fall back to "other".
+func errorClass(err error) string {
+	if err == nil {
+		return errorClassOther
+	}
+
+	var timeout interface{ Timeout() bool }
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &timeout) && timeout.Timeout()) {
+		return errorClassTimeout
+	}
+
+	switch {
+	case errors.Is(err, os.ErrPermission):
+		return errorClassPermission
+	case errors.Is(err, os.ErrNotExist):
+		return errorClassNotFound
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) {
+		return errorClassNetwork
+	}
+
+	var numErr *strconv.NumError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var timeErr *time.ParseError
+	if errors.As(err, &numErr) || errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.As(err, &timeErr) {
+		return errorClassParse
+	}
+
+	return errorClassOther
+}
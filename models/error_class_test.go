@@ -0,0 +1,49 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/influxdata/telegraf/selfstat"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorClass(t *testing.T) {
+	_, parseErr := strconv.Atoi("x")
+	_, openErr := os.Open("/nonexistent/file")
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{nil, "other"},
+		{errors.New("failed"), "other"},
+		{context.DeadlineExceeded, "timeout"},
+		{fmt.Errorf("query failed: %w", context.DeadlineExceeded), "timeout"},
+		{fmt.Errorf("reading: %w", os.ErrPermission), "permission"},
+		{openErr, "not_found"},
+		{dialErr, "network"},
+		{fmt.Errorf("parsing: %w", parseErr), "parse"},
+		{fmt.Errorf("parsing: %v", parseErr), "other"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.class, errorClass(tt.err), "%v", tt.err)
+	}
+}
+
+func TestErrorClassCounting(t *testing.T) {
+	ro := NewRunningOutput("error_class_test", &mockOutput{}, &OutputConfig{Name: "error_class_test"}, 0, 0)
+	ro.log.Errorf("Error writing to %s: %v", ro.LogName(), context.DeadlineExceeded)
+	ro.log.Error("failed")
+
+	tags := map[string]string{"output": "error_class_test"}
+	require.Equal(t, int64(2), selfstat.Register("write", "errors", tags).Get())
+	require.Equal(t, int64(1), selfstat.Register("write", "errors_timeout", tags).Get())
+	require.Equal(t, int64(1), selfstat.Register("write", "errors_other", tags).Get())
+}
@@ -1,22 +1,39 @@
 package models
 
 import (
-	"log"
+	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/logger"
+	"github.com/influxdata/wlog"
 )
 
 // Logger defines a logging structure for plugins.
 type Logger struct {
 	OnErrs []func()
 	Name   string // Name is the plugin name, will be printed in the `[]`.
+
+	pluginType string
+	pluginName string
+	alias      string
+	// level overrides the global log level if set
+	level wlog.Level
+
+	onErrClasses []func(class string)
 }
 
-// NewLogger creates a new logger instance
-func NewLogger(pluginType, name, alias string) *Logger {
+// NewLogger creates a new logger instance.  The messages are filtered by the
+// level, one of "error", "warn", "info" or "debug", instead of the global log
+// level unless the level is empty.
+func NewLogger(pluginType, name, alias, level string) *Logger {
 	return &Logger{
-		Name: logName(pluginType, name, alias),
+		Name:       logName(pluginType, name, alias),
+		pluginType: pluginType,
+		pluginName: name,
+		alias:      alias,
+		level:      wlog.StringToLevel[strings.ToUpper(level)],
 	}
 }
 
@@ -25,50 +42,92 @@ func (l *Logger) OnErr(f func()) {
 	l.OnErrs = append(l.OnErrs, f)
 }
 
-// Errorf logs an error message, patterned after log.Printf.
-func (l *Logger) Errorf(format string, args ...interface{}) {
+// OnErrClass defines a callback that triggers with the class of the error,
+// such as "timeout" or "network", when errors are about to be written to the
+// log.  The class is taken from the first error argument of the log call.
+func (l *Logger) OnErrClass(f func(class string)) {
+	l.onErrClasses = append(l.onErrClasses, f)
+}
+
+func (l *Logger) onErr(args []interface{}) {
 	for _, f := range l.OnErrs {
 		f()
 	}
-	log.Printf("E! ["+l.Name+"] "+format, args...)
+	if len(l.onErrClasses) == 0 {
+		return
+	}
+
+	var err error
+	for _, arg := range args {
+		if e, ok := arg.(error); ok {
+			err = e
+			break
+		}
+	}
+	class := errorClass(err)
+	for _, f := range l.onErrClasses {
+		f(class)
+	}
+}
+
+// Errorf logs an error message, patterned after log.Printf.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.onErr(args)
+	l.print(wlog.ERROR, fmt.Sprintf(format, args...))
 }
 
 // Error logs an error message, patterned after log.Print.
 func (l *Logger) Error(args ...interface{}) {
-	for _, f := range l.OnErrs {
-		f()
-	}
-	log.Print(append([]interface{}{"E! [" + l.Name + "] "}, args...)...)
+	l.onErr(args)
+	l.print(wlog.ERROR, fmt.Sprint(args...))
 }
 
 // Debugf logs a debug message, patterned after log.Printf.
 func (l *Logger) Debugf(format string, args ...interface{}) {
-	log.Printf("D! ["+l.Name+"] "+format, args...)
+	l.print(wlog.DEBUG, fmt.Sprintf(format, args...))
 }
 
 // Debug logs a debug message, patterned after log.Print.
 func (l *Logger) Debug(args ...interface{}) {
-	log.Print(append([]interface{}{"D! [" + l.Name + "] "}, args...)...)
+	l.print(wlog.DEBUG, fmt.Sprint(args...))
 }
 
 // Warnf logs a warning message, patterned after log.Printf.
 func (l *Logger) Warnf(format string, args ...interface{}) {
-	log.Printf("W! ["+l.Name+"] "+format, args...)
+	l.print(wlog.WARN, fmt.Sprintf(format, args...))
 }
 
 // Warn logs a warning message, patterned after log.Print.
 func (l *Logger) Warn(args ...interface{}) {
-	log.Print(append([]interface{}{"W! [" + l.Name + "] "}, args...)...)
+	l.print(wlog.WARN, fmt.Sprint(args...))
 }
 
 // Infof logs an information message, patterned after log.Printf.
 func (l *Logger) Infof(format string, args ...interface{}) {
-	log.Printf("I! ["+l.Name+"] "+format, args...)
+	l.print(wlog.INFO, fmt.Sprintf(format, args...))
 }
 
 // Info logs an information message, patterned after log.Print.
 func (l *Logger) Info(args ...interface{}) {
-	log.Print(append([]interface{}{"I! [" + l.Name + "] "}, args...)...)
+	l.print(wlog.INFO, fmt.Sprint(args...))
+}
+
+func (l *Logger) print(level wlog.Level, msg string) {
+	if l.level != 0 && level < l.level {
+		return
+	}
+	name := l.pluginName
+	if l.pluginType == "" {
+		// logger not created by NewLogger
+		name = l.Name
+	}
+	logger.WritePluginEntry(&logger.Entry{
+		Level:       level,
+		PluginType:  l.pluginType,
+		PluginName:  name,
+		PluginAlias: l.alias,
+		Message:     msg,
+	}, l.level != 0)
 }
 
 // logName returns the log-friendly name/type.
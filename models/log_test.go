@@ -1,8 +1,13 @@
 package models
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 
+	"github.com/influxdata/telegraf/logger"
 	"github.com/influxdata/telegraf/selfstat"
 	"github.com/stretchr/testify/require"
 )
@@ -22,3 +27,35 @@ func TestErrorCounting(t *testing.T) {
 
 	require.Equal(t, int64(2), reg.Get())
 }
+
+func TestLoggerLevel(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "")
+	require.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+	logger.SetupLogging(logger.LogConfig{
+		LogTarget: logger.LogTargetFile,
+		Logfile:   tmpfile.Name(),
+		LogFormat: logger.LogFormatJSON,
+	})
+	defer logger.SetupLogging(logger.LogConfig{})
+
+	NewLogger("inputs", "cpu", "", "").Debug("dropped by global level")
+	NewLogger("inputs", "snmp", "core", "debug").Debugf("%d oids", 3)
+	NewLogger("outputs", "file", "", "error").Warn("dropped by plugin level")
+
+	f, err := ioutil.ReadFile(tmpfile.Name())
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(f)), "\n")
+	require.Len(t, lines, 1)
+
+	var r map[string]string
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &r))
+	delete(r, "time")
+	require.Equal(t, map[string]string{
+		"level":        "debug",
+		"plugin_type":  "inputs",
+		"plugin_name":  "snmp",
+		"plugin_alias": "core",
+		"message":      "3 oids",
+	}, r)
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// Approximate bytes held by a metric, a tag and a field besides their names
+// and values.
+const (
+	metricOverhead = 128
+	tagOverhead    = 48
+	fieldOverhead  = 56
+)
+
+// MetricSize returns the approximate number of bytes held by the metric.
+func MetricSize(metric telegraf.Metric) int64 {
+	size := metricOverhead + len(metric.Name())
+	for _, tag := range metric.TagList() {
+		size += tagOverhead + len(tag.Key) + len(tag.Value)
+	}
+	for _, field := range metric.FieldList() {
+		size += fieldOverhead + len(field.Key)
+		switch v := field.Value.(type) {
+		case string:
+			size += len(v)
+		case []byte:
+			size += len(v)
+		}
+	}
+	return int64(size)
+}
+
+// GlobalMemory accounts the metrics held in the output buffers.
+var GlobalMemory = newMemoryBudget()
+
+// MemoryBudget tracks the approximate bytes of the buffered metrics against a
+// limit.  Once the limit is exceeded the budget stays exceeded until the usage
+// drops to the resume level, so the inputs do not flap around the limit.
+type MemoryBudget struct {
+	MemoryUsed   selfstat.Stat
+	MemoryLimit  selfstat.Stat
+	Backpressure selfstat.Stat
+
+	// limited is 1 while a limit is set, it is read without the lock on
+	// every buffer operation.
+	limited int32
+
+	mu       sync.Mutex
+	used     int64
+	limit    int64
+	exceeded bool
+	// released is closed when the budget stops being exceeded
+	released chan struct{}
+}
+
+func newMemoryBudget() *MemoryBudget {
+	tags := map[string]string{}
+	return &MemoryBudget{
+		MemoryUsed:   selfstat.Register("agent", "memory_used_bytes", tags),
+		MemoryLimit:  selfstat.Register("agent", "memory_limit_bytes", tags),
+		Backpressure: selfstat.Register("agent", "backpressure", tags),
+	}
+}
+
+// SetLimit sets the limit of the budget in bytes, zero disables it.
+func (b *MemoryBudget) SetLimit(limit int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.limit = limit
+	b.MemoryLimit.Set(limit)
+	if limit > 0 {
+		atomic.StoreInt32(&b.limited, 1)
+	} else {
+		atomic.StoreInt32(&b.limited, 0)
+	}
+	b.update()
+}
+
+// Limited returns true if a limit is set, the metrics are only accounted while
+// the budget is limited.
+func (b *MemoryBudget) Limited() bool {
+	return atomic.LoadInt32(&b.limited) == 1
+}
+
+// Add adds n bytes to the budget, n is negative for released metrics.
+func (b *MemoryBudget) Add(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.used += n
+	b.MemoryUsed.Set(b.used)
+	b.update()
+}
+
+// Exceeded returns true while the inputs should hold back metrics.
+func (b *MemoryBudget) Exceeded() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.exceeded
+}
+
+// Wait blocks while the budget is exceeded.
+func (b *MemoryBudget) Wait() {
+	b.mu.Lock()
+	if !b.exceeded {
+		b.mu.Unlock()
+		return
+	}
+	released := b.released
+	b.mu.Unlock()
+
+	<-released
+}
+
+// update switches the backpressure on above the limit and off at 90% of it.
+func (b *MemoryBudget) update() {
+	switch {
+	case b.limit <= 0:
+		b.release()
+	case !b.exceeded && b.used > b.limit:
+		log.Printf("W! [agent] Buffered metrics use %d bytes, exceeding max_memory of %d bytes; pausing inputs",
+			b.used, b.limit)
+		b.exceeded = true
+		b.released = make(chan struct{})
+		b.Backpressure.Set(1)
+	case b.exceeded && b.used <= b.limit/10*9:
+		log.Printf("I! [agent] Buffered metrics use %d bytes; resuming inputs", b.used)
+		b.release()
+	}
+}
+
+func (b *MemoryBudget) release() {
+	if !b.exceeded {
+		return
+	}
+	b.exceeded = false
+	close(b.released)
+	b.Backpressure.Set(0)
+}
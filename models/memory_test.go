@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricSize(t *testing.T) {
+	m := testutil.MustMetric("cpu",
+		map[string]string{"host": "localhost"},
+		map[string]interface{}{"value": 42.0, "state": "idle"},
+		time.Unix(0, 0),
+	)
+	expected := metricOverhead + len("cpu") +
+		tagOverhead + len("host") + len("localhost") +
+		fieldOverhead + len("value") +
+		fieldOverhead + len("state") + len("idle")
+	require.Equal(t, int64(expected), MetricSize(m))
+}
+
+func TestMemoryBudget(t *testing.T) {
+	b := newMemoryBudget()
+	b.Add(200)
+	require.False(t, b.Exceeded(), "no limit")
+
+	b.SetLimit(100)
+	require.True(t, b.Exceeded())
+	require.Equal(t, int64(1), b.Backpressure.Get())
+
+	waiting := make(chan struct{})
+	go func() {
+		defer close(waiting)
+		b.Wait()
+	}()
+
+	// the budget is released at 90% of the limit
+	b.Add(-105)
+	require.True(t, b.Exceeded())
+	b.Add(-5)
+	require.False(t, b.Exceeded())
+	require.Equal(t, int64(0), b.Backpressure.Get())
+	<-waiting
+
+	b.Add(20)
+	require.True(t, b.Exceeded())
+	b.SetLimit(0)
+	require.False(t, b.Exceeded())
+	b.Wait()
+	b.Add(-110)
+}
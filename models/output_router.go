@@ -0,0 +1,205 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+// Default time after which a routed output without metrics is closed.
+const DefaultRouteIdleTimeout = time.Hour
+
+// Time after which the creation of a routed output that failed is retried,
+// the metrics of its tag value are dropped meanwhile.
+const RouteRetryInterval = time.Minute
+
+// OutputRouter instantiates an output for every distinct value of the routing
+// tag of the metrics, each instance has its own buffer and statistics.
+//
+// The router is not safe for concurrent use, it is expected to be used by the
+// goroutine distributing the metrics to the outputs.
+type OutputRouter struct {
+	Config *OutputConfig
+
+	// NewOutput creates the output of a routing tag value.
+	NewOutput func(value string) (*RunningOutput, error)
+
+	MetricsFiltered selfstat.Stat
+	MetricsUnrouted selfstat.Stat
+	MetricsLimited  selfstat.Stat
+	Routes          selfstat.Stat
+
+	outputs map[string]*routedOutput
+	// failed holds the time the creation of the output of a tag value is
+	// retried after it failed.
+	failed  map[string]time.Time
+	limited bool
+	log     telegraf.Logger
+}
+
+type routedOutput struct {
+	output   *RunningOutput
+	lastSeen time.Time
+}
+
+func NewOutputRouter(
+	config *OutputConfig,
+	newOutput func(value string) (*RunningOutput, error),
+) *OutputRouter {
+	tags := map[string]string{"output": config.Name}
+	if config.Alias != "" {
+		tags["alias"] = config.Alias
+	}
+
+	if config.RouteIdleTimeout == 0 {
+		config.RouteIdleTimeout = DefaultRouteIdleTimeout
+	}
+
+	return &OutputRouter{
+		Config:    config,
+		NewOutput: newOutput,
+		MetricsFiltered: selfstat.Register(
+			"write",
+			"metrics_filtered",
+			tags,
+		),
+		MetricsUnrouted: selfstat.Register(
+			"write",
+			"metrics_unrouted",
+			tags,
+		),
+		MetricsLimited: selfstat.Register(
+			"write",
+			"metrics_route_limited",
+			tags,
+		),
+		Routes: selfstat.Register(
+			"write",
+			"routes",
+			tags,
+		),
+		outputs: make(map[string]*routedOutput),
+		failed:  make(map[string]time.Time),
+		log:     NewLogger("outputs", config.Name, config.Alias, config.LogLevel),
+	}
+}
+
+func (r *OutputRouter) LogName() string {
+	return logName("outputs", r.Config.Name, r.Config.Alias)
+}
+
+func (r *OutputRouter) Log() telegraf.Logger {
+	return r.log
+}
+
+// Route returns the output of the metric, the output is created on the first
+// metric with its routing tag value and created is true.  The metric is
+// dropped and a nil output is returned when the metric has no routing tag, is
+// rejected by the filter of the output, or when its output can't be created.
+// An output is not created while MaxRoutes outputs are running, and not
+// before RouteRetryInterval after its creation failed; the error is only
+// returned on the failure itself.
+//
+// Takes ownership of metric if no output is returned
+func (r *OutputRouter) Route(metric telegraf.Metric, now time.Time) (output *RunningOutput, created bool, err error) {
+	value, ok := metric.GetTag(r.Config.RouteTag)
+	if !ok {
+		r.MetricsUnrouted.Incr(1)
+		metric.Drop()
+		return nil, false, nil
+	}
+
+	if routed, ok := r.outputs[value]; ok {
+		routed.lastSeen = now
+		return routed.output, false, nil
+	}
+
+	// Metrics an instance would filter out do not create the instance.
+	if ok := r.Config.Filter.Select(metric); !ok {
+		r.MetricsFiltered.Incr(1)
+		metric.Drop()
+		return nil, false, nil
+	}
+
+	if retry, ok := r.failed[value]; ok && now.Before(retry) {
+		r.MetricsUnrouted.Incr(1)
+		metric.Drop()
+		return nil, false, nil
+	}
+
+	if r.Config.MaxRoutes > 0 && len(r.outputs) >= r.Config.MaxRoutes {
+		if !r.limited {
+			r.log.Warnf("Reached max_routes of %d, dropping the metrics of new %s values",
+				r.Config.MaxRoutes, r.Config.RouteTag)
+			r.limited = true
+		}
+		r.MetricsLimited.Incr(1)
+		metric.Drop()
+		return nil, false, nil
+	}
+
+	output, err = r.NewOutput(value)
+	if err == nil {
+		if err = output.Init(); err != nil {
+			output.Unregister()
+		}
+	}
+	if err != nil {
+		r.failed[value] = now.Add(RouteRetryInterval)
+		r.MetricsUnrouted.Incr(1)
+		metric.Drop()
+		return nil, false, fmt.Errorf("creating output for %s=%q, retrying in %s: %w",
+			r.Config.RouteTag, value, RouteRetryInterval, err)
+	}
+
+	delete(r.failed, value)
+	r.outputs[value] = &routedOutput{output: output, lastSeen: now}
+	r.Routes.Set(int64(len(r.outputs)))
+	return output, true, nil
+}
+
+// Evict removes and returns the outputs without metrics for the idle timeout.
+// Outputs with metrics left in their buffer, usually as their destination is
+// down, are kept until the metrics are written so no metrics are dropped.
+// The caller is responsible for flushing and closing them.
+func (r *OutputRouter) Evict(now time.Time) []*RunningOutput {
+	var evicted []*RunningOutput
+	for value, routed := range r.outputs {
+		if now.Sub(routed.lastSeen) < r.Config.RouteIdleTimeout {
+			continue
+		}
+		if routed.output.BufferLength() != 0 {
+			continue
+		}
+		evicted = append(evicted, routed.output)
+		delete(r.outputs, value)
+	}
+	for value, retry := range r.failed {
+		if !now.Before(retry) {
+			delete(r.failed, value)
+		}
+	}
+	if len(evicted) != 0 {
+		r.limited = false
+	}
+	r.Routes.Set(int64(len(r.outputs)))
+	return evicted
+}
+
+// Outputs returns the current outputs sorted by routing tag value.
+func (r *OutputRouter) Outputs() []*RunningOutput {
+	values := make([]string, 0, len(r.outputs))
+	for value := range r.outputs {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	outputs := make([]*RunningOutput, 0, len(values))
+	for _, value := range values {
+		outputs = append(outputs, r.outputs[value].output)
+	}
+	return outputs
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/selfstat"
+	"github.com/stretchr/testify/require"
+)
+
+func routedMetric(t *testing.T, tags map[string]string) telegraf.Metric {
+	m, err := metric.New("cpu", tags, map[string]interface{}{"value": 42}, time.Unix(0, 0))
+	require.NoError(t, err)
+	return m
+}
+
+func newTestRouter(name string, config *OutputConfig) *OutputRouter {
+	config.Name = name
+	return NewOutputRouter(config, func(value string) (*RunningOutput, error) {
+		if value == "broken" {
+			return nil, errors.New("broken")
+		}
+		c := *config
+		c.RouteValue = value
+		return NewRunningOutput(name, &mockOutput{}, &c, 0, 0), nil
+	})
+}
+
+func TestOutputRouterRoute(t *testing.T) {
+	router := newTestRouter("router_route_test", &OutputConfig{RouteTag: "tenant"})
+	require.Equal(t, DefaultRouteIdleTimeout, router.Config.RouteIdleTimeout)
+
+	now := time.Unix(0, 0)
+	a, created, err := router.Route(routedMetric(t, map[string]string{"tenant": "a"}), now)
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, "a", a.Config.RouteValue)
+	require.Equal(t, "outputs.router_route_test::tenant=a", a.LogName())
+
+	output, created, err := router.Route(routedMetric(t, map[string]string{"tenant": "a"}), now)
+	require.NoError(t, err)
+	require.False(t, created)
+	require.Same(t, a, output)
+
+	b, created, err := router.Route(routedMetric(t, map[string]string{"tenant": "b"}), now)
+	require.NoError(t, err)
+	require.True(t, created)
+	require.NotSame(t, a, b)
+	require.Equal(t, []*RunningOutput{a, b}, router.Outputs())
+	require.Equal(t, int64(2), router.Routes.Get())
+
+	// every instance has its own buffer and statistics
+	a.AddMetric(routedMetric(t, map[string]string{"tenant": "a"}))
+	require.Equal(t, 1, a.BufferLength())
+	require.Equal(t, 0, b.BufferLength())
+	require.Equal(t, int64(1), selfstat.Register("write", "metrics_added",
+		map[string]string{"output": "router_route_test", "route": "a"}).Get())
+
+	output, _, err = router.Route(routedMetric(t, map[string]string{"host": "localhost"}), now)
+	require.NoError(t, err)
+	require.Nil(t, output)
+	require.Equal(t, int64(1), router.MetricsUnrouted.Get())
+
+	output, _, err = router.Route(routedMetric(t, map[string]string{"tenant": "broken"}), now)
+	require.Error(t, err)
+	require.Nil(t, output)
+	require.Equal(t, int64(2), router.MetricsUnrouted.Get())
+	require.Len(t, router.Outputs(), 2)
+}
+
+func TestOutputRouterFilter(t *testing.T) {
+	router := newTestRouter("router_filter_test", &OutputConfig{
+		RouteTag: "tenant",
+		Filter:   Filter{NameDrop: []string{"cpu"}},
+	})
+	require.NoError(t, router.Config.Filter.Compile())
+
+	output, created, err := router.Route(routedMetric(t, map[string]string{"tenant": "a"}), time.Unix(0, 0))
+	require.NoError(t, err)
+	require.False(t, created)
+	require.Nil(t, output)
+	require.Empty(t, router.Outputs())
+	require.Equal(t, int64(1), router.MetricsFiltered.Get())
+}
+
+func TestOutputRouterEvict(t *testing.T) {
+	router := newTestRouter("router_evict_test", &OutputConfig{
+		RouteTag:         "tenant",
+		RouteIdleTimeout: time.Minute,
+	})
+
+	start := time.Unix(0, 0)
+	a, _, err := router.Route(routedMetric(t, map[string]string{"tenant": "a"}), start)
+	require.NoError(t, err)
+	b, _, err := router.Route(routedMetric(t, map[string]string{"tenant": "b"}), start)
+	require.NoError(t, err)
+
+	_, _, err = router.Route(routedMetric(t, map[string]string{"tenant": "b"}), start.Add(30*time.Second))
+	require.NoError(t, err)
+
+	require.Empty(t, router.Evict(start.Add(59*time.Second)))
+	require.Equal(t, []*RunningOutput{a}, router.Evict(start.Add(time.Minute)))
+	require.Equal(t, []*RunningOutput{b}, router.Outputs())
+	require.Equal(t, int64(1), router.Routes.Get())
+
+	// an instance with unwritten metrics is kept until they are written
+	b.AddMetric(routedMetric(t, map[string]string{"tenant": "b"}))
+	require.Empty(t, router.Evict(start.Add(time.Hour)))
+	require.NoError(t, b.Write())
+	require.Equal(t, []*RunningOutput{b}, router.Evict(start.Add(time.Hour)))
+	require.Empty(t, router.Outputs())
+
+	// a new metric recreates an evicted instance
+	output, created, err := router.Route(routedMetric(t, map[string]string{"tenant": "a"}), start.Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, created)
+	require.NotSame(t, a, output)
+}
+
+func TestOutputRouterRetry(t *testing.T) {
+	router := newTestRouter("router_retry_test", &OutputConfig{RouteTag: "tenant"})
+	newOutput := router.NewOutput
+	var attempts int
+	router.NewOutput = func(value string) (*RunningOutput, error) {
+		attempts++
+		return newOutput(value)
+	}
+
+	start := time.Unix(0, 0)
+	_, _, err := router.Route(routedMetric(t, map[string]string{"tenant": "broken"}), start)
+	require.Error(t, err)
+
+	// the metrics are dropped without retrying until the retry interval passed
+	output, _, err := router.Route(routedMetric(t, map[string]string{"tenant": "broken"}), start.Add(time.Second))
+	require.NoError(t, err)
+	require.Nil(t, output)
+	require.Equal(t, 1, attempts)
+	require.Equal(t, int64(2), router.MetricsUnrouted.Get())
+
+	_, _, err = router.Route(routedMetric(t, map[string]string{"tenant": "broken"}), start.Add(RouteRetryInterval))
+	require.Error(t, err)
+	require.Equal(t, 2, attempts)
+	require.Equal(t, int64(3), router.MetricsUnrouted.Get())
+
+	// other values are not affected
+	output, created, err := router.Route(routedMetric(t, map[string]string{"tenant": "a"}), start.Add(time.Second))
+	require.NoError(t, err)
+	require.True(t, created)
+	require.NotNil(t, output)
+
+	// the failures are forgotten once their retry interval passed
+	router.Evict(start.Add(2 * RouteRetryInterval))
+	require.Empty(t, router.failed)
+}
+
+func TestOutputRouterMaxRoutes(t *testing.T) {
+	router := newTestRouter("router_max_routes_test", &OutputConfig{
+		RouteTag:         "tenant",
+		RouteIdleTimeout: time.Minute,
+		MaxRoutes:        2,
+	})
+
+	start := time.Unix(0, 0)
+	for _, value := range []string{"a", "b"} {
+		_, created, err := router.Route(routedMetric(t, map[string]string{"tenant": value}), start)
+		require.NoError(t, err)
+		require.True(t, created)
+	}
+
+	output, created, err := router.Route(routedMetric(t, map[string]string{"tenant": "c"}), start)
+	require.NoError(t, err)
+	require.False(t, created)
+	require.Nil(t, output)
+	require.Len(t, router.Outputs(), 2)
+	require.Equal(t, int64(1), router.MetricsLimited.Get())
+
+	// the running instances still receive their metrics
+	output, _, err = router.Route(routedMetric(t, map[string]string{"tenant": "b"}), start.Add(30*time.Second))
+	require.NoError(t, err)
+	require.NotNil(t, output)
+
+	// an evicted instance makes room for a new one
+	router.Evict(start.Add(time.Minute))
+	output, created, err = router.Route(routedMetric(t, map[string]string{"tenant": "c"}), start.Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, "c", output.Config.RouteValue)
+	require.Equal(t, int64(1), router.MetricsLimited.Get())
+}
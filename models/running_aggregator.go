@@ -1,6 +1,8 @@
 package models
 
 import (
+	"errors"
+	"sort"
 	"sync"
 	"time"
 
@@ -17,6 +19,15 @@ type RunningAggregator struct {
 	periodEnd   time.Time
 	log         telegraf.Logger
 
+	// NewAggregator creates a configured aggregator for each window, it is
+	// required if the config is windowed.
+	NewAggregator func() (telegraf.Aggregator, error)
+
+	windows map[int64]*aggregatorWindow // by start in Unix nanoseconds
+	anchor  time.Time                   // start of a window
+	closed  time.Time                   // windows ending until closed are pushed
+	latest  time.Time                   // latest metric time in event time
+
 	MetricsPushed   selfstat.Stat
 	MetricsFiltered selfstat.Stat
 	MetricsDropped  selfstat.Stat
@@ -30,10 +41,13 @@ func NewRunningAggregator(aggregator telegraf.Aggregator, config *AggregatorConf
 	}
 
 	aggErrorsRegister := selfstat.Register("aggregate", "errors", tags)
-	logger := NewLogger("aggregators", config.Name, config.Alias)
+	logger := NewLogger("aggregators", config.Name, config.Alias, config.LogLevel)
 	logger.OnErr(func() {
 		aggErrorsRegister.Incr(1)
 	})
+	logger.OnErrClass(func(class string) {
+		selfstat.Register("aggregate", "errors_"+class, tags).Incr(1)
+	})
 
 	setLoggerOnPlugin(aggregator, logger)
 
@@ -68,11 +82,21 @@ func NewRunningAggregator(aggregator telegraf.Aggregator, config *AggregatorConf
 type AggregatorConfig struct {
 	Name         string
 	Alias        string
+	LogLevel     string
 	DropOriginal bool
 	Period       time.Duration
 	Delay        time.Duration
 	Grace        time.Duration
 
+	// Window is the length of the windows, windows longer than the period
+	// overlap.  Zero is the period.
+	Window time.Duration
+	// TimeMode is TimeModeProcessing or TimeModeEvent.
+	TimeMode string
+	// Watermark is how far the windows lag behind the latest metric time in
+	// event time.
+	Watermark time.Duration
+
 	NameOverride      string
 	MeasurementPrefix string
 	MeasurementSuffix string
@@ -80,11 +104,36 @@ type AggregatorConfig struct {
 	Filter            Filter
 }
 
+// Time modes of the aggregation windows.
+const (
+	// TimeModeProcessing closes the windows by the wall clock.
+	TimeModeProcessing = "processing"
+	// TimeModeEvent closes the windows once the latest metric time, minus
+	// the watermark, passed their end.
+	TimeModeEvent = "event"
+)
+
+// Windowed returns true if the aggregator keeps a window per period instead
+// of a single window reset on each push.
+func (c *AggregatorConfig) Windowed() bool {
+	return c.Window > c.Period || c.TimeMode == TimeModeEvent
+}
+
+// aggregatorWindow is the aggregation of the metrics within [start, end).
+type aggregatorWindow struct {
+	start      time.Time
+	end        time.Time
+	aggregator telegraf.Aggregator
+}
+
 func (r *RunningAggregator) LogName() string {
 	return logName("aggregators", r.Config.Name, r.Config.Alias)
 }
 
 func (r *RunningAggregator) Init() error {
+	if r.Config.Windowed() && r.NewAggregator == nil {
+		return errors.New("windows longer than the period and event time require a new aggregator per window")
+	}
 	if p, ok := r.Aggregator.(telegraf.Initializer); ok {
 		err := p.Init()
 		if err != nil {
@@ -98,11 +147,19 @@ func (r *RunningAggregator) Period() time.Duration {
 	return r.Config.Period
 }
 
+// EndPeriod returns the time of the next push.  Windowed aggregators push after
+// the delay, so metrics arriving late by less than the delay are included.
 func (r *RunningAggregator) EndPeriod() time.Time {
+	if r.Config.Windowed() {
+		return r.periodEnd.Add(r.Config.Delay)
+	}
 	return r.periodEnd
 }
 
 func (r *RunningAggregator) UpdateWindow(start, until time.Time) {
+	if r.anchor.IsZero() {
+		r.anchor = start
+	}
 	r.periodStart = start
 	r.periodEnd = until
 	r.log.Debugf("Updated aggregation range [%s, %s]", start, until)
@@ -148,6 +205,11 @@ func (r *RunningAggregator) Add(m telegraf.Metric) bool {
 	r.Lock()
 	defer r.Unlock()
 
+	if r.Config.Windowed() {
+		r.addWindowed(m)
+		return r.Config.DropOriginal
+	}
+
 	if m.Time().Before(r.periodStart.Add(-r.Config.Grace)) || m.Time().After(r.periodEnd.Add(r.Config.Delay)) {
 		r.log.Debugf("Metric is outside aggregation window; discarding. %s: m: %s e: %s g: %s",
 			m.Time(), r.periodStart, r.periodEnd, r.Config.Grace)
@@ -159,25 +221,193 @@ func (r *RunningAggregator) Add(m telegraf.Metric) bool {
 	return r.Config.DropOriginal
 }
 
+// addWindowed adds the metric to all open windows including its time.
+func (r *RunningAggregator) addWindowed(m telegraf.Metric) {
+	t := m.Time()
+	if r.anchor.IsZero() {
+		r.anchor = t.Truncate(r.Config.Period)
+	}
+	if r.Config.TimeMode == TimeModeEvent && t.After(r.latest) {
+		r.latest = t
+	}
+
+	added := false
+	for _, start := range r.windowStarts(t) {
+		w, ok := r.windows[start.UnixNano()]
+		if !ok {
+			end := start.Add(r.windowLength())
+			if !end.After(r.closed) {
+				// already pushed
+				continue
+			}
+
+			aggregator, err := r.NewAggregator()
+			if err == nil {
+				setLoggerOnPlugin(aggregator, r.log)
+				if p, ok := aggregator.(telegraf.Initializer); ok {
+					err = p.Init()
+				}
+			}
+			if err != nil {
+				r.log.Errorf("Creating aggregator for window [%s, %s) failed: %v", start, end, err)
+				break
+			}
+
+			w = &aggregatorWindow{start: start, end: end, aggregator: aggregator}
+			if r.windows == nil {
+				r.windows = make(map[int64]*aggregatorWindow)
+			}
+			r.windows[start.UnixNano()] = w
+		}
+
+		if added {
+			// aggregators may keep the metric
+			w.aggregator.Add(m.Copy())
+		} else {
+			w.aggregator.Add(m)
+		}
+		added = true
+	}
+
+	if !added {
+		r.log.Debugf("Metric is outside of the open aggregation windows; discarding. %s: closed until %s",
+			t, r.closed)
+		r.MetricsDropped.Incr(1)
+	}
+}
+
+func (r *RunningAggregator) windowLength() time.Duration {
+	if r.Config.Window > r.Config.Period {
+		return r.Config.Window
+	}
+	return r.Config.Period
+}
+
+// windowStarts returns the starts of the windows including t, the windows
+// start every period from the anchor.
+func (r *RunningAggregator) windowStarts(t time.Time) []time.Time {
+	period := r.Config.Period
+	k := t.Sub(r.anchor) / period
+	start := r.anchor.Add(k * period)
+	if start.After(t) {
+		start = start.Add(-period)
+	}
+
+	var starts []time.Time
+	for ; start.Add(r.windowLength()).After(t); start = start.Add(-period) {
+		starts = append(starts, start)
+	}
+	return starts
+}
+
 func (r *RunningAggregator) Push(acc telegraf.Accumulator) {
 	r.Lock()
 	defer r.Unlock()
 
 	since := r.periodEnd
 	until := r.periodEnd.Add(r.Config.Period)
+
+	if r.Config.Windowed() {
+		closed := since
+		if r.Config.TimeMode == TimeModeEvent {
+			closed = r.latest.Add(-r.Config.Watermark)
+		}
+		r.pushWindows(acc, closed)
+		r.UpdateWindow(since, until)
+		return
+	}
+
 	r.UpdateWindow(since, until)
 
-	r.push(acc)
+	r.push(acc, r.Aggregator)
 	r.Aggregator.Reset()
 }
 
-func (r *RunningAggregator) push(acc telegraf.Accumulator) {
+// PushAll pushes the aggregations of all windows, it is called once no more
+// metrics are added.
+func (r *RunningAggregator) PushAll(acc telegraf.Accumulator) {
+	if !r.Config.Windowed() {
+		r.Push(acc)
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	var closed time.Time
+	for _, w := range r.windows {
+		if w.end.After(closed) {
+			closed = w.end
+		}
+	}
+	r.pushWindows(acc, closed)
+}
+
+// pushWindows pushes the windows ending until closed in the order of their
+// ends, later metrics are only added to windows ending after closed.
+func (r *RunningAggregator) pushWindows(acc telegraf.Accumulator, closed time.Time) {
+	var ready []*aggregatorWindow
+	for key, w := range r.windows {
+		if !w.end.After(closed) {
+			ready = append(ready, w)
+			delete(r.windows, key)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		return ready[i].end.Before(ready[j].end)
+	})
+
+	for _, w := range ready {
+		r.log.Debugf("Pushing aggregation window [%s, %s)", w.start, w.end)
+		r.push(&windowAccumulator{Accumulator: acc, end: w.end}, w.aggregator)
+	}
+
+	if closed.After(r.closed) {
+		r.closed = closed
+	}
+}
+
+func (r *RunningAggregator) push(acc telegraf.Accumulator, aggregator telegraf.Aggregator) {
 	start := time.Now()
-	r.Aggregator.Push(acc)
+	aggregator.Push(acc)
 	elapsed := time.Since(start)
 	r.PushTime.Incr(elapsed.Nanoseconds())
 }
 
+// windowAccumulator timestamps the aggregations of a window with the end of
+// the window.
+type windowAccumulator struct {
+	telegraf.Accumulator
+	end time.Time
+}
+
+func (w *windowAccumulator) time(t []time.Time) []time.Time {
+	if len(t) > 0 {
+		return t
+	}
+	return []time.Time{w.end}
+}
+
+func (w *windowAccumulator) AddFields(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	w.Accumulator.AddFields(measurement, fields, tags, w.time(t)...)
+}
+
+func (w *windowAccumulator) AddGauge(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	w.Accumulator.AddGauge(measurement, fields, tags, w.time(t)...)
+}
+
+func (w *windowAccumulator) AddCounter(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	w.Accumulator.AddCounter(measurement, fields, tags, w.time(t)...)
+}
+
+func (w *windowAccumulator) AddSummary(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	w.Accumulator.AddSummary(measurement, fields, tags, w.time(t)...)
+}
+
+func (w *windowAccumulator) AddHistogram(measurement string, fields map[string]interface{}, tags map[string]string, t ...time.Time) {
+	w.Accumulator.AddHistogram(measurement, fields, tags, w.time(t)...)
+}
+
 func (r *RunningAggregator) Log() telegraf.Logger {
 	return r.log
 }
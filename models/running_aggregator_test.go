@@ -238,6 +238,103 @@ func TestAddDoesNotModifyMetric(t *testing.T) {
 	testutil.RequireMetricEqual(t, expected, m)
 }
 
+func newTestAggregator() (telegraf.Aggregator, error) {
+	return &TestAggregator{}, nil
+}
+
+func TestSlidingWindows(t *testing.T) {
+	ra := NewRunningAggregator(&TestAggregator{}, &AggregatorConfig{
+		Name:   "TestRunningAggregator",
+		Period: time.Minute,
+		Window: 3 * time.Minute,
+	})
+	ra.NewAggregator = newTestAggregator
+	require.NoError(t, ra.Init())
+	acc := testutil.Accumulator{}
+
+	start := time.Unix(1600000020, 0)
+	ra.UpdateWindow(start, start.Add(time.Minute))
+	require.Equal(t, start.Add(time.Minute), ra.EndPeriod())
+
+	for i, offset := range []time.Duration{10 * time.Second, 70 * time.Second, 130 * time.Second} {
+		m := testutil.MustMetric("RITest",
+			map[string]string{},
+			map[string]interface{}{"value": int64(1 << uint(i))},
+			start.Add(offset))
+		require.False(t, ra.Add(m))
+	}
+
+	ra.Push(&acc)
+	ra.Push(&acc)
+	ra.Push(&acc)
+	ra.PushAll(&acc)
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric("TestMetric", map[string]string{}, map[string]interface{}{"sum": int64(1)}, start.Add(time.Minute)),
+		testutil.MustMetric("TestMetric", map[string]string{}, map[string]interface{}{"sum": int64(3)}, start.Add(2*time.Minute)),
+		testutil.MustMetric("TestMetric", map[string]string{}, map[string]interface{}{"sum": int64(7)}, start.Add(3*time.Minute)),
+		testutil.MustMetric("TestMetric", map[string]string{}, map[string]interface{}{"sum": int64(6)}, start.Add(4*time.Minute)),
+		testutil.MustMetric("TestMetric", map[string]string{}, map[string]interface{}{"sum": int64(4)}, start.Add(5*time.Minute)),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics())
+}
+
+func TestEventTimeWindows(t *testing.T) {
+	ra := NewRunningAggregator(&TestAggregator{}, &AggregatorConfig{
+		Name:      "TestRunningAggregator",
+		Period:    time.Minute,
+		TimeMode:  TimeModeEvent,
+		Watermark: 30 * time.Second,
+	})
+	ra.NewAggregator = newTestAggregator
+	require.NoError(t, ra.Init())
+	acc := testutil.Accumulator{}
+
+	start := time.Unix(1600000020, 0)
+	ra.UpdateWindow(start, start.Add(time.Minute))
+
+	add := func(offset time.Duration, value int64) {
+		m := testutil.MustMetric("RITest",
+			map[string]string{},
+			map[string]interface{}{"value": value},
+			start.Add(offset))
+		ra.Add(m)
+	}
+
+	add(10*time.Second, 1)
+	add(50*time.Second, 2)
+	// the watermark did not pass the end of the first window yet
+	ra.Push(&acc)
+	require.Empty(t, acc.GetTelegrafMetrics())
+
+	add(100*time.Second, 4)
+	// late, but its window is still open
+	add(40*time.Second, 8)
+	ra.Push(&acc)
+
+	dropped := ra.MetricsDropped.Get()
+	// late for the pushed window
+	add(30*time.Second, 16)
+	require.Equal(t, dropped+1, ra.MetricsDropped.Get())
+
+	ra.PushAll(&acc)
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric("TestMetric", map[string]string{}, map[string]interface{}{"sum": int64(11)}, start.Add(time.Minute)),
+		testutil.MustMetric("TestMetric", map[string]string{}, map[string]interface{}{"sum": int64(4)}, start.Add(2*time.Minute)),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics())
+}
+
+func TestWindowsRequireNewAggregator(t *testing.T) {
+	ra := NewRunningAggregator(&TestAggregator{}, &AggregatorConfig{
+		Name:     "TestRunningAggregator",
+		Period:   time.Minute,
+		TimeMode: TimeModeEvent,
+	})
+	require.Error(t, ra.Init())
+}
+
 type TestAggregator struct {
 	sum int64
 }
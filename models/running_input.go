@@ -1,10 +1,12 @@
 package models
 
 import (
+	"context"
 	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/selfstat"
+	"github.com/robfig/cron/v3"
 )
 
 var (
@@ -21,6 +23,15 @@ type RunningInput struct {
 
 	MetricsGathered selfstat.Stat
 	GatherTime      selfstat.Stat
+	GatherDuration  selfstat.Histogram
+	GatherTimeouts  selfstat.Stat
+	GatherSkipped   selfstat.Stat
+	StartupErrors   selfstat.Stat
+	NextRun         selfstat.Stat
+
+	// UndeliveredBytes are the approximate bytes of the metrics added with
+	// tracking and not delivered yet.
+	UndeliveredBytes selfstat.Stat
 }
 
 func NewRunningInput(input telegraf.Input, config *InputConfig) *RunningInput {
@@ -30,14 +41,17 @@ func NewRunningInput(input telegraf.Input, config *InputConfig) *RunningInput {
 	}
 
 	inputErrorsRegister := selfstat.Register("gather", "errors", tags)
-	logger := NewLogger("inputs", config.Name, config.Alias)
+	logger := NewLogger("inputs", config.Name, config.Alias, config.LogLevel)
 	logger.OnErr(func() {
 		inputErrorsRegister.Incr(1)
 		GlobalGatherErrors.Incr(1)
 	})
+	logger.OnErrClass(func(class string) {
+		selfstat.Register("gather", "errors_"+class, tags).Incr(1)
+	})
 	setLoggerOnPlugin(input, logger)
 
-	return &RunningInput{
+	r := &RunningInput{
 		Input:  input,
 		Config: config,
 		MetricsGathered: selfstat.Register(
@@ -50,17 +64,58 @@ func NewRunningInput(input telegraf.Input, config *InputConfig) *RunningInput {
 			"gather_time_ns",
 			tags,
 		),
+		GatherDuration: selfstat.RegisterHistogram(
+			"gather",
+			"gather_duration_seconds",
+			tags,
+		),
+		GatherTimeouts: selfstat.Register(
+			"gather",
+			"gather_timeouts",
+			tags,
+		),
+		GatherSkipped: selfstat.Register(
+			"gather",
+			"gathers_skipped",
+			tags,
+		),
+		StartupErrors: selfstat.Register(
+			"gather",
+			"startup_errors",
+			tags,
+		),
+		UndeliveredBytes: selfstat.Register(
+			"gather",
+			"undelivered_bytes",
+			tags,
+		),
 		log: logger,
 	}
+	if config.Schedule != nil {
+		r.NextRun = selfstat.Register("gather", "next_run", tags)
+	}
+	return r
 }
 
 // InputConfig is the common config for all inputs.
 type InputConfig struct {
 	Name             string
 	Alias            string
+	LogLevel         string
 	Interval         time.Duration
 	CollectionJitter time.Duration
 	Precision        time.Duration
+	Schedule         cron.Schedule
+	GatherTimeout    time.Duration
+	OverlapPolicy    string
+
+	// IgnoreMaxMemory keeps gathering the input while the memory budget of
+	// the agent is exceeded.
+	IgnoreMaxMemory bool
+
+	// StartupErrorBehavior is "error", "retry" or "ignore", it applies to
+	// the Start of service inputs.
+	StartupErrorBehavior string
 
 	NameOverride      string
 	MeasurementPrefix string
@@ -113,10 +168,22 @@ func (r *RunningInput) MakeMetric(metric telegraf.Metric) telegraf.Metric {
 }
 
 func (r *RunningInput) Gather(acc telegraf.Accumulator) error {
+	return r.GatherContext(context.Background(), acc)
+}
+
+// GatherContext gathers the input, the context is passed to inputs
+// implementing telegraf.ContextInput.
+func (r *RunningInput) GatherContext(ctx context.Context, acc telegraf.Accumulator) error {
 	start := time.Now()
-	err := r.Input.Gather(acc)
+	var err error
+	if ci, ok := r.Input.(telegraf.ContextInput); ok {
+		err = ci.GatherContext(ctx, acc)
+	} else {
+		err = r.Input.Gather(acc)
+	}
 	elapsed := time.Since(start)
 	r.GatherTime.Incr(elapsed.Nanoseconds())
+	r.GatherDuration.ObserveDuration(elapsed)
 	return err
 }
 
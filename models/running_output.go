@@ -19,18 +19,45 @@ const (
 
 // OutputConfig containing name and filter
 type OutputConfig struct {
-	Name   string
-	Alias  string
-	Filter Filter
+	Name     string
+	Alias    string
+	LogLevel string
+	Filter   Filter
 
 	FlushInterval     time.Duration
 	FlushJitter       time.Duration
 	MetricBufferLimit int
 	MetricBatchSize   int
 
+	// StartupErrorBehavior is "error", "retry" or "ignore", it applies to
+	// the first Connect.
+	StartupErrorBehavior string
+
 	NameOverride string
 	NamePrefix   string
 	NameSuffix   string
+
+	// RouteTag is the tag routing the metrics to one instance of the output
+	// per tag value, instances without metrics for RouteIdleTimeout are
+	// closed.  At most MaxRoutes instances run, if not zero.  RouteValue is
+	// the tag value of an instance.
+	RouteTag         string
+	RouteIdleTimeout time.Duration
+	MaxRoutes        int
+	RouteValue       string
+}
+
+// logAlias returns the alias of the output in the logs, including the routing
+// tag value of routed instances.
+func (c *OutputConfig) logAlias() string {
+	if c.RouteTag == "" {
+		return c.Alias
+	}
+	route := c.RouteTag + "=" + c.RouteValue
+	if c.Alias == "" {
+		return route
+	}
+	return c.Alias + "," + route
 }
 
 // RunningOutput contains the output configuration
@@ -46,11 +73,14 @@ type RunningOutput struct {
 
 	MetricsFiltered selfstat.Stat
 	WriteTime       selfstat.Stat
+	WriteDuration   selfstat.Histogram
+	StartupErrors   selfstat.Stat
 
 	BatchReady chan time.Time
 
 	buffer *Buffer
 	log    telegraf.Logger
+	tags   map[string]string
 
 	aggMutex sync.Mutex
 }
@@ -66,12 +96,18 @@ func NewRunningOutput(
 	if config.Alias != "" {
 		tags["alias"] = config.Alias
 	}
+	if config.RouteTag != "" {
+		tags["route"] = config.RouteValue
+	}
 
 	writeErrorsRegister := selfstat.Register("write", "errors", tags)
-	logger := NewLogger("outputs", config.Name, config.Alias)
+	logger := NewLogger("outputs", config.Name, config.logAlias(), config.LogLevel)
 	logger.OnErr(func() {
 		writeErrorsRegister.Incr(1)
 	})
+	logger.OnErrClass(func(class string) {
+		selfstat.Register("write", "errors_"+class, tags).Incr(1)
+	})
 	setLoggerOnPlugin(output, logger)
 
 	if config.MetricBufferLimit > 0 {
@@ -88,7 +124,7 @@ func NewRunningOutput(
 	}
 
 	ro := &RunningOutput{
-		buffer:            NewBuffer(config.Name, config.Alias, bufferLimit),
+		buffer:            newBuffer(tags, bufferLimit),
 		BatchReady:        make(chan time.Time, 1),
 		Output:            output,
 		Config:            config,
@@ -104,14 +140,25 @@ func NewRunningOutput(
 			"write_time_ns",
 			tags,
 		),
-		log: logger,
+		WriteDuration: selfstat.RegisterHistogram(
+			"write",
+			"write_duration_seconds",
+			tags,
+		),
+		StartupErrors: selfstat.Register(
+			"write",
+			"startup_errors",
+			tags,
+		),
+		log:  logger,
+		tags: tags,
 	}
 
 	return ro
 }
 
 func (r *RunningOutput) LogName() string {
-	return logName("outputs", r.Config.Name, r.Config.Alias)
+	return logName("outputs", r.Config.Name, r.Config.logAlias())
 }
 
 func (ro *RunningOutput) metricFiltered(metric telegraf.Metric) {
@@ -235,6 +282,11 @@ func (r *RunningOutput) Close() {
 	}
 }
 
+// Unregister removes the internal statistics of the output.
+func (r *RunningOutput) Unregister() {
+	selfstat.Unregister("write", r.tags)
+}
+
 func (r *RunningOutput) write(metrics []telegraf.Metric) error {
 	dropped := atomic.LoadInt64(&r.droppedMetrics)
 	if dropped > 0 {
@@ -246,6 +298,7 @@ func (r *RunningOutput) write(metrics []telegraf.Metric) error {
 	err := r.Output.Write(metrics)
 	elapsed := time.Since(start)
 	r.WriteTime.Incr(elapsed.Nanoseconds())
+	r.WriteDuration.ObserveDuration(elapsed)
 
 	if err == nil {
 		r.log.Debugf("Wrote batch of %d metrics in %s", len(metrics), elapsed)
@@ -265,3 +318,11 @@ func (r *RunningOutput) Log() telegraf.Logger {
 func (r *RunningOutput) BufferLength() int {
 	return r.buffer.Len()
 }
+
+// DropBuffer drops the metrics left in the buffer of an output that is no
+// longer flushed, releasing their memory.
+func (r *RunningOutput) DropBuffer() {
+	if dropped := r.buffer.Drop(); dropped != 0 {
+		r.log.Warnf("Dropped %d unsent metrics", dropped)
+	}
+}
@@ -488,14 +488,18 @@ func TestInternalMetrics(t *testing.T) {
 				"alias":  "test_alias",
 			},
 			map[string]interface{}{
-				"buffer_limit":     10,
-				"buffer_size":      0,
-				"errors":           0,
-				"metrics_added":    0,
-				"metrics_dropped":  0,
-				"metrics_filtered": 0,
-				"metrics_written":  0,
-				"write_time_ns":    0,
+				"buffer_bytes":                 0,
+				"buffer_limit":                 10,
+				"buffer_size":                  0,
+				"errors":                       0,
+				"metrics_added":                0,
+				"metrics_dropped":              0,
+				"metrics_filtered":             0,
+				"metrics_written":              0,
+				"startup_errors":               0,
+				"write_time_ns":                0,
+				"write_duration_seconds_count": 0,
+				"write_duration_seconds_sum":   0.0,
 			},
 			time.Unix(0, 0),
 		),
@@ -22,10 +22,11 @@ func (rp RunningProcessors) Less(i, j int) bool { return rp[i].Config.Order < rp
 
 // FilterConfig containing a name and filter
 type ProcessorConfig struct {
-	Name   string
-	Alias  string
-	Order  int64
-	Filter Filter
+	Name     string
+	Alias    string
+	LogLevel string
+	Order    int64
+	Filter   Filter
 }
 
 func NewRunningProcessor(processor telegraf.StreamingProcessor, config *ProcessorConfig) *RunningProcessor {
@@ -35,10 +36,13 @@ func NewRunningProcessor(processor telegraf.StreamingProcessor, config *Processo
 	}
 
 	processErrorsRegister := selfstat.Register("process", "errors", tags)
-	logger := NewLogger("processors", config.Name, config.Alias)
+	logger := NewLogger("processors", config.Name, config.Alias, config.LogLevel)
 	logger.OnErr(func() {
 		processErrorsRegister.Incr(1)
 	})
+	logger.OnErrClass(func(class string) {
+		selfstat.Register("process", "errors_"+class, tags).Incr(1)
+	})
 	setLoggerOnPlugin(processor, logger)
 
 	return &RunningProcessor{
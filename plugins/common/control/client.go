@@ -0,0 +1,266 @@
+package control
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/internal/process"
+)
+
+// Config are the control channel options of the execd plugins.
+type Config struct {
+	ControlChannel    bool            `toml:"control_channel"`
+	HeartbeatInterval config.Duration `toml:"heartbeat_interval"`
+	HeartbeatTimeout  config.Duration `toml:"heartbeat_timeout"`
+	PluginConfig      string          `toml:"plugin_config"`
+}
+
+// Validate checks the options and sets the default heartbeat timeout of
+// three heartbeat intervals.
+func (c *Config) Validate() error {
+	if !c.ControlChannel {
+		if c.HeartbeatInterval != 0 || c.HeartbeatTimeout != 0 || c.PluginConfig != "" {
+			return errors.New("heartbeat_interval, heartbeat_timeout and plugin_config require control_channel")
+		}
+		return nil
+	}
+
+	if c.HeartbeatInterval < 0 || c.HeartbeatTimeout < 0 {
+		return errors.New("heartbeat_interval and heartbeat_timeout must not be negative")
+	}
+	if c.HeartbeatTimeout != 0 && c.HeartbeatInterval == 0 {
+		return errors.New("heartbeat_timeout requires heartbeat_interval")
+	}
+	if c.HeartbeatTimeout == 0 {
+		c.HeartbeatTimeout = 3 * c.HeartbeatInterval
+	}
+	if c.HeartbeatTimeout < c.HeartbeatInterval {
+		return errors.New("heartbeat_timeout must not be shorter than heartbeat_interval")
+	}
+	return nil
+}
+
+var errProcessExited = errors.New("process exited")
+
+// Client is the Telegraf side of the control channel.  Serve handles the
+// channel of each started process.
+type Client struct {
+	Config
+	Log telegraf.Logger
+
+	// OnError is called with the errors reported by the process.
+	OnError func(error)
+	// Kill terminates the process when the channel breaks or the process
+	// misses its heartbeats.
+	Kill func() error
+
+	mu       sync.Mutex
+	conn     *Conn
+	ready    chan struct{} // closed while conn is set
+	lastSeen time.Time
+	nextID   uint64
+	pending  map[uint64]chan error
+}
+
+// NewClient returns a client with the validated config.
+func NewClient(cfg Config, log telegraf.Logger) *Client {
+	return &Client{
+		Config:  cfg,
+		Log:     log,
+		OnError: func(err error) { log.Error(err) },
+		Kill:    func() error { return nil },
+		ready:   make(chan struct{}),
+		pending: make(map[uint64]chan error),
+	}
+}
+
+// Attach serves the control channel of the process.
+func (c *Client) Attach(p *process.Process) {
+	p.Env = append(p.Env, EnvVar+"=1")
+	p.ControlFn = c.Serve
+	c.Kill = p.Kill
+}
+
+// Serve handles the control channel of one process until the process closes
+// it.  The configuration is sent first.
+func (c *Client) Serve(r io.Reader, w io.Writer) {
+	conn := NewConn(r, w)
+
+	// writes wait for the config to be sent first
+	conn.mu.Lock()
+	c.mu.Lock()
+	c.conn = conn
+	c.lastSeen = time.Now()
+	close(c.ready)
+	c.mu.Unlock()
+	err := WriteMessage(w, &Message{Type: TypeConfig, Config: c.PluginConfig})
+	conn.mu.Unlock()
+	if err != nil && !errors.Is(err, os.ErrClosed) {
+		c.Log.Errorf("Sending config to process failed: %v", err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	if c.HeartbeatInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.heartbeat(conn, done)
+		}()
+	}
+
+	for {
+		m, err := conn.Receive()
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, os.ErrClosed) {
+				c.Log.Errorf("Reading control channel failed, restarting process: %v", err)
+				c.kill()
+			}
+			break
+		}
+		c.handle(m)
+	}
+
+	close(done)
+	wg.Wait()
+
+	c.mu.Lock()
+	c.conn = nil
+	c.ready = make(chan struct{})
+	for id, ch := range c.pending {
+		ch <- errProcessExited
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+}
+
+func (c *Client) handle(m *Message) {
+	c.mu.Lock()
+	c.lastSeen = time.Now()
+	c.mu.Unlock()
+
+	switch m.Type {
+	case TypeAck:
+		c.mu.Lock()
+		ch, ok := c.pending[m.ID]
+		delete(c.pending, m.ID)
+		c.mu.Unlock()
+		if !ok {
+			c.Log.Debugf("Ignoring acknowledgement of unknown batch %d", m.ID)
+			return
+		}
+		if m.Error != "" {
+			ch <- fmt.Errorf("batch rejected by process: %s", m.Error)
+			return
+		}
+		ch <- nil
+	case TypeLog:
+		switch m.Level {
+		case "E":
+			c.Log.Error(m.Message)
+		case "W":
+			c.Log.Warn(m.Message)
+		case "D":
+			c.Log.Debug(m.Message)
+		default:
+			c.Log.Info(m.Message)
+		}
+	case TypeError:
+		c.OnError(errors.New(m.Error))
+	case TypePong:
+	default:
+		c.Log.Debugf("Ignoring control message of unknown type %q", m.Type)
+	}
+}
+
+// heartbeat pings the process and kills it if it did not send any message
+// within the heartbeat timeout.
+func (c *Client) heartbeat(conn *Conn, done chan struct{}) {
+	interval := time.Duration(c.HeartbeatInterval)
+	timeout := time.Duration(c.HeartbeatTimeout)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		silent := time.Since(c.lastSeen)
+		c.nextID++
+		id := c.nextID
+		c.mu.Unlock()
+
+		if silent > timeout {
+			c.Log.Errorf("No heartbeat from process for %s, restarting it", silent.Round(time.Millisecond))
+			c.kill()
+			return
+		}
+
+		if err := conn.SendTimeout(&Message{Type: TypePing, ID: id}, interval); err != nil {
+			c.Log.Errorf("Sending ping failed, restarting process: %v", err)
+			c.kill()
+			return
+		}
+	}
+}
+
+func (c *Client) kill() {
+	if err := c.Kill(); err != nil {
+		c.Log.Errorf("Killing process failed: %v", err)
+	}
+}
+
+// Write sends a batch of serialized metrics and waits until the process
+// acknowledges it.  An error is returned if the process rejects the batch or
+// does not start and acknowledge it within the timeout.
+func (c *Client) Write(data []byte, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	c.mu.Lock()
+	for c.conn == nil {
+		ready := c.ready
+		c.mu.Unlock()
+		select {
+		case <-ready:
+		case <-timer.C:
+			return errors.New("process is not running")
+		}
+		c.mu.Lock()
+	}
+	conn := c.conn
+	c.nextID++
+	id := c.nextID
+	ch := make(chan error, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := conn.SendTimeout(&Message{Type: TypeWrite, ID: id, Data: string(data)}, timeout); err != nil {
+		// A partially written message breaks the framing of the channel.
+		c.kill()
+		return fmt.Errorf("sending batch failed, restarting process: %w", err)
+	}
+
+	select {
+	case err := <-ch:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("batch not acknowledged within %s", timeout)
+	}
+}
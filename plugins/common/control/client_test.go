@@ -0,0 +1,213 @@
+package control
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf/config"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	sent := []*Message{
+		{Type: TypeConfig, Config: "[[inputs.cpu]]\n"},
+		{Type: TypeAck, ID: 42, Error: "rejected"},
+	}
+	for _, m := range sent {
+		require.NoError(t, WriteMessage(&buf, m))
+	}
+
+	for _, expected := range sent {
+		m, err := ReadMessage(&buf)
+		require.NoError(t, err)
+		require.Equal(t, expected, m)
+	}
+	_, err := ReadMessage(&buf)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, MaxMessageSize+1)
+	_, err := ReadMessage(bytes.NewReader(header))
+	require.Error(t, err)
+
+	binary.BigEndian.PutUint32(header, 10)
+	_, err = ReadMessage(bytes.NewReader(append(header, '{')))
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, err = ReadMessage(bytes.NewReader(append(header, []byte("not json!!")...)))
+	require.Error(t, err)
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := Config{HeartbeatInterval: config.Duration(time.Second)}
+	require.Error(t, cfg.Validate())
+
+	cfg.ControlChannel = true
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, config.Duration(3*time.Second), cfg.HeartbeatTimeout)
+
+	cfg.HeartbeatTimeout = config.Duration(time.Millisecond)
+	require.Error(t, cfg.Validate())
+
+	cfg = Config{ControlChannel: true, HeartbeatTimeout: config.Duration(time.Second)}
+	require.Error(t, cfg.Validate())
+}
+
+// testProcess is the process side of a control channel served by a client.
+type testProcess struct {
+	conn   *Conn
+	toProc *io.PipeWriter
+	toTel  *io.PipeWriter
+	served chan struct{}
+}
+
+func startProcess(t *testing.T, c *Client) *testProcess {
+	procR, telW := io.Pipe()
+	telR, procW := io.Pipe()
+
+	p := &testProcess{
+		conn:   NewConn(procR, procW),
+		toProc: telW,
+		toTel:  procW,
+		served: make(chan struct{}),
+	}
+	go func() {
+		c.Serve(telR, telW)
+		close(p.served)
+	}()
+
+	m, err := p.conn.Receive()
+	require.NoError(t, err)
+	require.Equal(t, TypeConfig, m.Type)
+	require.Equal(t, c.PluginConfig, m.Config)
+	return p
+}
+
+// exit closes the channel like an exiting process.
+func (p *testProcess) exit() {
+	p.toTel.Close()
+	<-p.served
+	p.toProc.Close()
+}
+
+func TestClientWrite(t *testing.T) {
+	c := NewClient(Config{ControlChannel: true, PluginConfig: "[[outputs.file]]"}, testutil.Logger{})
+	require.Error(t, c.Write([]byte("cpu value=1\n"), 10*time.Millisecond))
+
+	p := startProcess(t, c)
+	defer p.exit()
+
+	go func() {
+		for i := 0; i < 2; i++ {
+			m, err := p.conn.Receive()
+			if err != nil {
+				return
+			}
+			ack := &Message{Type: TypeAck, ID: m.ID}
+			if strings.Contains(m.Data, "reject") {
+				ack.Error = "invalid metric"
+			}
+			p.conn.Send(ack)
+		}
+	}()
+
+	require.NoError(t, c.Write([]byte("cpu value=1\n"), time.Second))
+	err := c.Write([]byte("reject value=1\n"), time.Second)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid metric")
+}
+
+func TestClientWriteProcessExit(t *testing.T) {
+	c := NewClient(Config{ControlChannel: true}, testutil.Logger{})
+	p := startProcess(t, c)
+
+	go func() {
+		p.conn.Receive()
+		p.exit()
+	}()
+
+	err := c.Write([]byte("cpu value=1\n"), 10*time.Second)
+	require.Equal(t, errProcessExited, err)
+}
+
+func TestClientWriteTimeout(t *testing.T) {
+	c := NewClient(Config{ControlChannel: true}, testutil.Logger{})
+	p := startProcess(t, c)
+	defer p.exit()
+
+	go p.conn.Receive()
+
+	err := c.Write([]byte("cpu value=1\n"), 10*time.Millisecond)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not acknowledged")
+}
+
+func TestClientErrors(t *testing.T) {
+	var mu sync.Mutex
+	var errs []string
+
+	c := NewClient(Config{ControlChannel: true}, testutil.Logger{})
+	c.OnError = func(err error) {
+		mu.Lock()
+		errs = append(errs, err.Error())
+		mu.Unlock()
+	}
+	p := startProcess(t, c)
+
+	require.NoError(t, p.conn.Send(&Message{Type: TypeLog, Level: "E", Message: "logged"}))
+	require.NoError(t, p.conn.Send(&Message{Type: TypeError, Error: "failed to gather metrics"}))
+	p.exit()
+
+	require.Equal(t, []string{"failed to gather metrics"}, errs)
+}
+
+func TestClientHeartbeat(t *testing.T) {
+	killed := make(chan struct{})
+	c := NewClient(Config{
+		ControlChannel:    true,
+		HeartbeatInterval: config.Duration(10 * time.Millisecond),
+		HeartbeatTimeout:  config.Duration(50 * time.Millisecond),
+	}, testutil.Logger{})
+	c.Kill = func() error {
+		close(killed)
+		return nil
+	}
+	p := startProcess(t, c)
+	defer p.exit()
+
+	// Answering the pings keeps the process alive.
+	for i := 0; i < 10; i++ {
+		m, err := p.conn.Receive()
+		require.NoError(t, err)
+		require.Equal(t, TypePing, m.Type)
+		require.NoError(t, p.conn.Send(&Message{Type: TypePong, ID: m.ID}))
+	}
+	select {
+	case <-killed:
+		require.FailNow(t, "process killed while answering pings")
+	default:
+	}
+
+	// A silent process is killed.
+	go func() {
+		for {
+			if _, err := p.conn.Receive(); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-killed:
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "silent process not killed")
+	}
+}
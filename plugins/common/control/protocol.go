@@ -0,0 +1,149 @@
+// Package control implements the optional control channel between the execd
+// plugins and their processes.
+//
+// The channel consists of two pipes passed to the process as the file
+// descriptors 3 (Telegraf to process) and 4 (process to Telegraf).  Each
+// message is a JSON object prefixed by its length as a 4 byte big-endian
+// unsigned integer.
+package control
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// EnvVar is set to "1" in the environment of processes with a control
+// channel.
+const EnvVar = "TELEGRAF_EXECD_CONTROL"
+
+// File descriptors of the control channel in the process.
+const (
+	ReadFd  = 3
+	WriteFd = 4
+)
+
+// MaxMessageSize is the largest accepted message in bytes.
+const MaxMessageSize = 64 * 1024 * 1024
+
+// Message types.
+const (
+	// TypeConfig is sent by Telegraf once after the process started, with
+	// the configuration of the plugin in Config.  The config is empty if
+	// the plugin_config option is not set.
+	TypeConfig = "config"
+	// TypeWrite is sent by outputs.execd with a batch of serialized metrics
+	// in Data.
+	TypeWrite = "write"
+	// TypeAck is the reply of the process to a write with the same ID.  A
+	// non-empty Error rejects the batch.
+	TypeAck = "ack"
+	// TypePing is sent by Telegraf on every heartbeat.
+	TypePing = "ping"
+	// TypePong is the reply of the process to a ping with the same ID.
+	TypePong = "pong"
+	// TypeLog is a log message of the process with Level and Message.
+	TypeLog = "log"
+	// TypeError is an error of the process in Error.
+	TypeError = "error"
+)
+
+// Message is a frame of the control channel, only the fields of its Type are
+// set.
+type Message struct {
+	Type    string `json:"type"`
+	ID      uint64 `json:"id,omitempty"`
+	Level   string `json:"level,omitempty"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Data    string `json:"data,omitempty"`
+	Config  string `json:"config,omitempty"`
+}
+
+// WriteMessage writes the framed message.
+func WriteMessage(w io.Writer, m *Message) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if len(body) > MaxMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds the maximum of %d bytes", len(body), MaxMessageSize)
+	}
+
+	buf := make([]byte, 4+len(body))
+	binary.BigEndian.PutUint32(buf, uint32(len(body)))
+	copy(buf[4:], body)
+	_, err = w.Write(buf)
+	return err
+}
+
+// ReadMessage reads the next framed message.  io.EOF is returned if the
+// channel is closed between messages.
+func ReadMessage(r io.Reader) (*Message, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the maximum of %d bytes", size, MaxMessageSize)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	m := &Message{}
+	if err := json.Unmarshal(body, m); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	return m, nil
+}
+
+// Conn is a control channel safe for concurrent senders.
+type Conn struct {
+	r io.Reader
+	w io.Writer
+
+	mu sync.Mutex
+}
+
+// NewConn returns a control channel reading messages from r and writing
+// messages to w.
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{r: r, w: w}
+}
+
+// Send writes a message.
+func (c *Conn) Send(m *Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return WriteMessage(c.w, m)
+}
+
+// SendTimeout writes a message, failing after the timeout if the writer
+// supports deadlines such as pipes.
+func (c *Conn) SendTimeout(m *Message, timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if d, ok := c.w.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		if err := d.SetWriteDeadline(time.Now().Add(timeout)); err == nil {
+			defer d.SetWriteDeadline(time.Time{})
+		}
+	}
+	return WriteMessage(c.w, m)
+}
+
+// Receive reads the next message, it must not be called concurrently.
+func (c *Conn) Receive() (*Message, error) {
+	return ReadMessage(c.r)
+}
@@ -0,0 +1,94 @@
+// Package mqtttest provides an MQTT v5 server for the tests of the MQTT
+// plugins.
+package mqtttest
+
+import (
+	"net"
+	"testing"
+
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/stretchr/testify/require"
+)
+
+// Broker is a minimal MQTT v5 server accepting a single client.  It sends the
+// connect packet of the client to Connect, publishes the messages given to
+// NewBroker to the client once it has subscribed, and acknowledges and sends
+// the packets published by the client to Published.
+type Broker struct {
+	Connect   chan *packets.Connect
+	Published chan *packets.ControlPacket
+
+	listener net.Listener
+	publish  []*packets.Publish
+}
+
+// NewBroker starts a broker listening on a random local port.
+func NewBroker(t *testing.T, publish ...*packets.Publish) *Broker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	b := &Broker{
+		Connect:   make(chan *packets.Connect, 1),
+		Published: make(chan *packets.ControlPacket, 10),
+		listener:  listener,
+		publish:   publish,
+	}
+	go b.serve()
+	return b
+}
+
+// Addr returns the address the broker listens on.
+func (b *Broker) Addr() string {
+	return b.listener.Addr().String()
+}
+
+// Close stops the broker from accepting the client.
+func (b *Broker) Close() {
+	b.listener.Close()
+}
+
+func (b *Broker) serve() {
+	conn, err := b.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	for {
+		p, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		switch content := p.Content.(type) {
+		case *packets.Connect:
+			b.Connect <- content
+			packets.NewControlPacket(packets.CONNACK).WriteTo(conn)
+		case *packets.Subscribe:
+			ack := packets.NewControlPacket(packets.SUBACK)
+			suback := ack.Content.(*packets.Suback)
+			suback.PacketID = content.PacketID
+			for range content.Subscriptions {
+				suback.Reasons = append(suback.Reasons, packets.SubackGrantedQoS0)
+			}
+			ack.WriteTo(conn)
+
+			for _, publish := range b.publish {
+				p := packets.NewControlPacket(packets.PUBLISH)
+				p.Content = publish
+				p.WriteTo(conn)
+			}
+		case *packets.Publish:
+			b.Published <- p
+			if content.QoS == 1 {
+				ack := packets.NewControlPacket(packets.PUBACK)
+				ack.Content.(*packets.Puback).PacketID = content.PacketID
+				ack.WriteTo(conn)
+			}
+		case *packets.Pingreq:
+			packets.NewControlPacket(packets.PINGRESP).WriteTo(conn)
+		case *packets.Disconnect:
+			return
+		}
+	}
+}
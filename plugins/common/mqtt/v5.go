@@ -0,0 +1,142 @@
+// Package mqtt contains the MQTT v5 connection handling shared by the MQTT
+// plugins.
+package mqtt
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// Dial connects to the first reachable server.  The "tcp" and "ssl" schemes
+// are supported, along with their "mqtt" and "mqtts" aliases.
+func Dial(servers []*url.URL, tlsConfig *tls.Config, timeout time.Duration) (net.Conn, error) {
+	if len(servers) == 0 {
+		return nil, errors.New("no servers")
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var lastErr error
+	for _, server := range servers {
+		var conn net.Conn
+		var err error
+		switch server.Scheme {
+		case "tcp", "mqtt":
+			conn, err = dialer.Dial("tcp", server.Host)
+		case "ssl", "tls", "tcps", "mqtts":
+			conn, err = tls.DialWithDialer(dialer, "tcp", server.Host, tlsConfig)
+		default:
+			err = fmt.Errorf("unsupported scheme %q for MQTT v5", server.Scheme)
+		}
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// NewV5Client returns a MQTT v5 client using the connection.  The timeout
+// applies to every request to the server.
+func NewV5Client(conn net.Conn, timeout time.Duration) *paho.Client {
+	client := paho.NewClient()
+	client.Conn = conn
+	client.PingHandler = NewPinger(client.Error)
+	if timeout > 0 {
+		client.PacketTimeout = timeout
+	}
+	return client
+}
+
+// Conn calls onLost once when reading from the connection fails, unless
+// Disconnecting was called before.  The v5 client has no notification of
+// the connection loss.
+type Conn struct {
+	net.Conn
+	onLost func(error)
+
+	once          sync.Once
+	mu            sync.Mutex
+	disconnecting bool
+}
+
+func NewConn(conn net.Conn, onLost func(error)) *Conn {
+	return &Conn{Conn: conn, onLost: onLost}
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		c.mu.Lock()
+		disconnecting := c.disconnecting
+		c.mu.Unlock()
+		if !disconnecting && c.onLost != nil {
+			c.once.Do(func() { c.onLost(err) })
+		}
+	}
+	return n, err
+}
+
+// Disconnecting marks the connection as closed on purpose.
+func (c *Conn) Disconnecting() {
+	c.mu.Lock()
+	c.disconnecting = true
+	c.mu.Unlock()
+}
+
+// Pinger keeps the connection alive.  Unlike the default pinger of the
+// client it can be stopped before it is started.
+type Pinger struct {
+	onError     func(error)
+	stop        chan struct{}
+	once        sync.Once
+	outstanding int32
+}
+
+func NewPinger(onError func(error)) *Pinger {
+	return &Pinger{
+		onError: onError,
+		stop:    make(chan struct{}),
+	}
+}
+
+func (p *Pinger) Start(conn net.Conn, keepAlive time.Duration) {
+	if keepAlive <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			if atomic.LoadInt32(&p.outstanding) > 0 {
+				p.onError(errors.New("ping response timed out"))
+				return
+			}
+			atomic.StoreInt32(&p.outstanding, 1)
+			if _, err := packets.NewControlPacket(packets.PINGREQ).WriteTo(conn); err != nil {
+				p.onError(err)
+				return
+			}
+		}
+	}
+}
+
+func (p *Pinger) Stop() {
+	p.once.Do(func() { close(p.stop) })
+}
+
+func (p *Pinger) PingResp() {
+	atomic.StoreInt32(&p.outstanding, 0)
+}
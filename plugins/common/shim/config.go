@@ -6,6 +6,9 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/influxdata/telegraf"
@@ -21,9 +24,28 @@ type config struct {
 }
 
 type loadedConfig struct {
-	Input     telegraf.Input
+	Inputs     []loadedInput
+	Processors []loadedProcessor
+	Outputs    []loadedOutput
+}
+
+type loadedInput struct {
+	Name     string
+	Input    telegraf.Input
+	Interval time.Duration
+	position int
+}
+
+type loadedProcessor struct {
+	Name      string
 	Processor telegraf.StreamingProcessor
-	Output    telegraf.Output
+	position  int
+}
+
+type loadedOutput struct {
+	Name     string
+	Output   telegraf.Output
+	position int
 }
 
 // LoadConfig Adds plugins to the shim
@@ -32,17 +54,23 @@ func (s *Shim) LoadConfig(filePath *string) error {
 	if err != nil {
 		return err
 	}
-	if conf.Input != nil {
-		if err = s.AddInput(conf.Input); err != nil {
-			return fmt.Errorf("Failed to add Input: %w", err)
+	return s.addConfig(conf)
+}
+
+func (s *Shim) addConfig(conf loadedConfig) error {
+	for _, in := range conf.Inputs {
+		if err := s.addInput(in.Name, in.Input, in.Interval); err != nil {
+			return fmt.Errorf("Failed to add Input %s: %w", in.Name, err)
 		}
-	} else if conf.Processor != nil {
-		if err = s.AddStreamingProcessor(conf.Processor); err != nil {
-			return fmt.Errorf("Failed to add Processor: %w", err)
+	}
+	for _, p := range conf.Processors {
+		if err := s.addStreamingProcessor(p.Name, p.Processor); err != nil {
+			return fmt.Errorf("Failed to add Processor %s: %w", p.Name, err)
 		}
-	} else if conf.Output != nil {
-		if err = s.AddOutput(conf.Output); err != nil {
-			return fmt.Errorf("Failed to add Output: %w", err)
+	}
+	for _, o := range conf.Outputs {
+		if err := s.addOutput(o.Name, o.Output); err != nil {
+			return fmt.Errorf("Failed to add Output %s: %w", o.Name, err)
 		}
 	}
 	return nil
@@ -76,6 +104,17 @@ func LoadConfig(filePath *string) (loaded loadedConfig, err error) {
 	return createPluginsWithTomlConfig(md, conf)
 }
 
+// loadConfigData loads the config handed over by Telegraf.
+func loadConfigData(data string) (loadedConfig, error) {
+	conf := config{}
+	md, err := toml.Decode(expandEnvVars([]byte(data)), &conf)
+	if err != nil {
+		return loadedConfig{}, err
+	}
+
+	return createPluginsWithTomlConfig(md, conf)
+}
+
 func expandEnvVars(contents []byte) string {
 	return os.Expand(string(contents), getEnv)
 }
@@ -86,8 +125,16 @@ func getEnv(key string) string {
 	return envVarEscaper.Replace(v)
 }
 
+// inputOptions are the options of the input tables handled by the shim.
+type inputOptions struct {
+	Interval string `toml:"interval"`
+}
+
+// createPluginsWithTomlConfig creates the plugins of every table, in the
+// order of the tables.  Unknown plugins and options are an error.
 func createPluginsWithTomlConfig(md toml.MetaData, conf config) (loadedConfig, error) {
 	loadedConf := loadedConfig{}
+	order := tableOrder(md)
 
 	for name, primitives := range conf.Inputs {
 		creator, ok := inputs.Inputs[name]
@@ -95,16 +142,35 @@ func createPluginsWithTomlConfig(md toml.MetaData, conf config) (loadedConfig, e
 			return loadedConf, errors.New("unknown input " + name)
 		}
 
-		plugin := creator()
-		if len(primitives) > 0 {
-			primitive := primitives[0]
+		if len(primitives) == 0 {
+			loadedConf.Inputs = append(loadedConf.Inputs, loadedInput{Name: name, Input: creator()})
+			continue
+		}
+		for i, primitive := range primitives {
+			var opts inputOptions
+			if err := md.PrimitiveDecode(primitive, &opts); err != nil {
+				return loadedConf, fmt.Errorf("input %s: %w", name, err)
+			}
+			var interval time.Duration
+			if opts.Interval != "" {
+				var err error
+				interval, err = time.ParseDuration(opts.Interval)
+				if err != nil || interval <= 0 {
+					return loadedConf, fmt.Errorf("input %s: invalid interval %q", name, opts.Interval)
+				}
+			}
+
+			plugin := creator()
 			if err := md.PrimitiveDecode(primitive, plugin); err != nil {
-				return loadedConf, err
+				return loadedConf, fmt.Errorf("input %s: %w", name, err)
 			}
+			loadedConf.Inputs = append(loadedConf.Inputs, loadedInput{
+				Name:     name,
+				Input:    plugin,
+				Interval: interval,
+				position: order.position("inputs", name, i),
+			})
 		}
-
-		loadedConf.Input = plugin
-		break
 	}
 
 	for name, primitives := range conf.Processors {
@@ -113,15 +179,21 @@ func createPluginsWithTomlConfig(md toml.MetaData, conf config) (loadedConfig, e
 			return loadedConf, errors.New("unknown processor " + name)
 		}
 
-		plugin := creator()
-		if len(primitives) > 0 {
-			primitive := primitives[0]
+		if len(primitives) == 0 {
+			loadedConf.Processors = append(loadedConf.Processors, loadedProcessor{Name: name, Processor: creator()})
+			continue
+		}
+		for i, primitive := range primitives {
+			plugin := creator()
 			if err := md.PrimitiveDecode(primitive, plugin); err != nil {
-				return loadedConf, err
+				return loadedConf, fmt.Errorf("processor %s: %w", name, err)
 			}
+			loadedConf.Processors = append(loadedConf.Processors, loadedProcessor{
+				Name:      name,
+				Processor: plugin,
+				position:  order.position("processors", name, i),
+			})
 		}
-		loadedConf.Processor = plugin
-		break
 	}
 
 	for name, primitives := range conf.Outputs {
@@ -130,19 +202,74 @@ func createPluginsWithTomlConfig(md toml.MetaData, conf config) (loadedConfig, e
 			return loadedConf, errors.New("unknown output " + name)
 		}
 
-		plugin := creator()
-		if len(primitives) > 0 {
-			primitive := primitives[0]
+		if len(primitives) == 0 {
+			loadedConf.Outputs = append(loadedConf.Outputs, loadedOutput{Name: name, Output: creator()})
+			continue
+		}
+		for i, primitive := range primitives {
+			plugin := creator()
 			if err := md.PrimitiveDecode(primitive, plugin); err != nil {
-				return loadedConf, err
+				return loadedConf, fmt.Errorf("output %s: %w", name, err)
 			}
+			loadedConf.Outputs = append(loadedConf.Outputs, loadedOutput{
+				Name:     name,
+				Output:   plugin,
+				position: order.position("outputs", name, i),
+			})
 		}
-		loadedConf.Output = plugin
-		break
 	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, key := range undecoded {
+			keys = append(keys, key.String())
+		}
+		return loadedConf, fmt.Errorf("unknown options: %s", strings.Join(keys, ", "))
+	}
+
+	if err := checkPlugins(len(loadedConf.Inputs), len(loadedConf.Processors), len(loadedConf.Outputs)); err != nil {
+		return loadedConf, err
+	}
+
+	sort.SliceStable(loadedConf.Inputs, func(i, j int) bool {
+		return loadedConf.Inputs[i].position < loadedConf.Inputs[j].position
+	})
+	sort.SliceStable(loadedConf.Processors, func(i, j int) bool {
+		return loadedConf.Processors[i].position < loadedConf.Processors[j].position
+	})
+	sort.SliceStable(loadedConf.Outputs, func(i, j int) bool {
+		return loadedConf.Outputs[i].position < loadedConf.Outputs[j].position
+	})
 	return loadedConf, nil
 }
 
+// tables holds the positions of the plugin tables in the config, by plugin
+// kind and name.
+type tables map[string][]int
+
+func tableOrder(md toml.MetaData) tables {
+	order := make(tables)
+	for i, key := range md.Keys() {
+		if len(key) != 2 {
+			continue
+		}
+		switch key[0] {
+		case "inputs", "processors", "outputs":
+			order[key.String()] = append(order[key.String()], i)
+		}
+	}
+	return order
+}
+
+// position returns the position of the i-th table of the plugin.
+func (t tables) position(kind string, name string, i int) int {
+	positions := t[kind+"."+name]
+	if i < len(positions) {
+		return positions[i]
+	}
+	return len(positions)
+}
+
 // DefaultImportedPlugins defaults to whatever plugins happen to be loaded and
 // have registered themselves with the registry. This makes loading plugins
 // without having to define a config dead easy.
@@ -3,9 +3,12 @@ package shim
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/plugins/inputs"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	"github.com/influxdata/telegraf/plugins/processors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -21,7 +24,8 @@ func TestLoadConfig(t *testing.T) {
 	conf, err := LoadConfig(&c)
 	require.NoError(t, err)
 
-	inp := conf.Input.(*serviceInput)
+	require.Len(t, conf.Inputs, 1)
+	inp := conf.Inputs[0].Input.(*serviceInput)
 
 	require.Equal(t, "awesome name", inp.ServiceName)
 	require.Equal(t, "xxxxxxxxxx", inp.SecretToken)
@@ -35,5 +39,114 @@ func TestDefaultImportedPluginsSelfRegisters(t *testing.T) {
 
 	cfg, err := LoadConfig(nil)
 	require.NoError(t, err)
-	require.Equal(t, "test", cfg.Input.Description())
+	require.Len(t, cfg.Inputs, 1)
+	require.Equal(t, "test", cfg.Inputs[0].Input.Description())
+}
+
+func TestLoadConfigMultiplePlugins(t *testing.T) {
+	inputs.Add("test", func() telegraf.Input {
+		return &serviceInput{}
+	})
+	processors.AddStreaming("test_a", func() telegraf.StreamingProcessor {
+		return &namedProcessor{}
+	})
+	processors.AddStreaming("test_b", func() telegraf.StreamingProcessor {
+		return &namedProcessor{}
+	})
+
+	conf, err := loadConfigData(`
+[[inputs.test]]
+  service_name = "first"
+  interval = "10s"
+[[processors.test_b]]
+  tag = "b"
+[[inputs.test]]
+  service_name = "second"
+[[processors.test_a]]
+  tag = "a"
+[[processors.test_b]]
+  tag = "c"
+`)
+	require.NoError(t, err)
+
+	require.Len(t, conf.Inputs, 2)
+	require.Equal(t, "first", conf.Inputs[0].Input.(*serviceInput).ServiceName)
+	require.Equal(t, 10*time.Second, conf.Inputs[0].Interval)
+	require.Equal(t, "second", conf.Inputs[1].Input.(*serviceInput).ServiceName)
+	require.Equal(t, time.Duration(0), conf.Inputs[1].Interval)
+
+	var tags []string
+	for _, p := range conf.Processors {
+		tags = append(tags, p.Processor.(*namedProcessor).Tag)
+	}
+	require.Equal(t, []string{"b", "a", "c"}, tags)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	inputs.Add("test", func() telegraf.Input {
+		return &serviceInput{}
+	})
+	processors.AddStreaming("test_a", func() telegraf.StreamingProcessor {
+		return &namedProcessor{}
+	})
+	outputs.Add("test", func() telegraf.Output {
+		return &testOutput{}
+	})
+
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{
+			name:   "unknown plugin",
+			config: "[[inputs.test]]\n[[inputs.missing]]\n",
+		},
+		{
+			name:   "unknown option in second table",
+			config: "[[inputs.test]]\n  service_name = \"a\"\n[[inputs.test]]\n  servce_name = \"b\"\n",
+		},
+		{
+			name:   "invalid interval",
+			config: "[[inputs.test]]\n  interval = \"often\"\n",
+		},
+		{
+			name:   "interval of processor",
+			config: "[[processors.test_a]]\n  interval = \"10s\"\n",
+		},
+		{
+			name:   "outputs with inputs",
+			config: "[[inputs.test]]\n[[outputs.test]]\n",
+		},
+		{
+			name:   "outputs with processors",
+			config: "[[processors.test_a]]\n[[outputs.test]]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadConfigData(tt.config)
+			require.Error(t, err)
+		})
+	}
+}
+
+type namedProcessor struct {
+	Tag string `toml:"tag"`
+}
+
+func (p *namedProcessor) SampleConfig() string { return "" }
+func (p *namedProcessor) Description() string  { return "" }
+
+func (p *namedProcessor) Start(acc telegraf.Accumulator) error {
+	return nil
+}
+
+func (p *namedProcessor) Add(m telegraf.Metric, acc telegraf.Accumulator) error {
+	m.AddTag("processed", m.Tags()["processed"]+p.Tag)
+	acc.AddMetric(m)
+	return nil
+}
+
+func (p *namedProcessor) Stop() error {
+	return nil
 }
@@ -52,7 +52,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	// run the input plugin(s) until stdin closes or we receive a termination signal
+	// run the plugins until stdin closes or we receive a termination signal
 	if err := shim.Run(*pollInterval); err != nil {
 		fmt.Fprintf(os.Stderr, "Err: %s\n", err)
 		os.Exit(1)
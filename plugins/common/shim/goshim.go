@@ -2,15 +2,18 @@ package shim
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/common/control"
 	"github.com/influxdata/telegraf/plugins/serializers/influx"
 )
 
@@ -32,10 +35,31 @@ const (
 
 // Shim allows you to wrap your inputs and run them as if they were part of Telegraf,
 // except built externally.
+//
+// Several plugins can run in one shim.  Inputs can be combined with
+// processors, which process the metrics of the inputs in the order they were
+// added.  Outputs can only be combined with other outputs.
 type Shim struct {
-	Input     telegraf.Input
+	// Input is the input of a shim running a single input.
+	//
+	// Deprecated: use AddInput.  The field is set while the shim has exactly
+	// one input, setting it replaces the inputs of the shim.
+	Input telegraf.Input
+	// Processor is the processor of a shim running a single processor.
+	//
+	// Deprecated: use AddStreamingProcessor.  The field is set while the shim
+	// has exactly one processor, setting it replaces the processors of the
+	// shim.
 	Processor telegraf.StreamingProcessor
-	Output    telegraf.Output
+	// Output is the output of a shim running a single output.
+	//
+	// Deprecated: use AddOutput.  The field is set while the shim has exactly
+	// one output, setting it replaces the outputs of the shim.
+	Output telegraf.Output
+
+	inputs     []*shimInput
+	processors []*shimProcessor
+	outputs    []*shimOutput
 
 	// streams
 	stdin  io.Reader
@@ -45,14 +69,19 @@ type Shim struct {
 	// outgoing metric channel
 	metricCh chan telegraf.Metric
 
-	// input only
-	gatherPromptCh chan empty
+	// control channel to Telegraf, set if started by an execd plugin with
+	// control_channel enabled
+	control *control.Conn
+	// output only, batches received on the control channel
+	writeCh chan *control.Message
+	writeMu sync.Mutex
 }
 
 // New creates a new shim interface
 func New() *Shim {
 	return &Shim{
 		metricCh: make(chan telegraf.Metric, 1),
+		writeCh:  make(chan *control.Message, 1),
 		stdin:    os.Stdin,
 		stdout:   os.Stdout,
 		stderr:   os.Stderr,
@@ -71,17 +100,26 @@ func (s *Shim) watchForShutdown(cancel context.CancelFunc) {
 
 // Run the input plugins..
 func (s *Shim) Run(pollInterval time.Duration) error {
-	if s.Input != nil {
+	if err := s.startControl(); err != nil {
+		return fmt.Errorf("control channel error: %w", err)
+	}
+
+	s.syncPlugins()
+	if err := checkPlugins(len(s.inputs), len(s.processors), len(s.outputs)); err != nil {
+		return err
+	}
+
+	if len(s.inputs) > 0 {
 		err := s.RunInput(pollInterval)
 		if err != nil {
 			return fmt.Errorf("RunInput error: %w", err)
 		}
-	} else if s.Processor != nil {
+	} else if len(s.processors) > 0 {
 		err := s.RunProcessor()
 		if err != nil {
 			return fmt.Errorf("RunProcessor error: %w", err)
 		}
-	} else if s.Output != nil {
+	} else if len(s.outputs) > 0 {
 		err := s.RunOutput()
 		if err != nil {
 			return fmt.Errorf("RunOutput error: %w", err)
@@ -93,6 +131,146 @@ func (s *Shim) Run(pollInterval time.Duration) error {
 	return nil
 }
 
+// startControl opens the control channel if Telegraf provides one and loads
+// the plugin configuration handed over by Telegraf.
+func (s *Shim) startControl() error {
+	if s.control == nil {
+		if os.Getenv(control.EnvVar) != "1" {
+			return nil
+		}
+		s.control = control.NewConn(
+			os.NewFile(control.ReadFd, "control-in"),
+			os.NewFile(control.WriteFd, "control-out"),
+		)
+	}
+
+	m, err := s.control.Receive()
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	if m.Type != control.TypeConfig {
+		return fmt.Errorf("expected config message but got %q", m.Type)
+	}
+	if m.Config != "" {
+		conf, err := loadConfigData(m.Config)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		s.inputs, s.processors, s.outputs = nil, nil, nil
+		s.Input, s.Processor, s.Output = nil, nil, nil
+		if err := s.addConfig(conf); err != nil {
+			return err
+		}
+	}
+
+	setLogConn(s.control)
+	go s.serveControl()
+	return nil
+}
+
+// serveControl answers the messages from Telegraf until the channel closes.
+func (s *Shim) serveControl() {
+	defer close(s.writeCh)
+	for {
+		m, err := s.control.Receive()
+		if err != nil {
+			if err != io.EOF {
+				s.reportError(fmt.Errorf("failed to read control message: %w", err))
+			}
+			return
+		}
+
+		switch m.Type {
+		case control.TypePing:
+			s.control.Send(&control.Message{Type: control.TypePong, ID: m.ID})
+		case control.TypeWrite:
+			if len(s.outputs) == 0 {
+				s.control.Send(&control.Message{Type: control.TypeAck, ID: m.ID, Error: "no output plugins"})
+				continue
+			}
+			s.writeCh <- m
+		}
+	}
+}
+
+// reportError sends the error to Telegraf, or writes it to stderr without
+// control channel.
+func (s *Shim) reportError(err error) {
+	if s.control != nil {
+		if s.control.Send(&control.Message{Type: control.TypeError, Error: err.Error()}) == nil {
+			return
+		}
+	}
+	fmt.Fprintf(s.stderr, "%s\n", err)
+}
+
+// syncPlugins keeps the deprecated single plugin fields in line with the
+// plugins of the shim.  A field set directly replaces the plugins of its kind,
+// as it did when the shim ran a single plugin.
+func (s *Shim) syncPlugins() {
+	if s.Input != nil && (len(s.inputs) != 1 || s.inputs[0].input != s.Input) {
+		s.inputs = []*shimInput{newShimInput("", s.Input, 0)}
+	}
+	if s.Processor != nil && (len(s.processors) != 1 || s.processors[0].processor != s.Processor) {
+		s.processors = []*shimProcessor{newShimProcessor("", s.Processor)}
+	}
+	if s.Output != nil && (len(s.outputs) != 1 || s.outputs[0].output != s.Output) {
+		s.outputs = []*shimOutput{newShimOutput("", s.Output)}
+	}
+	s.updatePluginFields()
+}
+
+// updatePluginFields sets the deprecated single plugin fields to the plugins
+// of the shim.
+func (s *Shim) updatePluginFields() {
+	s.Input, s.Processor, s.Output = nil, nil, nil
+	if len(s.inputs) == 1 {
+		s.Input = s.inputs[0].input
+	}
+	if len(s.processors) == 1 {
+		s.Processor = s.processors[0].processor
+	}
+	if len(s.outputs) == 1 {
+		s.Output = s.outputs[0].output
+	}
+}
+
+// checkPlugins returns an error if the plugins can't run in the same shim.
+func checkPlugins(inputs, processors, outputs int) error {
+	if outputs > 0 && (inputs > 0 || processors > 0) {
+		return errors.New("outputs can't run in the same shim as inputs or processors")
+	}
+	return nil
+}
+
+// plugin is the name and logger of a plugin run by the shim.
+type plugin struct {
+	name string
+	log  *Logger
+}
+
+func newPlugin(kind string, name string) plugin {
+	if name != "" {
+		name = kind + "." + name
+	}
+	return plugin{name: name, log: newPluginLogger(name)}
+}
+
+// LogName satisfies the MetricMaker interface
+func (p plugin) LogName() string {
+	return p.name
+}
+
+// MakeMetric satisfies the MetricMaker interface
+func (p plugin) MakeMetric(m telegraf.Metric) telegraf.Metric {
+	return m
+}
+
+// Log satisfies the MetricMaker interface
+func (p plugin) Log() telegraf.Logger {
+	return p.log
+}
+
 func hasQuit(ctx context.Context) bool {
 	return ctx.Err() != nil
 }
@@ -127,5 +305,5 @@ func (s *Shim) MakeMetric(m telegraf.Metric) telegraf.Metric {
 
 // Log satisfies the MetricMaker interface
 func (s *Shim) Log() telegraf.Logger {
-	return nil
+	return NewLogger()
 }
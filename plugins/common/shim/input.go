@@ -11,9 +11,33 @@ import (
 	"github.com/influxdata/telegraf/agent"
 )
 
+// shimInput is an input run by the shim.
+type shimInput struct {
+	plugin
+	input telegraf.Input
+	// interval overrides the poll interval if set
+	interval time.Duration
+	promptCh chan empty
+}
+
 // AddInput adds the input to the shim. Later calls to Run() will run this input.
 func (s *Shim) AddInput(input telegraf.Input) error {
-	setLoggerOnPlugin(input, NewLogger())
+	return s.addInput("", input, 0)
+}
+
+func newShimInput(name string, input telegraf.Input, interval time.Duration) *shimInput {
+	return &shimInput{
+		plugin:   newPlugin("inputs", name),
+		input:    input,
+		interval: interval,
+		promptCh: make(chan empty, 1),
+	}
+}
+
+func (s *Shim) addInput(name string, input telegraf.Input, interval time.Duration) error {
+	s.syncPlugins()
+	in := newShimInput(name, input, interval)
+	setLoggerOnPlugin(input, in.log)
 	if p, ok := input.(telegraf.Initializer); ok {
 		err := p.Init()
 		if err != nil {
@@ -21,7 +45,8 @@ func (s *Shim) AddInput(input telegraf.Input) error {
 		}
 	}
 
-	s.Input = input
+	s.inputs = append(s.inputs, in)
+	s.updatePluginFields()
 	return nil
 }
 
@@ -32,23 +57,45 @@ func (s *Shim) RunInput(pollInterval time.Duration) error {
 	defer cancel()
 
 	s.watchForShutdown(cancel)
+	s.syncPlugins()
+
+	// the metrics of the inputs pass through the processors, if any
+	inputCh := s.metricCh
+	if len(s.processors) > 0 {
+		inputCh = make(chan telegraf.Metric, 1)
+		if err := s.startProcessors(inputCh); err != nil {
+			return err
+		}
+	}
 
-	acc := agent.NewAccumulator(s, s.metricCh)
-	acc.SetPrecision(time.Nanosecond)
+	accs := make([]telegraf.Accumulator, 0, len(s.inputs))
+	for i, in := range s.inputs {
+		acc := agent.NewAccumulator(in, inputCh)
+		acc.SetPrecision(time.Nanosecond)
+		accs = append(accs, acc)
 
-	if serviceInput, ok := s.Input.(telegraf.ServiceInput); ok {
-		if err := serviceInput.Start(acc); err != nil {
-			return fmt.Errorf("failed to start input: %s", err)
+		if serviceInput, ok := in.input.(telegraf.ServiceInput); ok {
+			if err := serviceInput.Start(acc); err != nil {
+				stopServiceInputs(s.inputs[:i])
+				close(inputCh)
+				return fmt.Errorf("failed to start input%s: %s", in.describe(), err)
+			}
 		}
 	}
-	s.gatherPromptCh = make(chan empty, 1)
+
 	go func() {
-		s.startGathering(ctx, s.Input, acc, pollInterval)
-		if serviceInput, ok := s.Input.(telegraf.ServiceInput); ok {
-			serviceInput.Stop()
+		var gatherWg sync.WaitGroup
+		for i, in := range s.inputs {
+			gatherWg.Add(1)
+			go func(in *shimInput, acc telegraf.Accumulator) {
+				defer gatherWg.Done()
+				s.startGathering(ctx, in, acc, pollInterval)
+			}(in, accs[i])
 		}
+		gatherWg.Wait()
+		stopServiceInputs(s.inputs)
 		// closing the metric channel gracefully stops writing to stdout
-		close(s.metricCh)
+		close(inputCh)
 	}()
 
 	wg := sync.WaitGroup{}
@@ -72,7 +119,26 @@ func (s *Shim) RunInput(pollInterval time.Duration) error {
 	return nil
 }
 
-func (s *Shim) startGathering(ctx context.Context, input telegraf.Input, acc telegraf.Accumulator, pollInterval time.Duration) {
+func stopServiceInputs(inputs []*shimInput) {
+	for _, in := range inputs {
+		if serviceInput, ok := in.input.(telegraf.ServiceInput); ok {
+			serviceInput.Stop()
+		}
+	}
+}
+
+// describe returns the name of the input for error messages.
+func (in *shimInput) describe() string {
+	if in.name == "" {
+		return ""
+	}
+	return " " + in.name
+}
+
+func (s *Shim) startGathering(ctx context.Context, in *shimInput, acc telegraf.Accumulator, pollInterval time.Duration) {
+	if in.interval > 0 {
+		pollInterval = in.interval
+	}
 	if pollInterval == PollIntervalDisabled {
 		pollInterval = forever
 	}
@@ -87,26 +153,28 @@ func (s *Shim) startGathering(ctx context.Context, input telegraf.Input, acc tel
 		select {
 		case <-ctx.Done():
 			return
-		case <-s.gatherPromptCh:
-			if err := input.Gather(acc); err != nil {
-				fmt.Fprintf(s.stderr, "failed to gather metrics: %s\n", err)
+		case <-in.promptCh:
+			if err := in.input.Gather(acc); err != nil {
+				in.log.logError(fmt.Errorf("failed to gather metrics: %s", err))
 			}
 		case <-t.C:
-			if err := input.Gather(acc); err != nil {
-				fmt.Fprintf(s.stderr, "failed to gather metrics: %s\n", err)
+			if err := in.input.Gather(acc); err != nil {
+				in.log.logError(fmt.Errorf("failed to gather metrics: %s", err))
 			}
 		}
 	}
 }
 
 // pushCollectMetricsRequest pushes a non-blocking (nil) message to the
-// gatherPromptCh channel to trigger metric collection.
-// The channel is defined with a buffer of 1, so while it's full, subsequent
-// requests are discarded.
+// prompt channel of every input to trigger metric collection.
+// The channels are defined with a buffer of 1, so while one is full,
+// subsequent requests for its input are discarded.
 func (s *Shim) pushCollectMetricsRequest() {
 	// push a message out to each channel to collect metrics. don't block.
-	select {
-	case s.gatherPromptCh <- empty{}:
-	default:
+	for _, in := range s.inputs {
+		select {
+		case in.promptCh <- empty{}:
+		default:
+		}
 	}
 }
@@ -50,6 +50,62 @@ func TestInputShimStdinSignalingWorks(t *testing.T) {
 	<-exited
 }
 
+func TestInputShimMultiplePlugins(t *testing.T) {
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+
+	s := New()
+	s.stdin = stdinReader
+	s.stdout = stdoutWriter
+	require.NoError(t, s.addInput("first", &serviceInput{ServiceName: "first"}, 0))
+	require.NoError(t, s.addInput("second", &serviceInput{ServiceName: "second"}, 0))
+	require.NoError(t, s.addStreamingProcessor("a", &namedProcessor{Tag: "a"}))
+	require.NoError(t, s.addStreamingProcessor("b", &namedProcessor{Tag: "b"}))
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- s.Run(PollIntervalDisabled)
+	}()
+
+	// a signal triggers every input
+	_, err := stdinWriter.Write([]byte("\n"))
+	require.NoError(t, err)
+
+	r := bufio.NewReader(stdoutReader)
+	var lines []string
+	for i := 0; i < 2; i++ {
+		out, err := r.ReadString('\n')
+		require.NoError(t, err)
+		lines = append(lines, out)
+	}
+	require.ElementsMatch(t, []string{
+		"measurement,processed=ab,service=first,tag=tag field=1i 1234000005678\n",
+		"measurement,processed=ab,service=second,tag=tag field=1i 1234000005678\n",
+	}, lines)
+
+	stdinWriter.Close()
+	go ioutil.ReadAll(r)
+	require.NoError(t, <-exited)
+}
+
+func TestInputShimDeprecatedField(t *testing.T) {
+	first := &serviceInput{ServiceName: "first"}
+	second := &serviceInput{ServiceName: "second"}
+
+	s := New()
+	require.NoError(t, s.AddInput(first))
+	require.Equal(t, first, s.Input)
+	require.NoError(t, s.AddInput(second))
+	require.Nil(t, s.Input)
+
+	// setting the field replaces the inputs
+	s.Input = first
+	s.syncPlugins()
+	require.Len(t, s.inputs, 1)
+	require.Equal(t, first, s.inputs[0].input)
+	require.Equal(t, first, s.Input)
+}
+
 func runInputPlugin(t *testing.T, interval time.Duration, stdin io.Reader, stdout, stderr io.Writer) (metricProcessed chan bool, exited chan bool) {
 	metricProcessed = make(chan bool, 1)
 	exited = make(chan bool, 1)
@@ -122,13 +178,17 @@ func (i *serviceInput) Description() string {
 }
 
 func (i *serviceInput) Gather(acc telegraf.Accumulator) error {
+	tags := map[string]string{
+		"tag": "tag",
+	}
+	if i.ServiceName != "" {
+		tags["service"] = i.ServiceName
+	}
 	acc.AddFields("measurement",
 		map[string]interface{}{
 			"field": 1,
 		},
-		map[string]string{
-			"tag": "tag",
-		}, time.Unix(1234, 5678))
+		tags, time.Unix(1234, 5678))
 
 	return nil
 }
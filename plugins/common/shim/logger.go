@@ -5,8 +5,10 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"sync"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/common/control"
 )
 
 func init() {
@@ -16,51 +18,104 @@ func init() {
 // Logger defines a logging structure for plugins.
 // external plugins can only ever write to stderr and writing to stdout
 // would interfere with input/processor writing out of metrics.
-type Logger struct{}
+type Logger struct {
+	prefix string
+}
 
 // NewLogger creates a new logger instance
 func NewLogger() *Logger {
 	return &Logger{}
 }
 
+// newPluginLogger creates a logger prefixing the messages with the plugin
+// name.
+func newPluginLogger(name string) *Logger {
+	if name == "" {
+		return NewLogger()
+	}
+	return &Logger{prefix: "[" + name + "] "}
+}
+
 // Errorf logs an error message, patterned after log.Printf.
 func (l *Logger) Errorf(format string, args ...interface{}) {
-	log.Printf("E! "+format, args...)
+	printLog("E", l.prefix+fmt.Sprintf(format, args...))
 }
 
 // Error logs an error message, patterned after log.Print.
 func (l *Logger) Error(args ...interface{}) {
-	log.Print("E! ", fmt.Sprint(args...))
+	printLog("E", l.prefix+fmt.Sprint(args...))
 }
 
 // Debugf logs a debug message, patterned after log.Printf.
 func (l *Logger) Debugf(format string, args ...interface{}) {
-	log.Printf("D! "+format, args...)
+	printLog("D", l.prefix+fmt.Sprintf(format, args...))
 }
 
 // Debug logs a debug message, patterned after log.Print.
 func (l *Logger) Debug(args ...interface{}) {
-	log.Print("D! ", fmt.Sprint(args...))
+	printLog("D", l.prefix+fmt.Sprint(args...))
 }
 
 // Warnf logs a warning message, patterned after log.Printf.
 func (l *Logger) Warnf(format string, args ...interface{}) {
-	log.Printf("W! "+format, args...)
+	printLog("W", l.prefix+fmt.Sprintf(format, args...))
 }
 
 // Warn logs a warning message, patterned after log.Print.
 func (l *Logger) Warn(args ...interface{}) {
-	log.Print("W! ", fmt.Sprint(args...))
+	printLog("W", l.prefix+fmt.Sprint(args...))
 }
 
 // Infof logs an information message, patterned after log.Printf.
 func (l *Logger) Infof(format string, args ...interface{}) {
-	log.Printf("I! "+format, args...)
+	printLog("I", l.prefix+fmt.Sprintf(format, args...))
 }
 
 // Info logs an information message, patterned after log.Print.
 func (l *Logger) Info(args ...interface{}) {
-	log.Print("I! ", fmt.Sprint(args...))
+	printLog("I", l.prefix+fmt.Sprint(args...))
+}
+
+var (
+	logConnMu sync.Mutex
+	logConn   *control.Conn
+)
+
+// setLogConn sends the log messages to Telegraf over the control channel.
+func setLogConn(conn *control.Conn) {
+	logConnMu.Lock()
+	logConn = conn
+	logConnMu.Unlock()
+}
+
+func getLogConn() *control.Conn {
+	logConnMu.Lock()
+	defer logConnMu.Unlock()
+	return logConn
+}
+
+// logError reports a plugin error, it is sent to Telegraf as error on the
+// control channel or logged otherwise.
+func (l *Logger) logError(err error) {
+	if conn := getLogConn(); conn != nil {
+		err := conn.Send(&control.Message{Type: control.TypeError, Error: l.prefix + err.Error()})
+		if err == nil {
+			return
+		}
+	}
+	log.Print("E! " + l.prefix + err.Error())
+}
+
+// printLog sends the message over the control channel, if there is one, or
+// writes it to stderr.
+func printLog(level string, msg string) {
+	if conn := getLogConn(); conn != nil {
+		err := conn.Send(&control.Message{Type: control.TypeLog, Level: level, Message: msg})
+		if err == nil {
+			return
+		}
+	}
+	log.Print(level + "! " + msg)
 }
 
 // setLoggerOnPlugin injects the logger into the plugin,
@@ -5,12 +5,32 @@ import (
 	"fmt"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/common/control"
 	"github.com/influxdata/telegraf/plugins/parsers"
 )
 
+// shimOutput is an output run by the shim.
+type shimOutput struct {
+	plugin
+	output telegraf.Output
+}
+
 // AddOutput adds the input to the shim. Later calls to Run() will run this.
 func (s *Shim) AddOutput(output telegraf.Output) error {
-	setLoggerOnPlugin(output, NewLogger())
+	return s.addOutput("", output)
+}
+
+func newShimOutput(name string, output telegraf.Output) *shimOutput {
+	return &shimOutput{
+		plugin: newPlugin("outputs", name),
+		output: output,
+	}
+}
+
+func (s *Shim) addOutput(name string, output telegraf.Output) error {
+	s.syncPlugins()
+	o := newShimOutput(name, output)
+	setLoggerOnPlugin(output, o.log)
 	if p, ok := output.(telegraf.Initializer); ok {
 		err := p.Init()
 		if err != nil {
@@ -18,7 +38,8 @@ func (s *Shim) AddOutput(output telegraf.Output) error {
 		}
 	}
 
-	s.Output = output
+	s.outputs = append(s.outputs, o)
+	s.updatePluginFields()
 	return nil
 }
 
@@ -28,11 +49,30 @@ func (s *Shim) RunOutput() error {
 		return fmt.Errorf("Failed to create new parser: %w", err)
 	}
 
-	err = s.Output.Connect()
-	if err != nil {
-		return fmt.Errorf("failed to start processor: %w", err)
+	s.syncPlugins()
+	for i, o := range s.outputs {
+		if err := o.output.Connect(); err != nil {
+			for _, connected := range s.outputs[:i] {
+				connected.output.Close()
+			}
+			return fmt.Errorf("failed to start output: %w", err)
+		}
+	}
+	defer func() {
+		s.writeMu.Lock()
+		for _, o := range s.outputs {
+			o.output.Close()
+		}
+		s.writeMu.Unlock()
+	}()
+
+	if s.control != nil {
+		batchParser, err := parsers.NewInfluxParser()
+		if err != nil {
+			return fmt.Errorf("Failed to create new parser: %w", err)
+		}
+		go s.writeBatches(batchParser)
 	}
-	defer s.Output.Close()
 
 	var m telegraf.Metric
 
@@ -40,13 +80,61 @@ func (s *Shim) RunOutput() error {
 	for scanner.Scan() {
 		m, err = parser.ParseLine(scanner.Text())
 		if err != nil {
-			fmt.Fprintf(s.stderr, "Failed to parse metric: %s\n", err)
+			s.reportError(fmt.Errorf("Failed to parse metric: %s", err))
 			continue
 		}
-		if err = s.Output.Write([]telegraf.Metric{m}); err != nil {
-			fmt.Fprintf(s.stderr, "Failed to write metric: %s\n", err)
-		}
+		s.write([]telegraf.Metric{m}, true)
 	}
 
 	return nil
 }
+
+// writeBatches writes the batches received on the control channel and
+// acknowledges them.  A batch that fails to parse or write is rejected.
+func (s *Shim) writeBatches(parser parsers.Parser) {
+	for msg := range s.writeCh {
+		ack := &control.Message{Type: control.TypeAck, ID: msg.ID}
+
+		metrics, err := parser.Parse([]byte(msg.Data))
+		if err == nil {
+			err = s.write(metrics, false)
+		}
+		if err != nil {
+			ack.Error = err.Error()
+		}
+
+		if err := s.control.Send(ack); err != nil {
+			fmt.Fprintf(s.stderr, "Failed to acknowledge batch: %s\n", err)
+		}
+	}
+}
+
+// write writes the metrics to every output and returns the first error.  The
+// errors are reported by the logger of the output if report is set.
+func (s *Shim) write(metrics []telegraf.Metric, report bool) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var failed error
+	for i, o := range s.outputs {
+		batch := metrics
+		if i < len(s.outputs)-1 {
+			batch = make([]telegraf.Metric, 0, len(metrics))
+			for _, m := range metrics {
+				batch = append(batch, m.Copy())
+			}
+		}
+
+		err := o.output.Write(batch)
+		if err == nil {
+			continue
+		}
+		if report {
+			o.log.logError(fmt.Errorf("Failed to write metric: %s", err))
+		}
+		if failed == nil {
+			failed = err
+		}
+	}
+	return failed
+}
@@ -1,6 +1,7 @@
 package shim
 
 import (
+	"errors"
 	"io"
 	"sync"
 	"testing"
@@ -8,6 +9,8 @@ import (
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/common/control"
+	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/serializers"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/require"
@@ -58,7 +61,89 @@ func TestOutputShim(t *testing.T) {
 	testutil.RequireMetricEqual(t, m, mOut)
 }
 
+func TestOutputShimMultipleOutputs(t *testing.T) {
+	first := &testOutput{}
+	second := &testOutput{RejectName: "thing"}
+
+	stdinReader, stdinWriter := io.Pipe()
+
+	s := New()
+	s.stdin = stdinReader
+	require.NoError(t, s.addOutput("first", first))
+	require.NoError(t, s.addOutput("second", second))
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- s.RunOutput()
+	}()
+
+	_, err := stdinWriter.Write([]byte("thing v=1i 1\nother v=2i 2\n"))
+	require.NoError(t, err)
+	require.NoError(t, stdinWriter.Close())
+	require.NoError(t, <-exited)
+
+	// a failing output doesn't keep the metrics from the other outputs
+	require.Len(t, first.MetricsWritten, 2)
+	require.Len(t, second.MetricsWritten, 1)
+	require.Equal(t, "other", second.MetricsWritten[0].Name())
+}
+
+func TestOutputShimControlChannel(t *testing.T) {
+	o := &testOutput{}
+	outputs.Add("control_test", func() telegraf.Output {
+		return o
+	})
+
+	stdinReader, stdinWriter := io.Pipe()
+	procR, telW := io.Pipe()
+	telR, procW := io.Pipe()
+	tel := control.NewConn(telR, telW)
+
+	s := New()
+	s.stdin = stdinReader
+	s.control = control.NewConn(procR, procW)
+	defer setLogConn(nil)
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- s.Run(PollIntervalDisabled)
+	}()
+
+	require.NoError(t, tel.Send(&control.Message{
+		Type:   control.TypeConfig,
+		Config: "[[outputs.control_test]]\n  reject_name = \"reject\"\n",
+	}))
+
+	require.NoError(t, tel.Send(&control.Message{Type: control.TypePing, ID: 1}))
+	m, err := tel.Receive()
+	require.NoError(t, err)
+	require.Equal(t, &control.Message{Type: control.TypePong, ID: 1}, m)
+
+	require.NoError(t, tel.Send(&control.Message{Type: control.TypeWrite, ID: 2, Data: "cpu value=1 1\n"}))
+	m, err = tel.Receive()
+	require.NoError(t, err)
+	require.Equal(t, &control.Message{Type: control.TypeAck, ID: 2}, m)
+
+	require.NoError(t, tel.Send(&control.Message{Type: control.TypeWrite, ID: 3, Data: "reject value=1 1\n"}))
+	m, err = tel.Receive()
+	require.NoError(t, err)
+	require.Equal(t, control.TypeAck, m.Type)
+	require.Equal(t, uint64(3), m.ID)
+	require.Equal(t, "rejected metric", m.Error)
+
+	require.NoError(t, stdinWriter.Close())
+	require.NoError(t, <-exited)
+	telW.Close()
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"value": 1.0}, time.Unix(0, 1)),
+	}
+	testutil.RequireMetricsEqual(t, expected, o.MetricsWritten)
+}
+
 type testOutput struct {
+	RejectName string `toml:"reject_name"`
+
 	MetricsWritten []telegraf.Metric
 }
 
@@ -69,6 +154,11 @@ func (o *testOutput) Close() error {
 	return nil
 }
 func (o *testOutput) Write(metrics []telegraf.Metric) error {
+	for _, m := range metrics {
+		if m.Name() == o.RejectName {
+			return errors.New("rejected metric")
+		}
+	}
 	o.MetricsWritten = append(o.MetricsWritten, metrics...)
 	return nil
 }
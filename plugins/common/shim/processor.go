@@ -12,6 +12,12 @@ import (
 	"github.com/influxdata/telegraf/plugins/processors"
 )
 
+// shimProcessor is a processor run by the shim.
+type shimProcessor struct {
+	plugin
+	processor telegraf.StreamingProcessor
+}
+
 // AddProcessor adds the processor to the shim. Later calls to Run() will run this.
 func (s *Shim) AddProcessor(processor telegraf.Processor) error {
 	setLoggerOnPlugin(processor, NewLogger())
@@ -21,7 +27,20 @@ func (s *Shim) AddProcessor(processor telegraf.Processor) error {
 
 // AddStreamingProcessor adds the processor to the shim. Later calls to Run() will run this.
 func (s *Shim) AddStreamingProcessor(processor telegraf.StreamingProcessor) error {
-	setLoggerOnPlugin(processor, NewLogger())
+	return s.addStreamingProcessor("", processor)
+}
+
+func newShimProcessor(name string, processor telegraf.StreamingProcessor) *shimProcessor {
+	return &shimProcessor{
+		plugin:    newPlugin("processors", name),
+		processor: processor,
+	}
+}
+
+func (s *Shim) addStreamingProcessor(name string, processor telegraf.StreamingProcessor) error {
+	s.syncPlugins()
+	p := newShimProcessor(name, processor)
+	setLoggerOnPlugin(processor, p.log)
 	if p, ok := processor.(telegraf.Initializer); ok {
 		err := p.Init()
 		if err != nil {
@@ -29,22 +48,21 @@ func (s *Shim) AddStreamingProcessor(processor telegraf.StreamingProcessor) erro
 		}
 	}
 
-	s.Processor = processor
+	s.processors = append(s.processors, p)
+	s.updatePluginFields()
 	return nil
 }
 
 func (s *Shim) RunProcessor() error {
-	acc := agent.NewAccumulator(s, s.metricCh)
-	acc.SetPrecision(time.Nanosecond)
-
 	parser, err := parsers.NewInfluxParser()
 	if err != nil {
 		return fmt.Errorf("Failed to create new parser: %w", err)
 	}
 
-	err = s.Processor.Start(acc)
-	if err != nil {
-		return fmt.Errorf("failed to start processor: %w", err)
+	s.syncPlugins()
+	in := make(chan telegraf.Metric, 1)
+	if err := s.startProcessors(in); err != nil {
+		return err
 	}
 
 	wg := sync.WaitGroup{}
@@ -58,14 +76,47 @@ func (s *Shim) RunProcessor() error {
 	for scanner.Scan() {
 		m, err := parser.ParseLine(scanner.Text())
 		if err != nil {
-			fmt.Fprintf(s.stderr, "Failed to parse metric: %s\b", err)
+			s.reportError(fmt.Errorf("Failed to parse metric: %s", err))
 			continue
 		}
-		s.Processor.Add(m, acc)
+		in <- m
 	}
 
-	close(s.metricCh)
-	s.Processor.Stop()
+	close(in)
 	wg.Wait()
 	return nil
 }
+
+// startProcessors passes the metrics from the in channel through the
+// processors in order to the metric channel.  The metric channel is closed
+// once in is closed and all processors stopped.
+func (s *Shim) startProcessors(in chan telegraf.Metric) error {
+	src := in
+	for i, p := range s.processors {
+		dst := s.metricCh
+		if i < len(s.processors)-1 {
+			dst = make(chan telegraf.Metric, 1)
+		}
+
+		acc := agent.NewAccumulator(p, dst)
+		acc.SetPrecision(time.Nanosecond)
+		if err := p.processor.Start(acc); err != nil {
+			// stops the already started processors
+			close(in)
+			return fmt.Errorf("failed to start processor: %w", err)
+		}
+
+		go func(p *shimProcessor, src, dst chan telegraf.Metric, acc telegraf.Accumulator) {
+			for m := range src {
+				if err := p.processor.Add(m, acc); err != nil {
+					p.log.logError(err)
+				}
+			}
+			p.processor.Stop()
+			close(dst)
+		}(p, src, dst, acc)
+
+		src = dst
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package tmpl
+
+import (
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+// Metric is a metric as seen by Go templates of plugins.  The templates can
+// use the methods Name, Tag, Field and Time, a missing tag is an empty string
+// and a missing field is nil.
+type Metric struct {
+	metric telegraf.Metric
+}
+
+// NewMetric returns the metric to pass to the Execute method of a template.
+func NewMetric(metric telegraf.Metric) *Metric {
+	return &Metric{metric: metric}
+}
+
+// Name returns the measurement name of the metric.
+func (m *Metric) Name() string {
+	return m.metric.Name()
+}
+
+// Tag returns the value of the tag key, or an empty string.
+func (m *Metric) Tag(key string) string {
+	tagString, _ := m.metric.GetTag(key)
+	return tagString
+}
+
+// Field returns the value of the field key, or nil.
+func (m *Metric) Field(key string) interface{} {
+	field, _ := m.metric.GetField(key)
+	return field
+}
+
+// Time returns the timestamp of the metric.
+func (m *Metric) Time() time.Time {
+	return m.metric.Time()
+}
@@ -194,7 +194,7 @@ func (tm *testMetricMaker) MakeMetric(metric telegraf.Metric) telegraf.Metric {
 }
 
 func (tm *testMetricMaker) Log() telegraf.Logger {
-	return models.NewLogger("test", "test", "")
+	return models.NewLogger("test", "test", "", "")
 }
 
 type testOutput struct {
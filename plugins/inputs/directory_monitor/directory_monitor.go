@@ -0,0 +1,453 @@
+package directory_monitor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/inputs"
+	"github.com/influxdata/telegraf/plugins/parsers"
+)
+
+const sampleConfig = `
+  ## The directory to monitor and read files from.
+  directory = ""
+
+  ## The directory to move finished files to.
+  finished_directory = ""
+
+  ## The directory to move files to upon file error.
+  ## If not provided, erroring files will stay in the monitored directory.
+  # error_directory = ""
+
+  ## File name patterns of the files to read, matched against the base name
+  ## of the file.  By default all files are read.
+  # files_to_monitor = ["*"]
+
+  ## File name patterns of the files to ignore, even if they match
+  ## files_to_monitor.  Hidden files are always ignored.
+  # files_to_ignore = ["*.tmp"]
+
+  ## Only read files which have not been modified for at least this duration,
+  ## to avoid reading files that are still being written.
+  # directory_duration_threshold = "50ms"
+
+  ## Maximum number of files processed at the same time.
+  # max_concurrent_files = 1
+
+  ## Maximum number of metrics read from files that have not yet been written
+  ## by the outputs.  For best throughput set it to a multiple of the output's
+  ## metric_batch_size.
+  # max_undelivered_metrics = 10000
+
+  ## Parse the file "line-by-line" or "at-once".  Formats with multi-line
+  ## records, such as JSON documents, must be parsed at once.
+  # parse_method = "line-by-line"
+
+  ## Name a tag containing the name of the file the data was parsed from.
+  ## Leave empty to disable.
+  # file_tag = ""
+
+  ## The data format to be read from the files.  Files ending in ".gz" are
+  ## decompressed before parsing.
+  ## Each data format has its own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_INPUT.md
+  data_format = "influx"
+`
+
+const (
+	defaultMaxConcurrentFiles    = 1
+	defaultMaxUndeliveredMetrics = 10000
+	defaultParseMethod           = "line-by-line"
+
+	// batchSize is the maximum number of metrics added as one tracking group.
+	batchSize = 1000
+)
+
+type empty struct{}
+type semaphore chan empty
+
+type DirectoryMonitor struct {
+	Directory                  string            `toml:"directory"`
+	FinishedDirectory          string            `toml:"finished_directory"`
+	ErrorDirectory             string            `toml:"error_directory"`
+	FilesToMonitor             []string          `toml:"files_to_monitor"`
+	FilesToIgnore              []string          `toml:"files_to_ignore"`
+	DirectoryDurationThreshold internal.Duration `toml:"directory_duration_threshold"`
+	MaxConcurrentFiles         int               `toml:"max_concurrent_files"`
+	MaxUndeliveredMetrics      int               `toml:"max_undelivered_metrics"`
+	ParseMethod                string            `toml:"parse_method"`
+	FileTag                    string            `toml:"file_tag"`
+
+	Log telegraf.Logger `toml:"-"`
+
+	filter     filter.Filter
+	parserFunc parsers.ParserFunc
+	acc        telegraf.TrackingAccumulator
+	sem        semaphore
+	slots      semaphore
+	// acquire serializes taking tokens of sem, so files reading concurrently
+	// can not each hold part of the tokens while waiting for more.
+	acquire sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	mu sync.Mutex
+	// files holds the files being processed by their path.
+	files map[string]*fileState
+	// groups maps the tracking groups to the file they were read from.
+	groups map[telegraf.TrackingID]*trackingGroup
+	// early holds deliveries of groups not yet registered.
+	early map[telegraf.TrackingID]telegraf.DeliveryInfo
+}
+
+// fileState is the progress of a file being processed.
+type fileState struct {
+	path    string
+	pending int  // number of undelivered tracking groups
+	parsed  bool // all metrics of the file have been added
+	failed  bool
+}
+
+type trackingGroup struct {
+	file   *fileState
+	tokens int
+}
+
+func (m *DirectoryMonitor) SampleConfig() string {
+	return sampleConfig
+}
+
+func (m *DirectoryMonitor) Description() string {
+	return "Ingests files in a directory and then moves them to a target directory."
+}
+
+func (m *DirectoryMonitor) SetParserFunc(fn parsers.ParserFunc) {
+	m.parserFunc = fn
+}
+
+func (m *DirectoryMonitor) Init() error {
+	if m.Directory == "" || m.FinishedDirectory == "" {
+		return errors.New("missing one of the following required config options: directory, finished_directory")
+	}
+	if m.MaxConcurrentFiles < 1 {
+		return errors.New("max_concurrent_files must be positive")
+	}
+	if m.MaxUndeliveredMetrics < 1 {
+		return errors.New("max_undelivered_metrics must be positive")
+	}
+	if m.ParseMethod != "line-by-line" && m.ParseMethod != "at-once" {
+		return fmt.Errorf("unknown parse_method %q", m.ParseMethod)
+	}
+
+	for _, dir := range []string{m.FinishedDirectory, m.ErrorDirectory} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	m.filter, err = filter.NewIncludeExcludeFilter(m.FilesToMonitor, m.FilesToIgnore)
+	if err != nil {
+		return err
+	}
+
+	m.sem = make(semaphore, m.MaxUndeliveredMetrics)
+	m.slots = make(semaphore, m.MaxConcurrentFiles)
+	return nil
+}
+
+func (m *DirectoryMonitor) Start(acc telegraf.Accumulator) error {
+	m.acc = acc.WithTracking(m.MaxUndeliveredMetrics)
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.files = make(map[string]*fileState)
+	m.groups = make(map[telegraf.TrackingID]*trackingGroup)
+	m.early = make(map[telegraf.TrackingID]telegraf.DeliveryInfo)
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for {
+			select {
+			case <-m.ctx.Done():
+				return
+			case info := <-m.acc.Delivered():
+				m.onDelivery(info)
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *DirectoryMonitor) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Gather starts processing the files found in the directory, as long as the
+// maximum number of concurrent files is not reached.  The remaining files
+// are picked up by later calls.
+func (m *DirectoryMonitor) Gather(_ telegraf.Accumulator) error {
+	infos, err := ioutil.ReadDir(m.Directory)
+	if err != nil {
+		return err
+	}
+
+	// Process the oldest files first.
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+
+	now := time.Now()
+	for _, info := range infos {
+		name := info.Name()
+		if !info.Mode().IsRegular() || strings.HasPrefix(name, ".") || !m.filter.Match(name) {
+			continue
+		}
+		if now.Sub(info.ModTime()) < m.DirectoryDurationThreshold.Duration {
+			continue
+		}
+
+		path := filepath.Join(m.Directory, name)
+		m.mu.Lock()
+		_, busy := m.files[path]
+		m.mu.Unlock()
+		if busy {
+			continue
+		}
+
+		select {
+		case m.slots <- empty{}:
+		default:
+			return nil
+		}
+
+		state := &fileState{path: path}
+		m.mu.Lock()
+		m.files[path] = state
+		m.mu.Unlock()
+
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			defer func() { <-m.slots }()
+			m.processFile(state)
+		}()
+	}
+	return nil
+}
+
+func (m *DirectoryMonitor) processFile(state *fileState) {
+	err := m.readFile(state)
+	if err == context.Canceled {
+		// Stopping, the file is read again on the next start.
+		return
+	}
+	if err != nil {
+		m.acc.AddError(fmt.Errorf("reading %q failed: %v", state.path, err))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state.parsed = true
+	state.failed = state.failed || err != nil
+	if state.pending == 0 {
+		m.finish(state)
+	}
+}
+
+func (m *DirectoryMonitor) readFile(state *fileState) error {
+	file, err := os.Open(state.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(state.path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	// A new parser is used for each file, as parsers such as csv keep state
+	// between calls.
+	parser, err := m.parserFunc()
+	if err != nil {
+		return err
+	}
+
+	if m.ParseMethod == "at-once" {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		metrics, err := parser.Parse(data)
+		if err != nil {
+			return err
+		}
+		for len(metrics) > 0 {
+			n := batchSize
+			if n > len(metrics) {
+				n = len(metrics)
+			}
+			if err := m.addGroup(state, metrics[:n]); err != nil {
+				return err
+			}
+			metrics = metrics[n:]
+		}
+		return nil
+	}
+
+	var batch []telegraf.Metric
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		metrics, err := parser.Parse(scanner.Bytes())
+		if err != nil {
+			return err
+		}
+		batch = append(batch, metrics...)
+		if len(batch) >= batchSize {
+			if err := m.addGroup(state, batch); err != nil {
+				return err
+			}
+			batch = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return m.addGroup(state, batch)
+	}
+	return nil
+}
+
+// addGroup adds the metrics as a tracking group, blocking until there is room
+// for them within max_undelivered_metrics.
+func (m *DirectoryMonitor) addGroup(state *fileState, metrics []telegraf.Metric) error {
+	if m.FileTag != "" {
+		for _, metric := range metrics {
+			metric.AddTag(m.FileTag, filepath.Base(state.path))
+		}
+	}
+
+	tokens := len(metrics)
+	if tokens > m.MaxUndeliveredMetrics {
+		tokens = m.MaxUndeliveredMetrics
+	}
+	m.acquire.Lock()
+	for i := 0; i < tokens; i++ {
+		select {
+		case <-m.ctx.Done():
+			for ; i > 0; i-- {
+				<-m.sem
+			}
+			m.acquire.Unlock()
+			return context.Canceled
+		case m.sem <- empty{}:
+		}
+	}
+	m.acquire.Unlock()
+
+	id := m.acc.AddTrackingMetricGroup(metrics)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state.pending++
+	m.groups[id] = &trackingGroup{file: state, tokens: tokens}
+	if info, ok := m.early[id]; ok {
+		delete(m.early, id)
+		m.delivered(info)
+	}
+	return nil
+}
+
+func (m *DirectoryMonitor) onDelivery(info telegraf.DeliveryInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.groups[info.ID()]; !ok {
+		// The delivery overtook the registration of the group.
+		m.early[info.ID()] = info
+		return
+	}
+	m.delivered(info)
+}
+
+// delivered records the delivery of a group and finishes its file once all
+// groups have been delivered.  It must be called with the lock held.
+func (m *DirectoryMonitor) delivered(info telegraf.DeliveryInfo) {
+	group := m.groups[info.ID()]
+	delete(m.groups, info.ID())
+	for i := 0; i < group.tokens; i++ {
+		<-m.sem
+	}
+
+	state := group.file
+	state.pending--
+	if !info.Delivered() {
+		state.failed = true
+	}
+	if state.parsed && state.pending == 0 {
+		m.finish(state)
+	}
+}
+
+// finish moves the file to the finished or error directory.  It must be
+// called with the lock held.
+func (m *DirectoryMonitor) finish(state *fileState) {
+	dir := m.FinishedDirectory
+	if state.failed {
+		dir = m.ErrorDirectory
+	}
+
+	if dir == "" {
+		// Without an error directory the file stays in place, it is not read
+		// again until the plugin is restarted.
+		return
+	}
+
+	target := filepath.Join(dir, filepath.Base(state.path))
+	if err := os.Rename(state.path, target); err != nil {
+		m.acc.AddError(fmt.Errorf("moving %q failed: %v", state.path, err))
+		return
+	}
+	m.Log.Debugf("Moved %q to %q", state.path, dir)
+	delete(m.files, state.path)
+}
+
+func newDirectoryMonitor() *DirectoryMonitor {
+	return &DirectoryMonitor{
+		DirectoryDurationThreshold: internal.Duration{Duration: 50 * time.Millisecond},
+		MaxConcurrentFiles:         defaultMaxConcurrentFiles,
+		MaxUndeliveredMetrics:      defaultMaxUndeliveredMetrics,
+		ParseMethod:                defaultParseMethod,
+	}
+}
+
+func init() {
+	inputs.Add("directory_monitor", func() telegraf.Input {
+		return newDirectoryMonitor()
+	})
+}
@@ -0,0 +1,235 @@
+package directory_monitor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/agent"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/telegraf/plugins/parsers"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type testMetricMaker struct{}
+
+func (tm *testMetricMaker) Name() string {
+	return "TestPlugin"
+}
+
+func (tm *testMetricMaker) LogName() string {
+	return tm.Name()
+}
+
+func (tm *testMetricMaker) MakeMetric(metric telegraf.Metric) telegraf.Metric {
+	return metric
+}
+
+func (tm *testMetricMaker) Log() telegraf.Logger {
+	return models.NewLogger("test", "test", "", "")
+}
+
+type testDirs struct {
+	root     string
+	monitor  string
+	finished string
+	errors   string
+}
+
+func newTestDirs(t *testing.T) *testDirs {
+	root, err := ioutil.TempDir("", "directory_monitor")
+	require.NoError(t, err)
+	dirs := &testDirs{
+		root:     root,
+		monitor:  filepath.Join(root, "monitor"),
+		finished: filepath.Join(root, "finished"),
+		errors:   filepath.Join(root, "errors"),
+	}
+	require.NoError(t, os.Mkdir(dirs.monitor, 0755))
+	return dirs
+}
+
+func newTestMonitor(t *testing.T, dirs *testDirs) (*DirectoryMonitor, chan telegraf.Metric) {
+	m := newDirectoryMonitor()
+	m.Directory = dirs.monitor
+	m.FinishedDirectory = dirs.finished
+	m.ErrorDirectory = dirs.errors
+	m.DirectoryDurationThreshold = internal.Duration{}
+	m.Log = testutil.Logger{}
+	m.SetParserFunc(func() (parsers.Parser, error) {
+		return parsers.NewInfluxParser()
+	})
+	require.NoError(t, m.Init())
+
+	metrics := make(chan telegraf.Metric, 100)
+	require.NoError(t, m.Start(agent.NewAccumulator(&testMetricMaker{}, metrics)))
+	return m, metrics
+}
+
+func receive(t *testing.T, metrics chan telegraf.Metric, n int) []telegraf.Metric {
+	var result []telegraf.Metric
+	for i := 0; i < n; i++ {
+		select {
+		case m := <-metrics:
+			result = append(result, m)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timeout waiting for metrics")
+		}
+	}
+	return result
+}
+
+func requireExists(t *testing.T, path string) {
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond, "%s does not exist", path)
+}
+
+func TestFileMovedAfterDelivery(t *testing.T) {
+	dirs := newTestDirs(t)
+	defer os.RemoveAll(dirs.root)
+
+	m, metrics := newTestMonitor(t, dirs)
+	m.FileTag = "file"
+	defer m.Stop()
+
+	data := "cpu value=1 1\ncpu value=2 2\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dirs.monitor, "a.influx"), []byte(data), 0644))
+	require.NoError(t, m.Gather(nil))
+
+	received := receive(t, metrics, 2)
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{
+		testutil.MustMetric("cpu", map[string]string{"file": "a.influx"}, map[string]interface{}{"value": 1.0}, time.Unix(0, 1)),
+		testutil.MustMetric("cpu", map[string]string{"file": "a.influx"}, map[string]interface{}{"value": 2.0}, time.Unix(0, 2)),
+	}, received)
+
+	// Not yet delivered, the file must be neither read again nor moved.
+	require.NoError(t, m.Gather(nil))
+	_, err := os.Stat(filepath.Join(dirs.monitor, "a.influx"))
+	require.NoError(t, err)
+
+	for _, metric := range received {
+		metric.Accept()
+	}
+	requireExists(t, filepath.Join(dirs.finished, "a.influx"))
+	require.Len(t, metrics, 0)
+}
+
+func TestGzipFile(t *testing.T) {
+	dirs := newTestDirs(t)
+	defer os.RemoveAll(dirs.root)
+
+	m, metrics := newTestMonitor(t, dirs)
+	defer m.Stop()
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte("cpu value=1 1\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dirs.monitor, "a.influx.gz"), buf.Bytes(), 0644))
+
+	require.NoError(t, m.Gather(nil))
+	received := receive(t, metrics, 1)
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{
+		testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"value": 1.0}, time.Unix(0, 1)),
+	}, received)
+
+	received[0].Accept()
+	requireExists(t, filepath.Join(dirs.finished, "a.influx.gz"))
+}
+
+func TestUndeliveredFileMovedToErrorDirectory(t *testing.T) {
+	dirs := newTestDirs(t)
+	defer os.RemoveAll(dirs.root)
+
+	m, metrics := newTestMonitor(t, dirs)
+	defer m.Stop()
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dirs.monitor, "a.influx"), []byte("cpu value=1 1\n"), 0644))
+	require.NoError(t, m.Gather(nil))
+
+	receive(t, metrics, 1)[0].Reject()
+	requireExists(t, filepath.Join(dirs.errors, "a.influx"))
+}
+
+func TestParseErrorMovedToErrorDirectory(t *testing.T) {
+	dirs := newTestDirs(t)
+	defer os.RemoveAll(dirs.root)
+
+	m, metrics := newTestMonitor(t, dirs)
+	defer m.Stop()
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dirs.monitor, "a.influx"), []byte("not influx\n"), 0644))
+	require.NoError(t, m.Gather(nil))
+
+	requireExists(t, filepath.Join(dirs.errors, "a.influx"))
+	require.Len(t, metrics, 0)
+}
+
+func TestFilePatternsAndConcurrency(t *testing.T) {
+	dirs := newTestDirs(t)
+	defer os.RemoveAll(dirs.root)
+
+	m := newDirectoryMonitor()
+	m.Directory = dirs.monitor
+	m.FinishedDirectory = dirs.finished
+	m.FilesToMonitor = []string{"*.influx"}
+	m.FilesToIgnore = []string{"skip*"}
+	m.DirectoryDurationThreshold = internal.Duration{}
+	m.Log = testutil.Logger{}
+	m.SetParserFunc(func() (parsers.Parser, error) {
+		return parsers.NewInfluxParser()
+	})
+	require.NoError(t, m.Init())
+
+	metrics := make(chan telegraf.Metric, 100)
+	require.NoError(t, m.Start(agent.NewAccumulator(&testMetricMaker{}, metrics)))
+	defer m.Stop()
+
+	for _, name := range []string{"a.influx", "b.influx", "skip.influx", "c.csv", ".hidden.influx"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dirs.monitor, name), []byte("cpu value=1 1\n"), 0644))
+	}
+
+	// Only one file is processed at a time.
+	require.NoError(t, m.Gather(nil))
+	receive(t, metrics, 1)[0].Accept()
+	require.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.files) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Len(t, metrics, 0)
+
+	require.NoError(t, m.Gather(nil))
+	receive(t, metrics, 1)[0].Accept()
+	requireExists(t, filepath.Join(dirs.finished, "a.influx"))
+	requireExists(t, filepath.Join(dirs.finished, "b.influx"))
+
+	remaining, err := ioutil.ReadDir(dirs.monitor)
+	require.NoError(t, err)
+	var names []string
+	for _, info := range remaining {
+		names = append(names, info.Name())
+	}
+	require.ElementsMatch(t, []string{"skip.influx", "c.csv", ".hidden.influx"}, names)
+}
+
+func TestInitErrors(t *testing.T) {
+	m := newDirectoryMonitor()
+	require.Error(t, m.Init())
+
+	m = newDirectoryMonitor()
+	m.Directory = "monitor"
+	m.FinishedDirectory = "finished"
+	m.ParseMethod = "all"
+	require.Error(t, m.Init())
+}
@@ -2,7 +2,9 @@ package exec
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
@@ -29,6 +31,21 @@ const sampleConfig = `
   ## Timeout for each command to complete.
   timeout = "5s"
 
+  ## Maximum number of commands to run at the same time, 0 for no limit.
+  # concurrency = 0
+
+  ## Environment variables of the commands in addition to the environment
+  ## of Telegraf, in the form "KEY=value".
+  # environment = ["LD_LIBRARY_PATH=/opt/custom/lib64:/usr/local/libs"]
+
+  ## Working directory of the commands, defaults to the working directory of
+  ## Telegraf.
+  # working_directory = ""
+
+  ## Add an exec_status metric for each command, with its exit code,
+  ## duration and the first line of stderr, also when the command fails.
+  # status_metric = false
+
   ## measurement name suffix (for separating different commands)
   name_suffix = "_mycollector"
 
@@ -42,9 +59,13 @@ const sampleConfig = `
 const MaxStderrBytes = 512
 
 type Exec struct {
-	Commands []string
-	Command  string
-	Timeout  internal.Duration
+	Commands         []string
+	Command          string
+	Timeout          internal.Duration
+	Concurrency      int      `toml:"concurrency"`
+	Environment      []string `toml:"environment"`
+	WorkingDirectory string   `toml:"working_directory"`
+	StatusMetric     bool     `toml:"status_metric"`
 
 	parser parsers.Parser
 
@@ -60,12 +81,19 @@ func NewExec() *Exec {
 }
 
 type Runner interface {
-	Run(string, time.Duration) ([]byte, []byte, error)
+	Run(context.Context, string, time.Duration) ([]byte, []byte, error)
 }
 
-type CommandRunner struct{}
+type CommandRunner struct {
+	// Environment is added to the environment of the Telegraf process.
+	Environment []string
+	Dir         string
+}
 
+// Run runs the command, the command is killed when the timeout expires or the
+// context is done.
 func (c CommandRunner) Run(
+	ctx context.Context,
 	command string,
 	timeout time.Duration,
 ) ([]byte, []byte, error) {
@@ -74,7 +102,11 @@ func (c CommandRunner) Run(
 		return nil, nil, fmt.Errorf("exec: unable to parse command, %s", err)
 	}
 
-	cmd := exec.Command(split_cmd[0], split_cmd[1:]...)
+	cmd := exec.CommandContext(ctx, split_cmd[0], split_cmd[1:]...)
+	if len(c.Environment) > 0 {
+		cmd.Env = append(os.Environ(), c.Environment...)
+	}
+	cmd.Dir = c.Dir
 
 	var (
 		out    bytes.Buffer
@@ -84,6 +116,9 @@ func (c CommandRunner) Run(
 	cmd.Stderr = &stderr
 
 	runErr := internal.RunTimeout(cmd, timeout)
+	if ctx.Err() != nil {
+		runErr = ctx.Err()
+	}
 
 	out = removeCarriageReturns(out)
 	if stderr.Len() > 0 {
@@ -140,11 +175,15 @@ func removeCarriageReturns(b bytes.Buffer) bytes.Buffer {
 
 }
 
-func (e *Exec) ProcessCommand(command string, acc telegraf.Accumulator, wg *sync.WaitGroup) {
+func (e *Exec) ProcessCommand(ctx context.Context, command string, acc telegraf.Accumulator, wg *sync.WaitGroup) {
 	defer wg.Done()
 	_, isNagios := e.parser.(*nagios.NagiosParser)
 
-	out, errbuf, runErr := e.runner.Run(command, e.Timeout.Duration)
+	start := time.Now()
+	out, errbuf, runErr := e.runner.Run(ctx, command, e.Timeout.Duration)
+	if e.StatusMetric {
+		addStatus(acc, command, time.Since(start), errbuf, runErr)
+	}
 	if !isNagios && runErr != nil {
 		err := fmt.Errorf("exec: %s for command '%s': %s", runErr, command, string(errbuf))
 		acc.AddError(err)
@@ -169,6 +208,32 @@ func (e *Exec) ProcessCommand(command string, acc telegraf.Accumulator, wg *sync
 	}
 }
 
+// addStatus adds the exec_status metric with the result of a command.
+func addStatus(acc telegraf.Accumulator, command string, duration time.Duration, stderr []byte, runErr error) {
+	tags := map[string]string{"command": command}
+	fields := map[string]interface{}{
+		"duration": duration.Seconds(),
+		"stderr":   string(stderr),
+	}
+
+	switch err := runErr.(type) {
+	case nil:
+		tags["result"] = "success"
+		fields["exit_code"] = 0
+	case *exec.ExitError:
+		tags["result"] = "failure"
+		fields["exit_code"] = err.ExitCode()
+	default:
+		if runErr == internal.TimeoutErr || runErr == context.DeadlineExceeded {
+			tags["result"] = "timeout"
+		} else {
+			tags["result"] = "error"
+		}
+	}
+
+	acc.AddFields("exec_status", fields, tags)
+}
+
 func (e *Exec) SampleConfig() string {
 	return sampleConfig
 }
@@ -182,6 +247,12 @@ func (e *Exec) SetParser(parser parsers.Parser) {
 }
 
 func (e *Exec) Gather(acc telegraf.Accumulator) error {
+	return e.GatherContext(context.Background(), acc)
+}
+
+// GatherContext runs the commands, the commands still running are killed when
+// the context is done.
+func (e *Exec) GatherContext(ctx context.Context, acc telegraf.Accumulator) error {
 	var wg sync.WaitGroup
 	// Legacy single command support
 	if e.Command != "" {
@@ -220,15 +291,44 @@ func (e *Exec) Gather(acc telegraf.Accumulator) error {
 		}
 	}
 
+	var limit chan struct{}
+	if e.Concurrency > 0 {
+		limit = make(chan struct{}, e.Concurrency)
+	}
+
 	wg.Add(len(commands))
 	for _, command := range commands {
-		go e.ProcessCommand(command, acc, &wg)
+		if limit == nil {
+			go e.ProcessCommand(ctx, command, acc, &wg)
+			continue
+		}
+
+		limit <- struct{}{}
+		go func(command string) {
+			defer func() { <-limit }()
+			e.ProcessCommand(ctx, command, acc, &wg)
+		}(command)
 	}
 	wg.Wait()
 	return nil
 }
 
 func (e *Exec) Init() error {
+	if e.Concurrency < 0 {
+		return fmt.Errorf("concurrency must not be negative")
+	}
+	for _, env := range e.Environment {
+		if !strings.Contains(env, "=") {
+			return fmt.Errorf("invalid environment variable %q, expected KEY=value", env)
+		}
+	}
+
+	if _, ok := e.runner.(CommandRunner); ok {
+		e.runner = CommandRunner{
+			Environment: e.Environment,
+			Dir:         e.WorkingDirectory,
+		}
+	}
 	return nil
 }
 
@@ -2,11 +2,18 @@ package exec
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/plugins/parsers"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
@@ -86,7 +93,7 @@ func newRunnerMock(out []byte, errout []byte, err error) Runner {
 	}
 }
 
-func (r runnerMock) Run(command string, _ time.Duration) ([]byte, []byte, error) {
+func (r runnerMock) Run(_ context.Context, command string, _ time.Duration) ([]byte, []byte, error) {
 	return r.out, r.errout, r.err
 }
 
@@ -202,6 +209,151 @@ func TestExecCommandWithoutGlobAndPath(t *testing.T) {
 	acc.AssertContainsFields(t, "metric", fields)
 }
 
+func TestExecEnvironmentAndWorkingDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "exec")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	parser, _ := parsers.NewValueParser("metric", "string", nil)
+	e := NewExec()
+	e.Commands = []string{`sh -c 'echo "$FOO:$(pwd)"'`}
+	e.Environment = []string{"FOO=bar"}
+	e.WorkingDirectory = dir
+	e.SetParser(parser)
+	require.NoError(t, e.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(e.Gather))
+	acc.AssertContainsFields(t, "metric", map[string]interface{}{
+		"value": "bar:" + dir,
+	})
+}
+
+func TestExecInvalidEnvironment(t *testing.T) {
+	e := NewExec()
+	e.Environment = []string{"FOO"}
+	require.Error(t, e.Init())
+}
+
+func TestExecStatusMetric(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on windows")
+	}
+
+	parser, _ := parsers.NewValueParser("metric", "string", nil)
+	e := NewExec()
+	e.Commands = []string{`sh -c 'echo failed >&2; exit 3'`}
+	e.StatusMetric = true
+	e.SetParser(parser)
+	require.NoError(t, e.Init())
+
+	var acc testutil.Accumulator
+	require.Error(t, acc.GatherError(e.Gather))
+
+	m, ok := acc.Get("exec_status")
+	require.True(t, ok)
+	require.Equal(t, map[string]string{
+		"command": `sh -c 'echo failed >&2; exit 3'`,
+		"result":  "failure",
+	}, m.Tags)
+	require.Equal(t, 3, m.Fields["exit_code"])
+	require.Equal(t, "failed", m.Fields["stderr"])
+	require.IsType(t, float64(0), m.Fields["duration"])
+}
+
+func TestExecStatusMetricRunError(t *testing.T) {
+	parser, _ := parsers.NewParser(&parsers.Config{
+		DataFormat: "json",
+		MetricName: "exec",
+	})
+	e := &Exec{
+		Log:          testutil.Logger{},
+		runner:       newRunnerMock(nil, nil, fmt.Errorf("not found")),
+		Commands:     []string{"badcommand"},
+		StatusMetric: true,
+		parser:       parser,
+	}
+
+	var acc testutil.Accumulator
+	require.Error(t, acc.GatherError(e.Gather))
+
+	m, ok := acc.Get("exec_status")
+	require.True(t, ok)
+	require.Equal(t, "error", m.Tags["result"])
+	require.NotContains(t, m.Fields, "exit_code")
+}
+
+func TestExecGatherContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test on windows")
+	}
+
+	parser, _ := parsers.NewValueParser("metric", "string", nil)
+	e := NewExec()
+	e.Commands = []string{"sleep 10"}
+	e.Timeout = internal.Duration{Duration: time.Minute}
+	e.StatusMetric = true
+	e.SetParser(parser)
+	require.NoError(t, e.Init())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// The command is killed once the context is done.
+	start := time.Now()
+	var acc testutil.Accumulator
+	require.NoError(t, e.GatherContext(ctx, &acc))
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+	require.Len(t, acc.Errors, 1)
+
+	m, ok := acc.Get("exec_status")
+	require.True(t, ok)
+	require.Equal(t, "timeout", m.Tags["result"])
+}
+
+type concurrencyRunner struct {
+	running int32
+	max     int32
+	mu      sync.Mutex
+}
+
+func (r *concurrencyRunner) Run(_ context.Context, command string, _ time.Duration) ([]byte, []byte, error) {
+	n := atomic.AddInt32(&r.running, 1)
+	defer atomic.AddInt32(&r.running, -1)
+
+	r.mu.Lock()
+	if n > r.max {
+		r.max = n
+	}
+	r.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+	return []byte("1"), nil, nil
+}
+
+func TestExecConcurrency(t *testing.T) {
+	parser, _ := parsers.NewValueParser("metric", "integer", nil)
+	runner := &concurrencyRunner{}
+	e := &Exec{
+		Log:         testutil.Logger{},
+		runner:      runner,
+		Commands:    []string{"a", "b", "c", "d", "e"},
+		Concurrency: 2,
+		parser:      parser,
+	}
+
+	var acc testutil.Accumulator
+	require.NoError(t, acc.GatherError(e.Gather))
+	require.Equal(t, 5, len(acc.GetTelegrafMetrics()))
+	require.Equal(t, int32(2), runner.max)
+}
+
 func TestTruncate(t *testing.T) {
 	tests := []struct {
 		name string
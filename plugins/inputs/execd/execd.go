@@ -11,6 +11,7 @@ import (
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/config"
 	"github.com/influxdata/telegraf/internal/process"
+	"github.com/influxdata/telegraf/plugins/common/control"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
 	"github.com/influxdata/telegraf/plugins/parsers/influx"
@@ -33,6 +34,26 @@ const sampleConfig = `
   ## Delay before the process is restarted after an unexpected termination
   restart_delay = "10s"
 
+  ## Exchange framed JSON messages with the process on the file descriptors
+  ## 3 and 4, for structured logs and errors, heartbeats and handing over
+  ## the plugin configuration.  The process must implement
+  ## the protocol, for example by using the Telegraf Go shim.  Not available
+  ## on Windows.
+  # control_channel = false
+
+  ## Interval of the heartbeats sent over the control channel, the process is
+  ## restarted if it sends no message within the heartbeat timeout, which
+  ## defaults to three intervals.  Heartbeats are disabled if set to 0.
+  # heartbeat_interval = "0s"
+  # heartbeat_timeout = "0s"
+
+  ## Plugin configuration handed over to the process at startup, in the
+  ## format of the shim's configuration file.
+  # plugin_config = '''
+  #   [[inputs.my_plugin]]
+  #     option = "value"
+  # '''
+
   ## Data format to consume.
   ## Each data format has its own unique set of configuration options, read
   ## more about them here:
@@ -45,8 +66,10 @@ type Execd struct {
 	Signal       string          `toml:"signal"`
 	RestartDelay config.Duration `toml:"restart_delay"`
 	Log          telegraf.Logger `toml:"-"`
+	control.Config
 
 	process *process.Process
+	control *control.Client
 	acc     telegraf.Accumulator
 	parser  parsers.Parser
 }
@@ -75,6 +98,12 @@ func (e *Execd) Start(acc telegraf.Accumulator) error {
 	e.process.ReadStdoutFn = e.cmdReadOut
 	e.process.ReadStderrFn = e.cmdReadErr
 
+	if e.ControlChannel {
+		e.control = control.NewClient(e.Config, e.Log)
+		e.control.OnError = acc.AddError
+		e.control.Attach(e.process)
+	}
+
 	if err = e.process.Start(); err != nil {
 		// if there was only one argument, and it contained spaces, warn the user
 		// that they may have configured it wrong.
@@ -157,7 +186,7 @@ func (e *Execd) Init() error {
 	if len(e.Command) == 0 {
 		return errors.New("no command specified")
 	}
-	return nil
+	return e.Config.Validate()
 }
 
 func init() {
@@ -147,7 +147,7 @@ func (tm *TestMetricMaker) MakeMetric(metric telegraf.Metric) telegraf.Metric {
 }
 
 func (tm *TestMetricMaker) Log() telegraf.Logger {
-	return models.NewLogger("TestPlugin", "test", "")
+	return models.NewLogger("TestPlugin", "test", "", "")
 }
 
 var counter = flag.Bool("counter", false,
@@ -2,11 +2,13 @@ package http_test
 
 import (
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	plugin "github.com/influxdata/telegraf/plugins/inputs/http"
 	"github.com/influxdata/telegraf/plugins/parsers"
@@ -106,6 +108,33 @@ func TestInvalidStatusCode(t *testing.T) {
 	require.Error(t, acc.GatherError(plugin.Gather))
 }
 
+func TestGatherContextCancelsRequest(t *testing.T) {
+	release := make(chan struct{})
+	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer fakeServer.Close()
+	defer close(release)
+
+	plugin := &plugin.HTTP{
+		URLs: []string{fakeServer.URL + "/endpoint"},
+	}
+	p, _ := parsers.NewParser(&parsers.Config{
+		DataFormat: "json",
+		MetricName: "metricName",
+	})
+	plugin.SetParser(p)
+	require.NoError(t, plugin.Init())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.GatherContext(ctx, &acc))
+	require.Len(t, acc.Errors, 1)
+	require.Contains(t, acc.Errors[0].Error(), context.DeadlineExceeded.Error())
+}
+
 func TestSuccessStatusCodes(t *testing.T) {
 	fakeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusAccepted)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/Shopify/sarama"
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/internal/choice"
 	"github.com/influxdata/telegraf/plugins/common/kafka"
 	"github.com/influxdata/telegraf/plugins/common/tls"
 	"github.com/influxdata/telegraf/plugins/inputs"
@@ -26,6 +28,28 @@ const sampleConfig = `
 
   ## When set this tag will be added to all metrics with the topic as the value.
   # topic_tag = ""
+  ## When set this field will be added to all metrics with the topic as the value.
+  # topic_field = ""
+
+  ## Add the message key as tag or field with the given name.
+  # key_tag = ""
+  # key_field = ""
+
+  ## Add the message headers with the given keys as tags or fields, named
+  ## after the header key.
+  # header_tags = []
+  # header_fields = []
+
+  ## Add the partition as tag or field, and the offset as field, with the
+  ## given name.
+  # partition_tag = ""
+  # partition_field = ""
+  # offset_field = ""
+
+  ## Timestamp of the metrics; one of "metric" to use the time set by the
+  ## parser, or "message" to use the timestamp of the Kafka message.
+  ## The message timestamp requires Kafka 0.10.0.0 or later.
+  # timestamp_source = "metric"
 
   ## Optional Client id
   # client_id = "Telegraf"
@@ -74,6 +98,12 @@ const sampleConfig = `
   ## waiting until the next flush_interval.
   # max_undelivered_messages = 1000
 
+  ## Maximum time to wait on a rebalance for the messages read from the
+  ## revoked partitions to be written by an output, so their offsets are
+  ## committed and the messages are not consumed again by the new owner of the
+  ## partition.  Set to "0s" to give up the partitions immediately.
+  # rebalance_drain_timeout = "10s"
+
   ## Data format to consume.
   ## Each data format has its own unique set of configuration options, read
   ## more about them here:
@@ -85,6 +115,7 @@ const (
 	defaultMaxUndeliveredMessages = 1000
 	defaultMaxMessageLen          = 1000000
 	defaultConsumerGroup          = "telegraf_metrics_consumers"
+	defaultRebalanceDrainTimeout  = 10 * time.Second
 	reconnectDelay                = 5 * time.Second
 )
 
@@ -101,11 +132,22 @@ type KafkaConsumer struct {
 	BalanceStrategy        string   `toml:"balance_strategy"`
 	Topics                 []string `toml:"topics"`
 	TopicTag               string   `toml:"topic_tag"`
+	TopicField             string   `toml:"topic_field"`
+	KeyTag                 string   `toml:"key_tag"`
+	KeyField               string   `toml:"key_field"`
+	HeaderTags             []string `toml:"header_tags"`
+	HeaderFields           []string `toml:"header_fields"`
+	PartitionTag           string   `toml:"partition_tag"`
+	PartitionField         string   `toml:"partition_field"`
+	OffsetField            string   `toml:"offset_field"`
+	TimestampSource        string   `toml:"timestamp_source"`
 	Version                string   `toml:"version"`
 	SASLPassword           string   `toml:"sasl_password"`
 	SASLUsername           string   `toml:"sasl_username"`
 	SASLVersion            *int     `toml:"sasl_version"`
 
+	RebalanceDrainTimeout *internal.Duration `toml:"rebalance_drain_timeout"`
+
 	EnableTLS *bool `toml:"enable_tls"`
 	tls.ClientConfig
 
@@ -155,6 +197,17 @@ func (k *KafkaConsumer) Init() error {
 	if k.ConsumerGroup == "" {
 		k.ConsumerGroup = defaultConsumerGroup
 	}
+	if k.RebalanceDrainTimeout == nil {
+		k.RebalanceDrainTimeout = &internal.Duration{Duration: defaultRebalanceDrainTimeout}
+	}
+
+	switch k.TimestampSource {
+	case "":
+		k.TimestampSource = "metric"
+	case "metric", "message":
+	default:
+		return fmt.Errorf("invalid timestamp_source %q", k.TimestampSource)
+	}
 
 	config := sarama.NewConfig()
 	config.Consumer.Return.Errors = true
@@ -259,6 +312,17 @@ func (k *KafkaConsumer) Start(acc telegraf.Accumulator) error {
 			handler := NewConsumerGroupHandler(acc, k.MaxUndeliveredMessages, k.parser)
 			handler.MaxMessageLen = k.MaxMessageLen
 			handler.TopicTag = k.TopicTag
+			handler.TopicField = k.TopicField
+			handler.KeyTag = k.KeyTag
+			handler.KeyField = k.KeyField
+			handler.HeaderTags = k.HeaderTags
+			handler.HeaderFields = k.HeaderFields
+			handler.PartitionTag = k.PartitionTag
+			handler.PartitionField = k.PartitionField
+			handler.OffsetField = k.OffsetField
+			handler.MessageTimestamp = k.TimestampSource == "message"
+			handler.DrainTimeout = k.RebalanceDrainTimeout.Duration
+			handler.stopped = ctx.Done()
 			err := k.consumer.Consume(ctx, k.Topics, handler)
 			if err != nil {
 				acc.AddError(err)
@@ -310,8 +374,21 @@ func NewConsumerGroupHandler(acc telegraf.Accumulator, maxUndelivered int, parse
 
 // ConsumerGroupHandler is a sarama.ConsumerGroupHandler implementation.
 type ConsumerGroupHandler struct {
-	MaxMessageLen int
-	TopicTag      string
+	MaxMessageLen    int
+	TopicTag         string
+	TopicField       string
+	KeyTag           string
+	KeyField         string
+	HeaderTags       []string
+	HeaderFields     []string
+	PartitionTag     string
+	PartitionField   string
+	OffsetField      string
+	MessageTimestamp bool
+
+	// DrainTimeout is the maximum time to wait in Cleanup for the delivery
+	// of the messages of the session.
+	DrainTimeout time.Duration
 
 	acc    telegraf.TrackingAccumulator
 	sem    semaphore
@@ -319,8 +396,14 @@ type ConsumerGroupHandler struct {
 	wg     sync.WaitGroup
 	cancel context.CancelFunc
 
+	// stopped is closed when the plugin is stopped, the outputs are not
+	// written until all inputs are stopped so there is no point in waiting
+	// for deliveries.
+	stopped <-chan struct{}
+
 	mu          sync.Mutex
 	undelivered map[telegraf.TrackingID]Message
+	drained     chan empty
 }
 
 // Setup is called once when a new session is opened.  It setups up the handler
@@ -367,6 +450,11 @@ func (h *ConsumerGroupHandler) onDelivery(track telegraf.DeliveryInfo) {
 
 	delete(h.undelivered, track.ID())
 	<-h.sem
+
+	if len(h.undelivered) == 0 && h.drained != nil {
+		close(h.drained)
+		h.drained = nil
+	}
 }
 
 // Reserve blocks until there is an available slot for a new message.
@@ -399,10 +487,8 @@ func (h *ConsumerGroupHandler) Handle(session sarama.ConsumerGroupSession, msg *
 		return err
 	}
 
-	if len(h.TopicTag) > 0 {
-		for _, metric := range metrics {
-			metric.AddTag(h.TopicTag, msg.Topic)
-		}
+	for _, metric := range metrics {
+		h.addMetadata(metric, msg)
 	}
 
 	h.mu.Lock()
@@ -412,6 +498,55 @@ func (h *ConsumerGroupHandler) Handle(session sarama.ConsumerGroupSession, msg *
 	return nil
 }
 
+// addMetadata adds the selected message metadata to the metric.
+func (h *ConsumerGroupHandler) addMetadata(metric telegraf.Metric, msg *sarama.ConsumerMessage) {
+	if h.TopicTag != "" {
+		metric.AddTag(h.TopicTag, msg.Topic)
+	}
+	if h.TopicField != "" {
+		metric.AddField(h.TopicField, msg.Topic)
+	}
+
+	if msg.Key != nil {
+		if h.KeyTag != "" {
+			metric.AddTag(h.KeyTag, string(msg.Key))
+		}
+		if h.KeyField != "" {
+			metric.AddField(h.KeyField, string(msg.Key))
+		}
+	}
+
+	if len(h.HeaderTags) > 0 || len(h.HeaderFields) > 0 {
+		for _, header := range msg.Headers {
+			if header == nil {
+				continue
+			}
+			key := string(header.Key)
+			if choice.Contains(key, h.HeaderTags) {
+				metric.AddTag(key, string(header.Value))
+			}
+			if choice.Contains(key, h.HeaderFields) {
+				metric.AddField(key, string(header.Value))
+			}
+		}
+	}
+
+	if h.PartitionTag != "" {
+		metric.AddTag(h.PartitionTag, strconv.FormatInt(int64(msg.Partition), 10))
+	}
+	if h.PartitionField != "" {
+		metric.AddField(h.PartitionField, int64(msg.Partition))
+	}
+	if h.OffsetField != "" {
+		metric.AddField(h.OffsetField, msg.Offset)
+	}
+
+	// Brokers before Kafka 0.10.0.0 do not set a timestamp.
+	if h.MessageTimestamp && !msg.Timestamp.IsZero() {
+		metric.SetTime(msg.Timestamp)
+	}
+}
+
 // ConsumeClaim is called once each claim in a goroutine and must be
 // thread-safe.  Should run until the claim is closed.
 func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
@@ -439,13 +574,48 @@ func (h *ConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession,
 }
 
 // Cleanup stops the internal goroutine and is called after all ConsumeClaim
-// functions have completed.
+// functions have completed.  The offsets of messages delivered before
+// Cleanup returns are still committed, so on a rebalance it waits for the
+// messages in flight to be delivered before the partitions are given up.
 func (h *ConsumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	h.drain()
 	h.cancel()
 	h.wg.Wait()
 	return nil
 }
 
+// drain waits until all messages of the session are delivered, the drain
+// timeout is reached or the plugin is stopped.
+func (h *ConsumerGroupHandler) drain() {
+	if h.DrainTimeout <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	pending := len(h.undelivered)
+	if pending == 0 {
+		h.mu.Unlock()
+		return
+	}
+	h.drained = make(chan empty)
+	drained := h.drained
+	h.mu.Unlock()
+
+	timer := time.NewTimer(h.DrainTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-drained:
+	case <-h.stopped:
+	case <-timer.C:
+		h.mu.Lock()
+		pending = len(h.undelivered)
+		h.drained = nil
+		h.mu.Unlock()
+		log.Printf("W! [inputs.kafka_consumer] Giving up partitions with %d undelivered messages, they may be consumed again", pending)
+	}
+}
+
 func init() {
 	inputs.Add("kafka_consumer", func() telegraf.Input {
 		return &KafkaConsumer{}
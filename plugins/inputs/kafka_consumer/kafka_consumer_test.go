@@ -7,6 +7,9 @@ import (
 
 	"github.com/Shopify/sarama"
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/agent"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/models"
 	"github.com/influxdata/telegraf/plugins/common/tls"
 	"github.com/influxdata/telegraf/plugins/parsers/value"
 	"github.com/influxdata/telegraf/testutil"
@@ -394,3 +397,158 @@ func TestConsumerGroupHandler_Handle(t *testing.T) {
 		})
 	}
 }
+
+func TestConsumerGroupHandler_Metadata(t *testing.T) {
+	ts := time.Unix(1600000000, 0)
+	msg := &sarama.ConsumerMessage{
+		Topic:     "telegraf",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("key"),
+		Timestamp: ts,
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("source"), Value: []byte("app")},
+			{Key: []byte("trace"), Value: []byte("abc")},
+			{Key: []byte("ignored"), Value: []byte("x")},
+		},
+		Value: []byte("42"),
+	}
+
+	acc := &testutil.Accumulator{}
+	parser := &value.ValueParser{MetricName: "cpu", DataType: "int"}
+	cg := NewConsumerGroupHandler(acc, 1, parser)
+	cg.TopicField = "topic"
+	cg.KeyTag = "key"
+	cg.HeaderTags = []string{"source"}
+	cg.HeaderFields = []string{"trace"}
+	cg.PartitionTag = "partition"
+	cg.OffsetField = "offset"
+	cg.MessageTimestamp = true
+
+	ctx := context.Background()
+	session := &FakeConsumerGroupSession{ctx: ctx}
+	require.NoError(t, cg.Reserve(ctx))
+	require.NoError(t, cg.Handle(session, msg))
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"cpu",
+			map[string]string{
+				"key":       "key",
+				"source":    "app",
+				"partition": "3",
+			},
+			map[string]interface{}{
+				"value":  42,
+				"topic":  "telegraf",
+				"trace":  "abc",
+				"offset": int64(42),
+			},
+			ts,
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics())
+}
+
+func TestInitTimestampSource(t *testing.T) {
+	plugin := &KafkaConsumer{
+		TimestampSource: "inner",
+		Log:             testutil.Logger{},
+	}
+	require.Error(t, plugin.Init())
+}
+
+type testMetricMaker struct{}
+
+func (tm *testMetricMaker) Name() string {
+	return "TestPlugin"
+}
+
+func (tm *testMetricMaker) LogName() string {
+	return tm.Name()
+}
+
+func (tm *testMetricMaker) MakeMetric(metric telegraf.Metric) telegraf.Metric {
+	return metric
+}
+
+func (tm *testMetricMaker) Log() telegraf.Logger {
+	return models.NewLogger("test", "test", "", "")
+}
+
+type markingSession struct {
+	FakeConsumerGroupSession
+	marked chan *sarama.ConsumerMessage
+}
+
+func (s *markingSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.marked <- msg
+}
+
+func TestConsumerGroupHandler_CleanupWaitsForDelivery(t *testing.T) {
+	metrics := make(chan telegraf.Metric, 1)
+	acc := agent.NewAccumulator(&testMetricMaker{}, metrics)
+	parser := &value.ValueParser{MetricName: "cpu", DataType: "int"}
+	cg := NewConsumerGroupHandler(acc, 1, parser)
+	cg.DrainTimeout = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := &markingSession{
+		FakeConsumerGroupSession: FakeConsumerGroupSession{ctx: ctx},
+		marked:                   make(chan *sarama.ConsumerMessage, 1),
+	}
+
+	require.NoError(t, cg.Setup(session))
+	msg := &sarama.ConsumerMessage{Topic: "telegraf", Value: []byte("42")}
+	require.NoError(t, cg.Reserve(ctx))
+	require.NoError(t, cg.Handle(session, msg))
+
+	// The session ends with the message still in flight.
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.NoError(t, cg.Cleanup(session))
+	}()
+
+	select {
+	case <-done:
+		require.FailNow(t, "cleanup returned before delivery")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	m := <-metrics
+	m.Accept()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "cleanup did not return after delivery")
+	}
+	require.Equal(t, msg, <-session.marked)
+}
+
+func TestConsumerGroupHandler_CleanupDrainTimeout(t *testing.T) {
+	metrics := make(chan telegraf.Metric, 1)
+	acc := agent.NewAccumulator(&testMetricMaker{}, metrics)
+	parser := &value.ValueParser{MetricName: "cpu", DataType: "int"}
+	cg := NewConsumerGroupHandler(acc, 1, parser)
+	cg.DrainTimeout = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := &FakeConsumerGroupSession{ctx: ctx}
+
+	require.NoError(t, cg.Setup(session))
+	require.NoError(t, cg.Reserve(ctx))
+	require.NoError(t, cg.Handle(session, &sarama.ConsumerMessage{Topic: "telegraf", Value: []byte("42")}))
+
+	cancel()
+	require.NoError(t, cg.Cleanup(session))
+}
+
+func TestInitRebalanceDrainTimeout(t *testing.T) {
+	plugin := &KafkaConsumer{Log: testutil.Logger{}}
+	require.NoError(t, plugin.Init())
+	require.Equal(t, &internal.Duration{Duration: defaultRebalanceDrainTimeout}, plugin.RebalanceDrainTimeout)
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/eclipse/paho.mqtt.golang"
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/plugins/common/tls"
 	"github.com/influxdata/telegraf/plugins/inputs"
@@ -50,6 +51,10 @@ type MQTTConsumer struct {
 	QoS                    int               `toml:"qos"`
 	ConnectionTimeout      internal.Duration `toml:"connection_timeout"`
 	MaxUndeliveredMessages int               `toml:"max_undelivered_messages"`
+	Protocol               string            `toml:"protocol"`
+	UserPropertyTags       []string          `toml:"user_property_tags"`
+
+	TopicParsing []TopicParsingConfig `toml:"topic_parsing"`
 
 	parser parsers.Parser
 
@@ -70,6 +75,8 @@ type MQTTConsumer struct {
 	sem           semaphore
 	messages      map[telegraf.TrackingID]bool
 	topicTag      string
+	topicParsers  []*topicParser
+	userProperty  filter.Filter
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -103,6 +110,13 @@ var sampleConfig = `
   ## resuming unacknowledged messages.
   # qos = 0
 
+  ## MQTT protocol version, either "3.1.1" or "5".
+  # protocol = "3.1.1"
+
+  ## MQTT v5 user properties of the messages to add as tags, glob patterns are
+  ## supported.  Requires protocol = "5".
+  # user_property_tags = ["*"]
+
   ## Connection timeout for initial connection in seconds
   # connection_timeout = "30s"
 
@@ -142,6 +156,19 @@ var sampleConfig = `
   ## more about them here:
   ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_INPUT.md
   data_format = "influx"
+
+  ## Topic parsing sets the measurement name, tags and fields of the metrics
+  ## from the segments of the topics matching the topic pattern.  The
+  ## measurement, tags and fields patterns have one segment for each segment
+  ## of the topic, use "_" to skip a segment.
+  # [[inputs.mqtt_consumer.topic_parsing]]
+  #   topic = "sensors/+/+/+"
+  #   measurement = "_/_/measurement/_"
+  #   tags = "_/site/_/_"
+  #   fields = "_/_/_/sensor_id"
+  #   ## Types of the fields, one of "string", "int", "uint", "float" or "bool".
+  #   [inputs.mqtt_consumer.topic_parsing.types]
+  #     sensor_id = "int"
 `
 
 func (m *MQTTConsumer) SampleConfig() string {
@@ -176,12 +203,36 @@ func (m *MQTTConsumer) Init() error {
 		m.topicTag = *m.TopicTag
 	}
 
-	opts, err := m.createOpts()
+	switch m.Protocol {
+	case "", "3.1.1":
+		if len(m.UserPropertyTags) > 0 {
+			return errors.New("user_property_tags requires protocol \"5\"")
+		}
+	case "5":
+		m.clientFactory = newV5Client
+	default:
+		return fmt.Errorf("unknown protocol %q", m.Protocol)
+	}
+
+	var err error
+	m.userProperty, err = filter.Compile(m.UserPropertyTags)
 	if err != nil {
-		return err
+		return fmt.Errorf("user_property_tags: %v", err)
+	}
+
+	m.topicParsers = m.topicParsers[:0]
+	for _, cfg := range m.TopicParsing {
+		p, err := newTopicParser(cfg)
+		if err != nil {
+			return err
+		}
+		m.topicParsers = append(m.topicParsers, p)
 	}
 
-	m.opts = opts
+	m.opts, err = m.createOpts()
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -282,13 +333,36 @@ func (m *MQTTConsumer) onMessage(acc telegraf.TrackingAccumulator, msg mqtt.Mess
 		return err
 	}
 
+	topic := msg.Topic()
 	if m.topicTag != "" {
-		topic := msg.Topic()
 		for _, metric := range metrics {
 			metric.AddTag(m.topicTag, topic)
 		}
 	}
 
+	for _, p := range m.topicParsers {
+		for _, metric := range metrics {
+			if err := p.apply(metric, topic); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Only MQTT v5 messages have user properties.
+	type userProperties interface {
+		UserProperties() map[string]string
+	}
+	if msg, ok := msg.(userProperties); ok && m.userProperty != nil {
+		for key, value := range msg.UserProperties() {
+			if !m.userProperty.Match(key) {
+				continue
+			}
+			for _, metric := range metrics {
+				metric.AddTag(key, value)
+			}
+		}
+	}
+
 	id := acc.AddTrackingMetricGroup(metrics)
 	m.messages[id] = true
 	return nil
@@ -4,8 +4,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/eclipse/paho.golang/packets"
 	"github.com/eclipse/paho.mqtt.golang"
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/common/mqtt/mqtttest"
 	"github.com/influxdata/telegraf/plugins/parsers"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/require"
@@ -376,3 +378,210 @@ func TestSubscribeNotCalledIfSession(t *testing.T) {
 
 	require.Equal(t, client.subscribeCallCount, 0)
 }
+
+type topicMessage struct {
+	Message
+	topic   string
+	payload string
+}
+
+func (m *topicMessage) Topic() string {
+	return m.topic
+}
+
+func (m *topicMessage) Payload() []byte {
+	return []byte(m.payload)
+}
+
+func TestTopicParsing(t *testing.T) {
+	var handler mqtt.MessageHandler
+	client := &FakeClient{
+		ConnectF: func() mqtt.Token {
+			return &FakeToken{}
+		},
+		AddRouteF: func(topic string, callback mqtt.MessageHandler) {
+			handler = callback
+		},
+		SubscribeMultipleF: func(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+			return &FakeToken{}
+		},
+		DisconnectF: func(quiesce uint) {
+		},
+	}
+	plugin := New(func(o *mqtt.ClientOptions) Client {
+		return client
+	})
+	plugin.Log = testutil.Logger{}
+	plugin.Topics = []string{"sensors/#"}
+	plugin.TopicParsing = []TopicParsingConfig{
+		{
+			Topic:       "sensors/+/+/+",
+			Measurement: "_/_/measurement/_",
+			Tags:        "_/site/_/_",
+			Fields:      "_/_/_/sensor_id",
+			FieldTypes:  map[string]string{"sensor_id": "int"},
+		},
+	}
+
+	parser, err := parsers.NewInfluxParser()
+	require.NoError(t, err)
+	plugin.SetParser(parser)
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+
+	handler(nil, &topicMessage{topic: "sensors/berlin/temperature/42", payload: "value value=21.5"})
+	handler(nil, &topicMessage{topic: "sensors/berlin/humidity", payload: "value value=40"})
+	handler(nil, &topicMessage{topic: "sensors/berlin/temperature/x", payload: "value value=22"})
+
+	plugin.Stop()
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"temperature",
+			map[string]string{
+				"topic": "sensors/berlin/temperature/42",
+				"site":  "berlin",
+			},
+			map[string]interface{}{
+				"value":     21.5,
+				"sensor_id": int64(42),
+			},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"value",
+			map[string]string{
+				"topic": "sensors/berlin/humidity",
+			},
+			map[string]interface{}{
+				"value": 40.0,
+			},
+			time.Unix(0, 0),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime())
+	require.Len(t, acc.Errors, 1)
+}
+
+func TestTopicParsingConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  TopicParsingConfig
+	}{
+		{
+			name: "missing topic",
+			cfg:  TopicParsingConfig{Tags: "a"},
+		},
+		{
+			name: "segment count mismatch",
+			cfg:  TopicParsingConfig{Topic: "a/b", Tags: "_/b/c"},
+		},
+		{
+			name: "multiple measurement segments",
+			cfg:  TopicParsingConfig{Topic: "a/b", Measurement: "a/b"},
+		},
+		{
+			name: "wildcard segment used",
+			cfg:  TopicParsingConfig{Topic: "a/#", Tags: "_/b"},
+		},
+		{
+			name: "wildcard not last",
+			cfg:  TopicParsingConfig{Topic: "a/#/c"},
+		},
+		{
+			name: "type of unknown field",
+			cfg:  TopicParsingConfig{Topic: "a/b", Fields: "_/b", FieldTypes: map[string]string{"c": "int"}},
+		},
+		{
+			name: "unknown type",
+			cfg:  TopicParsingConfig{Topic: "a/b", Fields: "_/b", FieldTypes: map[string]string{"b": "time"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin := New(nil)
+			plugin.Log = testutil.Logger{}
+			plugin.TopicParsing = []TopicParsingConfig{tt.cfg}
+			require.Error(t, plugin.Init())
+		})
+	}
+}
+
+func TestProtocolConfig(t *testing.T) {
+	plugin := New(nil)
+	plugin.Log = testutil.Logger{}
+	plugin.Protocol = "4"
+	require.Error(t, plugin.Init())
+
+	plugin = New(nil)
+	plugin.Log = testutil.Logger{}
+	plugin.UserPropertyTags = []string{"*"}
+	require.Error(t, plugin.Init())
+
+	plugin = New(nil)
+	plugin.Log = testutil.Logger{}
+	plugin.Protocol = "5"
+	plugin.UserPropertyTags = []string{"*"}
+	require.NoError(t, plugin.Init())
+}
+
+func TestMQTTv5UserProperties(t *testing.T) {
+	broker := mqtttest.NewBroker(t,
+		&packets.Publish{
+			Topic:   "sensors/berlin/temperature",
+			Payload: []byte("value value=21.5"),
+			Properties: &packets.Properties{
+				User: map[string]string{
+					"site":    "berlin",
+					"ignored": "yes",
+				},
+			},
+		},
+	)
+	defer broker.Close()
+
+	plugin := New(nil)
+	plugin.Log = testutil.Logger{}
+	plugin.Servers = []string{"tcp://" + broker.Addr()}
+	plugin.Topics = []string{"sensors/#"}
+	plugin.Protocol = "5"
+	plugin.Username = "telegraf"
+	plugin.UserPropertyTags = []string{"site"}
+	plugin.TopicParsing = []TopicParsingConfig{
+		{
+			Topic:       "sensors/+/+",
+			Measurement: "_/_/measurement",
+		},
+	}
+
+	parser, err := parsers.NewInfluxParser()
+	require.NoError(t, err)
+	plugin.SetParser(parser)
+	require.NoError(t, plugin.Init())
+
+	var acc testutil.Accumulator
+	require.NoError(t, plugin.Start(&acc))
+	defer plugin.Stop()
+
+	connect := <-broker.Connect
+	require.Equal(t, "telegraf", connect.Username)
+	require.True(t, connect.CleanStart)
+
+	acc.Wait(1)
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"temperature",
+			map[string]string{
+				"topic": "sensors/berlin/temperature",
+				"site":  "berlin",
+			},
+			map[string]interface{}{
+				"value": 21.5,
+			},
+			time.Unix(0, 0),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, acc.GetTelegrafMetrics(), testutil.IgnoreTime())
+}
@@ -0,0 +1,176 @@
+package mqtt_consumer
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/eclipse/paho.mqtt.golang"
+	mqttint "github.com/influxdata/telegraf/plugins/common/mqtt"
+)
+
+// v5Client implements the Client interface with an MQTT v5 client, so the
+// plugin handles both protocol versions the same way.
+type v5Client struct {
+	opts   *mqtt.ClientOptions
+	router *paho.StandardRouter
+
+	mu      sync.Mutex
+	client  *paho.Client
+	conn    *mqttint.Conn
+	handler sync.Mutex
+}
+
+func newV5Client(opts *mqtt.ClientOptions) Client {
+	return &v5Client{
+		opts:   opts,
+		router: paho.NewStandardRouter(),
+	}
+}
+
+func (c *v5Client) Connect() mqtt.Token {
+	conn, err := mqttint.Dial(c.opts.Servers, c.opts.TLSConfig, c.opts.ConnectTimeout)
+	if err != nil {
+		return &v5Token{err: err}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn = mqttint.NewConn(conn, func(err error) {
+		if c.opts.OnConnectionLost != nil {
+			c.opts.OnConnectionLost(nil, err)
+		}
+	})
+	c.client = mqttint.NewV5Client(c.conn, c.opts.ConnectTimeout)
+	c.client.Router = c.router
+
+	cp := &paho.Connect{
+		ClientID:     c.opts.ClientID,
+		KeepAlive:    uint16(c.opts.KeepAlive),
+		CleanStart:   c.opts.CleanSession,
+		Username:     c.opts.Username,
+		UsernameFlag: c.opts.Username != "",
+		Password:     []byte(c.opts.Password),
+		PasswordFlag: c.opts.Password != "",
+	}
+	if !c.opts.CleanSession {
+		// Without an expiry interval the server discards the session when
+		// the connection is closed.
+		expiry := uint32(math.MaxUint32)
+		cp.Properties = &paho.ConnectProperties{SessionExpiryInterval: &expiry}
+	}
+
+	ca, err := c.client.Connect(context.Background(), cp)
+	if err != nil {
+		c.conn.Disconnecting()
+		return &v5Token{err: err}
+	}
+	return &v5Token{sessionPresent: ca.SessionPresent}
+}
+
+func (c *v5Client) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	subscriptions := make(map[string]paho.SubscribeOptions, len(filters))
+	for topic, qos := range filters {
+		c.AddRoute(topic, callback)
+		subscriptions[topic] = paho.SubscribeOptions{QoS: qos}
+	}
+
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil {
+		return &v5Token{err: errors.New("not connected")}
+	}
+
+	_, err := client.Subscribe(context.Background(), &paho.Subscribe{Subscriptions: subscriptions})
+	return &v5Token{err: err}
+}
+
+func (c *v5Client) AddRoute(topic string, callback mqtt.MessageHandler) {
+	// Replace the handler of an earlier connection.
+	c.router.UnregisterHandler(topic)
+	c.router.RegisterHandler(topic, func(p *paho.Publish) {
+		// The router calls the handlers concurrently, the plugin expects the
+		// messages one by one.
+		c.handler.Lock()
+		defer c.handler.Unlock()
+		callback(nil, &v5Message{publish: p})
+	})
+}
+
+func (c *v5Client) Disconnect(quiesce uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		return
+	}
+	c.conn.Disconnecting()
+	c.client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	c.client = nil
+}
+
+type v5Token struct {
+	err            error
+	sessionPresent bool
+}
+
+func (t *v5Token) Wait() bool {
+	return true
+}
+
+func (t *v5Token) WaitTimeout(time.Duration) bool {
+	return true
+}
+
+func (t *v5Token) Error() error {
+	return t.err
+}
+
+func (t *v5Token) SessionPresent() bool {
+	return t.sessionPresent
+}
+
+// v5Message is an MQTT v5 message, its user properties are available in
+// addition to the MQTT 3 message.
+type v5Message struct {
+	publish *paho.Publish
+}
+
+func (m *v5Message) Duplicate() bool {
+	return false
+}
+
+func (m *v5Message) Qos() byte {
+	return m.publish.QoS
+}
+
+func (m *v5Message) Retained() bool {
+	return m.publish.Retain
+}
+
+func (m *v5Message) Topic() string {
+	return m.publish.Topic
+}
+
+func (m *v5Message) MessageID() uint16 {
+	return 0
+}
+
+func (m *v5Message) Payload() []byte {
+	return m.publish.Payload
+}
+
+func (m *v5Message) Ack() {
+}
+
+func (m *v5Message) UserProperties() map[string]string {
+	if m.publish.Properties == nil {
+		return nil
+	}
+	return m.publish.Properties.User
+}
@@ -0,0 +1,163 @@
+package mqtt_consumer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/influxdata/telegraf"
+)
+
+// TopicParsingConfig maps the segments of the topics matching Topic to the
+// measurement name, tags and fields of the metrics of a message.  The
+// measurement, tags and fields patterns have a segment for each segment of
+// the topic, "_" skips the segment.
+type TopicParsingConfig struct {
+	Topic       string            `toml:"topic"`
+	Measurement string            `toml:"measurement"`
+	Tags        string            `toml:"tags"`
+	Fields      string            `toml:"fields"`
+	FieldTypes  map[string]string `toml:"types"`
+}
+
+type topicParser struct {
+	topic       []string
+	measurement int
+	tags        map[int]string
+	fields      map[int]string
+	types       map[string]string
+}
+
+func newTopicParser(cfg TopicParsingConfig) (*topicParser, error) {
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("topic_parsing topic must be set")
+	}
+
+	p := &topicParser{
+		topic:       strings.Split(cfg.Topic, "/"),
+		measurement: -1,
+		tags:        make(map[int]string),
+		fields:      make(map[int]string),
+		types:       cfg.FieldTypes,
+	}
+	for i, segment := range p.topic {
+		if segment == "#" && i != len(p.topic)-1 {
+			return nil, fmt.Errorf("topic_parsing topic %q: '#' must be the last segment", cfg.Topic)
+		}
+	}
+
+	segments := func(option, pattern string) (map[int]string, error) {
+		result := make(map[int]string)
+		if pattern == "" {
+			return result, nil
+		}
+		parts := strings.Split(pattern, "/")
+		if len(parts) != len(p.topic) {
+			return nil, fmt.Errorf("topic_parsing %s %q must have the %d segments of topic %q",
+				option, pattern, len(p.topic), cfg.Topic)
+		}
+		for i, part := range parts {
+			if part == "_" || part == "" {
+				continue
+			}
+			if p.topic[i] == "#" {
+				return nil, fmt.Errorf("topic_parsing %s %q: the '#' segment can not be used", option, pattern)
+			}
+			result[i] = part
+		}
+		return result, nil
+	}
+
+	measurement, err := segments("measurement", cfg.Measurement)
+	if err != nil {
+		return nil, err
+	}
+	if len(measurement) > 1 {
+		return nil, fmt.Errorf("topic_parsing measurement %q must select a single segment", cfg.Measurement)
+	}
+	for i := range measurement {
+		p.measurement = i
+	}
+
+	if p.tags, err = segments("tags", cfg.Tags); err != nil {
+		return nil, err
+	}
+	if p.fields, err = segments("fields", cfg.Fields); err != nil {
+		return nil, err
+	}
+
+	for key, typ := range p.types {
+		found := false
+		for _, field := range p.fields {
+			found = found || field == key
+		}
+		if !found {
+			return nil, fmt.Errorf("topic_parsing type of unknown field %q", key)
+		}
+		switch typ {
+		case "string", "int", "uint", "float", "bool":
+		default:
+			return nil, fmt.Errorf("topic_parsing field %q has unknown type %q", key, typ)
+		}
+	}
+
+	return p, nil
+}
+
+// match returns the segments of the topic if it matches the pattern.
+func (p *topicParser) match(topic string) ([]string, bool) {
+	segments := strings.Split(topic, "/")
+	for i, pattern := range p.topic {
+		if pattern == "#" {
+			return segments, true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		if pattern != "+" && pattern != segments[i] {
+			return nil, false
+		}
+	}
+	return segments, len(segments) == len(p.topic)
+}
+
+// apply sets the measurement, tags and fields selected from the topic if
+// it matches the pattern.
+func (p *topicParser) apply(metric telegraf.Metric, topic string) error {
+	segments, ok := p.match(topic)
+	if !ok {
+		return nil
+	}
+
+	if p.measurement >= 0 {
+		metric.SetName(segments[p.measurement])
+	}
+	for i, key := range p.tags {
+		metric.AddTag(key, segments[i])
+	}
+	for i, key := range p.fields {
+		value, err := convertSegment(segments[i], p.types[key])
+		if err != nil {
+			return fmt.Errorf("field %q of topic %q: %v", key, topic, err)
+		}
+		metric.AddField(key, value)
+	}
+	return nil
+}
+
+func convertSegment(value, typ string) (interface{}, error) {
+	switch typ {
+	case "", "string":
+		return value, nil
+	case "int":
+		return strconv.ParseInt(value, 10, 64)
+	case "uint":
+		return strconv.ParseUint(value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		return strconv.ParseBool(value)
+	default:
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+}
@@ -2,11 +2,14 @@ package natsconsumer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/plugins/common/tls"
 	"github.com/influxdata/telegraf/plugins/inputs"
 	"github.com/influxdata/telegraf/plugins/parsers"
@@ -15,6 +18,9 @@ import (
 
 var (
 	defaultMaxUndeliveredMessages = 1000
+	defaultAckWait                = internal.Duration{Duration: 30 * time.Second}
+	defaultFetchBatch             = 100
+	defaultFetchTimeout           = internal.Duration{Duration: 5 * time.Second}
 )
 
 type empty struct{}
@@ -31,6 +37,21 @@ func (e natsError) Error() string {
 		e.err.Error(), e.conn.ConnectedUrl(), e.conn.ConnectedServerId(), e.sub.Subject, e.sub.Queue)
 }
 
+// JetStreamConfig enables JetStream, the messages are acknowledged once
+// their metrics are written by the outputs.
+type JetStreamConfig struct {
+	Stream        string            `toml:"stream"`
+	CreateStream  bool              `toml:"create_stream"`
+	Storage       string            `toml:"storage"`
+	Durable       string            `toml:"durable"`
+	Bind          bool              `toml:"bind"`
+	Mode          string            `toml:"mode"`
+	DeliverPolicy string            `toml:"deliver_policy"`
+	AckWait       internal.Duration `toml:"ack_wait"`
+	FetchBatch    int               `toml:"fetch_batch"`
+	FetchTimeout  internal.Duration `toml:"fetch_timeout"`
+}
+
 type natsConsumer struct {
 	QueueGroup  string   `toml:"queue_group"`
 	Subjects    []string `toml:"subjects"`
@@ -50,11 +71,16 @@ type natsConsumer struct {
 
 	MaxUndeliveredMessages int `toml:"max_undelivered_messages"`
 
+	JetStream *JetStreamConfig `toml:"jetstream"`
+
 	// Legacy metric buffer support; deprecated in v0.10.3
 	MetricBuffer int
 
 	conn *nats.Conn
+	js   nats.JetStreamContext
 	subs []*nats.Subscription
+	// JetStream messages waiting for the delivery of their metrics
+	messages map[telegraf.TrackingID]*nats.Msg
 
 	parser parsers.Parser
 	// channel for all incoming NATS messages
@@ -113,6 +139,43 @@ var sampleConfig = `
   ## more about them here:
   ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_INPUT.md
   data_format = "influx"
+
+  ## Use JetStream instead of core NATS.  The messages are acknowledged once
+  ## their metrics are written by the outputs, or rejected for redelivery if
+  ## the outputs fail.  JetStream supports a single subject, the queue_group
+  ## and pending limits are not used.
+  # [inputs.nats_consumer.jetstream]
+  #   ## Stream of the subject, if unset the stream is looked up by the subject.
+  #   # stream = ""
+  #
+  #   ## Create the stream with the subject if it does not exist, storing the
+  #   ## messages in a "file" or in "memory".
+  #   # create_stream = false
+  #   # storage = "file"
+  #
+  #   ## Name of the durable consumer, so the messages arriving while telegraf
+  #   ## is down are delivered once it is running again.  If unset, an
+  #   ## ephemeral consumer is used.  Required in pull mode.
+  #   # durable = ""
+  #
+  #   ## Bind to an existing durable consumer instead of creating it.
+  #   # bind = false
+  #
+  #   ## Consumer mode, either "push" for messages sent by the server or
+  #   ## "pull" to fetch batches of messages, for example to spread the
+  #   ## messages over several telegraf instances.
+  #   # mode = "push"
+  #
+  #   ## Messages delivered to a created consumer; one of "all", "new" or "last".
+  #   # deliver_policy = "all"
+  #
+  #   ## Time until unacknowledged messages are delivered again.
+  #   # ack_wait = "30s"
+  #
+  #   ## Maximum number of messages of a fetch in pull mode, and time to wait
+  #   ## for a full batch before the fetched messages are processed.
+  #   # fetch_batch = 100
+  #   # fetch_timeout = "5s"
 `
 
 func (n *natsConsumer) SampleConfig() string {
@@ -127,6 +190,62 @@ func (n *natsConsumer) SetParser(parser parsers.Parser) {
 	n.parser = parser
 }
 
+func (n *natsConsumer) Init() error {
+	if n.JetStream == nil {
+		return nil
+	}
+	js := n.JetStream
+
+	if len(n.Subjects) != 1 {
+		return errors.New("jetstream requires a single subject")
+	}
+
+	switch js.Mode {
+	case "", "push":
+		js.Mode = "push"
+	case "pull":
+		if js.Durable == "" {
+			return errors.New("jetstream pull mode requires durable")
+		}
+	default:
+		return fmt.Errorf("unknown jetstream mode %q", js.Mode)
+	}
+
+	switch js.Storage {
+	case "", "file", "memory":
+	default:
+		return fmt.Errorf("unknown jetstream storage %q", js.Storage)
+	}
+
+	switch js.DeliverPolicy {
+	case "", "all", "new", "last":
+	default:
+		return fmt.Errorf("unknown jetstream deliver_policy %q", js.DeliverPolicy)
+	}
+
+	if js.CreateStream && js.Stream == "" {
+		return errors.New("jetstream create_stream requires stream")
+	}
+	if js.Bind && js.Durable == "" {
+		return errors.New("jetstream bind requires durable")
+	}
+
+	if js.AckWait.Duration <= 0 {
+		js.AckWait = defaultAckWait
+	}
+	if js.FetchBatch <= 0 {
+		js.FetchBatch = defaultFetchBatch
+	}
+	if js.FetchBatch > n.MaxUndeliveredMessages {
+		js.FetchBatch = n.MaxUndeliveredMessages
+	}
+	if js.FetchTimeout.Duration <= 0 {
+		js.FetchTimeout = defaultFetchTimeout
+	}
+
+	return nil
+}
+
 func (n *natsConsumer) natsErrHandler(c *nats.Conn, s *nats.Subscription, e error) {
 	select {
 	case n.errs <- natsError{conn: c, sub: s, err: e}:
@@ -174,6 +293,19 @@ func (n *natsConsumer) Start(acc telegraf.Accumulator) error {
 		n.errs = make(chan error)
 
 		n.in = make(chan *nats.Msg, 1000)
+		n.messages = make(map[telegraf.TrackingID]*nats.Msg)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n.cancel = cancel
+
+	if n.JetStream != nil && len(n.subs) == 0 {
+		if err := n.subscribeJetStream(ctx); err != nil {
+			cancel()
+			n.clean()
+			return err
+		}
+	} else if len(n.subs) == 0 {
 		for _, subj := range n.Subjects {
 			sub, err := n.conn.QueueSubscribe(subj, n.QueueGroup, func(m *nats.Msg) {
 				n.in <- m
@@ -192,14 +324,11 @@ func (n *natsConsumer) Start(acc telegraf.Accumulator) error {
 		}
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	n.cancel = cancel
-
 	// Start the message reader
 	n.wg.Add(1)
 	go func() {
 		defer n.wg.Done()
-		go n.receiver(ctx)
+		n.receiver(ctx)
 	}()
 
 	n.Log.Infof("Started the NATS consumer service, nats: %v, subjects: %v, queue: %v",
@@ -208,6 +337,155 @@ func (n *natsConsumer) Start(acc telegraf.Accumulator) error {
 	return nil
 }
 
+func (n *natsConsumer) subscribeJetStream(ctx context.Context) error {
+	cfg := n.JetStream
+	subject := n.Subjects[0]
+
+	js, err := n.conn.JetStream()
+	if err != nil {
+		return err
+	}
+	n.js = js
+
+	if cfg.CreateStream {
+		if _, err := js.StreamInfo(cfg.Stream); err != nil {
+			storage := nats.FileStorage
+			if cfg.Storage == "memory" {
+				storage = nats.MemoryStorage
+			}
+			_, err = js.AddStream(&nats.StreamConfig{
+				Name:     cfg.Stream,
+				Subjects: []string{subject},
+				Storage:  storage,
+			})
+			if err != nil {
+				return fmt.Errorf("creating stream %q failed: %v", cfg.Stream, err)
+			}
+			n.Log.Infof("Created stream %q", cfg.Stream)
+		}
+	}
+
+	stream := cfg.Stream
+	if stream == "" {
+		// The stream is required to check the consumer.
+		stream, err = n.streamBySubject(subject)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.Bind {
+		if _, err := js.ConsumerInfo(stream, cfg.Durable); err != nil {
+			return fmt.Errorf("consumer %q of stream %q: %v", cfg.Durable, stream, err)
+		}
+	}
+
+	opts := []nats.SubOpt{
+		nats.BindStream(stream),
+		nats.ManualAck(),
+		nats.AckExplicit(),
+		nats.AckWait(cfg.AckWait.Duration),
+		nats.MaxAckPending(n.MaxUndeliveredMessages),
+	}
+	switch cfg.DeliverPolicy {
+	case "new":
+		opts = append(opts, nats.DeliverNew())
+	case "last":
+		opts = append(opts, nats.DeliverLast())
+	default:
+		opts = append(opts, nats.DeliverAll())
+	}
+
+	var sub *nats.Subscription
+	if cfg.Mode == "pull" {
+		sub, err = js.PullSubscribe(subject, cfg.Durable, opts...)
+		if err != nil {
+			return err
+		}
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			n.fetcher(ctx, sub)
+		}()
+	} else {
+		if cfg.Durable != "" {
+			opts = append(opts, nats.Durable(cfg.Durable))
+		}
+		sub, err = js.Subscribe(subject, func(m *nats.Msg) {
+			n.in <- m
+		}, opts...)
+		if err != nil {
+			return err
+		}
+	}
+	n.subs = append(n.subs, sub)
+	return nil
+}
+
+// streamBySubject returns the name of the stream storing the subject.
+func (n *natsConsumer) streamBySubject(subject string) (string, error) {
+	for info := range n.js.StreamsInfo() {
+		for _, s := range info.Config.Subjects {
+			if s == subject {
+				return info.Config.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no stream found for subject %q", subject)
+}
+
+// fetcher pulls the messages of a pull consumer.
+func (n *natsConsumer) fetcher(ctx context.Context, sub *nats.Subscription) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		fetchCtx, cancel := context.WithTimeout(ctx, n.JetStream.FetchTimeout.Duration)
+		msgs, err := sub.Fetch(n.JetStream.FetchBatch, nats.Context(fetchCtx))
+		cancel()
+		if err != nil {
+			if err != nats.ErrTimeout && err != context.DeadlineExceeded && ctx.Err() == nil {
+				n.Log.Errorf("Fetching messages failed: %v", err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+				}
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			select {
+			case n.in <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// onDelivery acknowledges the JetStream message of the delivered metrics.
+func (n *natsConsumer) onDelivery(track telegraf.DeliveryInfo) {
+	msg, ok := n.messages[track.ID()]
+	if !ok {
+		return
+	}
+	delete(n.messages, track.ID())
+
+	var err error
+	if track.Delivered() {
+		err = msg.Ack()
+	} else {
+		err = msg.Nak()
+	}
+	if err != nil {
+		n.Log.Errorf("Acknowledging message failed: %v", err)
+	}
+}
+
 // receiver() reads all incoming messages from NATS, and parses them into
 // telegraf metrics.
 func (n *natsConsumer) receiver(ctx context.Context) {
@@ -217,8 +495,9 @@ func (n *natsConsumer) receiver(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
-		case <-n.acc.Delivered():
+		case track := <-n.acc.Delivered():
 			<-sem
+			n.onDelivery(track)
 		case err := <-n.errs:
 			n.Log.Error(err)
 		case sem <- empty{}:
@@ -228,24 +507,39 @@ func (n *natsConsumer) receiver(ctx context.Context) {
 			case err := <-n.errs:
 				<-sem
 				n.Log.Error(err)
-			case <-n.acc.Delivered():
+			case track := <-n.acc.Delivered():
 				<-sem
 				<-sem
+				n.onDelivery(track)
 			case msg := <-n.in:
 				metrics, err := n.parser.Parse(msg.Data)
 				if err != nil {
 					n.Log.Errorf("Subject: %s, error: %s", msg.Subject, err.Error())
 					<-sem
+					if n.js != nil {
+						// The message would fail again when redelivered.
+						if err := msg.Term(); err != nil {
+							n.Log.Errorf("Terminating message failed: %v", err)
+						}
+					}
 					continue
 				}
 
-				n.acc.AddTrackingMetricGroup(metrics)
+				id := n.acc.AddTrackingMetricGroup(metrics)
+				if n.js != nil {
+					n.messages[id] = msg
+				}
 			}
 		}
 	}
 }
 
 func (n *natsConsumer) clean() {
+	// Unsubscribing would delete the JetStream consumer, so the messages
+	// arriving until the next start would be lost.
+	if n.js != nil {
+		n.subs = nil
+	}
 	for _, sub := range n.subs {
 		if err := sub.Unsubscribe(); err != nil {
 			n.Log.Errorf("Error unsubscribing from subject %s in queue %s: %s",
@@ -256,6 +550,8 @@ func (n *natsConsumer) clean() {
 	if n.conn != nil && !n.conn.IsClosed() {
 		n.conn.Close()
 	}
+	n.subs = nil
+	n.js = nil
 }
 
 func (n *natsConsumer) Stop() {
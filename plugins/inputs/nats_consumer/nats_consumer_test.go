@@ -0,0 +1,239 @@
+package natsconsumer
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/agent"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/models"
+	"github.com/influxdata/telegraf/plugins/parsers"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/require"
+)
+
+type testMetricMaker struct{}
+
+func (tm *testMetricMaker) Name() string {
+	return "TestPlugin"
+}
+
+func (tm *testMetricMaker) LogName() string {
+	return tm.Name()
+}
+
+func (tm *testMetricMaker) MakeMetric(metric telegraf.Metric) telegraf.Metric {
+	return metric
+}
+
+func (tm *testMetricMaker) Log() telegraf.Logger {
+	return models.NewLogger("test", "test", "", "")
+}
+
+// runJetStreamServer starts an embedded NATS server with JetStream enabled,
+// storing the streams in a temporary directory. The returned function stops
+// the server and removes the directory.
+func runJetStreamServer(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "jetstream")
+	require.NoError(t, err)
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = dir
+	s := test.RunServer(&opts)
+	return s.ClientURL(), func() {
+		s.Shutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestConsumer(t *testing.T, url string, js *JetStreamConfig) *natsConsumer {
+	parser, err := parsers.NewInfluxParser()
+	require.NoError(t, err)
+
+	n := &natsConsumer{
+		Servers:                []string{url},
+		Subjects:               []string{"telegraf"},
+		QueueGroup:             "telegraf_consumers",
+		PendingBytesLimit:      nats.DefaultSubPendingBytesLimit,
+		PendingMessageLimit:    nats.DefaultSubPendingMsgsLimit,
+		MaxUndeliveredMessages: defaultMaxUndeliveredMessages,
+		JetStream:              js,
+		Log:                    testutil.Logger{},
+	}
+	n.SetParser(parser)
+	require.NoError(t, n.Init())
+	return n
+}
+
+func publish(t *testing.T, url string, messages ...string) {
+	conn, err := nats.Connect(url)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	js, err := conn.JetStream()
+	require.NoError(t, err)
+	for _, msg := range messages {
+		_, err := js.Publish("telegraf", []byte(msg))
+		require.NoError(t, err)
+	}
+}
+
+func receive(t *testing.T, metrics chan telegraf.Metric) telegraf.Metric {
+	select {
+	case m := <-metrics:
+		return m
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "timeout waiting for metric")
+	}
+	return nil
+}
+
+func pendingAcks(t *testing.T, url string, consumer string) int {
+	conn, err := nats.Connect(url)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	js, err := conn.JetStream()
+	require.NoError(t, err)
+	info, err := js.ConsumerInfo("metrics", consumer)
+	require.NoError(t, err)
+	return info.NumAckPending
+}
+
+func TestJetStreamPushDurable(t *testing.T) {
+	url, stop := runJetStreamServer(t)
+	defer stop()
+
+	cfg := &JetStreamConfig{
+		Stream:       "metrics",
+		CreateStream: true,
+		Durable:      "telegraf",
+	}
+	n := newTestConsumer(t, url, cfg)
+	metrics := make(chan telegraf.Metric, 10)
+	require.NoError(t, n.Start(agent.NewAccumulator(&testMetricMaker{}, metrics)))
+
+	publish(t, url, "cpu value=1 1", "cpu value=2 2")
+
+	first := receive(t, metrics)
+	second := receive(t, metrics)
+	require.Equal(t, 1.0, first.Fields()["value"])
+	require.Equal(t, 2.0, second.Fields()["value"])
+
+	// Rejected metrics are delivered again.
+	first.Accept()
+	second.Reject()
+	again := receive(t, metrics)
+	require.Equal(t, 2.0, again.Fields()["value"])
+	again.Accept()
+	require.Eventually(t, func() bool {
+		return pendingAcks(t, url, "telegraf") == 0
+	}, 10*time.Second, 10*time.Millisecond)
+
+	n.Stop()
+
+	// Messages published while stopped are consumed after the restart.
+	publish(t, url, "cpu value=3 3")
+
+	n = newTestConsumer(t, url, cfg)
+	require.NoError(t, n.Start(agent.NewAccumulator(&testMetricMaker{}, metrics)))
+	defer n.Stop()
+
+	m := receive(t, metrics)
+	require.Equal(t, 3.0, m.Fields()["value"])
+	m.Accept()
+}
+
+func TestJetStreamPull(t *testing.T) {
+	url, stop := runJetStreamServer(t)
+	defer stop()
+
+	n := newTestConsumer(t, url, &JetStreamConfig{
+		Stream:       "metrics",
+		CreateStream: true,
+		Storage:      "memory",
+		Durable:      "puller",
+		Mode:         "pull",
+		FetchTimeout: internal.Duration{Duration: 100 * time.Millisecond},
+	})
+	metrics := make(chan telegraf.Metric, 10)
+	require.NoError(t, n.Start(agent.NewAccumulator(&testMetricMaker{}, metrics)))
+	defer n.Stop()
+
+	publish(t, url, "cpu value=1 1", "not line protocol", "cpu value=3 3")
+
+	first := receive(t, metrics)
+	second := receive(t, metrics)
+	require.Equal(t, 1.0, first.Fields()["value"])
+	require.Equal(t, 3.0, second.Fields()["value"])
+	first.Accept()
+	second.Accept()
+
+	// The invalid message is terminated, no message is left unacknowledged.
+	require.Eventually(t, func() bool {
+		return pendingAcks(t, url, "puller") == 0
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestJetStreamMissingConsumer(t *testing.T) {
+	url, stop := runJetStreamServer(t)
+	defer stop()
+
+	n := newTestConsumer(t, url, &JetStreamConfig{
+		Stream:       "metrics",
+		CreateStream: true,
+		Durable:      "missing",
+		Bind:         true,
+	})
+	require.Error(t, n.Start(agent.NewAccumulator(&testMetricMaker{}, make(chan telegraf.Metric, 10))))
+}
+
+func TestJetStreamInitErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		subjects []string
+		cfg      JetStreamConfig
+	}{
+		{
+			name:     "multiple subjects",
+			subjects: []string{"a", "b"},
+			cfg:      JetStreamConfig{},
+		},
+		{
+			name: "pull without durable",
+			cfg:  JetStreamConfig{Mode: "pull"},
+		},
+		{
+			name: "unknown mode",
+			cfg:  JetStreamConfig{Mode: "poll"},
+		},
+		{
+			name: "create stream without name",
+			cfg:  JetStreamConfig{CreateStream: true},
+		},
+		{
+			name: "bind without durable",
+			cfg:  JetStreamConfig{Bind: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &natsConsumer{
+				Subjects:               []string{"telegraf"},
+				MaxUndeliveredMessages: defaultMaxUndeliveredMessages,
+				JetStream:              &tt.cfg,
+			}
+			if tt.subjects != nil {
+				n.Subjects = tt.subjects
+			}
+			require.Error(t, n.Init())
+		})
+	}
+}
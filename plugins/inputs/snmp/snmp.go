@@ -3,6 +3,7 @@ package snmp
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"math"
@@ -107,6 +108,11 @@ type Snmp struct {
 
 	connectionCache []snmpConnection
 	initialized     bool
+
+	// agentLocks serializes the gathers of each agent, overlapping gathers
+	// must not share its connection.
+	agentLocksMu sync.Mutex
+	agentLocks   map[int]*sync.Mutex
 }
 
 func (s *Snmp) init() error {
@@ -316,6 +322,13 @@ func (s *Snmp) Description() string {
 // Any error encountered does not halt the process. The errors are accumulated
 // and returned at the end.
 func (s *Snmp) Gather(acc telegraf.Accumulator) error {
+	return s.GatherContext(context.Background(), acc)
+}
+
+// GatherContext is Gather with the requests to the agents cancelled once ctx
+// is done.  The tables not gathered yet are skipped.  Overlapping gathers of
+// an agent are run one after the other, as they share its connection.
+func (s *Snmp) GatherContext(ctx context.Context, acc telegraf.Accumulator) error {
 	if err := s.init(); err != nil {
 		return err
 	}
@@ -325,11 +338,20 @@ func (s *Snmp) Gather(acc telegraf.Accumulator) error {
 		wg.Add(1)
 		go func(i int, agent string) {
 			defer wg.Done()
+
+			lock := s.agentLock(i)
+			lock.Lock()
+			defer lock.Unlock()
+
 			gs, err := s.getConnection(i)
 			if err != nil {
 				acc.AddError(fmt.Errorf("agent %s: %w", agent, err))
 				return
 			}
+			if w, ok := gs.(snmp.GosnmpWrapper); ok {
+				w.Context = ctx
+				defer func() { w.Context = context.Background() }()
+			}
 
 			// First is the top-level fields. We treat the fields as table prefixes with an empty index.
 			t := Table{
@@ -343,6 +365,10 @@ func (s *Snmp) Gather(acc telegraf.Accumulator) error {
 
 			// Now is the real tables.
 			for _, t := range s.Tables {
+				if ctx.Err() != nil {
+					acc.AddError(fmt.Errorf("agent %s: %w", agent, ctx.Err()))
+					return
+				}
 				if err := s.gatherTable(acc, gs, t, topTags, true); err != nil {
 					acc.AddError(fmt.Errorf("agent %s: gathering table %s: %w", agent, t.Name, err))
 				}
@@ -354,6 +380,22 @@ func (s *Snmp) Gather(acc telegraf.Accumulator) error {
 	return nil
 }
 
+// agentLock returns the lock of the agent at idx.
+func (s *Snmp) agentLock(idx int) *sync.Mutex {
+	s.agentLocksMu.Lock()
+	defer s.agentLocksMu.Unlock()
+
+	if s.agentLocks == nil {
+		s.agentLocks = make(map[int]*sync.Mutex)
+	}
+	lock, ok := s.agentLocks[idx]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.agentLocks[idx] = lock
+	}
+	return lock
+}
+
 func (s *Snmp) gatherTable(acc telegraf.Accumulator, gs snmpConnection, t Table, topTags map[string]string, walk bool) error {
 	rt, err := t.Build(gs, walk)
 	if err != nil {
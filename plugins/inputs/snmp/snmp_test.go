@@ -2,10 +2,13 @@
 package snmp
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os/exec"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -650,6 +653,99 @@ func TestGather(t *testing.T) {
 	assert.Equal(t, 123456, m2.Fields["myOtherField"])
 }
 
+func TestGatherContextCancelled(t *testing.T) {
+	s := &Snmp{
+		Agents: []string{"TestGather"},
+		Name:   "mytable",
+		Fields: []Field{
+			{
+				Name: "myfield2",
+				Oid:  ".1.0.0.1.2",
+			},
+		},
+		Tables: []Table{
+			{
+				Name: "myOtherTable",
+				Fields: []Field{
+					{
+						Name: "myOtherField",
+						Oid:  ".1.0.0.0.1.5",
+					},
+				},
+			},
+		},
+
+		connectionCache: []snmpConnection{
+			tsc,
+		},
+		initialized: true,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, s.GatherContext(ctx, acc))
+
+	require.Len(t, acc.Metrics, 1)
+	assert.Equal(t, "mytable", acc.Metrics[0].Measurement)
+	require.Len(t, acc.Errors, 1)
+	assert.True(t, errors.Is(acc.Errors[0], context.Canceled))
+}
+
+// overlapSNMPConnection records the most requests in flight at once.
+type overlapSNMPConnection struct {
+	testSNMPConnection
+	active    int32
+	maxActive int32
+}
+
+func (c *overlapSNMPConnection) Get(oids []string) (*gosnmp.SnmpPacket, error) {
+	active := atomic.AddInt32(&c.active, 1)
+	defer atomic.AddInt32(&c.active, -1)
+	for {
+		max := atomic.LoadInt32(&c.maxActive)
+		if active <= max || atomic.CompareAndSwapInt32(&c.maxActive, max, active) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return c.testSNMPConnection.Get(oids)
+}
+
+func TestGatherOverlappingSerialized(t *testing.T) {
+	conn := &overlapSNMPConnection{testSNMPConnection: *tsc}
+	s := &Snmp{
+		Agents: []string{"TestGather"},
+		Name:   "mytable",
+		Fields: []Field{
+			{
+				Name: "myfield2",
+				Oid:  ".1.0.0.1.2",
+			},
+		},
+
+		connectionCache: []snmpConnection{
+			conn,
+		},
+		initialized: true,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			acc := &testutil.Accumulator{}
+			require.NoError(t, s.GatherContext(context.Background(), acc))
+			assert.Len(t, acc.Metrics, 1)
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&conn.maxActive))
+}
+
 func TestGather_host(t *testing.T) {
 	s := &Snmp{
 		Agents: []string{"TestGather"},
@@ -0,0 +1,195 @@
+package syslog
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/influxdata/go-syslog/v3/nontransparent"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	framing "github.com/influxdata/telegraf/internal/syslog"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const rfc3164Message = "<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8"
+
+func rfc3164Metric(ts time.Time, received time.Time) telegraf.Metric {
+	return testutil.MustMetric(
+		"syslog",
+		map[string]string{
+			"severity": "crit",
+			"facility": "auth",
+			"hostname": "mymachine",
+			"appname":  "su",
+		},
+		map[string]interface{}{
+			"severity_code": 2,
+			"facility_code": 4,
+			"timestamp":     ts.UnixNano(),
+			"procid":        "123",
+			"message":       "'su root' failed for lonvick on /dev/pts/8",
+		},
+		received,
+	)
+}
+
+func newRFC3164Receiver(address string) *Syslog {
+	return &Syslog{
+		Address: address,
+		now: func() time.Time {
+			return defaultTime
+		},
+		ReadTimeout:    &internal.Duration{Duration: defaultReadTimeout},
+		Separator:      "_",
+		SyslogStandard: syslogRFC3164,
+	}
+}
+
+func TestRFC3164_udp(t *testing.T) {
+	receiver := newRFC3164Receiver("udp://" + address)
+	acc := &testutil.Accumulator{}
+	require.NoError(t, receiver.Start(acc))
+	defer receiver.Stop()
+
+	conn, err := net.Dial("udp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(rfc3164Message))
+	require.NoError(t, err)
+	acc.Wait(1)
+
+	want := rfc3164Metric(time.Date(1970, 10, 11, 22, 14, 15, 0, time.UTC), defaultTime)
+	testutil.RequireMetricsEqual(t, []telegraf.Metric{want}, acc.GetTelegrafMetrics())
+}
+
+func TestRFC3164_tcp(t *testing.T) {
+	ts := time.Date(1970, 10, 11, 22, 14, 15, 0, time.UTC)
+	want := []telegraf.Metric{
+		rfc3164Metric(ts, defaultTime),
+		// Messages received at the same time are told apart
+		rfc3164Metric(ts, defaultTime.Add(time.Nanosecond)),
+	}
+	tests := []struct {
+		name    string
+		framing framing.Framing
+		trailer nontransparent.TrailerType
+		data    string
+	}{
+		{
+			name:    "octet-counting",
+			framing: framing.OctetCounting,
+			data:    "81 " + rfc3164Message + "81 " + rfc3164Message,
+		},
+		{
+			name:    "non-transparent/LF",
+			framing: framing.NonTransparent,
+			trailer: nontransparent.LF,
+			data:    rfc3164Message + "\n" + rfc3164Message + "\n",
+		},
+		{
+			name:    "non-transparent/NUL",
+			framing: framing.NonTransparent,
+			trailer: nontransparent.NUL,
+			data:    rfc3164Message + "\x00" + rfc3164Message,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := newRFC3164Receiver("tcp://" + address)
+			receiver.Framing = tt.framing
+			receiver.Trailer = tt.trailer
+			acc := &testutil.Accumulator{}
+			require.NoError(t, receiver.Start(acc))
+			defer receiver.Stop()
+
+			conn, err := net.Dial("tcp", address)
+			require.NoError(t, err)
+
+			_, err = conn.Write([]byte(tt.data))
+			require.NoError(t, err)
+			conn.Close()
+			acc.Wait(2)
+
+			testutil.RequireMetricsEqual(t, want, acc.GetTelegrafMetrics())
+			require.Empty(t, acc.Errors)
+		})
+	}
+}
+
+func TestRFC3164InvalidOctetCount_tcp(t *testing.T) {
+	receiver := newRFC3164Receiver("tcp://" + address)
+	receiver.Framing = framing.OctetCounting
+	acc := &testutil.Accumulator{}
+	require.NoError(t, receiver.Start(acc))
+	defer receiver.Stop()
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("x1 " + rfc3164Message))
+	require.NoError(t, err)
+	conn.Close()
+
+	acc.WaitError(1)
+	require.EqualError(t, acc.Errors[0], `invalid message length "x1"`)
+	require.Empty(t, acc.GetTelegrafMetrics())
+}
+
+func TestRFC3164Parse(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		timezone string
+		now      time.Time
+		data     string
+		want     time.Time
+	}{
+		{
+			name:     "default timezone",
+			timezone: "America/New_York",
+			now:      time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+			data:     "<34>Oct 11 22:14:15 mymachine su: failed",
+			want:     time.Date(2020, 10, 11, 22, 14, 15, 0, newYork),
+		},
+		{
+			name:     "previous year",
+			timezone: "UTC",
+			now:      time.Date(2021, 1, 1, 0, 0, 5, 0, time.UTC),
+			data:     "<34>Dec 31 23:59:58 mymachine su: failed",
+			want:     time.Date(2020, 12, 31, 23, 59, 58, 0, time.UTC),
+		},
+		{
+			name:     "rfc3339 timestamp",
+			timezone: "America/New_York",
+			now:      time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC),
+			data:     "<34>2019-10-11T22:14:15Z mymachine su: failed",
+			want:     time.Date(2019, 10, 11, 22, 14, 15, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Syslog{
+				SyslogStandard: syslogRFC3164,
+				now:            func() time.Time { return tt.now },
+			}
+			s.location, err = time.LoadLocation(tt.timezone)
+			require.NoError(t, err)
+
+			msg, err := s.parse([]byte(tt.data))
+			require.NoError(t, err)
+			require.True(t, tt.want.Equal(*base(msg).Timestamp), "%v != %v", tt.want, *base(msg).Timestamp)
+			require.Equal(t, "su", *base(msg).Appname)
+			require.Nil(t, base(msg).ProcID)
+		})
+	}
+}
+
+func TestUnknownSyslogStandard(t *testing.T) {
+	receiver := newRFC3164Receiver("udp://" + address)
+	receiver.SyslogStandard = "RFC1234"
+	require.EqualError(t, receiver.Start(&testutil.Accumulator{}), "unknown syslog standard 'RFC1234'")
+}
@@ -1,21 +1,24 @@
 package syslog
 
 import (
+	"bufio"
 	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 	"unicode"
 
-	"github.com/influxdata/go-syslog/v2"
-	"github.com/influxdata/go-syslog/v2/nontransparent"
-	"github.com/influxdata/go-syslog/v2/octetcounting"
-	"github.com/influxdata/go-syslog/v2/rfc5424"
+	"github.com/influxdata/go-syslog/v3"
+	"github.com/influxdata/go-syslog/v3/nontransparent"
+	"github.com/influxdata/go-syslog/v3/octetcounting"
+	"github.com/influxdata/go-syslog/v3/rfc3164"
+	"github.com/influxdata/go-syslog/v3/rfc5424"
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	framing "github.com/influxdata/telegraf/internal/syslog"
@@ -26,6 +29,11 @@ import (
 const defaultReadTimeout = time.Second * 5
 const ipMaxPacketSize = 64 * 1024
 
+const (
+	syslogRFC3164 = "RFC3164"
+	syslogRFC5424 = "RFC5424"
+)
+
 // Syslog is a syslog plugin
 type Syslog struct {
 	tlsConfig.ServerConfig
@@ -37,9 +45,12 @@ type Syslog struct {
 	Trailer         nontransparent.TrailerType
 	BestEffort      bool
 	Separator       string `toml:"sdparam_separator"`
+	SyslogStandard  string `toml:"syslog_standard"`
+	Timezone        string `toml:"timezone"`
 
 	now      func() time.Time
 	lastTime time.Time
+	location *time.Location
 
 	mu sync.Mutex
 	wg sync.WaitGroup
@@ -91,6 +102,14 @@ var sampleConfig = `
   ## Must be one of "LF", or "NUL".
   # trailer = "LF"
 
+  ## The expected syslog standard (default = "RFC5424").
+  ## Must be one of "RFC5424", or "RFC3164".
+  # syslog_standard = "RFC5424"
+
+  ## Timezone of RFC3164 timestamps, which do not contain a timezone
+  ## (default = "UTC").  Use "Local" for the timezone of the host.
+  # timezone = "UTC"
+
   ## Whether to parse in best effort mode or not (default = false).
   ## By default best effort parsing is off.
   # best_effort = false
@@ -110,7 +129,7 @@ func (s *Syslog) SampleConfig() string {
 
 // Description returns the plugin description
 func (s *Syslog) Description() string {
-	return "Accepts syslog messages following RFC5424 format with transports as per RFC5426, RFC5425, or RFC6587"
+	return "Accepts syslog messages following RFC5424 or RFC3164 format with transports as per RFC5426, RFC5425, or RFC6587"
 }
 
 // Gather ...
@@ -129,6 +148,17 @@ func (s *Syslog) Start(acc telegraf.Accumulator) error {
 	}
 	s.Address = host
 
+	switch s.SyslogStandard {
+	case "", syslogRFC5424, syslogRFC3164:
+	default:
+		return fmt.Errorf("unknown syslog standard '%s'", s.SyslogStandard)
+	}
+
+	s.location, err = time.LoadLocation(s.Timezone)
+	if err != nil {
+		return err
+	}
+
 	switch scheme {
 	case "tcp", "tcp4", "tcp6", "unix", "unixpacket":
 		s.isStream = true
@@ -218,12 +248,6 @@ func getAddressParts(a string) (string, string, error) {
 func (s *Syslog) listenPacket(acc telegraf.Accumulator) {
 	defer s.wg.Done()
 	b := make([]byte, ipMaxPacketSize)
-	var p syslog.Machine
-	if s.BestEffort {
-		p = rfc5424.NewParser(rfc5424.WithBestEffort())
-	} else {
-		p = rfc5424.NewParser()
-	}
 	for {
 		n, _, err := s.udpListener.ReadFrom(b)
 		if err != nil {
@@ -233,7 +257,7 @@ func (s *Syslog) listenPacket(acc telegraf.Accumulator) {
 			break
 		}
 
-		message, err := p.Parse(b[:n])
+		message, err := s.parse(b[:n])
 		if message != nil {
 			acc.AddFields("syslog", fields(message, s), tags(message), s.time())
 		}
@@ -305,6 +329,19 @@ func (s *Syslog) handle(conn net.Conn, acc telegraf.Accumulator) {
 		}
 	}
 
+	// The go-syslog stream parsers only support RFC5424 messages, RFC3164
+	// messages are split into frames here.
+	if s.SyslogStandard == syslogRFC3164 {
+		err := s.readFrames(conn, func(frame []byte) {
+			message, err := s.parse(frame)
+			emit(&syslog.Result{Message: message, Error: err})
+		})
+		if _, ok := err.(*framingError); ok {
+			acc.AddError(err)
+		}
+		return
+	}
+
 	// Create parser options
 	opts := []syslog.ParserOption{
 		syslog.WithListener(emit),
@@ -330,6 +367,104 @@ func (s *Syslog) handle(conn net.Conn, acc telegraf.Accumulator) {
 	}
 }
 
+// parse parses a single syslog message of the configured standard.
+func (s *Syslog) parse(data []byte) (syslog.Message, error) {
+	if s.SyslogStandard != syslogRFC3164 {
+		if s.BestEffort {
+			return rfc5424.NewParser(rfc5424.WithBestEffort()).Parse(data)
+		}
+		return rfc5424.NewParser().Parse(data)
+	}
+
+	// The year is missing from RFC3164 timestamps, the current one is
+	// assumed.  The machine keeps the year it was created with, so a new one
+	// is created for every message.
+	now := s.now().In(s.location)
+	opts := []syslog.MachineOption{
+		rfc3164.WithYear(rfc3164.Year{YYYY: now.Year()}),
+		rfc3164.WithLocaleTimezone(s.location),
+		rfc3164.WithRFC3339(),
+	}
+	if s.BestEffort {
+		opts = append(opts, rfc3164.WithBestEffort())
+	}
+
+	message, err := rfc3164.NewParser(opts...).Parse(data)
+	if msg, ok := message.(*rfc3164.SyslogMessage); ok && msg.Timestamp != nil {
+		// Messages sent in December and received in January belong to the
+		// previous year.
+		ts := *msg.Timestamp
+		if ts.Month() == time.December && now.Month() == time.January && ts.Year() == now.Year() {
+			ts = ts.AddDate(-1, 0, 0)
+			msg.Timestamp = &ts
+		}
+	}
+	return message, err
+}
+
+// framingError is a malformed frame in a stream, the stream can not be
+// parsed any further.
+type framingError struct {
+	msg string
+}
+
+func (e *framingError) Error() string {
+	return e.msg
+}
+
+// readFrames splits the stream into messages according to the configured
+// framing and calls fn for each of them.  It returns a *framingError if the
+// stream is malformed and the error of the reader otherwise.
+func (s *Syslog) readFrames(r io.Reader, fn func([]byte)) error {
+	br := bufio.NewReader(r)
+
+	if s.Framing == framing.OctetCounting {
+		for {
+			// MSG-LEN SP SYSLOG-MSG
+			length, err := br.ReadString(' ')
+			if err != nil {
+				if err == io.EOF && length != "" {
+					return &framingError{msg: fmt.Sprintf("found EOF after \"%s\", expecting a message length", length)}
+				}
+				return err
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+			if err != nil || n <= 0 || length[0] == '0' {
+				return &framingError{msg: fmt.Sprintf("invalid message length \"%s\"", strings.TrimSuffix(length, " "))}
+			}
+			if n > ipMaxPacketSize {
+				return &framingError{msg: fmt.Sprintf("message length %d exceeds the maximum of %d", n, ipMaxPacketSize)}
+			}
+
+			frame := make([]byte, n)
+			if _, err := io.ReadFull(br, frame); err != nil {
+				if err == io.ErrUnexpectedEOF {
+					return &framingError{msg: fmt.Sprintf("found EOF after %d of %d bytes", len(frame), n)}
+				}
+				return err
+			}
+			fn(frame)
+		}
+	}
+
+	trailer := byte('\n')
+	if s.Trailer == nontransparent.NUL {
+		trailer = 0
+	}
+	for {
+		frame, err := br.ReadBytes(trailer)
+		if len(frame) > 0 && frame[len(frame)-1] == trailer {
+			frame = frame[:len(frame)-1]
+		}
+		if len(frame) > 0 {
+			fn(frame)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
 func (s *Syslog) setKeepAlive(c *net.TCPConn) error {
 	if s.KeepAlivePeriod == nil {
 		return nil
@@ -353,6 +488,17 @@ func (s *Syslog) store(res syslog.Result, acc telegraf.Accumulator) {
 	}
 }
 
+// base returns the fields common to the messages of all standards.
+func base(msg syslog.Message) *syslog.Base {
+	switch msg := msg.(type) {
+	case *rfc5424.SyslogMessage:
+		return &msg.Base
+	case *rfc3164.SyslogMessage:
+		return &msg.Base
+	}
+	return &syslog.Base{}
+}
+
 func tags(msg syslog.Message) map[string]string {
 	ts := map[string]string{}
 
@@ -360,45 +506,53 @@ func tags(msg syslog.Message) map[string]string {
 	ts["severity"] = *msg.SeverityShortLevel()
 	ts["facility"] = *msg.FacilityLevel()
 
-	if msg.Hostname() != nil {
-		ts["hostname"] = *msg.Hostname()
+	b := base(msg)
+	if b.Hostname != nil {
+		ts["hostname"] = *b.Hostname
 	}
 
-	if msg.Appname() != nil {
-		ts["appname"] = *msg.Appname()
+	if b.Appname != nil {
+		ts["appname"] = *b.Appname
 	}
 
 	return ts
 }
 
 func fields(msg syslog.Message, s *Syslog) map[string]interface{} {
+	b := base(msg)
+
 	// Not checking assuming a minimally valid message
-	flds := map[string]interface{}{
-		"version": msg.Version(),
-	}
-	flds["severity_code"] = int(*msg.Severity())
-	flds["facility_code"] = int(*msg.Facility())
+	flds := map[string]interface{}{}
+	flds["severity_code"] = int(*b.Severity)
+	flds["facility_code"] = int(*b.Facility)
 
-	if msg.Timestamp() != nil {
-		flds["timestamp"] = (*msg.Timestamp()).UnixNano()
+	if b.Timestamp != nil {
+		flds["timestamp"] = (*b.Timestamp).UnixNano()
 	}
 
-	if msg.ProcID() != nil {
-		flds["procid"] = *msg.ProcID()
+	if b.ProcID != nil {
+		flds["procid"] = *b.ProcID
 	}
 
-	if msg.MsgID() != nil {
-		flds["msgid"] = *msg.MsgID()
+	if b.MsgID != nil {
+		flds["msgid"] = *b.MsgID
 	}
 
-	if msg.Message() != nil {
-		flds["message"] = strings.TrimRightFunc(*msg.Message(), func(r rune) bool {
+	if b.Message != nil {
+		flds["message"] = strings.TrimRightFunc(*b.Message, func(r rune) bool {
 			return unicode.IsSpace(r)
 		})
 	}
 
-	if msg.StructuredData() != nil {
-		for sdid, sdparams := range *msg.StructuredData() {
+	m, ok := msg.(*rfc5424.SyslogMessage)
+	if !ok {
+		return flds
+	}
+
+	flds["version"] = m.Version
+
+	if m.StructuredData != nil {
+		for sdid, sdparams := range *m.StructuredData {
 			if len(sdparams) == 0 {
 				// When SD-ID does not have params we indicate its presence with a bool
 				flds[sdid] = true
@@ -446,9 +600,11 @@ func init() {
 			ReadTimeout: &internal.Duration{
 				Duration: defaultReadTimeout,
 			},
-			Framing:   framing.OctetCounting,
-			Trailer:   nontransparent.LF,
-			Separator: "_",
+			Framing:        framing.OctetCounting,
+			Trailer:        nontransparent.LF,
+			Separator:      "_",
+			SyslogStandard: syslogRFC5424,
+			Timezone:       "UTC",
 		}
 	})
 }
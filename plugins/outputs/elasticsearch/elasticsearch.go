@@ -3,9 +3,13 @@ package elasticsearch
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
@@ -15,6 +19,7 @@ import (
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/plugins/common/tls"
 	"github.com/influxdata/telegraf/plugins/outputs"
+	"github.com/influxdata/telegraf/selfstat"
 	"gopkg.in/olivere/elastic.v5"
 )
 
@@ -32,9 +37,25 @@ type Elasticsearch struct {
 	TemplateName        string
 	OverwriteTemplate   bool
 	MajorReleaseNumber  int
+	UseDataStream       bool   `toml:"use_data_stream"`
+	UsePipeline         string `toml:"use_pipeline"`
+	DefaultPipeline     string `toml:"default_pipeline"`
+	ForceDocumentID     bool   `toml:"force_document_id"`
 	tls.ClientConfig
 
 	Client *elastic.Client
+
+	pipelineName    string
+	pipelineTagKeys []string
+
+	// retryBatch holds the metrics of a partially failed write, written
+	// marks by position the ones which do not need to be sent again when the
+	// batch is retried.
+	retryBatch []telegraf.Metric
+	written    []bool
+
+	documentsRetried selfstat.Stat
+	documentsDropped selfstat.Stat
 }
 
 var sampleConfig = `
@@ -86,6 +107,22 @@ var sampleConfig = `
   template_name = "telegraf"
   ## Set to true if you want telegraf to overwrite an existing template
   overwrite_template = false
+
+  ## Write to a data stream instead of an index, index_name is used as name
+  ## of the data stream.  Documents are created with op_type "create" and a
+  ## managed template is created as composable index template.
+  ## Requires Elasticsearch 7.9 or later.
+  # use_data_stream = false
+
+  ## Ingest pipeline to process the documents with.  Like index_name, it can
+  ## contain tags with the notation {{tag_name}}.  If a tag does not exist,
+  ## default_pipeline is used, or no pipeline if it is empty.
+  # use_pipeline = "{{es_pipeline}}"
+  # default_pipeline = "my_pipeline"
+
+  ## Generate the document id from the metric name, tags and timestamp, so a
+  ## retried write does not create duplicate documents.
+  # force_document_id = false
 `
 
 const telegrafTemplate = `
@@ -158,6 +195,67 @@ const telegrafTemplate = `
 	}
 }`
 
+const telegrafDataStreamTemplate = `
+{
+	"index_patterns" : [ "{{.TemplatePattern}}" ],
+	"data_stream": {},
+	"priority": 200,
+	"template": {
+		"settings": {
+			"index": {
+				"refresh_interval": "10s",
+				"mapping.total_fields.limit": 5000,
+				"auto_expand_replicas" : "0-1",
+				"codec" : "best_compression"
+			}
+		},
+		"mappings" : {
+			"properties" : {
+				"@timestamp" : { "type" : "date" },
+				"measurement_name" : { "type" : "keyword" }
+			},
+			"dynamic_templates": [
+				{
+					"tags": {
+						"match_mapping_type": "string",
+						"path_match": "tag.*",
+						"mapping": {
+							"ignore_above": 512,
+							"type": "keyword"
+						}
+					}
+				},
+				{
+					"metrics_long": {
+						"match_mapping_type": "long",
+						"mapping": {
+							"type": "float",
+							"index": false
+						}
+					}
+				},
+				{
+					"metrics_double": {
+						"match_mapping_type": "double",
+						"mapping": {
+							"type": "float",
+							"index": false
+						}
+					}
+				},
+				{
+					"text_fields": {
+						"match": "*",
+						"mapping": {
+							"norms": false
+						}
+					}
+				}
+			]
+		}
+	}
+}`
+
 type templatePart struct {
 	TemplatePattern string
 	Version         int
@@ -227,9 +325,24 @@ func (a *Elasticsearch) Connect() error {
 
 	log.Println("I! Elasticsearch version: " + esVersion)
 
+	// data streams were introduced with Elasticsearch 7.9
+	if a.UseDataStream {
+		var minorReleaseNumber int
+		if parts := strings.Split(esVersion, "."); len(parts) > 1 {
+			minorReleaseNumber, _ = strconv.Atoi(parts[1])
+		}
+		if majorReleaseNumber < 7 || majorReleaseNumber == 7 && minorReleaseNumber < 9 {
+			return fmt.Errorf("Elasticsearch version does not support data streams: %s", esVersion)
+		}
+	}
+
 	a.Client = client
 	a.MajorReleaseNumber = majorReleaseNumber
 
+	tags := map[string]string{"index_name": a.IndexName}
+	a.documentsRetried = selfstat.Register("elasticsearch", "documents_retried", tags)
+	a.documentsDropped = selfstat.Register("elasticsearch", "documents_dropped", tags)
+
 	if a.ManageTemplate {
 		err := a.manageTemplate(ctx)
 		if err != nil {
@@ -238,6 +351,7 @@ func (a *Elasticsearch) Connect() error {
 	}
 
 	a.IndexName, a.TagKeys = a.GetTagKeys(a.IndexName)
+	a.pipelineName, a.pipelineTagKeys = a.GetTagKeys(a.UsePipeline)
 
 	return nil
 }
@@ -247,9 +361,25 @@ func (a *Elasticsearch) Write(metrics []telegraf.Metric) error {
 		return nil
 	}
 
+	if !a.retrying(metrics) {
+		a.retryBatch, a.written = nil, nil
+	}
+
 	bulkRequest := a.Client.Bulk()
 
-	for _, metric := range metrics {
+	// ids holds the document hash and positions the batch position of each
+	// bulk request item, in the same order as the items of the bulk response.
+	var ids []string
+	var positions []int
+
+	for i, metric := range metrics {
+		if i < len(a.written) && a.written[i] {
+			continue
+		}
+		id := GetDocumentID(metric)
+		ids = append(ids, id)
+		positions = append(positions, i)
+
 		var name = metric.Name()
 
 		// index name has to be re-evaluated each time for telegraf
@@ -265,6 +395,18 @@ func (a *Elasticsearch) Write(metrics []telegraf.Metric) error {
 
 		br := elastic.NewBulkIndexRequest().Index(indexName).Doc(m)
 
+		if a.UseDataStream {
+			br.OpType("create")
+		}
+
+		if a.ForceDocumentID {
+			br.Id(id)
+		}
+
+		if pipeline := a.getPipelineName(metric.Tags()); pipeline != "" {
+			br.Pipeline(pipeline)
+		}
+
 		if a.MajorReleaseNumber <= 6 {
 			br.Type("metrics")
 		}
@@ -273,6 +415,11 @@ func (a *Elasticsearch) Write(metrics []telegraf.Metric) error {
 
 	}
 
+	if len(ids) == 0 {
+		a.retryBatch, a.written = nil, nil
+		return nil
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), a.Timeout.Duration)
 	defer cancel()
 
@@ -282,15 +429,123 @@ func (a *Elasticsearch) Write(metrics []telegraf.Metric) error {
 		return fmt.Errorf("Error sending bulk request to Elasticsearch: %s", err)
 	}
 
-	if res.Errors {
-		for id, err := range res.Failed() {
-			log.Printf("E! Elasticsearch indexing failure, id: %d, error: %s, caused by: %s, %s", id, err.Error.Reason, err.Error.CausedBy["reason"], err.Error.CausedBy["type"])
+	if !res.Errors {
+		a.retryBatch, a.written = nil, nil
+		return nil
+	}
+
+	// Keep the documents handled by the earlier attempts, so only the
+	// rejected documents are sent when the agent retries the batch.
+	written := make([]bool, len(metrics))
+	copy(written, a.written)
+	var retry int
+	for i, item := range res.Items {
+		if i >= len(ids) {
+			break
+		}
+		for _, result := range item {
+			switch {
+			case result.Status >= 200 && result.Status <= 299:
+				written[positions[i]] = true
+			case result.Status == http.StatusConflict && a.UseDataStream && a.ForceDocumentID:
+				// The document was created by an earlier attempt.
+				written[positions[i]] = true
+			case isRetryable(result.Status):
+				retry++
+			default:
+				log.Printf("E! Elasticsearch indexing failure, dropping document, id: %s, status: %d, error: %s", ids[i], result.Status, errorReason(result.Error))
+				written[positions[i]] = true
+				a.documentsDropped.Incr(1)
+			}
+		}
+	}
+
+	if retry == 0 {
+		a.retryBatch, a.written = nil, nil
+		return nil
+	}
+
+	a.retryBatch = append([]telegraf.Metric(nil), metrics...)
+	a.written = written
+	a.documentsRetried.Incr(int64(retry))
+	return fmt.Errorf("W! Elasticsearch failed to index %d metrics, retrying", retry)
+}
+
+// retrying returns true if the batch starts with the metrics of the partially
+// failed write, the agent appends newer metrics to a retried batch if it has
+// room for them.
+func (a *Elasticsearch) retrying(metrics []telegraf.Metric) bool {
+	if len(a.retryBatch) == 0 || len(metrics) < len(a.retryBatch) {
+		return false
+	}
+	for i, m := range a.retryBatch {
+		if metrics[i] != m {
+			return false
 		}
-		return fmt.Errorf("W! Elasticsearch failed to index %d metrics", len(res.Failed()))
 	}
+	return true
+}
 
-	return nil
+// GetDocumentID returns an id for the document of a metric, derived from
+// its name, tags and timestamp.
+func GetDocumentID(m telegraf.Metric) string {
+	var tags []string
+	for k, v := range m.Tags() {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
 
+	h := sha256.New()
+	h.Write([]byte(m.Name()))
+	for _, tag := range tags {
+		h.Write([]byte{0})
+		h.Write([]byte(tag))
+	}
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatInt(m.Time().UnixNano(), 10)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (a *Elasticsearch) getPipelineName(metricTags map[string]string) string {
+	if a.pipelineName == "" {
+		return ""
+	}
+
+	tagValues := []interface{}{}
+	for _, key := range a.pipelineTagKeys {
+		value, ok := metricTags[key]
+		if !ok {
+			log.Printf("D! Tag '%s' not found, using default pipeline '%s' instead\n", key, a.DefaultPipeline)
+			return a.DefaultPipeline
+		}
+		tagValues = append(tagValues, value)
+	}
+
+	return fmt.Sprintf(a.pipelineName, tagValues...)
+}
+
+// isRetryable reports if a document rejected with the status may succeed
+// when sent again.
+func isRetryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func errorReason(details *elastic.ErrorDetails) string {
+	if details == nil {
+		return "unknown"
+	}
+	if details.CausedBy != nil {
+		return fmt.Sprintf("%s, caused by: %v, %v", details.Reason, details.CausedBy["reason"], details.CausedBy["type"])
+	}
+	return details.Reason
 }
 
 func (a *Elasticsearch) manageTemplate(ctx context.Context) error {
@@ -298,7 +553,7 @@ func (a *Elasticsearch) manageTemplate(ctx context.Context) error {
 		return fmt.Errorf("Elasticsearch template_name configuration not defined")
 	}
 
-	templateExists, errExists := a.Client.IndexTemplateExists(a.TemplateName).Do(ctx)
+	templateExists, errExists := a.templateExists(ctx)
 
 	if errExists != nil {
 		return fmt.Errorf("Elasticsearch template check failed, template name: %s, error: %s", a.TemplateName, errExists)
@@ -324,11 +579,15 @@ func (a *Elasticsearch) manageTemplate(ctx context.Context) error {
 			Version:         a.MajorReleaseNumber,
 		}
 
-		t := template.Must(template.New("template").Parse(telegrafTemplate))
+		text := telegrafTemplate
+		if a.UseDataStream {
+			text = telegrafDataStreamTemplate
+		}
+		t := template.Must(template.New("template").Parse(text))
 		var tmpl bytes.Buffer
 
 		t.Execute(&tmpl, tp)
-		_, errCreateTemplate := a.Client.IndexPutTemplate(a.TemplateName).BodyString(tmpl.String()).Do(ctx)
+		errCreateTemplate := a.putTemplate(ctx, tmpl.String())
 
 		if errCreateTemplate != nil {
 			return fmt.Errorf("Elasticsearch failed to create index template %s : %s", a.TemplateName, errCreateTemplate)
@@ -344,6 +603,30 @@ func (a *Elasticsearch) manageTemplate(ctx context.Context) error {
 	return nil
 }
 
+// templateExists checks for the legacy index template, or for the
+// composable index template when writing to data streams.
+func (a *Elasticsearch) templateExists(ctx context.Context) (bool, error) {
+	if !a.UseDataStream {
+		return a.Client.IndexTemplateExists(a.TemplateName).Do(ctx)
+	}
+
+	res, err := a.Client.PerformRequest(ctx, "HEAD", "/_index_template/"+url.PathEscape(a.TemplateName), nil, nil, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	return res.StatusCode == http.StatusOK, nil
+}
+
+func (a *Elasticsearch) putTemplate(ctx context.Context, body string) error {
+	if !a.UseDataStream {
+		_, err := a.Client.IndexPutTemplate(a.TemplateName).BodyString(body).Do(ctx)
+		return err
+	}
+
+	_, err := a.Client.PerformRequest(ctx, "PUT", "/_index_template/"+url.PathEscape(a.TemplateName), nil, body)
+	return err
+}
+
 func (a *Elasticsearch) GetTagKeys(indexName string) (string, []string) {
 
 	tagKeys := []string{}
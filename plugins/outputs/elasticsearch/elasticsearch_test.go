@@ -1,11 +1,19 @@
 package elasticsearch
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/require"
@@ -257,3 +265,206 @@ func TestGetIndexName(t *testing.T) {
 		}
 	}
 }
+
+// bulkServer is a fake Elasticsearch node answering bulk requests with the
+// item statuses of the next response.
+type bulkServer struct {
+	*httptest.Server
+
+	sync.Mutex
+	version   string
+	statuses  [][]int
+	actions   [][]map[string]map[string]interface{}
+	templates []string
+}
+
+func newBulkServer(t *testing.T, version string) *bulkServer {
+	s := &bulkServer{version: version}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Lock()
+		defer s.Unlock()
+
+		switch {
+		case r.URL.Path == "/":
+			fmt.Fprintf(w, `{"version": {"number": %q}}`, s.version)
+		case strings.HasPrefix(r.URL.Path, "/_index_template/"):
+			s.templates = append(s.templates, r.Method+" "+r.URL.Path)
+			if r.Method == "HEAD" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, `{"acknowledged": true}`)
+		case r.URL.Path == "/_bulk":
+			var actions []map[string]map[string]interface{}
+			scanner := bufio.NewScanner(r.Body)
+			for scanner.Scan() {
+				var action map[string]map[string]interface{}
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &action))
+				actions = append(actions, action)
+				// skip the document
+				scanner.Scan()
+			}
+			s.actions = append(s.actions, actions)
+
+			var statuses []int
+			if len(s.statuses) > 0 {
+				statuses, s.statuses = s.statuses[0], s.statuses[1:]
+			}
+
+			var items []map[string]map[string]interface{}
+			hasErrors := false
+			for i, action := range actions {
+				status := http.StatusCreated
+				if i < len(statuses) {
+					status = statuses[i]
+				}
+				item := map[string]interface{}{"status": status}
+				if status >= 300 {
+					hasErrors = true
+					item["error"] = map[string]interface{}{"type": "error", "reason": "failed"}
+				}
+				for op := range action {
+					items = append(items, map[string]map[string]interface{}{op: item})
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": hasErrors, "items": items})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return s
+}
+
+func newTestElasticsearch(url, indexName string) *Elasticsearch {
+	return &Elasticsearch{
+		URLs:      []string{url},
+		IndexName: indexName,
+		Timeout:   internal.Duration{Duration: time.Second * 5},
+	}
+}
+
+func TestWriteRetriesRejectedDocuments(t *testing.T) {
+	s := newBulkServer(t, "7.10.0")
+	defer s.Close()
+
+	e := newTestElasticsearch(s.URL, "test-retry")
+	require.NoError(t, e.Connect())
+
+	metrics := []telegraf.Metric{
+		testutil.TestMetric(1, "a"),
+		testutil.TestMetric(2, "b"),
+		testutil.TestMetric(3, "c"),
+	}
+
+	// The second document is rejected temporarily, the third one permanently.
+	s.statuses = [][]int{{http.StatusCreated, http.StatusTooManyRequests, http.StatusBadRequest}}
+	require.Error(t, e.Write(metrics))
+	require.Equal(t, int64(1), e.documentsRetried.Get())
+	require.Equal(t, int64(1), e.documentsDropped.Get())
+
+	// Only the rejected document is sent again.
+	require.NoError(t, e.Write(metrics))
+	require.Len(t, s.actions, 2)
+	require.Len(t, s.actions[1], 1)
+
+	// Once written, the next batch is sent in full.
+	require.NoError(t, e.Write(metrics))
+	require.Len(t, s.actions[2], 3)
+}
+
+func TestWriteRetriesByBatchPosition(t *testing.T) {
+	s := newBulkServer(t, "7.10.0")
+	defer s.Close()
+
+	e := newTestElasticsearch(s.URL, "test-retry-position")
+	require.NoError(t, e.Connect())
+
+	// The metrics only differ in their fields and share the document id.
+	now := time.Unix(0, 0)
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"usage_idle": 1.0}, now),
+		testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"usage_user": 2.0}, now),
+	}
+	require.Equal(t, GetDocumentID(metrics[0]), GetDocumentID(metrics[1]))
+
+	s.statuses = [][]int{{http.StatusCreated, http.StatusTooManyRequests}}
+	require.Error(t, e.Write(metrics))
+
+	// The retried batch has room for a newer metric, only the rejected
+	// metric and the new one are sent.
+	retried := []telegraf.Metric{metrics[0], metrics[1], testutil.TestMetric(3, "c")}
+	require.NoError(t, e.Write(retried))
+	require.Len(t, s.actions, 2)
+	require.Len(t, s.actions[1], 2)
+
+	// A different batch after a failed write is sent in full.
+	s.statuses = [][]int{{http.StatusCreated, http.StatusTooManyRequests}}
+	require.Error(t, e.Write(metrics))
+	other := []telegraf.Metric{
+		testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"usage_idle": 1.0}, now),
+		testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"usage_user": 2.0}, now),
+	}
+	require.NoError(t, e.Write(other))
+	require.Len(t, s.actions, 4)
+	require.Len(t, s.actions[3], 2)
+}
+
+func TestWriteDataStream(t *testing.T) {
+	s := newBulkServer(t, "7.10.0")
+	defer s.Close()
+
+	e := newTestElasticsearch(s.URL, "metrics-telegraf")
+	e.UseDataStream = true
+	e.ForceDocumentID = true
+	e.UsePipeline = "{{es_pipeline}}"
+	e.DefaultPipeline = "default"
+	e.ManageTemplate = true
+	e.TemplateName = "telegraf"
+	require.NoError(t, e.Connect())
+	require.Equal(t, []string{"HEAD /_index_template/telegraf", "PUT /_index_template/telegraf"}, s.templates)
+
+	m1 := testutil.TestMetric(1, "a")
+	m1.AddTag("es_pipeline", "custom")
+	m2 := testutil.TestMetric(2, "b")
+
+	// A conflict means the document exists from an earlier attempt.
+	s.statuses = [][]int{{http.StatusConflict, http.StatusCreated}}
+	require.NoError(t, e.Write([]telegraf.Metric{m1, m2}))
+
+	require.Len(t, s.actions, 1)
+	require.Equal(t, map[string]interface{}{
+		"_index":   "metrics-telegraf",
+		"_id":      GetDocumentID(m1),
+		"pipeline": "custom",
+	}, s.actions[0][0]["create"])
+	require.Equal(t, map[string]interface{}{
+		"_index":   "metrics-telegraf",
+		"_id":      GetDocumentID(m2),
+		"pipeline": "default",
+	}, s.actions[0][1]["create"])
+}
+
+func TestDataStreamUnsupportedVersion(t *testing.T) {
+	for _, version := range []string{"6.8.0", "7.8.1"} {
+		t.Run(version, func(t *testing.T) {
+			s := newBulkServer(t, version)
+			defer s.Close()
+
+			e := newTestElasticsearch(s.URL, "metrics-telegraf")
+			e.UseDataStream = true
+			require.Error(t, e.Connect())
+		})
+	}
+}
+
+func TestGetDocumentID(t *testing.T) {
+	now := time.Now()
+	m1 := testutil.MustMetric("cpu", map[string]string{"a": "1", "b": "2"}, map[string]interface{}{"value": 1}, now)
+	m2 := testutil.MustMetric("cpu", map[string]string{"b": "2", "a": "1"}, map[string]interface{}{"value": 2}, now)
+	m3 := testutil.MustMetric("cpu", map[string]string{"a": "1", "b": "2"}, map[string]interface{}{"value": 1}, now.Add(time.Second))
+	m4 := testutil.MustMetric("cpu", map[string]string{"a": "1=b", "": "2"}, map[string]interface{}{"value": 1}, now)
+
+	require.Equal(t, GetDocumentID(m1), GetDocumentID(m2))
+	require.NotEqual(t, GetDocumentID(m1), GetDocumentID(m3))
+	require.NotEqual(t, GetDocumentID(m1), GetDocumentID(m4))
+}
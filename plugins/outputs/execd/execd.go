@@ -10,6 +10,7 @@ import (
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/config"
 	"github.com/influxdata/telegraf/internal/process"
+	"github.com/influxdata/telegraf/plugins/common/control"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/serializers"
 )
@@ -21,6 +22,30 @@ const sampleConfig = `
   ## Delay before the process is restarted after an unexpected termination
   restart_delay = "10s"
 
+  ## Exchange framed JSON messages with the process on the file descriptors
+  ## 3 and 4, for structured logs and errors, heartbeats and handing over
+  ## the plugin configuration.  With the control channel the metrics are sent
+  ## as batches that the process must acknowledge, a rejected batch is kept
+  ## and retried.  The process must implement the protocol, for example by
+  ## using the Telegraf Go shim.  Not available on Windows.
+  # control_channel = false
+
+  ## Interval of the heartbeats sent over the control channel, the process is
+  ## restarted if it sends no message within the heartbeat timeout, which
+  ## defaults to three intervals.  Heartbeats are disabled if set to 0.
+  # heartbeat_interval = "0s"
+  # heartbeat_timeout = "0s"
+
+  ## Plugin configuration handed over to the process at startup, in the
+  ## format of the shim's configuration file.
+  # plugin_config = '''
+  #   [[outputs.my_plugin]]
+  #     option = "value"
+  # '''
+
+  ## Maximum time to wait for the acknowledgement of a batch.
+  # ack_timeout = "30s"
+
   ## Data format to export.
   ## Each data format has its own unique set of configuration options, read
   ## more about them here:
@@ -31,10 +56,13 @@ const sampleConfig = `
 type Execd struct {
 	Command      []string        `toml:"command"`
 	RestartDelay config.Duration `toml:"restart_delay"`
+	AckTimeout   config.Duration `toml:"ack_timeout"`
 	Log          telegraf.Logger
+	control.Config
 
 	process    *process.Process
 	serializer serializers.Serializer
+	control    *control.Client
 }
 
 func (e *Execd) SampleConfig() string {
@@ -53,6 +81,12 @@ func (e *Execd) Init() error {
 	if len(e.Command) == 0 {
 		return fmt.Errorf("no command specified")
 	}
+	if err := e.Config.Validate(); err != nil {
+		return err
+	}
+	if e.ControlChannel && e.AckTimeout <= 0 {
+		return fmt.Errorf("ack_timeout must be positive")
+	}
 
 	var err error
 
@@ -65,6 +99,11 @@ func (e *Execd) Init() error {
 	e.process.ReadStdoutFn = e.cmdReadOut
 	e.process.ReadStderrFn = e.cmdReadErr
 
+	if e.ControlChannel {
+		e.control = control.NewClient(e.Config, e.Log)
+		e.control.Attach(e.process)
+	}
+
 	return nil
 }
 
@@ -89,6 +128,14 @@ func (e *Execd) Close() error {
 }
 
 func (e *Execd) Write(metrics []telegraf.Metric) error {
+	if e.control != nil {
+		b, err := e.serializer.SerializeBatch(metrics)
+		if err != nil {
+			return fmt.Errorf("error serializing metrics: %s", err)
+		}
+		return e.control.Write(b, time.Duration(e.AckTimeout))
+	}
+
 	for _, m := range metrics {
 		b, err := e.serializer.Serialize(m)
 		if err != nil {
@@ -124,6 +171,8 @@ func (e *Execd) cmdReadOut(out io.Reader) {
 
 func init() {
 	outputs.Add("execd", func() telegraf.Output {
-		return &Execd{}
+		return &Execd{
+			AckTimeout: config.Duration(30 * time.Second),
+		}
 	})
 }
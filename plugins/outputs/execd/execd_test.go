@@ -2,6 +2,7 @@ package execd
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -14,6 +15,9 @@ import (
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/config"
 	"github.com/influxdata/telegraf/metric"
+	"github.com/influxdata/telegraf/plugins/common/control"
+	"github.com/influxdata/telegraf/plugins/common/shim"
+	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/parsers/influx"
 	"github.com/influxdata/telegraf/plugins/serializers"
 	"github.com/influxdata/telegraf/testutil"
@@ -69,15 +73,76 @@ func TestExternalOutputWorks(t *testing.T) {
 	wg.Wait()
 }
 
+func TestControlChannel(t *testing.T) {
+	influxSerializer, err := serializers.NewInfluxSerializer()
+	require.NoError(t, err)
+
+	exe, err := os.Executable()
+	require.NoError(t, err)
+
+	e := &Execd{
+		Command:      []string{exe, "-testcontroloutput"},
+		RestartDelay: config.Duration(5 * time.Second),
+		AckTimeout:   config.Duration(10 * time.Second),
+		Config: control.Config{
+			ControlChannel: true,
+			PluginConfig:   "[[outputs.control_test]]\n  reject_name = \"reject\"\n",
+		},
+		serializer: influxSerializer,
+		Log:        testutil.Logger{},
+	}
+	require.NoError(t, e.Init())
+	require.NoError(t, e.Connect())
+	defer e.Close()
+
+	cpu := testutil.MustMetric("cpu",
+		map[string]string{"name": "cpu1"},
+		map[string]interface{}{"idle": 50},
+		now,
+	)
+	reject := testutil.MustMetric("reject",
+		map[string]string{},
+		map[string]interface{}{"value": 1},
+		now,
+	)
+	require.NoError(t, e.Write([]telegraf.Metric{cpu}))
+
+	err = e.Write([]telegraf.Metric{cpu, reject})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "rejected metric")
+}
+
+func TestControlChannelOptions(t *testing.T) {
+	e := &Execd{
+		Command: []string{"cat"},
+		Config:  control.Config{PluginConfig: "[[outputs.file]]"},
+		Log:     testutil.Logger{},
+	}
+	require.Error(t, e.Init())
+
+	e.ControlChannel = true
+	require.Error(t, e.Init())
+
+	e.AckTimeout = config.Duration(time.Second)
+	require.NoError(t, e.Init())
+}
+
 var testoutput = flag.Bool("testoutput", false,
 	"if true, act like line input program instead of test")
 
+var testcontroloutput = flag.Bool("testcontroloutput", false,
+	"if true, act like a shim output with control channel instead of test")
+
 func TestMain(m *testing.M) {
 	flag.Parse()
 	if *testoutput {
 		runOutputConsumerProgram()
 		os.Exit(0)
 	}
+	if *testcontroloutput {
+		runControlOutputProgram()
+		os.Exit(0)
+	}
 	code := m.Run()
 	os.Exit(code)
 }
@@ -111,3 +176,40 @@ func runOutputConsumerProgram() {
 		}
 	}
 }
+
+// rejectingOutput fails to write batches containing a metric named
+// RejectName.
+type rejectingOutput struct {
+	RejectName string `toml:"reject_name"`
+}
+
+func (o *rejectingOutput) SampleConfig() string { return "" }
+func (o *rejectingOutput) Description() string  { return "" }
+func (o *rejectingOutput) Connect() error       { return nil }
+func (o *rejectingOutput) Close() error         { return nil }
+
+func (o *rejectingOutput) Write(metrics []telegraf.Metric) error {
+	for _, m := range metrics {
+		if m.Name() == o.RejectName {
+			return errors.New("rejected metric")
+		}
+	}
+	return nil
+}
+
+func runControlOutputProgram() {
+	outputs.Add("control_test", func() telegraf.Output {
+		return &rejectingOutput{}
+	})
+
+	// the config handed over on the control channel replaces this one
+	s := shim.New()
+	if err := s.AddOutput(&rejectingOutput{}); err != nil {
+		fmt.Fprintf(os.Stderr, "ERR %v\n", err)
+		os.Exit(1)
+	}
+	if err := s.Run(shim.PollIntervalDisabled); err != nil {
+		fmt.Fprintf(os.Stderr, "ERR %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -12,6 +15,7 @@ import (
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/plugins/common/kafka"
 	tlsint "github.com/influxdata/telegraf/plugins/common/tls"
+	"github.com/influxdata/telegraf/plugins/common/tmpl"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/serializers"
 )
@@ -24,6 +28,13 @@ var ValidTopicSuffixMethods = []string{
 
 var zeroTime = time.Unix(0, 0)
 
+var partitioners = map[string]sarama.PartitionerConstructor{
+	"hash":        sarama.NewHashPartitioner,
+	"series":      newSeriesPartitioner,
+	"round_robin": sarama.NewRoundRobinPartitioner,
+	"manual":      newManualPartitioner,
+}
+
 type (
 	Kafka struct {
 		Brokers          []string    `toml:"brokers"`
@@ -39,6 +50,12 @@ type (
 		MaxRetry         int         `toml:"max_retry"`
 		MaxMessageBytes  int         `toml:"max_message_bytes"`
 
+		IdempotentWrites  bool              `toml:"idempotent_writes"`
+		Headers           map[string]string `toml:"headers"`
+		Partitioner       string            `toml:"partitioner"`
+		PartitionTag      string            `toml:"partition_tag"`
+		ProducerTimestamp string            `toml:"producer_timestamp"`
+
 		Version string `toml:"version"`
 
 		// Legacy TLS config options
@@ -63,6 +80,8 @@ type (
 		producerFunc func(addrs []string, config *sarama.Config) (sarama.SyncProducer, error)
 		producer     sarama.SyncProducer
 
+		headers []header
+
 		serializer serializers.Serializer
 	}
 	TopicSuffix struct {
@@ -70,6 +89,10 @@ type (
 		Keys      []string `toml:"keys"`
 		Separator string   `toml:"separator"`
 	}
+	header struct {
+		key  string
+		tmpl *template.Template
+	}
 )
 
 // DebugLogger logs messages from sarama at the debug level.
@@ -192,6 +215,36 @@ var sampleConfig = `
   ## smaller than the broker's 'message.max.bytes'.
   # max_message_bytes = 1000000
 
+  ## Use the idempotent producer, which ensures each message is written
+  ## exactly once to its partition even when sending is retried.  Requires
+  ## required_acks = -1 and a version of at least "0.11.0.0", which is used
+  ## if version is not set.  Transactional writes are not supported.
+  # idempotent_writes = false
+
+  ## Method to choose the partition of a message; one of:
+  ##   hash        - hash of the message key, see routing_tag and routing_key,
+  ##                 a random partition is used for messages without key
+  ##   series      - hash of the measurement name and tag set of the metric
+  ##   round_robin - each partition in turn
+  ##   manual      - the partition number in the tag set by partition_tag,
+  ##                 partition 0 is used if the tag is missing, invalid or
+  ##                 beyond the partitions of the topic
+  # partitioner = "hash"
+  # partition_tag = ""
+
+  ## Timestamp of the messages; one of "metric" to use the time of the
+  ## metric or "now" to use the time the message is produced.
+  # producer_timestamp = "metric"
+
+  ## Message headers created from Go templates, requires a version of at
+  ## least "0.11.0.0", which is used if version is not set.  The templates
+  ## can use the methods .Name, .Tag "key", .Field "key" and .Time of the
+  ## metric, a missing tag is empty and a missing field has no value.
+  ## Headers with an empty value are not added.
+  # [outputs.kafka.headers]
+  #   source = '{{ .Tag "host" }}'
+  #   measurement = '{{ .Name }}'
+
   ## Optional TLS Config
   # enable_tls = true
   # tls_ca = "/etc/telegraf/ca.pem"
@@ -278,6 +331,11 @@ func (k *Kafka) Connect() error {
 		config.Version = version
 	}
 
+	// Headers and the idempotent producer require at least Kafka 0.11.
+	if k.Version == "" && (k.IdempotentWrites || len(k.Headers) > 0) {
+		config.Version = sarama.V0_11_0_0
+	}
+
 	if k.ClientID != "" {
 		config.ClientID = k.ClientID
 	} else {
@@ -289,6 +347,43 @@ func (k *Kafka) Connect() error {
 	config.Producer.Retry.Max = k.MaxRetry
 	config.Producer.Return.Successes = true
 
+	if k.IdempotentWrites {
+		config.Producer.Idempotent = true
+		config.Net.MaxOpenRequests = 1
+	}
+
+	if k.Partitioner != "" {
+		partitioner, ok := partitioners[k.Partitioner]
+		if !ok {
+			return fmt.Errorf("unknown partitioner %q", k.Partitioner)
+		}
+		config.Producer.Partitioner = partitioner
+	}
+	if k.Partitioner == "manual" && k.PartitionTag == "" {
+		return fmt.Errorf("partition_tag is required for the manual partitioner")
+	}
+
+	switch k.ProducerTimestamp {
+	case "", "metric", "now":
+	default:
+		return fmt.Errorf("unknown producer_timestamp %q", k.ProducerTimestamp)
+	}
+
+	// Sort the headers to add them in a stable order.
+	keys := make([]string, 0, len(k.Headers))
+	for key := range k.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	k.headers = k.headers[:0]
+	for _, key := range keys {
+		tmpl, err := template.New(key).Parse(k.Headers[key])
+		if err != nil {
+			return fmt.Errorf("invalid template of header %q: %v", key, err)
+		}
+		k.headers = append(k.headers, header{key: key, tmpl: tmpl})
+	}
+
 	if k.MaxMessageBytes > 0 {
 		config.Producer.MaxMessageBytes = k.MaxMessageBytes
 	}
@@ -371,6 +466,42 @@ func (k *Kafka) routingKey(metric telegraf.Metric) (string, error) {
 	return k.RoutingKey, nil
 }
 
+// partition returns the partition set by the partition tag.
+func (k *Kafka) partition(metric telegraf.Metric) int32 {
+	value, ok := metric.GetTag(k.PartitionTag)
+	if !ok {
+		return 0
+	}
+	partition, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || partition < 0 {
+		k.Log.Debugf("Invalid partition %q, using partition 0", value)
+		return 0
+	}
+	return int32(partition)
+}
+
+func (k *Kafka) messageHeaders(metric telegraf.Metric) ([]sarama.RecordHeader, error) {
+	if len(k.headers) == 0 {
+		return nil, nil
+	}
+
+	headers := make([]sarama.RecordHeader, 0, len(k.headers))
+	for _, h := range k.headers {
+		var b strings.Builder
+		if err := h.tmpl.Execute(&b, tmpl.NewMetric(metric)); err != nil {
+			return nil, fmt.Errorf("could not create header %q: %v", h.key, err)
+		}
+		if b.Len() == 0 {
+			continue
+		}
+		headers = append(headers, sarama.RecordHeader{
+			Key:   []byte(h.key),
+			Value: []byte(b.String()),
+		})
+	}
+	return headers, nil
+}
+
 func (k *Kafka) Write(metrics []telegraf.Metric) error {
 	msgs := make([]*sarama.ProducerMessage, 0, len(metrics))
 	for _, metric := range metrics {
@@ -387,11 +518,25 @@ func (k *Kafka) Write(metrics []telegraf.Metric) error {
 			Value: sarama.ByteEncoder(buf),
 		}
 
-		// Negative timestamps are not allowed by the Kafka protocol.
-		if !metric.Time().Before(zeroTime) {
+		if k.ProducerTimestamp == "now" {
+			m.Timestamp = time.Now()
+		} else if !metric.Time().Before(zeroTime) {
+			// Negative timestamps are not allowed by the Kafka protocol.
 			m.Timestamp = metric.Time()
 		}
 
+		switch k.Partitioner {
+		case "series":
+			m.Metadata = metric.HashID()
+		case "manual":
+			m.Partition = k.partition(metric)
+		}
+
+		m.Headers, err = k.messageHeaders(metric)
+		if err != nil {
+			return err
+		}
+
 		key, err := k.routingKey(metric)
 		if err != nil {
 			return fmt.Errorf("could not generate routing key: %v", err)
@@ -425,6 +570,42 @@ func (k *Kafka) Write(metrics []telegraf.Metric) error {
 	return nil
 }
 
+// seriesPartitioner chooses the partition by the hash of the series of the
+// metric, stored in the message metadata.
+type seriesPartitioner struct{}
+
+func newSeriesPartitioner(topic string) sarama.Partitioner {
+	return &seriesPartitioner{}
+}
+
+func (p *seriesPartitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	id, _ := message.Metadata.(uint64)
+	return int32(id % uint64(numPartitions)), nil
+}
+
+func (p *seriesPartitioner) RequiresConsistency() bool {
+	return true
+}
+
+// manualPartitioner chooses the partition set by the partition tag, stored in
+// the message partition, and partition 0 if the topic has fewer partitions.
+type manualPartitioner struct{}
+
+func newManualPartitioner(topic string) sarama.Partitioner {
+	return &manualPartitioner{}
+}
+
+func (p *manualPartitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if message.Partition >= numPartitions {
+		return 0, nil
+	}
+	return message.Partition, nil
+}
+
+func (p *manualPartitioner) RequiresConsistency() bool {
+	return true
+}
+
 func init() {
 	sarama.Logger = &DebugLogger{}
 	outputs.Add("kafka", func() telegraf.Output {
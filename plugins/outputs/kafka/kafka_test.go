@@ -300,3 +300,230 @@ func TestTopicTag(t *testing.T) {
 		})
 	}
 }
+
+// recordingProducer records the messages sent by a producer, after sending
+// the partition and offset of the messages are set.
+type recordingProducer struct {
+	sarama.SyncProducer
+	sent []*sarama.ProducerMessage
+}
+
+func (p *recordingProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	err := p.SyncProducer.SendMessages(msgs)
+	p.sent = append(p.sent, msgs...)
+	return err
+}
+
+func TestIdempotentWritesMockBroker(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("telegraf", 0, broker.BrokerID()).
+			SetLeader("telegraf", 1, broker.BrokerID()),
+		"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{
+			ProducerID:    1000,
+			ProducerEpoch: 1,
+		}),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+
+	var producer *recordingProducer
+	s, err := serializers.NewInfluxSerializer()
+	require.NoError(t, err)
+	k := &Kafka{
+		Brokers:          []string{broker.Addr()},
+		Topic:            "telegraf",
+		RequiredAcks:     -1,
+		MaxRetry:         3,
+		IdempotentWrites: true,
+		Partitioner:      "round_robin",
+		Log:              testutil.Logger{},
+		producerFunc: func(addrs []string, config *sarama.Config) (sarama.SyncProducer, error) {
+			require.True(t, config.Producer.Idempotent)
+			require.Equal(t, sarama.V0_11_0_0, config.Version)
+
+			p, err := sarama.NewSyncProducer(addrs, config)
+			if err != nil {
+				return nil, err
+			}
+			producer = &recordingProducer{SyncProducer: p}
+			return producer, nil
+		},
+	}
+	k.SetSerializer(s)
+
+	require.NoError(t, k.Connect())
+	defer k.Close()
+	require.NoError(t, k.Write(testutil.MockMetrics()))
+	require.NoError(t, k.Write(testutil.MockMetrics()))
+
+	var initProducerID, produce int
+	for _, rr := range broker.History() {
+		switch rr.Request.(type) {
+		case *sarama.InitProducerIDRequest:
+			initProducerID++
+		case *sarama.ProduceRequest:
+			produce++
+		}
+	}
+	require.Equal(t, 1, initProducerID)
+	require.Equal(t, 2, produce)
+
+	require.Len(t, producer.sent, 2)
+	require.Equal(t, int32(0), producer.sent[0].Partition)
+	require.Equal(t, int32(1), producer.sent[1].Partition)
+}
+
+func TestIdempotentWritesRequiresAllAcks(t *testing.T) {
+	s, err := serializers.NewInfluxSerializer()
+	require.NoError(t, err)
+	k := &Kafka{
+		Brokers:          []string{"127.0.0.1:9092"},
+		Topic:            "telegraf",
+		RequiredAcks:     1,
+		MaxRetry:         3,
+		IdempotentWrites: true,
+		producerFunc:     sarama.NewSyncProducer,
+	}
+	k.SetSerializer(s)
+	require.Error(t, k.Connect())
+}
+
+func TestHeaders(t *testing.T) {
+	s, err := serializers.NewInfluxSerializer()
+	require.NoError(t, err)
+	k := &Kafka{
+		Topic: "telegraf",
+		Headers: map[string]string{
+			"source":      `{{ .Tag "host" }}`,
+			"measurement": `{{ .Name }}`,
+			"missing":     `{{ .Tag "missing" }}`,
+		},
+		producerFunc: func(addrs []string, config *sarama.Config) (sarama.SyncProducer, error) {
+			require.Equal(t, sarama.V0_11_0_0, config.Version)
+			return &MockProducer{}, nil
+		},
+	}
+	k.SetSerializer(s)
+	require.NoError(t, k.Connect())
+
+	producer := &MockProducer{}
+	k.producer = producer
+
+	m := testutil.MustMetric("cpu", map[string]string{"host": "server01"}, map[string]interface{}{"value": 42.0}, time.Unix(0, 0))
+	require.NoError(t, k.Write([]telegraf.Metric{m}))
+
+	require.Equal(t, []sarama.RecordHeader{
+		{Key: []byte("measurement"), Value: []byte("cpu")},
+		{Key: []byte("source"), Value: []byte("server01")},
+	}, producer.sent[0].Headers)
+}
+
+func TestInvalidHeaderTemplate(t *testing.T) {
+	k := &Kafka{
+		Headers:      map[string]string{"source": `{{ .Tag "host" `},
+		producerFunc: NewMockProducer,
+	}
+	require.Error(t, k.Connect())
+}
+
+func TestPartitioner(t *testing.T) {
+	cpu := func(host, partition string) telegraf.Metric {
+		return testutil.MustMetric("cpu",
+			map[string]string{"host": host, "partition": partition},
+			map[string]interface{}{"value": 42.0},
+			time.Unix(0, 0),
+		)
+	}
+	metrics := []telegraf.Metric{cpu("a", "3"), cpu("a", "3"), cpu("b", "x")}
+
+	tests := []struct {
+		name         string
+		partitioner  string
+		partitionTag string
+		check        func(t *testing.T, sent []*sarama.ProducerMessage)
+	}{
+		{
+			name:        "series",
+			partitioner: "series",
+			check: func(t *testing.T, sent []*sarama.ProducerMessage) {
+				p := newSeriesPartitioner("telegraf")
+				p0, err := p.Partition(sent[0], 16)
+				require.NoError(t, err)
+				p1, err := p.Partition(sent[1], 16)
+				require.NoError(t, err)
+				require.Equal(t, p0, p1)
+				require.Equal(t, metrics[0].HashID(), sent[0].Metadata)
+			},
+		},
+		{
+			name:         "manual",
+			partitioner:  "manual",
+			partitionTag: "partition",
+			check: func(t *testing.T, sent []*sarama.ProducerMessage) {
+				require.Equal(t, int32(3), sent[0].Partition)
+				require.Equal(t, int32(0), sent[2].Partition)
+
+				// partitions the topic does not have fall back to 0
+				p := newManualPartitioner("telegraf")
+				p0, err := p.Partition(sent[0], 4)
+				require.NoError(t, err)
+				require.Equal(t, int32(3), p0)
+				p0, err = p.Partition(sent[0], 2)
+				require.NoError(t, err)
+				require.Equal(t, int32(0), p0)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := serializers.NewInfluxSerializer()
+			require.NoError(t, err)
+			k := &Kafka{
+				Topic:        "telegraf",
+				Partitioner:  tt.partitioner,
+				PartitionTag: tt.partitionTag,
+				Log:          testutil.Logger{},
+				producerFunc: NewMockProducer,
+			}
+			k.SetSerializer(s)
+			require.NoError(t, k.Connect())
+
+			producer := &MockProducer{}
+			k.producer = producer
+			require.NoError(t, k.Write(metrics))
+			tt.check(t, producer.sent)
+		})
+	}
+}
+
+func TestInvalidPartitioner(t *testing.T) {
+	k := &Kafka{Partitioner: "sticky", producerFunc: NewMockProducer}
+	require.Error(t, k.Connect())
+
+	k = &Kafka{Partitioner: "manual", producerFunc: NewMockProducer}
+	require.Error(t, k.Connect())
+}
+
+func TestProducerTimestamp(t *testing.T) {
+	s, err := serializers.NewInfluxSerializer()
+	require.NoError(t, err)
+	k := &Kafka{
+		Topic:             "telegraf",
+		ProducerTimestamp: "now",
+		producerFunc:      NewMockProducer,
+	}
+	k.SetSerializer(s)
+	require.NoError(t, k.Connect())
+
+	producer := &MockProducer{}
+	k.producer = producer
+
+	before := time.Now()
+	m := testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"value": 42.0}, time.Unix(100, 0))
+	require.NoError(t, k.Write([]telegraf.Metric{m}))
+	require.False(t, producer.sent[0].Timestamp.Before(before))
+}
@@ -0,0 +1,265 @@
+package loki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/common/tls"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	defaultEndpoint      = "/loki/api/v1/push"
+	defaultClientTimeout = 5 * time.Second
+	defaultNameLabel     = "__name"
+)
+
+var sampleConfig = `
+  ## The domain of Loki
+  domain = "https://loki.domain.tld"
+
+  ## Endpoint to write api
+  # endpoint = "/loki/api/v1/push"
+
+  ## Connection timeout, defaults to "5s" if not set.
+  # timeout = "5s"
+
+  ## Basic auth credential
+  # username = "loki"
+  # password = "pass"
+
+  ## Bearer token, mutually exclusive with basic auth
+  # token = ""
+
+  ## Additional HTTP headers
+  # http_headers = {"X-Scope-OrgID" = "1"}
+
+  ## If the request must be gzip encoded
+  # gzip_request = false
+
+  ## Label holding the metric name in every stream
+  # metric_name_label = "__name"
+
+  ## OAuth2 Client Credentials Grant
+  # client_id = "clientid"
+  # client_secret = "secret"
+  # token_url = "https://indentityprovider/oauth2/v1/token"
+  # scopes = ["urn:opc:idm:__myscopes__"]
+
+  ## Optional TLS Config
+  # tls_ca = "/etc/telegraf/ca.pem"
+  # tls_cert = "/etc/telegraf/cert.pem"
+  # tls_key = "/etc/telegraf/key.pem"
+  ## Use TLS but skip chain & host verification
+  # insecure_skip_verify = false
+`
+
+type Loki struct {
+	Domain          string            `toml:"domain"`
+	Endpoint        string            `toml:"endpoint"`
+	Timeout         internal.Duration `toml:"timeout"`
+	Username        string            `toml:"username"`
+	Password        string            `toml:"password"`
+	Token           string            `toml:"token"`
+	Headers         map[string]string `toml:"http_headers"`
+	GZipRequest     bool              `toml:"gzip_request"`
+	MetricNameLabel string            `toml:"metric_name_label"`
+	ClientID        string            `toml:"client_id"`
+	ClientSecret    string            `toml:"client_secret"`
+	TokenURL        string            `toml:"token_url"`
+	Scopes          []string          `toml:"scopes"`
+	tls.ClientConfig
+
+	url    string
+	client *http.Client
+}
+
+func (l *Loki) SampleConfig() string {
+	return sampleConfig
+}
+
+func (l *Loki) Description() string {
+	return "Send logs to Loki"
+}
+
+func (l *Loki) createClient(ctx context.Context) (*http.Client, error) {
+	tlsCfg, err := l.ClientConfig.TLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("tls config fail: %v", err)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsCfg,
+			Proxy:           http.ProxyFromEnvironment,
+		},
+		Timeout: l.Timeout.Duration,
+	}
+
+	if l.ClientID != "" && l.ClientSecret != "" && l.TokenURL != "" {
+		oauthConfig := clientcredentials.Config{
+			ClientID:     l.ClientID,
+			ClientSecret: l.ClientSecret,
+			TokenURL:     l.TokenURL,
+			Scopes:       l.Scopes,
+		}
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, client)
+		client = oauthConfig.Client(ctx)
+	}
+
+	return client, nil
+}
+
+func (l *Loki) Connect() error {
+	if l.Domain == "" {
+		return fmt.Errorf("domain is required")
+	}
+
+	if (l.Username != "" || l.Password != "") && l.Token != "" {
+		return fmt.Errorf("basic auth and bearer token are mutually exclusive")
+	}
+
+	if l.Endpoint == "" {
+		l.Endpoint = defaultEndpoint
+	}
+
+	if l.MetricNameLabel == "" {
+		l.MetricNameLabel = defaultNameLabel
+	}
+
+	l.url = strings.TrimSuffix(l.Domain, "/") + l.Endpoint
+
+	if l.Timeout.Duration == 0 {
+		l.Timeout.Duration = defaultClientTimeout
+	}
+
+	ctx := context.Background()
+	client, err := l.createClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	l.client = client
+
+	return nil
+}
+
+func (l *Loki) Close() error {
+	return nil
+}
+
+func (l *Loki) Write(metrics []telegraf.Metric) error {
+	s := make(Streams)
+
+	for _, m := range metrics {
+		tags := make([]*telegraf.Tag, 0, len(m.TagList())+1)
+		tags = append(tags, &telegraf.Tag{Key: l.MetricNameLabel, Value: m.Name()})
+		for _, t := range m.TagList() {
+			if t.Key == l.MetricNameLabel {
+				continue
+			}
+			tags = append(tags, t)
+		}
+		sort.Slice(tags, func(i, j int) bool { return tags[i].Key < tags[j].Key })
+
+		s.insertLog(tags, newLog(m.Time(), logLine(m)))
+	}
+
+	return l.write(s)
+}
+
+// logLine renders the fields of the metric, sorted by key, as the log line.
+func logLine(m telegraf.Metric) string {
+	fields := m.FieldList()
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Key < fields[j].Key })
+
+	var b strings.Builder
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(fmt.Sprint(f.Value)))
+	}
+	return b.String()
+}
+
+func (l *Loki) write(s Streams) error {
+	bs, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	var reqBodyBuffer io.Reader = bytes.NewBuffer(bs)
+
+	if l.GZipRequest {
+		rc, err := internal.CompressWithGzip(reqBodyBuffer)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		reqBodyBuffer = rc
+	}
+
+	req, err := http.NewRequest(http.MethodPost, l.url, reqBodyBuffer)
+	if err != nil {
+		return err
+	}
+
+	if l.Username != "" || l.Password != "" {
+		req.SetBasicAuth(l.Username, l.Password)
+	}
+
+	if l.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+l.Token)
+	}
+
+	for k, v := range l.Headers {
+		if strings.ToLower(k) == "host" {
+			req.Host = v
+		}
+		req.Header.Set(k, v)
+	}
+
+	req.Header.Set("User-Agent", internal.ProductToken())
+	req.Header.Set("Content-Type", "application/json")
+	if l.GZipRequest {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("when writing to [%s] received status code, %d: %s", l.url, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	_, err = ioutil.ReadAll(resp.Body)
+
+	return err
+}
+
+func init() {
+	outputs.Add("loki", func() telegraf.Output {
+		return &Loki{
+			MetricNameLabel: defaultNameLabel,
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package loki
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func getMetric() telegraf.Metric {
+	return testutil.MustMetric(
+		"log",
+		map[string]string{
+			"key1": "value1",
+		},
+		map[string]interface{}{
+			"line":  "my log",
+			"field": 3.14,
+		},
+		time.Unix(123, 0),
+	)
+}
+
+func getOutOfOrderMetrics() []telegraf.Metric {
+	return []telegraf.Metric{
+		testutil.MustMetric(
+			"log",
+			map[string]string{
+				"key1": "value1",
+			},
+			map[string]interface{}{
+				"line": "newer log",
+			},
+			time.Unix(1230, 0),
+		),
+		testutil.MustMetric(
+			"log",
+			map[string]string{
+				"key1": "value1",
+			},
+			map[string]interface{}{
+				"line": "older log",
+			},
+			time.Unix(456, 0),
+		),
+		testutil.MustMetric(
+			"log",
+			map[string]string{
+				"key1": "value2",
+			},
+			map[string]interface{}{
+				"line": "other stream",
+			},
+			time.Unix(789, 0),
+		),
+	}
+}
+
+func newServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *url.URL) {
+	ts := httptest.NewServer(handler)
+	u, err := url.Parse(fmt.Sprintf("http://%s", ts.Listener.Addr().String()))
+	require.NoError(t, err)
+	return ts, u
+}
+
+func readRequest(t *testing.T, r *http.Request) Request {
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body = gz
+	}
+
+	payload, err := ioutil.ReadAll(body)
+	require.NoError(t, err)
+
+	var req Request
+	require.NoError(t, json.Unmarshal(payload, &req))
+	return req
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		errFunc    func(t *testing.T, err error)
+	}{
+		{
+			name:       "success",
+			statusCode: http.StatusNoContent,
+			errFunc: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:       "3xx status is an error",
+			statusCode: http.StatusMultipleChoices,
+			errFunc: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+		{
+			name:       "4xx status is an error",
+			statusCode: http.StatusBadRequest,
+			errFunc: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, u := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+			})
+			defer ts.Close()
+
+			plugin := &Loki{Domain: u.String()}
+			require.NoError(t, plugin.Connect())
+
+			err := plugin.Write([]telegraf.Metric{getMetric()})
+			tt.errFunc(t, err)
+		})
+	}
+}
+
+func TestContentEncodingGzip(t *testing.T) {
+	for _, gz := range []bool{false, true} {
+		t.Run(fmt.Sprintf("gzip=%v", gz), func(t *testing.T) {
+			ts, u := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, http.MethodPost, r.Method)
+				require.Equal(t, defaultEndpoint, r.URL.Path)
+				require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				if gz {
+					require.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+				} else {
+					require.Equal(t, "", r.Header.Get("Content-Encoding"))
+				}
+
+				req := readRequest(t, r)
+				require.Len(t, req.Streams, 1)
+				s := req.Streams[0]
+				require.Equal(t, map[string]string{"__name": "log", "key1": "value1"}, s.Labels)
+				require.Equal(t, []Log{{"123000000000", `field="3.14" line="my log"`}}, s.Logs)
+
+				w.WriteHeader(http.StatusNoContent)
+			})
+			defer ts.Close()
+
+			plugin := &Loki{
+				Domain:      u.String(),
+				GZipRequest: gz,
+			}
+			require.NoError(t, plugin.Connect())
+			require.NoError(t, plugin.Write([]telegraf.Metric{getMetric()}))
+		})
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	ts, u := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "loki", username)
+		require.Equal(t, "pass", password)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer ts.Close()
+
+	plugin := &Loki{
+		Domain:   u.String(),
+		Username: "loki",
+		Password: "pass",
+	}
+	require.NoError(t, plugin.Connect())
+	require.NoError(t, plugin.Write([]telegraf.Metric{getMetric()}))
+}
+
+func TestBearerToken(t *testing.T) {
+	ts, u := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		require.Equal(t, "tenant", r.Header.Get("X-Scope-OrgID"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer ts.Close()
+
+	plugin := &Loki{
+		Domain:  u.String(),
+		Token:   "secret",
+		Headers: map[string]string{"X-Scope-OrgID": "tenant"},
+	}
+	require.NoError(t, plugin.Connect())
+	require.NoError(t, plugin.Write([]telegraf.Metric{getMetric()}))
+}
+
+func TestAuthMutuallyExclusive(t *testing.T) {
+	plugin := &Loki{
+		Domain:   "http://localhost:3100",
+		Username: "loki",
+		Token:    "secret",
+	}
+	require.Error(t, plugin.Connect())
+}
+
+func TestMissingDomain(t *testing.T) {
+	plugin := &Loki{}
+	require.Error(t, plugin.Connect())
+}
+
+func TestMetricSorting(t *testing.T) {
+	ts, u := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		req := readRequest(t, r)
+		require.Len(t, req.Streams, 2)
+
+		require.Equal(t, map[string]string{"__name": "log", "key1": "value1"}, req.Streams[0].Labels)
+		require.Equal(t, []Log{
+			{"456000000000", `line="older log"`},
+			{"1230000000000", `line="newer log"`},
+		}, req.Streams[0].Logs)
+
+		require.Equal(t, map[string]string{"__name": "log", "key1": "value2"}, req.Streams[1].Labels)
+		require.Equal(t, []Log{
+			{"789000000000", `line="other stream"`},
+		}, req.Streams[1].Logs)
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer ts.Close()
+
+	plugin := &Loki{Domain: u.String()}
+	require.NoError(t, plugin.Connect())
+	require.NoError(t, plugin.Write(getOutOfOrderMetrics()))
+}
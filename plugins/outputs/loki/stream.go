@@ -0,0 +1,108 @@
+package loki
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+)
+
+type (
+	// Log is a single log entry as expected by the Loki push API, a tuple
+	// of the timestamp in nanoseconds and the log line.
+	Log []string
+
+	// Stream is a set of log entries sharing the same labels.
+	Stream struct {
+		Labels map[string]string `json:"stream"`
+		Logs   []Log             `json:"values"`
+	}
+
+	// Request is the body of a Loki push API request.
+	Request struct {
+		Streams []Stream `json:"streams"`
+	}
+
+	// Streams groups log entries by their label set.
+	Streams map[string]*Stream
+)
+
+// insertLog adds the log entry to the stream identified by the tags.
+func (s Streams) insertLog(tags []*telegraf.Tag, l Log) {
+	key := uniqKeyFromTagList(tags)
+
+	if _, ok := s[key]; !ok {
+		s[key] = newStream(tags)
+	}
+
+	s[key].Logs = append(s[key].Logs, l)
+}
+
+// MarshalJSON returns the streams as a push API request with the entries of
+// every stream sorted by timestamp.
+func (s Streams) MarshalJSON() ([]byte, error) {
+	r := Request{
+		Streams: make([]Stream, 0, len(s)),
+	}
+
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		stream := *s[k]
+		sort.SliceStable(stream.Logs, func(i, j int) bool {
+			return logTime(stream.Logs[i]) < logTime(stream.Logs[j])
+		})
+		r.Streams = append(r.Streams, stream)
+	}
+
+	return json.Marshal(r)
+}
+
+// keyEscaper escapes the separators of the stream keys.  The backslash is
+// escaped too, so an escaped separator can't be confused with a backslash
+// followed by a separator.
+var keyEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`=`, `\=`,
+	`;`, `\;`,
+)
+
+func uniqKeyFromTagList(tags []*telegraf.Tag) string {
+	var b strings.Builder
+	for _, t := range tags {
+		b.WriteString(keyEscaper.Replace(t.Key))
+		b.WriteByte('=')
+		b.WriteString(keyEscaper.Replace(t.Value))
+		b.WriteByte(';')
+	}
+	return b.String()
+}
+
+func newStream(tags []*telegraf.Tag) *Stream {
+	s := &Stream{
+		Labels: make(map[string]string, len(tags)),
+		Logs:   []Log{},
+	}
+
+	for _, t := range tags {
+		s.Labels[t.Key] = t.Value
+	}
+
+	return s
+}
+
+func newLog(t time.Time, line string) Log {
+	return []string{strconv.FormatInt(t.UnixNano(), 10), line}
+}
+
+func logTime(l Log) int64 {
+	ts, _ := strconv.ParseInt(l[0], 10, 64)
+	return ts
+}
@@ -0,0 +1,43 @@
+package loki
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamsInsertLog(t *testing.T) {
+	s := make(Streams)
+
+	tags := []*telegraf.Tag{
+		{Key: "a", Value: "1"},
+		{Key: "b", Value: "2"},
+	}
+	s.insertLog(tags, newLog(time.Unix(0, 1), "first"))
+	s.insertLog(tags, newLog(time.Unix(0, 2), "second"))
+	s.insertLog([]*telegraf.Tag{{Key: "a", Value: "1"}}, newLog(time.Unix(0, 3), "third"))
+
+	require.Len(t, s, 2)
+	stream := s[uniqKeyFromTagList(tags)]
+	require.Equal(t, map[string]string{"a": "1", "b": "2"}, stream.Labels)
+	require.Equal(t, []Log{{"1", "first"}, {"2", "second"}}, stream.Logs)
+}
+
+func TestUniqKeyFromTagList(t *testing.T) {
+	// Separators within keys and values must not create collisions.
+	a := uniqKeyFromTagList([]*telegraf.Tag{{Key: "a", Value: "1;b=2"}})
+	b := uniqKeyFromTagList([]*telegraf.Tag{{Key: "a", Value: "1"}, {Key: "b", Value: "2"}})
+	require.NotEqual(t, a, b)
+
+	a = uniqKeyFromTagList([]*telegraf.Tag{{Key: "a", Value: "1=b"}})
+	b = uniqKeyFromTagList([]*telegraf.Tag{{Key: "a=1", Value: "b"}})
+	require.NotEqual(t, a, b)
+
+	// An escaped separator must not be confused with a backslash in the
+	// value followed by a separator.
+	a = uniqKeyFromTagList([]*telegraf.Tag{{Key: "a", Value: `1\`}, {Key: "b", Value: "2"}})
+	b = uniqKeyFromTagList([]*telegraf.Tag{{Key: "a", Value: "1;b=2"}})
+	require.NotEqual(t, a, b)
+}
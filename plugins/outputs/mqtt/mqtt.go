@@ -1,16 +1,19 @@
 package mqtt
 
 import (
+	"bytes"
 	"fmt"
-	"log"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/plugins/common/tls"
+	"github.com/influxdata/telegraf/plugins/common/tmpl"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/serializers"
 )
@@ -18,11 +21,21 @@ import (
 var sampleConfig = `
   servers = ["localhost:1883"] # required.
 
+  ## MQTT protocol version, either "3.1.1" or "5".
+  # protocol = "3.1.1"
+
   ## MQTT outputs send metrics to this topic format
   ##    "<topic_prefix>/<hostname>/<pluginname>/"
   ##   ex: prefix/web01.example.com/mem
+  ## Ignored if topic is set.
   topic_prefix = "telegraf"
 
+  ## Go template of the topic of the metrics, replaces topic_prefix.  The
+  ## template can use the methods .Name, .Tag "key", .Field "key" and .Time
+  ## of the metric.  Empty topic levels, for example of missing tags, are
+  ## removed.
+  # topic = 'telegraf/{{ .Tag "host" }}/{{ .Name }}'
+
   ## QoS policy for messages
   ##   0 = at most once
   ##   1 = at least once
@@ -46,72 +59,149 @@ var sampleConfig = `
   ## Use TLS but skip chain & host verification
   # insecure_skip_verify = false
 
+  ## Layout of the messages:
+  ##   non-batch: one message per metric
+  ##   batch:     one message per topic and flush with all metrics of the topic
+  ##   field:     one message per field, published to the topic of the metric
+  ##              followed by the field key, with the raw field value as
+  ##              payload; the data format is not used
+  # layout = "non-batch"
+
   ## When true, metrics will be sent in one MQTT message per flush.  Otherwise,
   ## metrics are written one metric per MQTT message.
+  ##   deprecated in 1.16; use layout = "batch"
   # batch = false
 
   ## When true, metric will have RETAIN flag set, making broker cache entries until someone
   ## actually reads it
   # retain = false
 
+  ## Expiry of the messages stored by the broker, requires protocol "5".  The
+  ## messages do not expire if set to 0.
+  # message_expiry = "0s"
+
   ## Data format to output.
   ## Each data format has its own unique set of configuration options, read
   ## more about them here:
   ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_OUTPUT.md
   data_format = "influx"
+
+  ## User properties of the messages, requires protocol "5".
+  # [outputs.mqtt.user_properties]
+  #   source = "telegraf"
 `
 
+const (
+	layoutNonBatch = "non-batch"
+	layoutBatch    = "batch"
+	layoutField    = "field"
+)
+
+// client publishes the messages with one of the MQTT protocol versions.
+type client interface {
+	Connect() error
+	Publish(topic string, body []byte) error
+	Close() error
+}
+
 type MQTT struct {
 	Servers     []string `toml:"servers"`
+	Protocol    string   `toml:"protocol"`
 	Username    string
 	Password    string
 	Database    string
 	Timeout     internal.Duration
 	TopicPrefix string
+	Topic       string `toml:"topic"`
 	QoS         int    `toml:"qos"`
 	ClientID    string `toml:"client_id"`
 	tls.ClientConfig
-	BatchMessage bool `toml:"batch"`
-	Retain       bool `toml:"retain"`
+	BatchMessage   bool              `toml:"batch"` // deprecated in 1.16; use layout
+	Layout         string            `toml:"layout"`
+	Retain         bool              `toml:"retain"`
+	MessageExpiry  internal.Duration `toml:"message_expiry"`
+	UserProperties map[string]string `toml:"user_properties"`
 
-	client paho.Client
-	opts   *paho.ClientOptions
+	Log telegraf.Logger `toml:"-"`
+
+	client client
+	topic  *template.Template
 
 	serializer serializers.Serializer
 
 	sync.Mutex
 }
 
-func (m *MQTT) Connect() error {
-	var err error
-	m.Lock()
-	defer m.Unlock()
+func (m *MQTT) Init() error {
 	if m.QoS > 2 || m.QoS < 0 {
 		return fmt.Errorf("MQTT Output, invalid QoS value: %d", m.QoS)
 	}
 
-	m.opts, err = m.createOpts()
-	if err != nil {
-		return err
+	if m.Timeout.Duration < time.Second {
+		m.Timeout.Duration = 5 * time.Second
 	}
 
-	m.client = paho.NewClient(m.opts)
-	if token := m.client.Connect(); token.Wait() && token.Error() != nil {
-		return token.Error()
+	switch m.Protocol {
+	case "", "3.1.1":
+		if m.MessageExpiry.Duration != 0 || len(m.UserProperties) > 0 {
+			return fmt.Errorf("message_expiry and user_properties require protocol \"5\"")
+		}
+	case "5":
+	default:
+		return fmt.Errorf("unknown protocol %q", m.Protocol)
+	}
+
+	switch m.Layout {
+	case "":
+		m.Layout = layoutNonBatch
+		if m.BatchMessage {
+			m.Layout = layoutBatch
+		}
+	case layoutNonBatch, layoutBatch, layoutField:
+	default:
+		return fmt.Errorf("unknown layout %q", m.Layout)
+	}
+
+	if m.Topic != "" {
+		tmpl, err := template.New("topic").Parse(m.Topic)
+		if err != nil {
+			return fmt.Errorf("invalid topic template: %v", err)
+		}
+		m.topic = tmpl
 	}
 
 	return nil
 }
 
+func (m *MQTT) Connect() error {
+	m.Lock()
+	defer m.Unlock()
+
+	var err error
+	if m.Protocol == "5" {
+		m.client, err = m.createV5Client()
+	} else {
+		m.client, err = m.createV311Client()
+	}
+	if err != nil {
+		return err
+	}
+
+	return m.client.Connect()
+}
+
 func (m *MQTT) SetSerializer(serializer serializers.Serializer) {
 	m.serializer = serializer
 }
 
 func (m *MQTT) Close() error {
-	if m.client.IsConnected() {
-		m.client.Disconnect(20)
+	m.Lock()
+	defer m.Unlock()
+
+	if m.client == nil {
+		return nil
 	}
-	return nil
+	return m.client.Close()
 }
 
 func (m *MQTT) SampleConfig() string {
@@ -133,26 +223,34 @@ func (m *MQTT) Write(metrics []telegraf.Metric) error {
 		hostname = ""
 	}
 
-	metricsmap := make(map[string][]telegraf.Metric)
+	// Topics of the batches in order of their first metric.
+	var topics []string
+	batches := make(map[string][]telegraf.Metric)
 
 	for _, metric := range metrics {
-		var t []string
-		if m.TopicPrefix != "" {
-			t = append(t, m.TopicPrefix)
-		}
-		if hostname != "" {
-			t = append(t, hostname)
+		topic, err := m.metricTopic(metric, hostname)
+		if err != nil {
+			m.Log.Errorf("Could not create topic of metric %q: %v", metric.Name(), err)
+			continue
 		}
 
-		t = append(t, metric.Name())
-		topic := strings.Join(t, "/")
-
-		if m.BatchMessage {
-			metricsmap[topic] = append(metricsmap[topic], metric)
-		} else {
+		switch m.Layout {
+		case layoutBatch:
+			if _, ok := batches[topic]; !ok {
+				topics = append(topics, topic)
+			}
+			batches[topic] = append(batches[topic], metric)
+		case layoutField:
+			for _, field := range metric.FieldList() {
+				err := m.publish(topic+"/"+field.Key, formatValue(field.Value))
+				if err != nil {
+					return fmt.Errorf("Could not write to MQTT server, %s", err)
+				}
+			}
+		default:
 			buf, err := m.serializer.Serialize(metric)
 			if err != nil {
-				log.Printf("D! [outputs.mqtt] Could not serialize metric: %v", err)
+				m.Log.Debugf("Could not serialize metric: %v", err)
 				continue
 			}
 
@@ -163,13 +261,12 @@ func (m *MQTT) Write(metrics []telegraf.Metric) error {
 		}
 	}
 
-	for key := range metricsmap {
-		buf, err := m.serializer.SerializeBatch(metricsmap[key])
-
+	for _, topic := range topics {
+		buf, err := m.serializer.SerializeBatch(batches[topic])
 		if err != nil {
 			return err
 		}
-		publisherr := m.publish(key, buf)
+		publisherr := m.publish(topic, buf)
 		if publisherr != nil {
 			return fmt.Errorf("Could not write to MQTT server, %s", publisherr)
 		}
@@ -178,22 +275,66 @@ func (m *MQTT) Write(metrics []telegraf.Metric) error {
 	return nil
 }
 
+// metricTopic returns the topic of the metric, the hostname is used for the
+// topic_prefix layout.
+func (m *MQTT) metricTopic(metric telegraf.Metric, hostname string) (string, error) {
+	var t []string
+	if m.topic == nil {
+		if m.TopicPrefix != "" {
+			t = append(t, m.TopicPrefix)
+		}
+		if hostname != "" {
+			t = append(t, hostname)
+		}
+		t = append(t, metric.Name())
+		return strings.Join(t, "/"), nil
+	}
+
+	var b bytes.Buffer
+	if err := m.topic.Execute(&b, tmpl.NewMetric(metric)); err != nil {
+		return "", err
+	}
+	for _, level := range strings.Split(b.String(), "/") {
+		if level != "" {
+			t = append(t, level)
+		}
+	}
+
+	topic := strings.Join(t, "/")
+	if topic == "" {
+		return "", fmt.Errorf("empty topic")
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return "", fmt.Errorf("topic %q contains a wildcard", topic)
+	}
+	return topic, nil
+}
+
 func (m *MQTT) publish(topic string, body []byte) error {
-	token := m.client.Publish(topic, byte(m.QoS), m.Retain, body)
-	token.WaitTimeout(m.Timeout.Duration)
-	if token.Error() != nil {
-		return token.Error()
+	return m.client.Publish(topic, body)
+}
+
+// formatValue returns the raw value of a field for the field layout.
+func formatValue(value interface{}) []byte {
+	switch v := value.(type) {
+	case string:
+		return []byte(v)
+	case int64:
+		return []byte(strconv.FormatInt(v, 10))
+	case uint64:
+		return []byte(strconv.FormatUint(v, 10))
+	case float64:
+		return []byte(strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		return []byte(strconv.FormatBool(v))
+	default:
+		return []byte(fmt.Sprint(v))
 	}
-	return nil
 }
 
 func (m *MQTT) createOpts() (*paho.ClientOptions, error) {
 	opts := paho.NewClientOptions()
 	opts.KeepAlive = 0
-
-	if m.Timeout.Duration < time.Second {
-		m.Timeout.Duration = 5 * time.Second
-	}
 	opts.WriteTimeout = m.Timeout.Duration
 
 	if m.ClientID != "" {
@@ -234,6 +375,50 @@ func (m *MQTT) createOpts() (*paho.ClientOptions, error) {
 	return opts, nil
 }
 
+func (m *MQTT) createV311Client() (client, error) {
+	opts, err := m.createOpts()
+	if err != nil {
+		return nil, err
+	}
+	return &v311Client{
+		client:  paho.NewClient(opts),
+		qos:     byte(m.QoS),
+		retain:  m.Retain,
+		timeout: m.Timeout.Duration,
+	}, nil
+}
+
+// v311Client publishes with MQTT 3.1.1.
+type v311Client struct {
+	client  paho.Client
+	qos     byte
+	retain  bool
+	timeout time.Duration
+}
+
+func (c *v311Client) Connect() error {
+	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+func (c *v311Client) Publish(topic string, body []byte) error {
+	token := c.client.Publish(topic, c.qos, c.retain, body)
+	token.WaitTimeout(c.timeout)
+	if token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+func (c *v311Client) Close() error {
+	if c.client.IsConnected() {
+		c.client.Disconnect(20)
+	}
+	return nil
+}
+
 func init() {
 	outputs.Add("mqtt", func() telegraf.Output {
 		return &MQTT{}
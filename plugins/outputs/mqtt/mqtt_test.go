@@ -2,7 +2,12 @@ package mqtt
 
 import (
 	"testing"
+	"time"
 
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/common/mqtt/mqtttest"
 	"github.com/influxdata/telegraf/plugins/serializers"
 	"github.com/influxdata/telegraf/testutil"
 
@@ -19,7 +24,9 @@ func TestConnectAndWrite(t *testing.T) {
 	m := &MQTT{
 		Servers:    []string{url},
 		serializer: s,
+		Log:        testutil.Logger{},
 	}
+	require.NoError(t, m.Init())
 
 	// Verify that we can connect to the MQTT broker
 	err := m.Connect()
@@ -29,3 +36,214 @@ func TestConnectAndWrite(t *testing.T) {
 	err = m.Write(testutil.MockMetrics())
 	require.NoError(t, err)
 }
+
+type message struct {
+	topic string
+	body  string
+}
+
+type fakeClient struct {
+	messages []message
+}
+
+func (c *fakeClient) Connect() error {
+	return nil
+}
+
+func (c *fakeClient) Publish(topic string, body []byte) error {
+	c.messages = append(c.messages, message{topic: topic, body: string(body)})
+	return nil
+}
+
+func (c *fakeClient) Close() error {
+	return nil
+}
+
+func testMetrics() []telegraf.Metric {
+	return []telegraf.Metric{
+		testutil.MustMetric(
+			"cpu",
+			map[string]string{"host": "a", "cpu": "cpu0"},
+			map[string]interface{}{"usage_idle": 42.5},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"mem",
+			map[string]string{"host": "b"},
+			map[string]interface{}{"active": true},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"cpu",
+			map[string]string{"host": "a", "cpu": "cpu1"},
+			map[string]interface{}{"usage_idle": 40.0},
+			time.Unix(0, 0),
+		),
+	}
+}
+
+func TestLayouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		plugin   *MQTT
+		expected []message
+	}{
+		{
+			name:   "topic prefix",
+			plugin: &MQTT{TopicPrefix: "telegraf"},
+			expected: []message{
+				{topic: "telegraf/a/cpu", body: "cpu,cpu=cpu0,host=a usage_idle=42.5 0\n"},
+				{topic: "telegraf/a/mem", body: "mem,host=b active=true 0\n"},
+				{topic: "telegraf/a/cpu", body: "cpu,cpu=cpu1,host=a usage_idle=40 0\n"},
+			},
+		},
+		{
+			name:   "topic template",
+			plugin: &MQTT{Topic: `sensors/{{ .Tag "host" }}/{{ .Tag "cpu" }}/{{ .Name }}`},
+			expected: []message{
+				{topic: "sensors/a/cpu0/cpu", body: "cpu,cpu=cpu0,host=a usage_idle=42.5 0\n"},
+				{topic: "sensors/b/mem", body: "mem,host=b active=true 0\n"},
+				{topic: "sensors/a/cpu1/cpu", body: "cpu,cpu=cpu1,host=a usage_idle=40 0\n"},
+			},
+		},
+		{
+			name:   "batch per topic",
+			plugin: &MQTT{Topic: `sensors/{{ .Tag "host" }}/{{ .Name }}`, Layout: "batch"},
+			expected: []message{
+				{topic: "sensors/a/cpu", body: "cpu,cpu=cpu0,host=a usage_idle=42.5 0\ncpu,cpu=cpu1,host=a usage_idle=40 0\n"},
+				{topic: "sensors/b/mem", body: "mem,host=b active=true 0\n"},
+			},
+		},
+		{
+			name:   "deprecated batch option",
+			plugin: &MQTT{TopicPrefix: "telegraf", BatchMessage: true},
+			expected: []message{
+				{topic: "telegraf/a/cpu", body: "cpu,cpu=cpu0,host=a usage_idle=42.5 0\ncpu,cpu=cpu1,host=a usage_idle=40 0\n"},
+				{topic: "telegraf/a/mem", body: "mem,host=b active=true 0\n"},
+			},
+		},
+		{
+			name:   "field",
+			plugin: &MQTT{Topic: `sensors/{{ .Tag "host" }}/{{ .Tag "cpu" }}`, Layout: "field"},
+			expected: []message{
+				{topic: "sensors/a/cpu0/usage_idle", body: "42.5"},
+				{topic: "sensors/b/active", body: "true"},
+				{topic: "sensors/a/cpu1/usage_idle", body: "40"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := serializers.NewInfluxSerializer()
+			require.NoError(t, err)
+
+			client := &fakeClient{}
+			m := tt.plugin
+			m.Log = testutil.Logger{}
+			m.SetSerializer(s)
+			require.NoError(t, m.Init())
+			m.client = client
+
+			require.NoError(t, m.Write(testMetrics()))
+			require.Equal(t, tt.expected, client.messages)
+		})
+	}
+}
+
+func TestInvalidTopicSkipped(t *testing.T) {
+	s, err := serializers.NewInfluxSerializer()
+	require.NoError(t, err)
+
+	client := &fakeClient{}
+	m := &MQTT{
+		Topic:      `{{ .Tag "room" }}`,
+		serializer: s,
+		Log:        testutil.Logger{},
+	}
+	require.NoError(t, m.Init())
+	m.client = client
+
+	require.NoError(t, m.Write([]telegraf.Metric{
+		testutil.MustMetric("cpu", map[string]string{"room": "+"}, map[string]interface{}{"value": 1}, time.Unix(0, 0)),
+		testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"value": 2}, time.Unix(0, 0)),
+		testutil.MustMetric("cpu", map[string]string{"room": "kitchen"}, map[string]interface{}{"value": 3}, time.Unix(0, 0)),
+	}))
+	require.Equal(t, []message{{topic: "kitchen", body: "cpu,room=kitchen value=3i 0\n"}}, client.messages)
+}
+
+func TestFieldLayoutValues(t *testing.T) {
+	client := &fakeClient{}
+	m := &MQTT{
+		Topic:  `{{ .Name }}`,
+		Layout: "field",
+		Log:    testutil.Logger{},
+	}
+	require.NoError(t, m.Init())
+	m.client = client
+
+	require.NoError(t, m.Write([]telegraf.Metric{
+		testutil.MustMetric(
+			"sensor",
+			map[string]string{},
+			map[string]interface{}{
+				"string": "on",
+				"int":    int64(-3),
+				"uint":   uint64(3),
+				"float":  0.000001,
+				"bool":   false,
+			},
+			time.Unix(0, 0),
+		),
+	}))
+	require.ElementsMatch(t, []message{
+		{topic: "sensor/string", body: "on"},
+		{topic: "sensor/int", body: "-3"},
+		{topic: "sensor/uint", body: "3"},
+		{topic: "sensor/float", body: "0.000001"},
+		{topic: "sensor/bool", body: "false"},
+	}, client.messages)
+}
+
+func TestInitErrors(t *testing.T) {
+	require.Error(t, (&MQTT{QoS: 3}).Init())
+	require.Error(t, (&MQTT{Protocol: "4"}).Init())
+	require.Error(t, (&MQTT{Layout: "table"}).Init())
+	require.Error(t, (&MQTT{Topic: "{{ .Name"}).Init())
+	require.Error(t, (&MQTT{UserProperties: map[string]string{"a": "b"}}).Init())
+	require.Error(t, (&MQTT{MessageExpiry: internal.Duration{Duration: time.Minute}}).Init())
+}
+
+func TestWriteV5(t *testing.T) {
+	broker := mqtttest.NewBroker(t)
+	defer broker.Close()
+
+	s, err := serializers.NewInfluxSerializer()
+	require.NoError(t, err)
+
+	m := &MQTT{
+		Servers:        []string{broker.Addr()},
+		Protocol:       "5",
+		Topic:          `telegraf/{{ .Name }}`,
+		QoS:            1,
+		Retain:         true,
+		MessageExpiry:  internal.Duration{Duration: time.Hour},
+		UserProperties: map[string]string{"source": "telegraf"},
+		serializer:     s,
+		Log:            testutil.Logger{},
+	}
+	require.NoError(t, m.Init())
+	require.NoError(t, m.Connect())
+	defer m.Close()
+
+	require.NoError(t, m.Write(testMetrics()[1:2]))
+
+	p := <-broker.Published
+	publish := p.Content.(*packets.Publish)
+	require.Equal(t, "telegraf/mem", publish.Topic)
+	require.Equal(t, "mem,host=b active=true 0\n", string(publish.Payload))
+	require.Equal(t, byte(1), publish.QoS)
+	require.Equal(t, byte(1), p.Flags&0x01, "retain flag")
+	require.Equal(t, map[string]string{"source": "telegraf"}, publish.Properties.User)
+	require.NotNil(t, publish.Properties.MessageExpiry)
+	require.Equal(t, uint32(3600), *publish.Properties.MessageExpiry)
+}
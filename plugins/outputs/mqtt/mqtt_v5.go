@@ -0,0 +1,155 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/influxdata/telegraf/internal"
+	mqttint "github.com/influxdata/telegraf/plugins/common/mqtt"
+)
+
+func (m *MQTT) createV5Client() (client, error) {
+	tlsCfg, err := m.ClientConfig.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := "tcp"
+	if tlsCfg != nil {
+		scheme = "ssl"
+	}
+
+	if len(m.Servers) == 0 {
+		return nil, fmt.Errorf("could not get host informations")
+	}
+	var servers []*url.URL
+	for _, host := range m.Servers {
+		server, err := url.Parse(fmt.Sprintf("%s://%s", scheme, host))
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+
+	clientID := m.ClientID
+	if clientID == "" {
+		clientID = "Telegraf-Output-" + internal.RandomString(5)
+	}
+
+	publish := paho.Publish{
+		QoS:    byte(m.QoS),
+		Retain: m.Retain,
+	}
+	if m.MessageExpiry.Duration > 0 || len(m.UserProperties) > 0 {
+		publish.Properties = &paho.PublishProperties{User: m.UserProperties}
+		if m.MessageExpiry.Duration > 0 {
+			expiry := uint32(m.MessageExpiry.Duration / time.Second)
+			publish.Properties.MessageExpiry = &expiry
+		}
+	}
+
+	return &v5Client{
+		servers:   servers,
+		tlsConfig: tlsCfg,
+		timeout:   m.Timeout.Duration,
+		connect: paho.Connect{
+			ClientID:     clientID,
+			CleanStart:   true,
+			Username:     m.Username,
+			UsernameFlag: m.Username != "",
+			Password:     []byte(m.Password),
+			PasswordFlag: m.Password != "",
+		},
+		publish: publish,
+	}, nil
+}
+
+// v5Client publishes with MQTT v5.  It connects again on the next publish
+// if the connection is lost.
+type v5Client struct {
+	servers   []*url.URL
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	connect   paho.Connect
+	publish   paho.Publish
+
+	mu     sync.Mutex
+	client *paho.Client
+	conn   *mqttint.Conn
+}
+
+func (c *v5Client) Connect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connectLocked()
+}
+
+func (c *v5Client) connectLocked() error {
+	conn, err := mqttint.Dial(c.servers, c.tlsConfig, c.timeout)
+	if err != nil {
+		return err
+	}
+
+	var mqttConn *mqttint.Conn
+	mqttConn = mqttint.NewConn(conn, func(error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.conn == mqttConn {
+			c.client = nil
+			c.conn = nil
+		}
+	})
+	client := mqttint.NewV5Client(mqttConn, c.timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	connect := c.connect
+	if _, err := client.Connect(ctx, &connect); err != nil {
+		mqttConn.Disconnecting()
+		conn.Close()
+		return err
+	}
+
+	c.client = client
+	c.conn = mqttConn
+	return nil
+}
+
+func (c *v5Client) Publish(topic string, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		if err := c.connectLocked(); err != nil {
+			return err
+		}
+	}
+
+	publish := c.publish
+	publish.Topic = topic
+	publish.Payload = body
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	_, err := c.client.Publish(ctx, &publish)
+	return err
+}
+
+func (c *v5Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client == nil {
+		return nil
+	}
+	c.conn.Disconnecting()
+	err := c.client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	c.client = nil
+	c.conn = nil
+	return err
+}
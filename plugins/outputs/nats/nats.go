@@ -1,17 +1,35 @@
 package nats
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/plugins/common/tls"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/serializers"
 	"github.com/nats-io/nats.go"
 )
 
+var defaultAckWait = internal.Duration{Duration: 5 * time.Second}
+
+// JetStreamConfig enables publishing to JetStream, the write succeeds once
+// the stream has stored the messages.
+type JetStreamConfig struct {
+	Stream          string            `toml:"stream"`
+	CreateStream    bool              `toml:"create_stream"`
+	Storage         string            `toml:"storage"`
+	DuplicateWindow internal.Duration `toml:"duplicate_window"`
+	AckWait         internal.Duration `toml:"ack_wait"`
+	Deduplication   bool              `toml:"deduplication"`
+}
+
 type NATS struct {
 	Servers     []string `toml:"servers"`
 	Secure      bool     `toml:"secure"`
@@ -20,9 +38,12 @@ type NATS struct {
 	Credentials string   `toml:"credentials"`
 	Subject     string   `toml:"subject"`
 
+	JetStream *JetStreamConfig `toml:"jetstream"`
+
 	tls.ClientConfig
 
 	conn       *nats.Conn
+	js         nats.JetStreamContext
 	serializer serializers.Serializer
 }
 
@@ -55,12 +76,54 @@ var sampleConfig = `
   ## more about them here:
   ## https://github.com/influxdata/telegraf/blob/master/docs/DATA_FORMATS_OUTPUT.md
   data_format = "influx"
+
+  ## Publish to JetStream instead of core NATS.  A write succeeds once the
+  ## stream has stored all messages, otherwise the metrics are kept in the
+  ## buffer and written again.
+  # [outputs.nats.jetstream]
+  #   ## Stream expected to store the messages; if unset the messages may be
+  #   ## stored by any stream of the subject.
+  #   # stream = ""
+  #
+  #   ## Create the stream with the subject if it does not exist, storing the
+  #   ## messages in a "file" or in "memory".
+  #   # create_stream = false
+  #   # storage = "file"
+  #
+  #   ## Window in which the created stream drops messages with a known ID.
+  #   # duplicate_window = "2m"
+  #
+  #   ## Maximum time to wait for the acknowledgement of the messages.
+  #   # ack_wait = "5s"
+  #
+  #   ## Set the message ID to a hash of the subject and message, so the
+  #   ## stream drops messages written again within the duplicate window.
+  #   # deduplication = false
 `
 
 func (n *NATS) SetSerializer(serializer serializers.Serializer) {
 	n.serializer = serializer
 }
 
+func (n *NATS) Init() error {
+	if n.JetStream == nil {
+		return nil
+	}
+
+	switch n.JetStream.Storage {
+	case "", "file", "memory":
+	default:
+		return fmt.Errorf("unknown jetstream storage %q", n.JetStream.Storage)
+	}
+	if n.JetStream.CreateStream && n.JetStream.Stream == "" {
+		return errors.New("jetstream create_stream requires stream")
+	}
+	if n.JetStream.AckWait.Duration <= 0 {
+		n.JetStream.AckWait = defaultAckWait
+	}
+	return nil
+}
+
 func (n *NATS) Connect() error {
 	var err error
 
@@ -84,8 +147,46 @@ func (n *NATS) Connect() error {
 
 	// try and connect
 	n.conn, err = nats.Connect(strings.Join(n.Servers, ","), opts...)
+	if err != nil {
+		return err
+	}
+
+	if n.JetStream != nil {
+		if err := n.connectJetStream(); err != nil {
+			n.conn.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *NATS) connectJetStream() error {
+	js, err := n.conn.JetStream()
+	if err != nil {
+		return err
+	}
+
+	cfg := n.JetStream
+	if cfg.CreateStream {
+		if _, err := js.StreamInfo(cfg.Stream); err != nil {
+			storage := nats.FileStorage
+			if cfg.Storage == "memory" {
+				storage = nats.MemoryStorage
+			}
+			_, err = js.AddStream(&nats.StreamConfig{
+				Name:       cfg.Stream,
+				Subjects:   []string{n.Subject},
+				Storage:    storage,
+				Duplicates: cfg.DuplicateWindow.Duration,
+			})
+			if err != nil {
+				return fmt.Errorf("creating stream %q failed: %v", cfg.Stream, err)
+			}
+		}
+	}
 
-	return err
+	n.js = js
+	return nil
 }
 
 func (n *NATS) Close() error {
@@ -106,6 +207,10 @@ func (n *NATS) Write(metrics []telegraf.Metric) error {
 		return nil
 	}
 
+	if n.js != nil {
+		return n.writeJetStream(metrics)
+	}
+
 	for _, metric := range metrics {
 		buf, err := n.serializer.Serialize(metric)
 		if err != nil {
@@ -121,6 +226,55 @@ func (n *NATS) Write(metrics []telegraf.Metric) error {
 	return nil
 }
 
+func (n *NATS) writeJetStream(metrics []telegraf.Metric) error {
+	var opts []nats.PubOpt
+	if n.JetStream.Stream != "" {
+		opts = append(opts, nats.ExpectStream(n.JetStream.Stream))
+	}
+
+	futures := make([]nats.PubAckFuture, 0, len(metrics))
+	for _, metric := range metrics {
+		buf, err := n.serializer.Serialize(metric)
+		if err != nil {
+			log.Printf("D! [outputs.nats] Could not serialize metric: %v", err)
+			continue
+		}
+
+		msgOpts := opts
+		if n.JetStream.Deduplication {
+			msgOpts = append(msgOpts[:len(opts):len(opts)], nats.MsgId(messageID(n.Subject, buf)))
+		}
+
+		future, err := n.js.PublishAsync(n.Subject, buf, msgOpts...)
+		if err != nil {
+			return fmt.Errorf("FAILED to send NATS message: %s", err)
+		}
+		futures = append(futures, future)
+	}
+
+	timeout := time.NewTimer(n.JetStream.AckWait.Duration)
+	defer timeout.Stop()
+	for _, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			return fmt.Errorf("FAILED to store NATS message: %s", err)
+		case <-timeout.C:
+			return errors.New("FAILED to store NATS message: timeout waiting for acknowledgement")
+		}
+	}
+	return nil
+}
+
+// messageID returns the deduplication ID of a message.
+func messageID(subject string, data []byte) string {
+	h := sha256.New()
+	h.Write([]byte(subject))
+	h.Write([]byte{0})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func init() {
 	outputs.Add("nats", func() telegraf.Output {
 		return &NATS{}
@@ -1,10 +1,17 @@
 package nats
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/plugins/serializers"
 	"github.com/influxdata/telegraf/testutil"
+	"github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/require"
 )
 
@@ -29,3 +36,81 @@ func TestConnectAndWrite(t *testing.T) {
 	err = n.Write(testutil.MockMetrics())
 	require.NoError(t, err)
 }
+
+// runJetStreamServer starts an embedded NATS server with JetStream enabled,
+// storing the streams in a temporary directory. The returned function stops
+// the server and removes the directory.
+func runJetStreamServer(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "jetstream")
+	require.NoError(t, err)
+
+	opts := test.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = dir
+	s := test.RunServer(&opts)
+	return s.ClientURL(), func() {
+		s.Shutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestJetStreamWrite(t *testing.T) {
+	url, stop := runJetStreamServer(t)
+	defer stop()
+
+	s, err := serializers.NewInfluxSerializer()
+	require.NoError(t, err)
+	n := &NATS{
+		Servers: []string{url},
+		Subject: "telegraf",
+		JetStream: &JetStreamConfig{
+			Stream:          "metrics",
+			CreateStream:    true,
+			Storage:         "memory",
+			DuplicateWindow: internal.Duration{Duration: time.Minute},
+			Deduplication:   true,
+		},
+		serializer: s,
+	}
+	require.NoError(t, n.Init())
+	require.NoError(t, n.Connect())
+	defer n.Close()
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"value": 1.0}, time.Unix(0, 1)),
+		testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"value": 2.0}, time.Unix(0, 2)),
+	}
+	require.NoError(t, n.Write(metrics))
+
+	// Written again, the messages are dropped as duplicates.
+	require.NoError(t, n.Write(metrics))
+
+	info, err := n.js.StreamInfo("metrics")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), info.State.Msgs)
+
+	msg, err := n.js.GetMsg("metrics", 1)
+	require.NoError(t, err)
+	require.Equal(t, "cpu value=1 1\n", string(msg.Data))
+	require.Equal(t, messageID("telegraf", msg.Data), msg.Header.Get(nats.MsgIdHdr))
+}
+
+func TestJetStreamWriteWithoutStream(t *testing.T) {
+	url, stop := runJetStreamServer(t)
+	defer stop()
+
+	s, err := serializers.NewInfluxSerializer()
+	require.NoError(t, err)
+	n := &NATS{
+		Servers:    []string{url},
+		Subject:    "telegraf",
+		JetStream:  &JetStreamConfig{AckWait: internal.Duration{Duration: time.Second}},
+		serializer: s,
+	}
+	require.NoError(t, n.Init())
+	require.NoError(t, n.Connect())
+	defer n.Close()
+
+	require.Error(t, n.Write(testutil.MockMetrics()))
+}
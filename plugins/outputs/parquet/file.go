@@ -0,0 +1,109 @@
+package parquet
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	pq "github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// localFile implements the parquet-go source interface for files on the
+// local filesystem.
+type localFile struct {
+	*os.File
+}
+
+func (f *localFile) Open(name string) (source.ParquetFile, error) {
+	// An empty name opens another handle of the same file.
+	if name == "" {
+		name = f.Name()
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &localFile{File: file}, nil
+}
+
+func (f *localFile) Create(name string) (source.ParquetFile, error) {
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &localFile{File: file}, nil
+}
+
+// partitionFile is a parquet file being written.  Data is written to a
+// hidden temporary file which is renamed once the file is finalized, so a
+// file with the final name is always complete.
+type partitionFile struct {
+	path    string
+	tmpPath string
+	columns []column
+	rows    int64
+
+	file   *localFile
+	writer *writer.CSVWriter
+}
+
+func createPartitionFile(path string, columns []column, compression pq.CompressionCodec) (*partitionFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	tmpPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	lf := &localFile{File: file}
+
+	w, err := writer.NewCSVWriter(metadata(columns), lf, 1)
+	if err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	w.CompressionType = compression
+
+	// The slice is copied as the schema may grow while the file is open.
+	cols := make([]column, len(columns))
+	copy(cols, columns)
+
+	return &partitionFile{
+		path:    path,
+		tmpPath: tmpPath,
+		columns: cols,
+		file:    lf,
+		writer:  w,
+	}, nil
+}
+
+func (f *partitionFile) write(row []interface{}) error {
+	if err := f.writer.Write(row); err != nil {
+		return err
+	}
+	f.rows++
+	return nil
+}
+
+// finalize writes the footer and moves the file to its final name.
+func (f *partitionFile) finalize() error {
+	if err := f.writer.WriteStop(); err != nil {
+		f.file.Close()
+		return err
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.tmpPath, f.path)
+}
+
+// partitionKey identifies the file of a measurement and time window.
+type partitionKey struct {
+	name  string
+	start time.Time
+}
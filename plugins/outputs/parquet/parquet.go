@@ -0,0 +1,317 @@
+package parquet
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	pq "github.com/xitongsys/parquet-go/parquet"
+)
+
+var sampleConfig = `
+  ## Directory to write the files to, it is created if it does not exist.
+  directory = "/var/lib/telegraf/parquet"
+
+  ## Metrics are partitioned by measurement and by the time window their
+  ## timestamp falls into.  Each partition is written to the directory
+  ##   <directory>/<measurement>/<window start formatted with partition_format>
+  # partition_interval = "1h"
+
+  ## Go reference time layout of the window directory, a "/" creates nested
+  ## directories.
+  # partition_format = "2006-01-02/15"
+
+  ## Timezone used for the window boundaries and partition_format.
+  # timezone = "UTC"
+
+  ## Time to keep the file of a window open after the window has ended to
+  ## include late metrics.  Metrics arriving after the file has been finalized
+  ## are written to a new file of the same partition.
+  # finalize_delay = "1m"
+
+  ## Finalize a file once it contains this number of rows, 0 for no limit.
+  # max_rows = 0
+
+  ## Name of the timestamp column.
+  # timestamp_column = "time"
+
+  ## Compression codec, one of "uncompressed", "snappy" or "gzip".
+  # compression = "snappy"
+`
+
+const checkInterval = time.Second
+
+var compressionCodecs = map[string]pq.CompressionCodec{
+	"uncompressed": pq.CompressionCodec_UNCOMPRESSED,
+	"snappy":       pq.CompressionCodec_SNAPPY,
+	"gzip":         pq.CompressionCodec_GZIP,
+}
+
+type Parquet struct {
+	Directory         string            `toml:"directory"`
+	PartitionInterval internal.Duration `toml:"partition_interval"`
+	PartitionFormat   string            `toml:"partition_format"`
+	Timezone          string            `toml:"timezone"`
+	FinalizeDelay     internal.Duration `toml:"finalize_delay"`
+	MaxRows           int64             `toml:"max_rows"`
+	TimestampColumn   string            `toml:"timestamp_column"`
+	Compression       string            `toml:"compression"`
+
+	Log telegraf.Logger `toml:"-"`
+
+	location    *time.Location
+	compression pq.CompressionCodec
+	now         func() time.Time
+	lastName    int64
+
+	mu      sync.Mutex
+	schemas map[string]*schema
+	files   map[partitionKey]*partitionFile
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (p *Parquet) Description() string {
+	return "Write metrics to Parquet files partitioned by measurement and time"
+}
+
+func (p *Parquet) SampleConfig() string {
+	return sampleConfig
+}
+
+func (p *Parquet) Init() error {
+	if p.Directory == "" {
+		return fmt.Errorf("directory is required")
+	}
+	if p.PartitionInterval.Duration <= 0 {
+		return fmt.Errorf("partition_interval must be positive")
+	}
+
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone: %v", err)
+	}
+	p.location = loc
+
+	codec, ok := compressionCodecs[p.Compression]
+	if !ok {
+		return fmt.Errorf("unsupported compression %q", p.Compression)
+	}
+	p.compression = codec
+
+	p.schemas = make(map[string]*schema)
+	p.files = make(map[partitionKey]*partitionFile)
+	return nil
+}
+
+func (p *Parquet) Connect() error {
+	if err := os.MkdirAll(p.Directory, 0755); err != nil {
+		return err
+	}
+
+	p.done = make(chan struct{})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.mu.Lock()
+				p.finalizeExpired()
+				p.mu.Unlock()
+			}
+		}
+	}()
+	return nil
+}
+
+func (p *Parquet) Close() error {
+	if p.done != nil {
+		close(p.done)
+		p.wg.Wait()
+		p.done = nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var lastErr error
+	for key := range p.files {
+		if err := p.finalize(key); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (p *Parquet) Write(metrics []telegraf.Metric) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, m := range metrics {
+		s, ok := p.schemas[m.Name()]
+		if !ok {
+			s = newSchema(p.TimestampColumn)
+			p.schemas[m.Name()] = s
+		}
+		for _, key := range s.extend(m) {
+			p.Log.Debugf("Dropping %q of %q: column name conflicts with an existing column", key, m.Name())
+		}
+
+		key := partitionKey{name: m.Name(), start: p.windowStart(m.Time())}
+		f, ok := p.files[key]
+		if ok && (needsColumns(m, f, s) || (p.MaxRows > 0 && f.rows >= p.MaxRows)) {
+			// The schema of a parquet file can not be changed, the file is
+			// finalized and the metric starts a new one with all known
+			// columns.
+			if err := p.finalize(key); err != nil {
+				return err
+			}
+			ok = false
+		}
+		if !ok {
+			var err error
+			f, err = createPartitionFile(p.filePath(key), s.columns, p.compression)
+			if err != nil {
+				return fmt.Errorf("creating file failed: %v", err)
+			}
+			p.files[key] = f
+		}
+
+		if err := f.write(p.row(m, f.columns, s)); err != nil {
+			return fmt.Errorf("writing to %q failed: %v", f.tmpPath, err)
+		}
+	}
+
+	p.finalizeExpired()
+	return nil
+}
+
+// row returns the values of the metric in the order of the columns.
+func (p *Parquet) row(m telegraf.Metric, columns []column, s *schema) []interface{} {
+	row := make([]interface{}, len(columns))
+	row[0], _ = convert(m.Time(), timestampType)
+
+	set := func(key string, value interface{}) {
+		i, ok := s.index[columnName(key)]
+		if !ok {
+			return
+		}
+		v, ok := convert(value, columns[i].Type)
+		if !ok {
+			p.Log.Debugf("Dropping %q of %q: %T can not be stored in a %s column",
+				key, m.Name(), value, columns[i].Type)
+			return
+		}
+		row[i] = v
+	}
+	for _, tag := range m.TagList() {
+		set(tag.Key, tag.Value)
+	}
+	for _, field := range m.FieldList() {
+		set(field.Key, field.Value)
+	}
+	return row
+}
+
+// needsColumns reports if the metric contains values for columns the file
+// was created without.
+func needsColumns(m telegraf.Metric, f *partitionFile, s *schema) bool {
+	for _, tag := range m.TagList() {
+		if i, ok := s.index[columnName(tag.Key)]; ok && i >= len(f.columns) {
+			return true
+		}
+	}
+	for _, field := range m.FieldList() {
+		if i, ok := s.index[columnName(field.Key)]; ok && i >= len(f.columns) {
+			return true
+		}
+	}
+	return false
+}
+
+// windowStart returns the start of the partition window containing t.
+func (p *Parquet) windowStart(t time.Time) time.Time {
+	t = t.In(p.location)
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(p.PartitionInterval.Duration).Add(-shift)
+}
+
+func (p *Parquet) filePath(key partitionKey) string {
+	// Use the creation time as file name, it is unique and lets files of a
+	// partition sort by age.
+	name := p.now().UnixNano()
+	if name <= p.lastName {
+		name = p.lastName + 1
+	}
+	p.lastName = name
+
+	return filepath.Join(
+		p.Directory,
+		pathSegment(key.name),
+		filepath.FromSlash(key.start.Format(p.PartitionFormat)),
+		fmt.Sprintf("part-%d.parquet", name),
+	)
+}
+
+// pathSegment makes the measurement name usable as a directory name.
+func pathSegment(name string) string {
+	name = strings.NewReplacer("/", "_", `\`, "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		name = "_" + name
+	}
+	return name
+}
+
+func (p *Parquet) finalize(key partitionKey) error {
+	f := p.files[key]
+	delete(p.files, key)
+	if err := f.finalize(); err != nil {
+		return fmt.Errorf("finalizing %q failed: %v", f.tmpPath, err)
+	}
+	p.Log.Debugf("Finalized %q with %d rows", f.path, f.rows)
+	return nil
+}
+
+// finalizeExpired finalizes the files of windows that ended more than the
+// finalize delay ago.
+func (p *Parquet) finalizeExpired() {
+	now := p.now()
+	for key := range p.files {
+		end := key.start.Add(p.PartitionInterval.Duration + p.FinalizeDelay.Duration)
+		if now.Before(end) {
+			continue
+		}
+		if err := p.finalize(key); err != nil {
+			p.Log.Error(err)
+		}
+	}
+}
+
+func newParquet() *Parquet {
+	return &Parquet{
+		PartitionInterval: internal.Duration{Duration: time.Hour},
+		PartitionFormat:   "2006-01-02/15",
+		Timezone:          "UTC",
+		FinalizeDelay:     internal.Duration{Duration: time.Minute},
+		TimestampColumn:   "time",
+		Compression:       "snappy",
+		now:               time.Now,
+	}
+}
+
+func init() {
+	outputs.Add("parquet", func() telegraf.Output { return newParquet() })
+}
@@ -0,0 +1,213 @@
+package parquet
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+func newTestParquet(t *testing.T, dir string) *Parquet {
+	p := newParquet()
+	p.Directory = dir
+	p.Log = testutil.Logger{}
+	p.now = func() time.Time { return time.Unix(1600000000, 0) }
+	require.NoError(t, p.Init())
+	return p
+}
+
+// files returns the finalized files below dir relative to it.
+func files(t *testing.T, dir string) []string {
+	var result []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		result = append(result, filepath.ToSlash(rel))
+		return err
+	})
+	require.NoError(t, err)
+	sort.Strings(result)
+	return result
+}
+
+// readColumns returns the values of each column of a parquet file.
+func readColumns(t *testing.T, path string) map[string][]interface{} {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	pr, err := reader.NewParquetColumnReader(&localFile{File: f}, 1)
+	require.NoError(t, err)
+	defer pr.ReadStop()
+
+	rows := pr.GetNumRows()
+	result := make(map[string][]interface{})
+	for i, info := range pr.SchemaHandler.Infos[1:] {
+		values, _, _, err := pr.ReadColumnByIndex(int64(i), rows)
+		require.NoError(t, err)
+		result[info.ExName] = values
+	}
+	return result
+}
+
+func TestWritePartitions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p := newTestParquet(t, dir)
+	require.NoError(t, p.Connect())
+
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 42.0},
+			time.Date(2020, 9, 13, 12, 10, 0, 0, time.UTC)),
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "b"},
+			map[string]interface{}{"usage": 43.0},
+			time.Date(2020, 9, 13, 12, 20, 0, 0, time.UTC)),
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 44.0},
+			time.Date(2020, 9, 13, 13, 10, 0, 0, time.UTC)),
+		testutil.MustMetric("mem",
+			map[string]string{},
+			map[string]interface{}{"free": uint64(5), "state": "ok", "ok": true, "count": int64(-1)},
+			time.Date(2020, 9, 13, 12, 10, 0, 0, time.UTC)),
+	}
+	require.NoError(t, p.Write(metrics))
+
+	// Nothing is visible before the files are finalized.
+	require.Empty(t, files(t, dir+"/cpu/2020-09-13/12"))
+
+	require.NoError(t, p.Close())
+
+	found := files(t, dir)
+	require.Len(t, found, 3)
+	require.Regexp(t, `^cpu/2020-09-13/12/part-\d+\.parquet$`, found[0])
+	require.Regexp(t, `^cpu/2020-09-13/13/part-\d+\.parquet$`, found[1])
+	require.Regexp(t, `^mem/2020-09-13/12/part-\d+\.parquet$`, found[2])
+
+	cpu := readColumns(t, filepath.Join(dir, found[0]))
+	require.Equal(t, map[string][]interface{}{
+		"time": {
+			time.Date(2020, 9, 13, 12, 10, 0, 0, time.UTC).UnixNano() / 1000,
+			time.Date(2020, 9, 13, 12, 20, 0, 0, time.UTC).UnixNano() / 1000,
+		},
+		"host":  {"a", "b"},
+		"usage": {42.0, 43.0},
+	}, cpu)
+
+	mem := readColumns(t, filepath.Join(dir, found[2]))
+	require.Equal(t, []interface{}{int64(5)}, mem["free"])
+	require.Equal(t, []interface{}{"ok"}, mem["state"])
+	require.Equal(t, []interface{}{true}, mem["ok"])
+	require.Equal(t, []interface{}{int64(-1)}, mem["count"])
+}
+
+func TestSchemaEvolution(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p := newTestParquet(t, dir)
+	ts := time.Date(2020, 9, 13, 12, 10, 0, 0, time.UTC)
+
+	require.NoError(t, p.Write([]telegraf.Metric{
+		testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"usage": 42.0}, ts),
+		// Integers are converted to the type of the existing column.
+		testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"usage": int64(1)}, ts),
+	}))
+	require.NoError(t, p.Write([]telegraf.Metric{
+		testutil.MustMetric("cpu", map[string]string{"host": "a"}, map[string]interface{}{"usage": 43.0}, ts),
+	}))
+	require.NoError(t, p.Close())
+
+	found := files(t, dir)
+	require.Len(t, found, 2)
+
+	first := readColumns(t, filepath.Join(dir, found[0]))
+	require.Equal(t, []interface{}{42.0, 1.0}, first["usage"])
+	require.NotContains(t, first, "host")
+
+	second := readColumns(t, filepath.Join(dir, found[1]))
+	require.Equal(t, []interface{}{43.0}, second["usage"])
+	require.Equal(t, []interface{}{"a"}, second["host"])
+}
+
+func TestFinalizeExpiredWindows(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2020, 9, 13, 12, 30, 0, 0, time.UTC)
+	p := newTestParquet(t, dir)
+	p.now = func() time.Time { return now }
+
+	m := testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"usage": 42.0},
+		time.Date(2020, 9, 13, 12, 10, 0, 0, time.UTC))
+	require.NoError(t, p.Write([]telegraf.Metric{m}))
+	require.Empty(t, files(t, dir+"/cpu/2020-09-13/12"))
+
+	// Still within the finalize delay
+	now = time.Date(2020, 9, 13, 13, 0, 30, 0, time.UTC)
+	p.finalizeExpired()
+	require.Empty(t, files(t, dir+"/cpu/2020-09-13/12"))
+
+	now = time.Date(2020, 9, 13, 13, 1, 0, 0, time.UTC)
+	p.finalizeExpired()
+	require.Len(t, files(t, dir+"/cpu/2020-09-13/12"), 1)
+
+	// A late metric starts a new file in the same partition.
+	require.NoError(t, p.Write([]telegraf.Metric{m}))
+	require.NoError(t, p.Close())
+	require.Len(t, files(t, dir+"/cpu/2020-09-13/12"), 2)
+}
+
+func TestMaxRows(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p := newTestParquet(t, dir)
+	p.MaxRows = 2
+
+	m := testutil.MustMetric("cpu", map[string]string{}, map[string]interface{}{"usage": 42.0},
+		time.Date(2020, 9, 13, 12, 10, 0, 0, time.UTC))
+	require.NoError(t, p.Write([]telegraf.Metric{m, m, m}))
+	require.NoError(t, p.Close())
+	require.Len(t, files(t, dir), 2)
+}
+
+func TestWindowStartTimezone(t *testing.T) {
+	p := newParquet()
+	p.Directory = "unused"
+	p.PartitionInterval = internal.Duration{Duration: 24 * time.Hour}
+	p.Timezone = "America/New_York"
+	require.NoError(t, p.Init())
+
+	start := p.windowStart(time.Date(2020, 9, 13, 2, 0, 0, 0, time.UTC))
+	require.Equal(t, "2020-09-12T00:00:00-04:00", start.Format(time.RFC3339))
+}
+
+func TestInitErrors(t *testing.T) {
+	p := newParquet()
+	require.Error(t, p.Init())
+
+	p = newParquet()
+	p.Directory = "unused"
+	p.Compression = "lzma"
+	require.Error(t, p.Init())
+}
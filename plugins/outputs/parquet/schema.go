@@ -0,0 +1,215 @@
+package parquet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/xitongsys/parquet-go/common"
+)
+
+// columnType is the logical type of a column, stored using the parquet
+// physical type noted beside it.
+type columnType int
+
+const (
+	timestampType columnType = iota // INT64 (TIMESTAMP_MICROS)
+	stringType                      // BYTE_ARRAY (UTF8)
+	intType                         // INT64
+	uintType                        // INT64 (UINT_64)
+	floatType                       // DOUBLE
+	boolType                        // BOOLEAN
+)
+
+func (t columnType) String() string {
+	switch t {
+	case timestampType:
+		return "TIMESTAMP_MICROS"
+	case stringType:
+		return "UTF8"
+	case intType:
+		return "INT64"
+	case uintType:
+		return "UINT_64"
+	case floatType:
+		return "DOUBLE"
+	case boolType:
+		return "BOOLEAN"
+	}
+	return "unknown"
+}
+
+func typeOf(value interface{}) (columnType, bool) {
+	switch value.(type) {
+	case string:
+		return stringType, true
+	case int64:
+		return intType, true
+	case uint64:
+		return uintType, true
+	case float64:
+		return floatType, true
+	case bool:
+		return boolType, true
+	}
+	return 0, false
+}
+
+type column struct {
+	Name string
+	Type columnType
+}
+
+// schema is the ordered list of columns of a measurement.  Columns are only
+// ever appended, a file written with an older schema contains a prefix of
+// the columns of the current one.
+type schema struct {
+	columns []column
+	index   map[string]int
+
+	// variables holds the names used for the columns by the parquet-go
+	// writer, these must be unique as well.
+	variables map[string]bool
+}
+
+func newSchema(timestampColumn string) *schema {
+	s := &schema{
+		index:     make(map[string]int),
+		variables: make(map[string]bool),
+	}
+	s.add(timestampColumn, timestampType)
+	return s
+}
+
+// add appends a column to the schema, it reports false if the name can not
+// be told apart from an existing column.
+func (s *schema) add(name string, typ columnType) bool {
+	variable := common.StringToVariableName(name)
+	if s.variables[variable] {
+		return false
+	}
+	s.variables[variable] = true
+	s.index[name] = len(s.columns)
+	s.columns = append(s.columns, column{Name: name, Type: typ})
+	return true
+}
+
+func (s *schema) lookup(name string) (column, bool) {
+	i, ok := s.index[name]
+	if !ok {
+		return column{}, false
+	}
+	return s.columns[i], true
+}
+
+// metadata returns the column definitions in the format understood by the
+// parquet-go CSV writer.
+func metadata(columns []column) []string {
+	md := make([]string, 0, len(columns))
+	for _, c := range columns {
+		md = append(md, fmt.Sprintf("name=%s, type=%s", c.Name, c.Type))
+	}
+	return md
+}
+
+// columnName returns the name of the column holding a tag or field.  The
+// characters used as separators in the column definitions are replaced.
+func columnName(key string) string {
+	return strings.NewReplacer(",", "_", "=", "_").Replace(key)
+}
+
+// convert returns the value in the representation of the column type.  The
+// type of a column is set by the first value seen, later values of a
+// different type are converted if possible.
+func convert(value interface{}, typ columnType) (interface{}, bool) {
+	switch typ {
+	case stringType:
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case int64:
+			return strconv.FormatInt(v, 10), true
+		case uint64:
+			return strconv.FormatUint(v, 10), true
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		case bool:
+			return strconv.FormatBool(v), true
+		}
+	case intType:
+		switch v := value.(type) {
+		case int64:
+			return v, true
+		case uint64:
+			if v <= uint64(1<<63-1) {
+				return int64(v), true
+			}
+		case bool:
+			if v {
+				return int64(1), true
+			}
+			return int64(0), true
+		}
+	case uintType:
+		switch v := value.(type) {
+		case uint64:
+			return int64(v), true
+		case int64:
+			if v >= 0 {
+				return v, true
+			}
+		case bool:
+			if v {
+				return int64(1), true
+			}
+			return int64(0), true
+		}
+	case floatType:
+		switch v := value.(type) {
+		case float64:
+			return v, true
+		case int64:
+			return float64(v), true
+		case uint64:
+			return float64(v), true
+		}
+	case boolType:
+		if v, ok := value.(bool); ok {
+			return v, true
+		}
+	case timestampType:
+		if v, ok := value.(time.Time); ok {
+			return v.UnixNano() / int64(time.Microsecond), true
+		}
+	}
+	return nil, false
+}
+
+// extend adds the columns of the metric not yet part of the schema.  It
+// returns the keys of the tags and fields that can not be stored as their
+// column name conflicts with an existing column.
+func (s *schema) extend(m telegraf.Metric) []string {
+	var rejected []string
+	for _, tag := range m.TagList() {
+		name := columnName(tag.Key)
+		if _, ok := s.lookup(name); ok {
+			continue
+		}
+		if !s.add(name, stringType) {
+			rejected = append(rejected, tag.Key)
+		}
+	}
+	for _, field := range m.FieldList() {
+		name := columnName(field.Key)
+		if _, ok := s.lookup(name); ok {
+			continue
+		}
+		typ, ok := typeOf(field.Value)
+		if ok && !s.add(name, typ) {
+			rejected = append(rejected, field.Key)
+		}
+	}
+	return rejected
+}
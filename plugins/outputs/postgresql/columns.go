@@ -0,0 +1,179 @@
+package postgresql
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx"
+)
+
+// PostgreSQL data types used for the columns created by the plugin.
+const (
+	PgBool        = "boolean"
+	PgBigInt      = "bigint"
+	PgNumeric     = "numeric"
+	PgDouble      = "double precision"
+	PgText        = "text"
+	PgTimestamptz = "timestamp with time zone"
+	PgJSONB       = "jsonb"
+)
+
+type columnRole int
+
+const (
+	timeColumn columnRole = iota
+	measurementColumn
+	tagIDColumn
+	tagColumn
+	tagsJSONColumn
+	fieldColumn
+	fieldsJSONColumn
+)
+
+const (
+	tagIDColumnName      = "tag_id"
+	tagsJSONColumnName   = "tags"
+	fieldsJSONColumnName = "fields"
+)
+
+// Column is a column of a metric or tag table.  When used in a template the
+// column renders as its quoted name.
+type Column struct {
+	Name string
+	Type string
+	role columnRole
+}
+
+func (c Column) String() string {
+	return quoteIdentifier(c.Name)
+}
+
+// Definition returns the quoted name of the column followed by its type.
+func (c Column) Definition() string {
+	return c.String() + " " + c.Type
+}
+
+// Columns is a list of columns.  When used in a template the columns render
+// as a comma separated list of column definitions.
+type Columns []Column
+
+func (cs Columns) String() string {
+	return join(", ", cs)
+}
+
+// Names returns the comma separated quoted names of the columns.
+func (cs Columns) Names() string {
+	names := make([]string, 0, len(cs))
+	for _, c := range cs {
+		names = append(names, c.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+func (cs Columns) names() []string {
+	names := make([]string, 0, len(cs))
+	for _, c := range cs {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// TableRef is a schema qualified table name.  When used in a template the
+// table renders as its quoted, schema qualified name.
+type TableRef struct {
+	Schema string
+	Name   string
+}
+
+func (t TableRef) String() string {
+	return t.identifier().Sanitize()
+}
+
+func (t TableRef) identifier() pgx.Identifier {
+	if t.Schema == "" {
+		return pgx.Identifier{t.Name}
+	}
+	return pgx.Identifier{t.Schema, t.Name}
+}
+
+// fieldType returns the PostgreSQL type used to store the field value.
+func fieldType(value interface{}) string {
+	switch value.(type) {
+	case int64:
+		return PgBigInt
+	case uint64:
+		return PgNumeric
+	case float64:
+		return PgDouble
+	case bool:
+		return PgBool
+	default:
+		return PgText
+	}
+}
+
+// convertValue converts the field value to the column type, ok is false if
+// the value can't be converted without loss.  Values of other column types,
+// for example of columns created by the user, are left to PostgreSQL.
+func convertValue(value interface{}, typ string) (converted interface{}, ok bool) {
+	switch typ {
+	case PgBigInt:
+		switch v := value.(type) {
+		case int64:
+			return v, true
+		case uint64:
+			return int64(v), v <= math.MaxInt64
+		case float64:
+			if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+				return int64(v), true
+			}
+		}
+	case PgNumeric:
+		switch v := value.(type) {
+		case int64, uint64:
+			return v, true
+		case float64:
+			return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+		}
+	case PgDouble:
+		switch v := value.(type) {
+		case float64:
+			return v, true
+		case int64:
+			f := float64(v)
+			return f, f >= math.MinInt64 && f < math.MaxInt64 && int64(f) == v
+		case uint64:
+			f := float64(v)
+			return f, f < math.MaxUint64 && uint64(f) == v
+		}
+	case PgBool:
+		if v, ok := value.(bool); ok {
+			return v, true
+		}
+	case PgText:
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case int64:
+			return strconv.FormatInt(v, 10), true
+		case uint64:
+			return strconv.FormatUint(v, 10), true
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64), true
+		case bool:
+			return strconv.FormatBool(v), true
+		}
+	default:
+		return value, true
+	}
+	return nil, false
+}
+
+func quoteIdentifier(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.Replace(value, "'", "''", -1) + "'"
+}
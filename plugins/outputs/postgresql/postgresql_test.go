@@ -0,0 +1,316 @@
+package postgresql
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/jackc/pgx"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPlugin(t *testing.T) *Postgresql {
+	p := newPostgresql()
+	p.Log = testutil.Logger{}
+	require.NoError(t, p.Init())
+	return p
+}
+
+func testMetrics() []telegraf.Metric {
+	return []telegraf.Metric{
+		testutil.MustMetric(
+			"cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"usage": 42.0, "count": int64(1)},
+			time.Unix(0, 0),
+		),
+		testutil.MustMetric(
+			"cpu",
+			map[string]string{"host": "b", "cpu": "cpu0"},
+			map[string]interface{}{"usage": 43.0, "ok": true},
+			time.Unix(10, 0),
+		),
+		testutil.MustMetric(
+			"mem",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"free": uint64(5), "state": "ok"},
+			time.Unix(20, 0),
+		),
+	}
+}
+
+func TestGroupMetricsTablePerMeasurement(t *testing.T) {
+	p := newTestPlugin(t)
+	batches := p.groupMetrics(testMetrics())
+	require.Len(t, batches, 2)
+
+	cpu := batches["cpu"]
+	require.Equal(t, TableRef{Schema: "public", Name: "cpu"}, cpu.table)
+	require.Len(t, cpu.metrics, 2)
+	require.Equal(t, Columns{
+		{Name: "time", Type: PgTimestamptz, role: timeColumn},
+		{Name: "host", Type: PgText, role: tagColumn},
+		{Name: "count", Type: PgBigInt, role: fieldColumn},
+		{Name: "usage", Type: PgDouble, role: fieldColumn},
+		{Name: "cpu", Type: PgText, role: tagColumn},
+		{Name: "ok", Type: PgBool, role: fieldColumn},
+	}, cpu.columns)
+	require.Empty(t, cpu.tagColumns)
+
+	mem := batches["mem"]
+	require.Equal(t, Columns{
+		{Name: "time", Type: PgTimestamptz, role: timeColumn},
+		{Name: "host", Type: PgText, role: tagColumn},
+		{Name: "free", Type: PgNumeric, role: fieldColumn},
+		{Name: "state", Type: PgText, role: fieldColumn},
+	}, mem.columns)
+
+	require.Equal(t, []interface{}{time.Unix(10, 0).UTC(), "b", nil, 43.0, "cpu0", true},
+		p.row(cpu.metrics[1], cpu.columns))
+}
+
+func TestGroupMetricsSingleTable(t *testing.T) {
+	p := newPostgresql()
+	p.Log = testutil.Logger{}
+	p.Table = "metrics"
+	require.NoError(t, p.Init())
+
+	batches := p.groupMetrics(testMetrics())
+	require.Len(t, batches, 1)
+
+	b := batches["metrics"]
+	require.Len(t, b.metrics, 3)
+	require.Equal(t, Column{Name: "measurement", Type: PgText, role: measurementColumn}, b.columns[1])
+	require.Equal(t, []interface{}{time.Unix(20, 0).UTC(), "mem", "a", nil, nil, nil, nil, uint64(5), "ok"},
+		p.row(b.metrics[2], b.columns))
+}
+
+func TestGroupMetricsForeignKeysAndJSONB(t *testing.T) {
+	p := newPostgresql()
+	p.Log = testutil.Logger{}
+	p.TagsAsForeignKeys = true
+	p.FieldsAsJSONB = true
+	require.NoError(t, p.Init())
+
+	batches := p.groupMetrics(testMetrics())
+	cpu := batches["cpu"]
+	require.Equal(t, Columns{
+		{Name: "time", Type: PgTimestamptz, role: timeColumn},
+		{Name: "tag_id", Type: PgBigInt, role: tagIDColumn},
+		{Name: "fields", Type: PgJSONB, role: fieldsJSONColumn},
+	}, cpu.columns)
+	require.Equal(t, Columns{
+		{Name: "tag_id", Type: PgBigInt, role: tagIDColumn},
+		{Name: "host", Type: PgText, role: tagColumn},
+		{Name: "cpu", Type: PgText, role: tagColumn},
+	}, cpu.tagColumns)
+
+	m := cpu.metrics[0]
+	require.Equal(t, []interface{}{time.Unix(0, 0).UTC(), tagID(m), m.Fields()}, p.row(m, cpu.columns))
+}
+
+func TestGroupMetricsTagFieldCollision(t *testing.T) {
+	p := newTestPlugin(t)
+	metrics := []telegraf.Metric{
+		testutil.MustMetric(
+			"cpu",
+			map[string]string{"host": "a"},
+			map[string]interface{}{"host": "b", "usage": 42.0},
+			time.Unix(0, 0),
+		),
+	}
+
+	// The field is dropped instead of sharing the column of the tag.
+	cpu := p.groupMetrics(metrics)["cpu"]
+	require.Equal(t, Columns{
+		{Name: "time", Type: PgTimestamptz, role: timeColumn},
+		{Name: "host", Type: PgText, role: tagColumn},
+		{Name: "usage", Type: PgDouble, role: fieldColumn},
+	}, cpu.columns)
+	require.Equal(t, []interface{}{time.Unix(0, 0).UTC(), "a", 42.0}, p.rows(cpu)[0])
+
+	// In separate tables tags and fields do not collide.
+	p = newPostgresql()
+	p.Log = testutil.Logger{}
+	p.TagsAsForeignKeys = true
+	require.NoError(t, p.Init())
+	cpu = p.groupMetrics(metrics)["cpu"]
+	require.Equal(t, Column{Name: "host", Type: PgText, role: fieldColumn}, cpu.columns[2])
+	require.Equal(t, Column{Name: "host", Type: PgText, role: tagColumn}, cpu.tagColumns[1])
+}
+
+func TestRowsConvertFieldType(t *testing.T) {
+	p := newTestPlugin(t)
+	metrics := []telegraf.Metric{
+		testutil.MustMetric("cpu", nil, map[string]interface{}{"count": int64(1)}, time.Unix(0, 0)),
+		testutil.MustMetric("cpu", nil, map[string]interface{}{"count": 2.0}, time.Unix(1, 0)),
+		testutil.MustMetric("cpu", nil, map[string]interface{}{"count": 1.5}, time.Unix(2, 0)),
+		testutil.MustMetric("cpu", nil, map[string]interface{}{"count": "many"}, time.Unix(3, 0)),
+	}
+
+	// The column is an integer column, a later float is stored if it is
+	// integral and dropped otherwise.
+	cpu := p.groupMetrics(metrics)["cpu"]
+	require.Equal(t, Column{Name: "count", Type: PgBigInt, role: fieldColumn}, cpu.columns[1])
+	require.Equal(t, [][]interface{}{
+		{time.Unix(0, 0).UTC(), int64(1)},
+		{time.Unix(1, 0).UTC(), int64(2)},
+		{time.Unix(2, 0).UTC(), nil},
+		{time.Unix(3, 0).UTC(), nil},
+	}, p.rows(cpu))
+}
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		typ      string
+		expected interface{}
+		ok       bool
+	}{
+		{value: int64(1), typ: PgBigInt, expected: int64(1), ok: true},
+		{value: uint64(1), typ: PgBigInt, expected: int64(1), ok: true},
+		{value: uint64(1) << 63, typ: PgBigInt, ok: false},
+		{value: 3.0, typ: PgBigInt, expected: int64(3), ok: true},
+		{value: 1.5, typ: PgBigInt, ok: false},
+		{value: "1", typ: PgBigInt, ok: false},
+		{value: int64(1), typ: PgNumeric, expected: int64(1), ok: true},
+		{value: 1.5, typ: PgNumeric, expected: 1.5, ok: true},
+		{value: int64(1), typ: PgDouble, expected: 1.0, ok: true},
+		{value: int64(1)<<53 + 1, typ: PgDouble, ok: false},
+		{value: true, typ: PgDouble, ok: false},
+		{value: 1.5, typ: PgText, expected: "1.5", ok: true},
+		{value: true, typ: PgText, expected: "true", ok: true},
+		{value: "true", typ: PgBool, ok: false},
+		{value: "x", typ: "character varying", expected: "x", ok: true},
+	}
+	for _, tt := range tests {
+		v, ok := convertValue(tt.value, tt.typ)
+		require.Equal(t, tt.ok, ok, "%v to %s", tt.value, tt.typ)
+		if ok {
+			require.Equal(t, tt.expected, v, "%v to %s", tt.value, tt.typ)
+		}
+	}
+}
+
+func TestTagID(t *testing.T) {
+	metrics := testMetrics()
+	require.Equal(t, tagID(metrics[0]), tagID(metrics[2]))
+	require.NotEqual(t, tagID(metrics[0]), tagID(metrics[1]))
+
+	// Keys and values must not be interchangeable.
+	a := testutil.MustMetric("m", map[string]string{"ab": "c"}, map[string]interface{}{"v": 1}, time.Unix(0, 0))
+	b := testutil.MustMetric("m", map[string]string{"a": "bc"}, map[string]interface{}{"v": 1}, time.Unix(0, 0))
+	require.NotEqual(t, tagID(a), tagID(b))
+}
+
+func TestStatements(t *testing.T) {
+	p := newTestPlugin(t)
+	data := &templateData{
+		Table:      TableRef{Schema: "public", Name: "cpu"},
+		TimeColumn: Column{Name: "time", Type: PgTimestamptz},
+	}
+	columns := Columns{
+		{Name: "time", Type: PgTimestamptz},
+		{Name: "host", Type: PgText},
+		{Name: "usage", Type: PgDouble},
+	}
+
+	stmts, err := statements(data, map[string]string{}, columns, p.createTemplates, p.addColumnTemplates)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`CREATE TABLE "public"."cpu" ("time" timestamp with time zone, "host" text, "usage" double precision)`,
+	}, stmts)
+
+	stmts, err = statements(data, map[string]string{"time": PgTimestamptz}, columns, p.createTemplates, p.addColumnTemplates)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`ALTER TABLE "public"."cpu" ADD COLUMN IF NOT EXISTS "host" text, ADD COLUMN IF NOT EXISTS "usage" double precision`,
+	}, stmts)
+
+	stmts, err = statements(data, map[string]string{"time": PgTimestamptz, "host": PgText, "usage": PgDouble}, columns, p.createTemplates, p.addColumnTemplates)
+	require.NoError(t, err)
+	require.Empty(t, stmts)
+}
+
+func TestTimescaleTemplate(t *testing.T) {
+	tmpls, err := newTemplates([]string{
+		`SELECT create_hypertable({{ .Table | quoteLiteral }}, {{ .TimeColumn.Name | quoteLiteral }}, chunk_time_interval => INTERVAL '1d')`,
+	})
+	require.NoError(t, err)
+
+	sql, err := tmpls[0].Render(&templateData{
+		Table:      TableRef{Schema: "public", Name: "cpu"},
+		TimeColumn: Column{Name: "time", Type: PgTimestamptz},
+	})
+	require.NoError(t, err)
+	require.Equal(t, `SELECT create_hypertable('"public"."cpu"', 'time', chunk_time_interval => INTERVAL '1d')`, sql)
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	p := newPostgresql()
+	p.CreateTemplates = []string{"CREATE TABLE {{ .Table "}
+	require.Error(t, p.Init())
+}
+
+func TestWriteIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	connection := os.Getenv("POSTGRES_URL")
+	if connection == "" {
+		connection = "postgres://postgres@" + testutil.GetLocalHost() + "/postgres?sslmode=disable"
+	}
+
+	config, err := pgx.ParseConnectionString(connection)
+	require.NoError(t, err)
+	conn, err := pgx.Connect(config)
+	require.NoError(t, err)
+	defer conn.Close()
+	for _, table := range []string{"cpu", "cpu_tag", "mem", "mem_tag"} {
+		_, err = conn.Exec(`DROP TABLE IF EXISTS ` + quoteIdentifier(table))
+		require.NoError(t, err)
+	}
+
+	p := newPostgresql()
+	p.Log = testutil.Logger{}
+	p.Connection = connection
+	p.TagsAsForeignKeys = true
+	require.NoError(t, p.Init())
+	require.NoError(t, p.Connect())
+	defer p.Close()
+
+	metrics := testMetrics()
+	require.NoError(t, p.Write(metrics))
+	// Writing the same tag sets again must not create duplicates.
+	require.NoError(t, p.Write(metrics))
+
+	var count int
+	require.NoError(t, conn.QueryRow(`SELECT count(*) FROM "cpu"`).Scan(&count))
+	require.Equal(t, 4, count)
+	require.NoError(t, conn.QueryRow(`SELECT count(*) FROM "cpu_tag"`).Scan(&count))
+	require.Equal(t, 2, count)
+
+	var usage float64
+	require.NoError(t, conn.QueryRow(
+		`SELECT usage FROM "cpu" JOIN "cpu_tag" USING (tag_id) WHERE host = 'b' LIMIT 1`).Scan(&usage))
+	require.Equal(t, 43.0, usage)
+
+	// Values of another type than their column are converted or dropped
+	// instead of failing the batch.
+	require.NoError(t, p.Write([]telegraf.Metric{
+		testutil.MustMetric(
+			"cpu",
+			map[string]string{"host": "c"},
+			map[string]interface{}{"usage": int64(44), "count": 1.5},
+			time.Unix(30, 0),
+		),
+	}))
+	var count64 *int64
+	require.NoError(t, conn.QueryRow(
+		`SELECT usage, count FROM "cpu" JOIN "cpu_tag" USING (tag_id) WHERE host = 'c'`).Scan(&usage, &count64))
+	require.Equal(t, 44.0, usage)
+	require.Nil(t, count64)
+}
@@ -0,0 +1,136 @@
+package postgresql
+
+import (
+	"github.com/jackc/pgx"
+)
+
+const columnsQuery = `SELECT column_name, data_type FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2`
+
+// tableManager keeps track of the columns of the tables written to and
+// creates tables or adds columns when required.
+type tableManager struct {
+	schema string
+
+	// columns is a cache of the column names and types of each known table.
+	columns map[string]map[string]string
+}
+
+func newTableManager(schema string) *tableManager {
+	return &tableManager{
+		schema:  schema,
+		columns: make(map[string]map[string]string),
+	}
+}
+
+// ensureColumns makes sure the table exists and contains all of the columns,
+// using the create templates if the table does not exist and the add column
+// templates otherwise.  The types of the columns already in the table are set
+// to their type in the table.
+func (tm *tableManager) ensureColumns(
+	tx *pgx.Tx,
+	data *templateData,
+	columns Columns,
+	createTemplates []*Template,
+	addColumnTemplates []*Template,
+) error {
+	table := data.Table
+	known, ok := tm.columns[table.Name]
+	if !ok {
+		var err error
+		known, err = tm.loadColumns(tx, table)
+		if err != nil {
+			return err
+		}
+		tm.columns[table.Name] = known
+	}
+
+	stmts, err := statements(data, known, columns, createTemplates, addColumnTemplates)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			// The transaction is aborted, the cached state of the table
+			// can no longer be trusted.
+			tm.invalidate(table)
+			return err
+		}
+	}
+
+	for i, c := range columns {
+		if typ, ok := known[c.Name]; ok {
+			columns[i].Type = typ
+		} else {
+			known[c.Name] = c.Type
+		}
+	}
+	return nil
+}
+
+// invalidate removes the table from the cache, causing its columns to be
+// reloaded on the next write.
+func (tm *tableManager) invalidate(table TableRef) {
+	delete(tm.columns, table.Name)
+}
+
+func (tm *tableManager) loadColumns(tx *pgx.Tx, table TableRef) (map[string]string, error) {
+	rows, err := tx.Query(columnsQuery, tm.schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]string)
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, err
+		}
+		columns[name] = typ
+	}
+	return columns, rows.Err()
+}
+
+// statements returns the SQL statements needed to make a table with the
+// known columns contain all columns.  An empty set of known columns means
+// the table does not exist.
+func statements(
+	data *templateData,
+	known map[string]string,
+	columns Columns,
+	createTemplates []*Template,
+	addColumnTemplates []*Template,
+) ([]string, error) {
+	var tmpls []*Template
+	d := *data
+	if len(known) == 0 {
+		tmpls = createTemplates
+		d.Columns = columns
+		d.AllColumns = columns
+	} else {
+		var missing Columns
+		for _, c := range columns {
+			if _, ok := known[c.Name]; !ok {
+				missing = append(missing, c)
+			}
+		}
+		if len(missing) == 0 {
+			return nil, nil
+		}
+
+		tmpls = addColumnTemplates
+		d.Columns = missing
+		d.AllColumns = columns
+	}
+
+	stmts := make([]string, 0, len(tmpls))
+	for _, tmpl := range tmpls {
+		stmt, err := tmpl.Render(&d)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts, nil
+}
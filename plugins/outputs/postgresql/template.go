@@ -0,0 +1,86 @@
+package postgresql
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Template is a text/template used to generate the SQL statements that
+// create or alter tables.
+//
+// The following values are available within a template:
+//
+//	.Table       - the table being created or altered
+//	.Columns     - the columns to create or add
+//	.AllColumns  - all columns written to the table by the current batch
+//	.TimeColumn  - the time column of the metric table
+//	.MetricTable - the metric table
+//	.TagTable    - the tag table, when tags_as_foreign_keys is set
+//
+// Tables and columns render as quoted identifiers, a list of columns renders
+// as a list of column definitions.  The functions `join`, `quoteIdentifier`
+// and `quoteLiteral` are available in addition to the builtin functions.
+type Template struct {
+	text string
+	tmpl *template.Template
+}
+
+type templateData struct {
+	Table       TableRef
+	Columns     Columns
+	AllColumns  Columns
+	TimeColumn  Column
+	MetricTable TableRef
+	TagTable    TableRef
+}
+
+var templateFuncs = template.FuncMap{
+	"join": join,
+	"quoteIdentifier": func(v interface{}) string {
+		return quoteIdentifier(fmt.Sprint(v))
+	},
+	"quoteLiteral": func(v interface{}) string {
+		return quoteLiteral(fmt.Sprint(v))
+	},
+}
+
+// NewTemplate parses the template text.
+func NewTemplate(text string) (*Template, error) {
+	tmpl, err := template.New("").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{text: text, tmpl: tmpl}, nil
+}
+
+func newTemplates(texts []string) ([]*Template, error) {
+	tmpls := make([]*Template, 0, len(texts))
+	for _, text := range texts {
+		tmpl, err := NewTemplate(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template %q: %v", text, err)
+		}
+		tmpls = append(tmpls, tmpl)
+	}
+	return tmpls, nil
+}
+
+// Render executes the template with the given data.
+func (t *Template) Render(data *templateData) (string, error) {
+	var b bytes.Buffer
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// join returns the column definitions separated by sep.
+func join(sep string, columns Columns) string {
+	definitions := make([]string, 0, len(columns))
+	for _, c := range columns {
+		definitions = append(definitions, c.Definition())
+	}
+	return strings.Join(definitions, sep)
+}
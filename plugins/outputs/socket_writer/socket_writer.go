@@ -1,23 +1,40 @@
 package socket_writer
 
 import (
+	"bufio"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/internal"
 	tlsint "github.com/influxdata/telegraf/plugins/common/tls"
 	"github.com/influxdata/telegraf/plugins/outputs"
 	"github.com/influxdata/telegraf/plugins/serializers"
+	"github.com/influxdata/telegraf/selfstat"
+)
+
+const (
+	framingNone          = "none"
+	framingNewline       = "newline"
+	framingOctetCounting = "octet-counting"
 )
 
 type SocketWriter struct {
-	ContentEncoding string `toml:"content_encoding"`
-	Address         string
-	KeepAlivePeriod *internal.Duration
+	ContentEncoding     string `toml:"content_encoding"`
+	Address             string
+	KeepAlivePeriod     *internal.Duration
+	Framing             string            `toml:"framing"`
+	WriteTimeout        internal.Duration `toml:"write_timeout"`
+	WriteBufferSize     int               `toml:"write_buffer_size"`
+	ReconnectBackoffMin internal.Duration `toml:"reconnect_backoff_min"`
+	ReconnectBackoffMax internal.Duration `toml:"reconnect_backoff_max"`
 	tlsint.ClientConfig
 
 	serializers.Serializer
@@ -25,6 +42,17 @@ type SocketWriter struct {
 	encoder internal.ContentEncoder
 
 	net.Conn
+	writer *bufio.Writer
+
+	// failures is the number of failed connects and writes since the last
+	// successful write, it determines the reconnect backoff.
+	failures      int
+	nextReconnect time.Time
+
+	connected     selfstat.Stat
+	connects      selfstat.Stat
+	connectErrors selfstat.Stat
+	writeErrors   selfstat.Stat
 }
 
 func (sw *SocketWriter) Description() string {
@@ -58,6 +86,29 @@ func (sw *SocketWriter) SampleConfig() string {
   ## Defaults to the OS configuration.
   # keep_alive_period = "5m"
 
+  ## Framing of the metrics on stream sockets (i.e. TCP, unix):
+  ##   none:           send the data as created by the data format
+  ##   newline:        terminate every metric with a newline
+  ##   octet-counting: prefix every metric with its length and a space, as
+  ##                   described in RFC 6587
+  # framing = "none"
+
+  ## Timeout for writing to the socket, the connection is closed if the
+  ## receiver does not accept the data in time.  0 disables the timeout.
+  # write_timeout = "0s"
+
+  ## Size in bytes of the write buffer of stream sockets.  The metrics of a
+  ## write are sent in chunks of this size instead of one by one.  0 disables
+  ## the buffer.
+  # write_buffer_size = 0
+
+  ## Delay before connecting again after a failed connect or write.  The delay
+  ## doubles with every failure up to the maximum, with random jitter of up
+  ## to half of the delay.  Writes fail immediately while waiting to
+  ## reconnect.  0 reconnects on the next write.
+  # reconnect_backoff_min = "1s"
+  # reconnect_backoff_max = "1m"
+
   ## Content encoding for packet-based connections (i.e. UDP, unixgram).
   ## Can be set to "gzip" or to "identity" to apply no encoding.
   ##
@@ -75,7 +126,51 @@ func (sw *SocketWriter) SetSerializer(s serializers.Serializer) {
 	sw.Serializer = s
 }
 
+func (sw *SocketWriter) Init() error {
+	spl := strings.SplitN(sw.Address, "://", 2)
+	if len(spl) != 2 {
+		return fmt.Errorf("invalid address: %s", sw.Address)
+	}
+
+	switch sw.Framing {
+	case "", framingNone, framingNewline, framingOctetCounting:
+	default:
+		return fmt.Errorf("unknown framing %q", sw.Framing)
+	}
+
+	if isPacketSocket(spl[0]) {
+		if sw.Framing != "" && sw.Framing != framingNone {
+			return fmt.Errorf("framing is not supported on %s sockets", spl[0])
+		}
+		if sw.WriteBufferSize > 0 {
+			return fmt.Errorf("write_buffer_size is not supported on %s sockets", spl[0])
+		}
+	}
+
+	if sw.WriteBufferSize < 0 {
+		return fmt.Errorf("invalid write_buffer_size %d", sw.WriteBufferSize)
+	}
+	if sw.ReconnectBackoffMax.Duration < sw.ReconnectBackoffMin.Duration {
+		return fmt.Errorf("reconnect_backoff_max must not be less than reconnect_backoff_min")
+	}
+
+	sw.registerStats()
+	return nil
+}
+
+func (sw *SocketWriter) registerStats() {
+	tags := map[string]string{"address": sw.Address}
+	sw.connected = selfstat.Register("socket_writer", "connected", tags)
+	sw.connects = selfstat.Register("socket_writer", "connects", tags)
+	sw.connectErrors = selfstat.Register("socket_writer", "connect_errors", tags)
+	sw.writeErrors = selfstat.Register("socket_writer", "write_errors", tags)
+}
+
 func (sw *SocketWriter) Connect() error {
+	if sw.connected == nil {
+		sw.registerStats()
+	}
+
 	spl := strings.SplitN(sw.Address, "://", 2)
 	if len(spl) != 2 {
 		return fmt.Errorf("invalid address: %s", sw.Address)
@@ -93,6 +188,8 @@ func (sw *SocketWriter) Connect() error {
 		c, err = tls.Dial(spl[0], spl[1], tlsCfg)
 	}
 	if err != nil {
+		sw.connectErrors.Incr(1)
+		sw.fail()
 		return err
 	}
 
@@ -102,13 +199,56 @@ func (sw *SocketWriter) Connect() error {
 	//set encoder
 	sw.encoder, err = internal.NewContentEncoder(sw.ContentEncoding)
 	if err != nil {
+		c.Close()
 		return err
 	}
 
 	sw.Conn = c
+	if sw.WriteBufferSize > 0 {
+		sw.writer = bufio.NewWriterSize(c, sw.WriteBufferSize)
+	}
+	sw.connects.Incr(1)
+	sw.connected.Set(1)
 	return nil
 }
 
+func isPacketSocket(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return true
+	}
+	return false
+}
+
+// fail delays the next reconnect.
+func (sw *SocketWriter) fail() {
+	sw.failures++
+	delay := sw.backoff(sw.failures)
+	sw.nextReconnect = time.Now().Add(delay)
+}
+
+// backoff returns the delay before reconnecting after the given number of
+// consecutive failures.
+func (sw *SocketWriter) backoff(failures int) time.Duration {
+	min := sw.ReconnectBackoffMin.Duration
+	max := sw.ReconnectBackoffMax.Duration
+	if min <= 0 {
+		return 0
+	}
+
+	delay := min
+	for i := 1; i < failures && (max <= 0 || delay < max); i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+
+	// Spread the reconnects of several writers to the same receiver.
+	jitter := delay / 2
+	return delay - jitter + time.Duration(rand.Int63n(int64(jitter)+1))
+}
+
 func (sw *SocketWriter) setKeepAlive(c net.Conn) error {
 	if sw.KeepAlivePeriod == nil {
 		return nil
@@ -132,11 +272,19 @@ func (sw *SocketWriter) setKeepAlive(c net.Conn) error {
 func (sw *SocketWriter) Write(metrics []telegraf.Metric) error {
 	if sw.Conn == nil {
 		// previous write failed with permanent error and socket was closed.
+		if wait := time.Until(sw.nextReconnect); wait > 0 {
+			return fmt.Errorf("not connected, reconnecting in %s", wait.Round(time.Millisecond))
+		}
 		if err := sw.Connect(); err != nil {
 			return err
 		}
 	}
 
+	var w io.Writer = sw.Conn
+	if sw.writer != nil {
+		w = sw.writer
+	}
+
 	for _, m := range metrics {
 		bs, err := sw.Serialize(m)
 		if err != nil {
@@ -150,21 +298,64 @@ func (sw *SocketWriter) Write(metrics []telegraf.Metric) error {
 			continue
 		}
 
-		if _, err := sw.Conn.Write(bs); err != nil {
-			//TODO log & keep going with remaining strings
-			if err, ok := err.(net.Error); !ok || !err.Temporary() {
-				// permanent error. close the connection
-				sw.Close()
-				sw.Conn = nil
-				return fmt.Errorf("closing connection: %v", err)
-			}
-			return err
+		if err := sw.setDeadline(); err != nil {
+			return sw.writeFailed(err)
+		}
+		if _, err := w.Write(sw.frame(bs)); err != nil {
+			return sw.writeFailed(err)
+		}
+	}
+
+	if sw.writer != nil {
+		if err := sw.setDeadline(); err != nil {
+			return sw.writeFailed(err)
+		}
+		if err := sw.writer.Flush(); err != nil {
+			return sw.writeFailed(err)
 		}
 	}
 
+	sw.failures = 0
 	return nil
 }
 
+func (sw *SocketWriter) setDeadline() error {
+	if sw.WriteTimeout.Duration <= 0 {
+		return nil
+	}
+	return sw.Conn.SetWriteDeadline(time.Now().Add(sw.WriteTimeout.Duration))
+}
+
+// frame returns the metric with the framing of stream sockets applied.
+func (sw *SocketWriter) frame(bs []byte) []byte {
+	switch sw.Framing {
+	case framingNewline:
+		if len(bs) == 0 || bs[len(bs)-1] != '\n' {
+			bs = append(bs, '\n')
+		}
+	case framingOctetCounting:
+		framed := strconv.AppendInt(make([]byte, 0, len(bs)+8), int64(len(bs)), 10)
+		framed = append(framed, ' ')
+		bs = append(framed, bs...)
+	}
+	return bs
+}
+
+// writeFailed handles an error writing to the connection.  Temporary errors
+// keep the connection, unless a write timed out or the data is buffered, as
+// parts of a metric may have been sent already.
+func (sw *SocketWriter) writeFailed(err error) error {
+	sw.writeErrors.Incr(1)
+	if nerr, ok := err.(net.Error); ok && nerr.Temporary() && !nerr.Timeout() && sw.writer == nil {
+		return err
+	}
+
+	// permanent error. close the connection
+	sw.Close()
+	sw.fail()
+	return fmt.Errorf("closing connection: %v", err)
+}
+
 // Close closes the connection. Noop if already closed.
 func (sw *SocketWriter) Close() error {
 	if sw.Conn == nil {
@@ -172,13 +363,18 @@ func (sw *SocketWriter) Close() error {
 	}
 	err := sw.Conn.Close()
 	sw.Conn = nil
+	sw.writer = nil
+	sw.connected.Set(0)
 	return err
 }
 
 func newSocketWriter() *SocketWriter {
 	s, _ := serializers.NewInfluxSerializer()
 	return &SocketWriter{
-		Serializer: s,
+		Framing:             framingNone,
+		ReconnectBackoffMin: internal.Duration{Duration: time.Second},
+		ReconnectBackoffMax: internal.Duration{Duration: time.Minute},
+		Serializer:          s,
 	}
 }
 
@@ -8,8 +8,10 @@ import (
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/internal"
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -209,3 +211,185 @@ func TestSocketWriter_udp_gzip(t *testing.T) {
 
 	testSocketWriter_packet(t, sw, listener)
 }
+
+func TestSocketWriter_framing(t *testing.T) {
+	tests := []struct {
+		name     string
+		framing  string
+		buffer   int
+		expected string
+	}{
+		{
+			name:     "newline",
+			framing:  "newline",
+			expected: "test value=1i 1000000000\ntest value=2i 2000000000\n",
+		},
+		{
+			name:     "octet counting",
+			framing:  "octet-counting",
+			expected: "25 test value=1i 1000000000\n25 test value=2i 2000000000\n",
+		},
+		{
+			name:     "buffered octet counting",
+			framing:  "octet-counting",
+			buffer:   4096,
+			expected: "25 test value=1i 1000000000\n25 test value=2i 2000000000\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer listener.Close()
+
+			sw := newSocketWriter()
+			sw.Address = "tcp://" + listener.Addr().String()
+			sw.Framing = tt.framing
+			sw.WriteBufferSize = tt.buffer
+			require.NoError(t, sw.Init())
+			require.NoError(t, sw.Connect())
+
+			lconn, err := listener.Accept()
+			require.NoError(t, err)
+			defer lconn.Close()
+
+			metrics := []telegraf.Metric{
+				testutil.MustMetric("test", map[string]string{}, map[string]interface{}{"value": 1}, time.Unix(1, 0)),
+				testutil.MustMetric("test", map[string]string{}, map[string]interface{}{"value": 2}, time.Unix(2, 0)),
+			}
+			require.NoError(t, sw.Write(metrics))
+			require.NoError(t, sw.Close())
+
+			actual, err := ioutil.ReadAll(lconn)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(actual))
+		})
+	}
+}
+
+func TestSocketWriter_reconnectBackoff(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	sw := newSocketWriter()
+	sw.Address = "tcp://" + address
+	sw.ReconnectBackoffMin = internal.Duration{Duration: time.Hour}
+	sw.ReconnectBackoffMax = internal.Duration{Duration: 2 * time.Hour}
+	require.NoError(t, sw.Init())
+
+	require.Error(t, sw.Connect())
+	require.Equal(t, int64(1), sw.connectErrors.Get())
+
+	// The write fails without connecting while waiting to reconnect.
+	listener, err = net.Listen("tcp", address)
+	require.NoError(t, err)
+	defer listener.Close()
+	err = sw.Write([]telegraf.Metric{testutil.TestMetric(1, "test")})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "reconnecting in")
+	require.Nil(t, sw.Conn)
+	require.Equal(t, int64(0), sw.connects.Get())
+
+	sw.nextReconnect = time.Time{}
+	require.NoError(t, sw.Write([]telegraf.Metric{testutil.TestMetric(1, "test")}))
+	require.Equal(t, int64(1), sw.connects.Get())
+	require.Equal(t, int64(1), sw.connected.Get())
+	require.Equal(t, 0, sw.failures)
+
+	require.NoError(t, sw.Close())
+	require.Equal(t, int64(0), sw.connected.Get())
+}
+
+func TestSocketWriter_backoff(t *testing.T) {
+	sw := newSocketWriter()
+	sw.ReconnectBackoffMin = internal.Duration{Duration: time.Second}
+	sw.ReconnectBackoffMax = internal.Duration{Duration: 10 * time.Second}
+
+	bounds := []struct {
+		failures int
+		min      time.Duration
+		max      time.Duration
+	}{
+		{failures: 1, min: 500 * time.Millisecond, max: time.Second},
+		{failures: 2, min: time.Second, max: 2 * time.Second},
+		{failures: 3, min: 2 * time.Second, max: 4 * time.Second},
+		{failures: 5, min: 5 * time.Second, max: 10 * time.Second},
+		{failures: 100, min: 5 * time.Second, max: 10 * time.Second},
+	}
+	for _, b := range bounds {
+		for i := 0; i < 100; i++ {
+			delay := sw.backoff(b.failures)
+			require.True(t, delay >= b.min && delay <= b.max, "failures %d: delay %s", b.failures, delay)
+		}
+	}
+
+	sw.ReconnectBackoffMin = internal.Duration{}
+	require.Equal(t, time.Duration(0), sw.backoff(3))
+}
+
+func TestSocketWriter_writeTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	sw := newSocketWriter()
+	sw.Address = "tcp://" + listener.Addr().String()
+	sw.WriteTimeout = internal.Duration{Duration: 100 * time.Millisecond}
+	require.NoError(t, sw.Init())
+	require.NoError(t, sw.Connect())
+
+	lconn, err := listener.Accept()
+	require.NoError(t, err)
+	defer lconn.Close()
+
+	// The receiver never reads, the write blocks once the socket buffers
+	// are full.
+	metrics := make([]telegraf.Metric, 0, 100000)
+	for i := 0; i < cap(metrics); i++ {
+		metrics = append(metrics, testutil.TestMetric(i, "test"))
+	}
+	err = sw.Write(metrics)
+	require.Error(t, err)
+	require.Nil(t, sw.Conn)
+	require.Equal(t, int64(1), sw.writeErrors.Get())
+	require.Equal(t, 1, sw.failures)
+}
+
+func TestSocketWriter_initErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		sw   *SocketWriter
+	}{
+		{
+			name: "invalid address",
+			sw:   &SocketWriter{Address: "127.0.0.1:8094"},
+		},
+		{
+			name: "unknown framing",
+			sw:   &SocketWriter{Address: "tcp://127.0.0.1:8094", Framing: "length"},
+		},
+		{
+			name: "framing on packet socket",
+			sw:   &SocketWriter{Address: "udp://127.0.0.1:8094", Framing: "newline"},
+		},
+		{
+			name: "buffer on packet socket",
+			sw:   &SocketWriter{Address: "unixgram:///tmp/telegraf.sock", WriteBufferSize: 1024},
+		},
+		{
+			name: "backoff max below min",
+			sw: &SocketWriter{
+				Address:             "tcp://127.0.0.1:8094",
+				ReconnectBackoffMin: internal.Duration{Duration: time.Minute},
+				ReconnectBackoffMax: internal.Duration{Duration: time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Error(t, tt.sw.Init())
+		})
+	}
+}
@@ -0,0 +1,436 @@
+package sql
+
+import (
+	gosql "database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql" // register mysql driver
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/outputs"
+	_ "github.com/jackc/pgx/stdlib" // register pgx driver
+	_ "modernc.org/sqlite"          // register sqlite driver
+)
+
+var sampleConfig = `
+  ## Database driver
+  ## Valid options: mysql (MySQL and ClickHouse using the MySQL protocol),
+  ## pgx (Postgres), sqlite (SQLite)
+  # driver = ""
+
+  ## Data source name
+  ## The format of the data source name is different for each database driver.
+  ## See the plugin readme for details.
+  # data_source_name = ""
+
+  ## Timestamp column name
+  # timestamp_column = "timestamp"
+
+  ## Table creation template
+  ## Available template variables:
+  ##  {TABLE} - table name as a quoted identifier
+  ##  {TABLELITERAL} - table name as a quoted string literal
+  ##  {COLUMNS} - column definitions (list of quoted identifiers and types)
+  ##  {KEY_COLUMNS} - comma separated list of the timestamp and tag columns
+  # table_template = "CREATE TABLE {TABLE}({COLUMNS})"
+
+  ## Table existence check template
+  ## Available template variables:
+  ##  {TABLE} - table name as a quoted identifier
+  # table_exists_template = "SELECT 1 FROM {TABLE} LIMIT 1"
+
+  ## Table update template, executed for each column missing in an existing
+  ## table
+  ## Available template variables:
+  ##  {TABLE} - table name as a quoted identifier
+  ##  {COLUMN} - column definition (quoted identifier and type)
+  # table_update_template = "ALTER TABLE {TABLE} ADD COLUMN {COLUMN}"
+
+  ## Initialization SQL, executed once after connecting
+  # init_sql = ""
+
+  ## Metric type to SQL type conversion, defaults depend on the driver
+  #[outputs.sql.convert]
+  #  integer              = "BIGINT"
+  #  real                 = "DOUBLE"
+  #  text                 = "TEXT"
+  #  timestamp            = "TIMESTAMP"
+  #  defaultvalue         = "TEXT"
+  #  unsigned             = "BIGINT UNSIGNED"
+  #  bool                 = "BOOL"
+`
+
+const (
+	defaultTimestampColumn     = "timestamp"
+	defaultTableTemplate       = "CREATE TABLE {TABLE}({COLUMNS})"
+	defaultTableExistsTemplate = "SELECT 1 FROM {TABLE} LIMIT 1"
+	defaultTableUpdateTemplate = "ALTER TABLE {TABLE} ADD COLUMN {COLUMN}"
+)
+
+// ConvertStruct holds the SQL types used for each metric value type.
+type ConvertStruct struct {
+	Integer      string `toml:"integer"`
+	Real         string `toml:"real"`
+	Text         string `toml:"text"`
+	Timestamp    string `toml:"timestamp"`
+	Defaultvalue string `toml:"defaultvalue"`
+	Unsigned     string `toml:"unsigned"`
+	Bool         string `toml:"bool"`
+}
+
+// driverConversions are the default type conversions of each driver.
+var driverConversions = map[string]ConvertStruct{
+	"mysql": {
+		Integer:      "BIGINT",
+		Real:         "DOUBLE",
+		Text:         "TEXT",
+		Timestamp:    "TIMESTAMP",
+		Defaultvalue: "TEXT",
+		Unsigned:     "BIGINT UNSIGNED",
+		Bool:         "BOOL",
+	},
+	"pgx": {
+		Integer:      "BIGINT",
+		Real:         "DOUBLE PRECISION",
+		Text:         "TEXT",
+		Timestamp:    "TIMESTAMP",
+		Defaultvalue: "TEXT",
+		Unsigned:     "NUMERIC",
+		Bool:         "BOOLEAN",
+	},
+	"sqlite": {
+		Integer:      "INTEGER",
+		Real:         "REAL",
+		Text:         "TEXT",
+		Timestamp:    "TIMESTAMP",
+		Defaultvalue: "TEXT",
+		Unsigned:     "UNSIGNED",
+		Bool:         "BOOL",
+	},
+}
+
+type SQL struct {
+	Driver              string        `toml:"driver"`
+	DataSourceName      string        `toml:"data_source_name"`
+	TimestampColumn     string        `toml:"timestamp_column"`
+	TableTemplate       string        `toml:"table_template"`
+	TableExistsTemplate string        `toml:"table_exists_template"`
+	TableUpdateTemplate string        `toml:"table_update_template"`
+	InitSQL             string        `toml:"init_sql"`
+	Convert             ConvertStruct `toml:"convert"`
+
+	Log telegraf.Logger `toml:"-"`
+
+	db *gosql.DB
+	// tables holds the known columns of each table
+	tables map[string]map[string]bool
+}
+
+func (p *SQL) Description() string {
+	return "Save metrics to an SQL Database"
+}
+
+func (p *SQL) SampleConfig() string {
+	return sampleConfig
+}
+
+func (p *SQL) Init() error {
+	defaults, ok := driverConversions[p.Driver]
+	if !ok {
+		return fmt.Errorf("unsupported driver %q", p.Driver)
+	}
+
+	// Fill in the types not set by the user with the driver defaults.
+	set := func(value *string, def string) {
+		if *value == "" {
+			*value = def
+		}
+	}
+	set(&p.Convert.Integer, defaults.Integer)
+	set(&p.Convert.Real, defaults.Real)
+	set(&p.Convert.Text, defaults.Text)
+	set(&p.Convert.Timestamp, defaults.Timestamp)
+	set(&p.Convert.Defaultvalue, defaults.Defaultvalue)
+	set(&p.Convert.Unsigned, defaults.Unsigned)
+	set(&p.Convert.Bool, defaults.Bool)
+
+	p.tables = make(map[string]map[string]bool)
+	return nil
+}
+
+func (p *SQL) Connect() error {
+	db, err := gosql.Open(p.Driver, p.DataSourceName)
+	if err != nil {
+		return err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return err
+	}
+
+	if p.InitSQL != "" {
+		if _, err := db.Exec(p.InitSQL); err != nil {
+			db.Close()
+			return err
+		}
+	}
+
+	p.db = db
+	return nil
+}
+
+func (p *SQL) Close() error {
+	if p.db == nil {
+		return nil
+	}
+	return p.db.Close()
+}
+
+// quoteIdent quotes an identifier for the driver's SQL dialect.
+func (p *SQL) quoteIdent(name string) string {
+	if p.Driver == "mysql" {
+		return "`" + strings.Replace(name, "`", "``", -1) + "`"
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// columnKey returns the key of a column in the known columns of a table,
+// column names are case-insensitive except for Postgres.
+func (p *SQL) columnKey(name string) string {
+	if p.Driver == "pgx" {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+func quoteStr(name string) string {
+	return "'" + strings.Replace(name, "'", "''", -1) + "'"
+}
+
+// placeholder returns the bind variable of the i-th (starting at one)
+// parameter of a statement.
+func (p *SQL) placeholder(i int) string {
+	if p.Driver == "pgx" {
+		return "$" + strconv.Itoa(i)
+	}
+	return "?"
+}
+
+func (p *SQL) deriveDatatype(value interface{}) string {
+	switch value.(type) {
+	case int64:
+		return p.Convert.Integer
+	case uint64:
+		return p.Convert.Unsigned
+	case float64:
+		return p.Convert.Real
+	case string:
+		return p.Convert.Text
+	case bool:
+		return p.Convert.Bool
+	default:
+		return p.Convert.Defaultvalue
+	}
+}
+
+// columns returns the columns and values of the metric, the timestamp
+// followed by the tags and the fields, sorted by key.
+func columns(timestampColumn string, metric telegraf.Metric) ([]string, []interface{}) {
+	names := []string{timestampColumn}
+	values := []interface{}{metric.Time().UTC()}
+
+	for _, tag := range metric.TagList() {
+		names = append(names, tag.Key)
+		values = append(values, tag.Value)
+	}
+
+	fields := metric.FieldList()
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Key < fields[j].Key })
+	for _, field := range fields {
+		names = append(names, field.Key)
+		values = append(values, field.Value)
+	}
+	return names, values
+}
+
+// columnDefinition returns the quoted name and the type of the i-th column
+// returned by columns.
+func (p *SQL) columnDefinition(i int, name string, value interface{}) string {
+	typ := p.Convert.Timestamp
+	if i > 0 {
+		typ = p.deriveDatatype(value)
+	}
+	return p.quoteIdent(name) + " " + typ
+}
+
+func (p *SQL) generateCreateTable(metric telegraf.Metric) string {
+	names, values := columns(p.TimestampColumn, metric)
+
+	defs := make([]string, 0, len(names))
+	keys := make([]string, 0, len(metric.TagList())+1)
+	for i, name := range names {
+		defs = append(defs, p.columnDefinition(i, name, values[i]))
+
+		if i <= len(metric.TagList()) {
+			keys = append(keys, p.quoteIdent(name))
+		}
+	}
+
+	query := p.TableTemplate
+	query = strings.Replace(query, "{TABLE}", p.quoteIdent(metric.Name()), -1)
+	query = strings.Replace(query, "{TABLELITERAL}", quoteStr(metric.Name()), -1)
+	query = strings.Replace(query, "{COLUMNS}", strings.Join(defs, ","), -1)
+	query = strings.Replace(query, "{KEY_COLUMNS}", strings.Join(keys, ","), -1)
+	return query
+}
+
+func (p *SQL) generateInsert(metric telegraf.Metric) (string, []interface{}) {
+	names, values := columns(p.TimestampColumn, metric)
+
+	quoted := make([]string, 0, len(names))
+	placeholders := make([]string, 0, len(names))
+	for i, name := range names {
+		quoted = append(quoted, p.quoteIdent(name))
+		placeholders = append(placeholders, p.placeholder(i+1))
+	}
+
+	return fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s)",
+		p.quoteIdent(metric.Name()),
+		strings.Join(quoted, ","),
+		strings.Join(placeholders, ",")), values
+}
+
+func (p *SQL) tableExists(tableName string) bool {
+	stmt := strings.Replace(p.TableExistsTemplate, "{TABLE}", p.quoteIdent(tableName), -1)
+
+	rows, err := p.db.Query(stmt)
+	if err != nil {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+// tableColumns returns the columns of an existing table.
+func (p *SQL) tableColumns(tableName string) (map[string]bool, error) {
+	rows, err := p.db.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 0", p.quoteIdent(tableName)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]bool, len(names))
+	for _, name := range names {
+		columns[p.columnKey(name)] = true
+	}
+	return columns, nil
+}
+
+// ensureTable creates the table of the metric if it does not exist and
+// returns its known columns.
+func (p *SQL) ensureTable(metric telegraf.Metric) (map[string]bool, error) {
+	name := metric.Name()
+	if known, ok := p.tables[name]; ok {
+		return known, nil
+	}
+
+	if p.tableExists(name) {
+		known, err := p.tableColumns(name)
+		if err != nil {
+			return nil, fmt.Errorf("reading columns of table %q failed: %v", name, err)
+		}
+		p.tables[name] = known
+		return known, nil
+	}
+
+	stmt := p.generateCreateTable(metric)
+	if _, err := p.db.Exec(stmt); err != nil {
+		return nil, fmt.Errorf("creating table %q failed: %v", name, err)
+	}
+	p.Log.Debugf("Created table %q", name)
+
+	names, _ := columns(p.TimestampColumn, metric)
+	known := make(map[string]bool, len(names))
+	for _, column := range names {
+		known[p.columnKey(column)] = true
+	}
+	p.tables[name] = known
+	return known, nil
+}
+
+// addColumns adds the columns of the metric missing in its table.
+func (p *SQL) addColumns(metric telegraf.Metric, known map[string]bool) error {
+	names, values := columns(p.TimestampColumn, metric)
+	for i, name := range names {
+		if known[p.columnKey(name)] {
+			continue
+		}
+
+		stmt := p.TableUpdateTemplate
+		stmt = strings.Replace(stmt, "{TABLE}", p.quoteIdent(metric.Name()), -1)
+		stmt = strings.Replace(stmt, "{COLUMN}", p.columnDefinition(i, name, values[i]), -1)
+		if _, err := p.db.Exec(stmt); err != nil {
+			return fmt.Errorf("adding column %q to table %q failed: %v", name, metric.Name(), err)
+		}
+		p.Log.Debugf("Added column %q to table %q", name, metric.Name())
+		known[p.columnKey(name)] = true
+	}
+	return nil
+}
+
+func (p *SQL) Write(metrics []telegraf.Metric) error {
+	// Make sure all tables and columns exist before starting the
+	// transaction, some databases do not support DDL within transactions.
+	// Metrics whose columns can't be added are dropped, so they do not fail
+	// every retry of the batch.
+	batch := make([]telegraf.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		known, err := p.ensureTable(metric)
+		if err != nil {
+			return err
+		}
+		if err := p.addColumns(metric, known); err != nil {
+			p.Log.Errorf("Dropping metric: %v", err)
+			continue
+		}
+		batch = append(batch, metric)
+	}
+
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, metric := range batch {
+		stmt, values := p.generateInsert(metric)
+		if _, err := tx.Exec(stmt, values...); err != nil {
+			tx.Rollback()
+			// The table might have been dropped, check again on the next
+			// write.
+			delete(p.tables, metric.Name())
+			return fmt.Errorf("execution of %q failed: %v", stmt, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func newSQL() *SQL {
+	return &SQL{
+		TimestampColumn:     defaultTimestampColumn,
+		TableTemplate:       defaultTableTemplate,
+		TableExistsTemplate: defaultTableExistsTemplate,
+		TableUpdateTemplate: defaultTableUpdateTemplate,
+	}
+}
+
+func init() {
+	outputs.Add("sql", func() telegraf.Output { return newSQL() })
+}
@@ -0,0 +1,100 @@
+package sql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var ts = time.Date(2020, 8, 31, 17, 0, 0, 0, time.UTC)
+
+func testMetric() telegraf.Metric {
+	return testutil.MustMetric(
+		"metric one",
+		map[string]string{
+			"tag_one": "tag1",
+			"tag_two": "tag2",
+		},
+		map[string]interface{}{
+			"int64_one":  int64(1234),
+			"uint64_one": uint64(1),
+			"float_one":  1.5,
+			"bool_one":   true,
+			"string_one": "foo",
+		},
+		ts,
+	)
+}
+
+func newTestSQL(t *testing.T, driver string) *SQL {
+	p := newSQL()
+	p.Driver = driver
+	p.Log = testutil.Logger{}
+	require.NoError(t, p.Init())
+	return p
+}
+
+func TestUnsupportedDriver(t *testing.T) {
+	p := newSQL()
+	p.Driver = "oracle"
+	require.Error(t, p.Init())
+}
+
+func TestGenerateCreateTable(t *testing.T) {
+	tests := []struct {
+		driver   string
+		template string
+		expected string
+	}{
+		{
+			driver:   "mysql",
+			template: defaultTableTemplate,
+			expected: "CREATE TABLE `metric one`(`timestamp` TIMESTAMP,`tag_one` TEXT,`tag_two` TEXT,`bool_one` BOOL,`float_one` DOUBLE,`int64_one` BIGINT,`string_one` TEXT,`uint64_one` BIGINT UNSIGNED)",
+		},
+		{
+			driver:   "pgx",
+			template: defaultTableTemplate,
+			expected: `CREATE TABLE "metric one"("timestamp" TIMESTAMP,"tag_one" TEXT,"tag_two" TEXT,"bool_one" BOOLEAN,"float_one" DOUBLE PRECISION,"int64_one" BIGINT,"string_one" TEXT,"uint64_one" NUMERIC)`,
+		},
+		{
+			driver:   "sqlite",
+			template: "CREATE TABLE {TABLE}({COLUMNS}, PRIMARY KEY ({KEY_COLUMNS})) -- {TABLELITERAL}",
+			expected: `CREATE TABLE "metric one"("timestamp" TIMESTAMP,"tag_one" TEXT,"tag_two" TEXT,"bool_one" BOOL,"float_one" REAL,"int64_one" INTEGER,"string_one" TEXT,"uint64_one" UNSIGNED, PRIMARY KEY ("timestamp","tag_one","tag_two")) -- 'metric one'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			p := newTestSQL(t, tt.driver)
+			p.TableTemplate = tt.template
+			require.Equal(t, tt.expected, p.generateCreateTable(testMetric()))
+		})
+	}
+}
+
+func TestConvertOverride(t *testing.T) {
+	p := newSQL()
+	p.Driver = "mysql"
+	p.Convert.Integer = "INT"
+	require.NoError(t, p.Init())
+	require.Equal(t, "INT", p.Convert.Integer)
+	require.Equal(t, "DOUBLE", p.Convert.Real)
+}
+
+func TestGenerateInsert(t *testing.T) {
+	p := newTestSQL(t, "pgx")
+	stmt, values := p.generateInsert(testMetric())
+	require.Equal(t,
+		`INSERT INTO "metric one"("timestamp","tag_one","tag_two","bool_one","float_one","int64_one","string_one","uint64_one") VALUES($1,$2,$3,$4,$5,$6,$7,$8)`,
+		stmt)
+	require.Equal(t, []interface{}{ts, "tag1", "tag2", true, 1.5, int64(1234), "foo", uint64(1)}, values)
+
+	p = newTestSQL(t, "mysql")
+	stmt, _ = p.generateInsert(testMetric())
+	require.Equal(t,
+		"INSERT INTO `metric one`(`timestamp`,`tag_one`,`tag_two`,`bool_one`,`float_one`,`int64_one`,`string_one`,`uint64_one`) VALUES(?,?,?,?,?,?,?,?)",
+		stmt)
+}
@@ -0,0 +1,117 @@
+package sql
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSqlite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sql-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p := newTestSQL(t, "sqlite")
+	p.DataSourceName = filepath.Join(dir, "metrics.db")
+	p.InitSQL = "PRAGMA journal_mode=WAL"
+	require.NoError(t, p.Connect())
+	defer p.Close()
+
+	require.NoError(t, p.Write([]telegraf.Metric{testMetric()}))
+	require.Contains(t, p.tables, "metric one")
+
+	second := testutil.MustMetric(
+		"metric one",
+		map[string]string{"tag_one": "tag3"},
+		map[string]interface{}{"int64_one": int64(42)},
+		ts.Add(time.Second),
+	)
+	require.NoError(t, p.Write([]telegraf.Metric{second}))
+
+	rows, err := p.db.Query(`SELECT "tag_one", "tag_two", "int64_one", "float_one", "string_one" FROM "metric one" ORDER BY "timestamp"`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	type row struct {
+		tagOne, tagTwo interface{}
+		intOne         int64
+		floatOne       interface{}
+		stringOne      interface{}
+	}
+	var actual []row
+	for rows.Next() {
+		var r row
+		require.NoError(t, rows.Scan(&r.tagOne, &r.tagTwo, &r.intOne, &r.floatOne, &r.stringOne))
+		actual = append(actual, r)
+	}
+	require.NoError(t, rows.Err())
+
+	require.Equal(t, []row{
+		{tagOne: "tag1", tagTwo: "tag2", intOne: 1234, floatOne: 1.5, stringOne: "foo"},
+		{tagOne: "tag3", tagTwo: nil, intOne: 42, floatOne: nil, stringOne: nil},
+	}, actual)
+}
+
+func TestSqliteAddColumn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sql-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p := newTestSQL(t, "sqlite")
+	p.DataSourceName = filepath.Join(dir, "metrics.db")
+	require.NoError(t, p.Connect())
+	defer p.Close()
+
+	require.NoError(t, p.Write([]telegraf.Metric{testMetric()}))
+
+	// Missing columns are added to existing tables, also when the table
+	// was created by another instance.
+	p.tables = make(map[string]map[string]bool)
+	unknown := testutil.MustMetric(
+		"metric one",
+		map[string]string{"new_tag": "tag3"},
+		map[string]interface{}{"new_field": 1.0},
+		ts.Add(time.Second),
+	)
+	require.NoError(t, p.Write([]telegraf.Metric{unknown}))
+
+	var tag string
+	var field float64
+	require.NoError(t, p.db.QueryRow(`SELECT "new_tag", "new_field" FROM "metric one" WHERE "new_tag" IS NOT NULL`).Scan(&tag, &field))
+	require.Equal(t, "tag3", tag)
+	require.Equal(t, 1.0, field)
+}
+
+func TestSqliteAddColumnFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sql-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p := newTestSQL(t, "sqlite")
+	p.DataSourceName = filepath.Join(dir, "metrics.db")
+	p.TableUpdateTemplate = "ALTER TABLE {TABLE} ADD COLUMN {COLUMN} NOT NULL"
+	require.NoError(t, p.Connect())
+	defer p.Close()
+
+	require.NoError(t, p.Write([]telegraf.Metric{testMetric()}))
+
+	// A metric whose columns can't be added is dropped, the rest of the
+	// batch is written.
+	unknown := testutil.MustMetric(
+		"metric one",
+		map[string]string{},
+		map[string]interface{}{"new_field": 1.0},
+		ts,
+	)
+	require.NoError(t, p.Write([]telegraf.Metric{testMetric(), unknown}))
+
+	var count int
+	require.NoError(t, p.db.QueryRow(`SELECT count(*) FROM "metric one"`).Scan(&count))
+	require.Equal(t, 2, count)
+}
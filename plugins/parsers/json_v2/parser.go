@@ -0,0 +1,517 @@
+package json_v2
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/filter"
+	"github.com/influxdata/telegraf/internal"
+	"github.com/influxdata/telegraf/metric"
+	"github.com/tidwall/gjson"
+)
+
+// Config is a single `[[json_v2]]` selection.  Each selection produces its
+// own set of metrics from the same input document.
+type Config struct {
+	MeasurementName     string `toml:"measurement_name"`
+	MeasurementNamePath string `toml:"measurement_name_path"`
+	TimestampPath       string `toml:"timestamp_path"`
+	TimestampFormat     string `toml:"timestamp_format"`
+	TimestampTimezone   string `toml:"timestamp_timezone"`
+
+	Fields  []DataSet    `toml:"field"`
+	Tags    []DataSet    `toml:"tag"`
+	Objects []JSONObject `toml:"object"`
+}
+
+// DataSet selects a single value, or an array of values, with a GJSON path.
+type DataSet struct {
+	Path   string `toml:"path"`
+	Rename string `toml:"rename"`
+	Type   string `toml:"type"`
+}
+
+// JSONObject selects an object, or an array of objects, with a GJSON path
+// and turns every scalar below it into a tag or field.
+type JSONObject struct {
+	Path               string            `toml:"path"`
+	TimestampKey       string            `toml:"timestamp_key"`
+	TimestampFormat    string            `toml:"timestamp_format"`
+	TimestampTimezone  string            `toml:"timestamp_timezone"`
+	DisablePrependKeys bool              `toml:"disable_prepend_keys"`
+	IncludedKeys       []string          `toml:"included_keys"`
+	ExcludedKeys       []string          `toml:"excluded_keys"`
+	Tags               []string          `toml:"tags"`
+	Renames            map[string]string `toml:"renames"`
+	Fields             map[string]string `toml:"fields"`
+
+	included filter.Filter
+	excluded filter.Filter
+	tags     map[string]bool
+}
+
+type Parser struct {
+	Configs     []Config
+	MetricName  string
+	DefaultTags map[string]string
+
+	// TimeFunc returns the time used for metrics without a timestamp.
+	TimeFunc func() time.Time
+}
+
+// metricData is an intermediate, unnamed metric produced while walking the
+// document.
+type metricData struct {
+	tags      map[string]string
+	fields    map[string]interface{}
+	timestamp time.Time
+
+	// hasTimestamp is set when the timestamp was read from the document
+	// instead of being inherited.
+	hasTimestamp bool
+}
+
+func New(metricName string, configs []Config, defaultTags map[string]string) (*Parser, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("at least one json_v2 configuration is required")
+	}
+
+	for i := range configs {
+		c := &configs[i]
+		if c.TimestampPath != "" && c.TimestampFormat == "" {
+			return nil, fmt.Errorf("use of 'timestamp_path' requires 'timestamp_format'")
+		}
+		for _, ds := range c.Tags {
+			if ds.Path == "" {
+				return nil, fmt.Errorf("'path' is required for every tag")
+			}
+		}
+		for _, ds := range c.Fields {
+			if ds.Path == "" {
+				return nil, fmt.Errorf("'path' is required for every field")
+			}
+			if !validType(ds.Type) {
+				return nil, fmt.Errorf("unsupported type %q for field %q", ds.Type, ds.Path)
+			}
+		}
+
+		for j := range c.Objects {
+			obj := &c.Objects[j]
+			if obj.Path == "" {
+				return nil, fmt.Errorf("'path' is required for every object")
+			}
+			if obj.TimestampKey != "" && obj.TimestampFormat == "" {
+				return nil, fmt.Errorf("use of 'timestamp_key' requires 'timestamp_format'")
+			}
+			for key, typ := range obj.Fields {
+				if !validType(typ) {
+					return nil, fmt.Errorf("unsupported type %q for field %q", typ, key)
+				}
+			}
+
+			var err error
+			obj.included, err = filter.Compile(obj.IncludedKeys)
+			if err != nil {
+				return nil, err
+			}
+			obj.excluded, err = filter.Compile(obj.ExcludedKeys)
+			if err != nil {
+				return nil, err
+			}
+			obj.tags = make(map[string]bool, len(obj.Tags))
+			for _, tag := range obj.Tags {
+				obj.tags[tag] = true
+			}
+		}
+	}
+
+	return &Parser{
+		Configs:     configs,
+		MetricName:  metricName,
+		DefaultTags: defaultTags,
+		TimeFunc:    time.Now,
+	}, nil
+}
+
+func (p *Parser) Parse(buf []byte) ([]telegraf.Metric, error) {
+	if !gjson.ValidBytes(buf) {
+		return nil, fmt.Errorf("invalid JSON provided, unable to parse")
+	}
+
+	metrics := make([]telegraf.Metric, 0)
+	for _, c := range p.Configs {
+		name := p.MetricName
+		if c.MeasurementName != "" {
+			name = c.MeasurementName
+		}
+		if c.MeasurementNamePath != "" {
+			result := gjson.GetBytes(buf, c.MeasurementNamePath)
+			if !result.Exists() || result.IsArray() || result.IsObject() {
+				return nil, fmt.Errorf("measurement_name_path %q must lead to a single value", c.MeasurementNamePath)
+			}
+			name = result.String()
+		}
+
+		timestamp := p.TimeFunc()
+		if c.TimestampPath != "" {
+			result := gjson.GetBytes(buf, c.TimestampPath)
+			if !result.Exists() {
+				return nil, fmt.Errorf("timestamp_path %q could not be found", c.TimestampPath)
+			}
+			var err error
+			timestamp, err = internal.ParseTimestamp(c.TimestampFormat, result.Value(), c.TimestampTimezone)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		fields, err := p.processDataSets(buf, c.Fields, false, timestamp)
+		if err != nil {
+			return nil, err
+		}
+		tags, err := p.processDataSets(buf, c.Tags, true, timestamp)
+		if err != nil {
+			return nil, err
+		}
+
+		var objects []metricData
+		for i := range c.Objects {
+			entries, err := p.processObject(buf, &c.Objects[i], timestamp)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, entries...)
+		}
+
+		// Values selected outside of the objects are shared by every metric
+		// created from an object.
+		selection := cartesianProduct(cartesianProduct(tags, fields), objects)
+
+		for _, data := range selection {
+			if len(data.fields) == 0 {
+				continue
+			}
+			for k, v := range p.DefaultTags {
+				if _, ok := data.tags[k]; !ok {
+					data.tags[k] = v
+				}
+			}
+			m, err := metric.New(name, data.tags, data.fields, data.timestamp)
+			if err != nil {
+				return nil, err
+			}
+			metrics = append(metrics, m)
+		}
+	}
+
+	return metrics, nil
+}
+
+// processDataSets returns the metric data created by the basic field or tag
+// selections.  A path yielding an array creates one entry per element.
+func (p *Parser) processDataSets(buf []byte, sets []DataSet, asTag bool, timestamp time.Time) ([]metricData, error) {
+	var results []metricData
+	for _, ds := range sets {
+		result := gjson.GetBytes(buf, ds.Path)
+		if !result.Exists() {
+			continue
+		}
+
+		name := ds.Rename
+		if name == "" {
+			name = defaultName(ds.Path)
+		}
+
+		values := []gjson.Result{result}
+		if result.IsArray() {
+			values = result.Array()
+		}
+
+		var entries []metricData
+		for _, value := range values {
+			data := newMetricData(timestamp)
+			if asTag {
+				data.tags[name] = value.String()
+			} else {
+				v, err := convertType(value, ds.Type, name)
+				if err != nil {
+					return nil, err
+				}
+				if v == nil {
+					continue
+				}
+				data.fields[name] = v
+			}
+			entries = append(entries, data)
+		}
+
+		results = cartesianProduct(results, entries)
+	}
+	return results, nil
+}
+
+func (p *Parser) processObject(buf []byte, obj *JSONObject, timestamp time.Time) ([]metricData, error) {
+	result := gjson.GetBytes(buf, obj.Path)
+	if !result.Exists() {
+		return nil, nil
+	}
+	if !result.IsObject() && !result.IsArray() {
+		return nil, fmt.Errorf("object path %q must lead to a JSON object or array, but lead to: %v", obj.Path, result.Type)
+	}
+
+	base := newMetricData(timestamp)
+	return p.walk(obj, "", result, base)
+}
+
+// walk expands the value into metric data.  Keys of an object are combined
+// with each other so values of a parent object are inherited by every metric
+// created from a nested array, while every element of an array produces its
+// own metrics.
+func (p *Parser) walk(obj *JSONObject, key string, value gjson.Result, base metricData) ([]metricData, error) {
+	if key != "" && obj.excluded != nil && obj.excluded.Match(key) {
+		return []metricData{base}, nil
+	}
+
+	switch {
+	case value.IsArray():
+		var results []metricData
+		for _, elem := range value.Array() {
+			entries, err := p.walk(obj, key, elem, base.copy())
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, entries...)
+		}
+		if len(results) == 0 {
+			return []metricData{base}, nil
+		}
+		return results, nil
+	case value.IsObject():
+		results := []metricData{base}
+		var err error
+		value.ForEach(func(k, v gjson.Result) bool {
+			name := k.String()
+			if key != "" && !obj.DisablePrependKeys {
+				name = key + "_" + name
+			}
+
+			var entries []metricData
+			entries, err = p.walk(obj, name, v, newMetricData(base.timestamp))
+			if err != nil {
+				return false
+			}
+			results = cartesianProduct(results, entries)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		return results, nil
+	}
+
+	if key == "" {
+		return []metricData{base}, nil
+	}
+
+	if key == obj.TimestampKey {
+		ts, err := internal.ParseTimestamp(obj.TimestampFormat, value.Value(), obj.TimestampTimezone)
+		if err != nil {
+			return nil, err
+		}
+		base.timestamp = ts
+		base.hasTimestamp = true
+		return []metricData{base}, nil
+	}
+
+	if obj.included != nil && !obj.included.Match(key) {
+		return []metricData{base}, nil
+	}
+
+	name := key
+	if rename, ok := obj.Renames[key]; ok {
+		name = rename
+	}
+
+	if obj.tags[key] {
+		base.tags[name] = value.String()
+		return []metricData{base}, nil
+	}
+
+	v, err := convertType(value, obj.Fields[key], name)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		base.fields[name] = v
+	}
+	return []metricData{base}, nil
+}
+
+func (p *Parser) ParseLine(line string) (telegraf.Metric, error) {
+	metrics, err := p.Parse([]byte(line))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(metrics) < 1 {
+		return nil, fmt.Errorf("can not parse the line: %s, for data format: json_v2 ", line)
+	}
+
+	return metrics[0], nil
+}
+
+func (p *Parser) SetDefaultTags(tags map[string]string) {
+	p.DefaultTags = tags
+}
+
+func newMetricData(timestamp time.Time) metricData {
+	return metricData{
+		tags:      make(map[string]string),
+		fields:    make(map[string]interface{}),
+		timestamp: timestamp,
+	}
+}
+
+func (d metricData) copy() metricData {
+	c := newMetricData(d.timestamp)
+	c.hasTimestamp = d.hasTimestamp
+	for k, v := range d.tags {
+		c.tags[k] = v
+	}
+	for k, v := range d.fields {
+		c.fields[k] = v
+	}
+	return c
+}
+
+// cartesianProduct merges every entry of a with every entry of b.  If either
+// side is empty the other side is returned unchanged.
+func cartesianProduct(a, b []metricData) []metricData {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+
+	results := make([]metricData, 0, len(a)*len(b))
+	for _, x := range a {
+		for _, y := range b {
+			data := x.copy()
+			for k, v := range y.tags {
+				data.tags[k] = v
+			}
+			for k, v := range y.fields {
+				data.fields[k] = v
+			}
+			if y.hasTimestamp {
+				data.timestamp = y.timestamp
+				data.hasTimestamp = true
+			}
+			results = append(results, data)
+		}
+	}
+	return results
+}
+
+// defaultName returns the last key of a GJSON path, which is used as the
+// name of a field or tag unless it is renamed.
+func defaultName(path string) string {
+	keys := strings.Split(path, ".")
+	for i := len(keys) - 1; i >= 0; i-- {
+		if keys[i] != "" && !strings.HasPrefix(keys[i], "#") && !strings.HasPrefix(keys[i], "@") {
+			return keys[i]
+		}
+	}
+	return path
+}
+
+func validType(typ string) bool {
+	switch typ {
+	case "", "int", "uint", "float", "string", "bool":
+		return true
+	}
+	return false
+}
+
+// convertType returns the value of the result as the requested type.  If no
+// type is given, numbers are returned as floats, strings as strings and
+// booleans as bools.
+func convertType(result gjson.Result, typ string, name string) (interface{}, error) {
+	switch result.Type {
+	case gjson.Null:
+		return nil, nil
+	case gjson.Number:
+		switch typ {
+		case "", "float":
+			return result.Float(), nil
+		case "int":
+			return result.Int(), nil
+		case "uint":
+			if result.Num < 0 {
+				return nil, fmt.Errorf("unable to convert field %q to type uint: negative value", name)
+			}
+			return result.Uint(), nil
+		case "string":
+			return result.Raw, nil
+		case "bool":
+			return result.Num != 0, nil
+		}
+	case gjson.String:
+		switch typ {
+		case "", "string":
+			return result.Str, nil
+		case "float":
+			v, err := strconv.ParseFloat(result.Str, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unable to convert field %q to type float: %v", name, err)
+			}
+			return v, nil
+		case "int":
+			v, err := strconv.ParseInt(result.Str, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unable to convert field %q to type int: %v", name, err)
+			}
+			return v, nil
+		case "uint":
+			v, err := strconv.ParseUint(result.Str, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unable to convert field %q to type uint: %v", name, err)
+			}
+			return v, nil
+		case "bool":
+			v, err := strconv.ParseBool(result.Str)
+			if err != nil {
+				return nil, fmt.Errorf("unable to convert field %q to type bool: %v", name, err)
+			}
+			return v, nil
+		}
+	case gjson.True, gjson.False:
+		v := result.Bool()
+		switch typ {
+		case "", "bool":
+			return v, nil
+		case "string":
+			return strconv.FormatBool(v), nil
+		case "int":
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case "uint":
+			if v {
+				return uint64(1), nil
+			}
+			return uint64(0), nil
+		case "float":
+			if v {
+				return float64(1), nil
+			}
+			return float64(0), nil
+		}
+	}
+	return nil, fmt.Errorf("unable to convert field %q of JSON type %v to type %q", name, result.Type, typ)
+}
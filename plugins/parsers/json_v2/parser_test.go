@@ -0,0 +1,267 @@
+package json_v2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const nestedJSON = `
+{
+  "site": "lab",
+  "timestamp": 1598893200,
+  "devices": [
+    {
+      "name": "sensor1",
+      "location": {"room": "a"},
+      "readings": [
+        {"time": "2020-08-31T17:00:00Z", "temperature": 21.5, "humidity": "40"},
+        {"time": "2020-08-31T17:01:00Z", "temperature": 21.7, "humidity": "41"}
+      ]
+    },
+    {
+      "name": "sensor2",
+      "location": {"room": "b"},
+      "readings": [
+        {"time": "2020-08-31T17:00:00Z", "temperature": 19.0, "humidity": "55"}
+      ]
+    }
+  ],
+  "status": {"uptime": 3600, "healthy": true, "version": "1.2.3"}
+}
+`
+
+func defaultTime() time.Time {
+	return time.Unix(42, 0)
+}
+
+func newParser(t *testing.T, configs []Config) *Parser {
+	parser, err := New("json_v2_test", configs, nil)
+	require.NoError(t, err)
+	parser.TimeFunc = defaultTime
+	return parser
+}
+
+func TestBasicFieldsAndTags(t *testing.T) {
+	parser := newParser(t, []Config{
+		{
+			MeasurementName: "status",
+			TimestampPath:   "timestamp",
+			TimestampFormat: "unix",
+			Fields: []DataSet{
+				{Path: "status.uptime", Type: "int"},
+				{Path: "status.healthy"},
+			},
+			Tags: []DataSet{
+				{Path: "site"},
+				{Path: "status.version", Rename: "release"},
+			},
+		},
+	})
+
+	actual, err := parser.Parse([]byte(nestedJSON))
+	require.NoError(t, err)
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"status",
+			map[string]string{
+				"site":    "lab",
+				"release": "1.2.3",
+			},
+			map[string]interface{}{
+				"uptime":  int64(3600),
+				"healthy": true,
+			},
+			time.Unix(1598893200, 0),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, actual)
+}
+
+func TestObjectParentInheritance(t *testing.T) {
+	parser := newParser(t, []Config{
+		{
+			MeasurementName: "sensor",
+			Tags: []DataSet{
+				{Path: "site"},
+			},
+			Objects: []JSONObject{
+				{
+					Path:               "devices",
+					TimestampKey:       "time",
+					TimestampFormat:    "2006-01-02T15:04:05Z07:00",
+					DisablePrependKeys: true,
+					Tags:               []string{"name", "room"},
+					Renames:            map[string]string{"name": "device"},
+					Fields:             map[string]string{"humidity": "int"},
+				},
+			},
+		},
+	})
+
+	actual, err := parser.Parse([]byte(nestedJSON))
+	require.NoError(t, err)
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"sensor",
+			map[string]string{"site": "lab", "device": "sensor1", "room": "a"},
+			map[string]interface{}{"temperature": 21.5, "humidity": int64(40)},
+			time.Date(2020, 8, 31, 17, 0, 0, 0, time.UTC),
+		),
+		testutil.MustMetric(
+			"sensor",
+			map[string]string{"site": "lab", "device": "sensor1", "room": "a"},
+			map[string]interface{}{"temperature": 21.7, "humidity": int64(41)},
+			time.Date(2020, 8, 31, 17, 1, 0, 0, time.UTC),
+		),
+		testutil.MustMetric(
+			"sensor",
+			map[string]string{"site": "lab", "device": "sensor2", "room": "b"},
+			map[string]interface{}{"temperature": 19.0, "humidity": int64(55)},
+			time.Date(2020, 8, 31, 17, 0, 0, 0, time.UTC),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, actual, testutil.SortMetrics())
+}
+
+func TestObjectIncludedAndExcludedKeys(t *testing.T) {
+	parser := newParser(t, []Config{
+		{
+			Objects: []JSONObject{
+				{
+					Path:         "status",
+					IncludedKeys: []string{"uptime", "version"},
+				},
+				{
+					Path:         "devices",
+					ExcludedKeys: []string{"readings", "location"},
+					Tags:         []string{"name"},
+				},
+			},
+		},
+	})
+
+	actual, err := parser.Parse([]byte(nestedJSON))
+	require.NoError(t, err)
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"json_v2_test",
+			map[string]string{},
+			map[string]interface{}{"uptime": 3600.0, "version": "1.2.3"},
+			defaultTime(),
+		),
+	}
+	// The device objects only contain tags after the exclusions and do
+	// not create metrics.
+	testutil.RequireMetricsEqual(t, expected, actual)
+}
+
+func TestPrependKeys(t *testing.T) {
+	parser := newParser(t, []Config{
+		{
+			Objects: []JSONObject{
+				{
+					Path:         "devices.0",
+					ExcludedKeys: []string{"readings"},
+				},
+			},
+		},
+	})
+
+	actual, err := parser.Parse([]byte(nestedJSON))
+	require.NoError(t, err)
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"json_v2_test",
+			map[string]string{},
+			map[string]interface{}{"name": "sensor1", "location_room": "a"},
+			defaultTime(),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, actual)
+}
+
+func TestMultipleSelections(t *testing.T) {
+	parser := newParser(t, []Config{
+		{
+			MeasurementName: "first",
+			Fields:          []DataSet{{Path: "status.uptime"}},
+		},
+		{
+			MeasurementNamePath: "site",
+			Fields:              []DataSet{{Path: "devices.#.name", Rename: "device"}},
+		},
+	})
+
+	actual, err := parser.Parse([]byte(nestedJSON))
+	require.NoError(t, err)
+
+	expected := []telegraf.Metric{
+		testutil.MustMetric(
+			"first",
+			map[string]string{},
+			map[string]interface{}{"uptime": 3600.0},
+			defaultTime(),
+		),
+		testutil.MustMetric(
+			"lab",
+			map[string]string{},
+			map[string]interface{}{"device": "sensor1"},
+			defaultTime(),
+		),
+		testutil.MustMetric(
+			"lab",
+			map[string]string{},
+			map[string]interface{}{"device": "sensor2"},
+			defaultTime(),
+		),
+	}
+	testutil.RequireMetricsEqual(t, expected, actual)
+}
+
+func TestDefaultTags(t *testing.T) {
+	parser := newParser(t, []Config{
+		{
+			Fields: []DataSet{{Path: "status.uptime"}},
+			Tags:   []DataSet{{Path: "site"}},
+		},
+	})
+	parser.SetDefaultTags(map[string]string{"site": "default", "host": "localhost"})
+
+	actual, err := parser.ParseLine(`{"site": "lab", "status": {"uptime": 1}}`)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"site": "lab", "host": "localhost"}, actual.Tags())
+}
+
+func TestInvalidConfig(t *testing.T) {
+	_, err := New("test", nil, nil)
+	require.Error(t, err)
+
+	_, err = New("test", []Config{{TimestampPath: "time"}}, nil)
+	require.Error(t, err)
+
+	_, err = New("test", []Config{{Fields: []DataSet{{Path: "a", Type: "complex"}}}}, nil)
+	require.Error(t, err)
+
+	_, err = New("test", []Config{{Objects: []JSONObject{{Path: "a", TimestampKey: "time"}}}}, nil)
+	require.Error(t, err)
+}
+
+func TestInvalidJSON(t *testing.T) {
+	parser := newParser(t, []Config{{Fields: []DataSet{{Path: "a"}}}})
+	_, err := parser.Parse([]byte(`{"a": 5, "b": "c": 6}}`))
+	require.Error(t, err)
+}
+
+func TestTypeConversionError(t *testing.T) {
+	parser := newParser(t, []Config{{Fields: []DataSet{{Path: "a", Type: "int"}}}})
+	_, err := parser.Parse([]byte(`{"a": "not a number"}`))
+	require.Error(t, err)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/influxdata/telegraf/plugins/parsers/grok"
 	"github.com/influxdata/telegraf/plugins/parsers/influx"
 	"github.com/influxdata/telegraf/plugins/parsers/json"
+	"github.com/influxdata/telegraf/plugins/parsers/json_v2"
 	"github.com/influxdata/telegraf/plugins/parsers/logfmt"
 	"github.com/influxdata/telegraf/plugins/parsers/nagios"
 	"github.com/influxdata/telegraf/plugins/parsers/value"
@@ -148,6 +149,9 @@ type Config struct {
 
 	// FormData configuration
 	FormUrlencodedTagKeys []string `toml:"form_urlencoded_tag_keys"`
+
+	// JSON v2 configuration
+	JSONV2Config []json_v2.Config `toml:"json_v2"`
 }
 
 // NewParser returns a Parser interface based on the given config.
@@ -170,6 +174,12 @@ func NewParser(config *Config) (Parser, error) {
 				Strict:       config.JSONStrict,
 			},
 		)
+	case "json_v2":
+		parser, err = json_v2.New(
+			config.MetricName,
+			config.JSONV2Config,
+			config.DefaultTags,
+		)
 	case "value":
 		parser, err = NewValueParser(config.MetricName,
 			config.DataType, config.DefaultTags)
@@ -11,6 +11,7 @@ import (
 	"github.com/influxdata/telegraf"
 	"github.com/influxdata/telegraf/config"
 	"github.com/influxdata/telegraf/internal/process"
+	"github.com/influxdata/telegraf/plugins/common/control"
 	"github.com/influxdata/telegraf/plugins/parsers"
 	"github.com/influxdata/telegraf/plugins/processors"
 	"github.com/influxdata/telegraf/plugins/serializers"
@@ -23,12 +24,33 @@ const sampleConfig = `
 
   ## Delay before the process is restarted after an unexpected termination
   restart_delay = "10s"
+
+  ## Exchange framed JSON messages with the process on the file descriptors
+  ## 3 and 4, for structured logs and errors, heartbeats and handing over
+  ## the plugin configuration.  The process must implement
+  ## the protocol, for example by using the Telegraf Go shim.  Not available
+  ## on Windows.
+  # control_channel = false
+
+  ## Interval of the heartbeats sent over the control channel, the process is
+  ## restarted if it sends no message within the heartbeat timeout, which
+  ## defaults to three intervals.  Heartbeats are disabled if set to 0.
+  # heartbeat_interval = "0s"
+  # heartbeat_timeout = "0s"
+
+  ## Plugin configuration handed over to the process at startup, in the
+  ## format of the shim's configuration file.
+  # plugin_config = '''
+  #   [[processors.my_plugin]]
+  #     option = "value"
+  # '''
 `
 
 type Execd struct {
 	Command      []string        `toml:"command"`
 	RestartDelay config.Duration `toml:"restart_delay"`
 	Log          telegraf.Logger
+	control.Config
 
 	parserConfig     *parsers.Config
 	parser           parsers.Parser
@@ -36,6 +58,7 @@ type Execd struct {
 	serializer       serializers.Serializer
 	acc              telegraf.Accumulator
 	process          *process.Process
+	control          *control.Client
 }
 
 func New() *Execd {
@@ -79,6 +102,11 @@ func (e *Execd) Start(acc telegraf.Accumulator) error {
 	e.process.ReadStdoutFn = e.cmdReadOut
 	e.process.ReadStderrFn = e.cmdReadErr
 
+	if e.ControlChannel {
+		e.control = control.NewClient(e.Config, e.Log)
+		e.control.Attach(e.process)
+	}
+
 	if err = e.process.Start(); err != nil {
 		// if there was only one argument, and it contained spaces, warn the user
 		// that they may have configured it wrong.
@@ -151,7 +179,7 @@ func (e *Execd) Init() error {
 	if len(e.Command) == 0 {
 		return errors.New("no command specified")
 	}
-	return nil
+	return e.Config.Validate()
 }
 
 func init() {
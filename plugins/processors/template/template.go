@@ -5,6 +5,7 @@ import (
 	"text/template"
 
 	"github.com/influxdata/telegraf"
+	"github.com/influxdata/telegraf/plugins/common/tmpl"
 	"github.com/influxdata/telegraf/plugins/processors"
 )
 
@@ -37,10 +38,8 @@ func (r *TemplateProcessor) Apply(in ...telegraf.Metric) []telegraf.Metric {
 	// for each metric in "in" array
 	for _, metric := range in {
 		var b strings.Builder
-		newM := TemplateMetric{metric}
-
-		// supply TemplateMetric and Template from configuration to Template.Execute
-		err := r.tmpl.Execute(&b, &newM)
+		// supply the metric and Template from configuration to Template.Execute
+		err := r.tmpl.Execute(&b, tmpl.NewMetric(metric))
 		if err != nil {
 			r.Log.Errorf("failed to execute template: %v", err)
 			continue
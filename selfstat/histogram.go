@@ -0,0 +1,108 @@
+package selfstat
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DurationBuckets are the default upper bounds, in seconds, of the buckets of
+// duration histograms.
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Histogram is a telegraf statistic counting observations in buckets.
+type Histogram interface {
+	// Name is the name of the measurement
+	Name() string
+
+	// FieldName is the name of the measurement field
+	FieldName() string
+
+	// Tags is a tag map. Each time this is called a new map is allocated.
+	Tags() map[string]string
+
+	// Observe adds a value to the histogram.
+	Observe(v float64)
+
+	// ObserveDuration adds a duration in seconds to the histogram.
+	ObserveDuration(d time.Duration)
+
+	// Get returns the current state of the histogram.
+	Get() HistogramValue
+}
+
+// HistogramValue is the state of a histogram.  The bucket counts are
+// cumulative, Counts[i] is the number of observations less than or equal to
+// Buckets[i].
+type HistogramValue struct {
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	Sum     float64
+}
+
+type histogram struct {
+	measurement string
+	field       string
+	tags        map[string]string
+	buckets     []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) Observe(v float64) {
+	// index of the first bucket including v, the counts are made cumulative
+	// on Get
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+func (h *histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+func (h *histogram) Get() HistogramValue {
+	v := HistogramValue{
+		Buckets: h.buckets,
+		Counts:  make([]uint64, len(h.buckets)),
+	}
+
+	h.mu.Lock()
+	var total uint64
+	for i, c := range h.counts {
+		total += c
+		v.Counts[i] = total
+	}
+	v.Count = h.count
+	v.Sum = h.sum
+	h.mu.Unlock()
+	return v
+}
+
+func (h *histogram) Name() string {
+	return h.measurement
+}
+
+func (h *histogram) FieldName() string {
+	return h.field
+}
+
+// Tags returns a copy of the histogram's tags.
+// NOTE this allocates a new map every time it is called.
+func (h *histogram) Tags() map[string]string {
+	m := make(map[string]string, len(h.tags))
+	for k, v := range h.tags {
+		m[k] = v
+	}
+	return m
+}
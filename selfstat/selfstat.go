@@ -76,42 +76,125 @@ func RegisterTiming(measurement, field string, tags map[string]string) Stat {
 	return registry.registerTiming("internal_"+measurement, field, tags)
 }
 
+// RegisterHistogram registers the given measurement, field, and tags in the
+// selfstat registry. If given an identical measurement, it will return the
+// histogram that's already been registered.
+//
+// Histograms count the observed values in buckets with the given upper bounds,
+// DurationBuckets are used if no buckets are given.  The buckets are exposed
+// by the self-metrics listener, Metrics() only returns the count and sum of
+// the observations as the fields "<field>_count" and "<field>_sum".
+func RegisterHistogram(measurement, field string, tags map[string]string, buckets ...float64) Histogram {
+	return registry.registerHistogram("internal_"+measurement, field, tags, buckets)
+}
+
+// Unregister removes all the stats and histograms registered with the given
+// measurement and tags, used when the plugin they belong to goes away.
+func Unregister(measurement string, tags map[string]string) {
+	registry.unregister("internal_"+measurement, tags)
+}
+
 // Metrics returns all registered stats as telegraf metrics.
 func Metrics() []telegraf.Metric {
 	registry.mu.Lock()
 	now := time.Now()
-	metrics := make([]telegraf.Metric, len(registry.stats))
-	i := 0
-	for _, stats := range registry.stats {
-		if len(stats) > 0 {
-			var tags map[string]string
-			var name string
-			fields := map[string]interface{}{}
-			j := 0
-			for fieldname, stat := range stats {
-				if j == 0 {
-					tags = stat.Tags()
-					name = stat.Name()
-				}
-				fields[fieldname] = stat.Get()
-				j++
+	metrics := make([]telegraf.Metric, 0, len(registry.stats))
+	keys := make(map[uint64]bool, len(registry.stats)+len(registry.histograms))
+	for key := range registry.stats {
+		keys[key] = true
+	}
+	for key := range registry.histograms {
+		keys[key] = true
+	}
+	for key := range keys {
+		stats := registry.stats[key]
+		histograms := registry.histograms[key]
+		if len(stats) == 0 && len(histograms) == 0 {
+			continue
+		}
+
+		var tags map[string]string
+		var name string
+		fields := map[string]interface{}{}
+		for fieldname, stat := range stats {
+			if tags == nil {
+				tags = stat.Tags()
+				name = stat.Name()
 			}
-			metric, err := metric.New(name, tags, fields, now)
-			if err != nil {
-				log.Printf("E! Error creating selfstat metric: %s", err)
-				continue
+			fields[fieldname] = stat.Get()
+		}
+		for fieldname, h := range histograms {
+			if tags == nil {
+				tags = h.Tags()
+				name = h.Name()
 			}
-			metrics[i] = metric
-			i++
+			v := h.Get()
+			fields[fieldname+"_count"] = int64(v.Count)
+			fields[fieldname+"_sum"] = v.Sum
+		}
+		metric, err := metric.New(name, tags, fields, now)
+		if err != nil {
+			log.Printf("E! Error creating selfstat metric: %s", err)
+			continue
 		}
+		metrics = append(metrics, metric)
 	}
 	registry.mu.Unlock()
 	return metrics
 }
 
+// Sample is the current value of a registered stat or histogram.
+type Sample struct {
+	Measurement string
+	Field       string
+	Tags        map[string]string
+	// Value is the value of a stat
+	Value int64
+	// Histogram is the value of a histogram, nil for stats
+	Histogram *HistogramValue
+}
+
+// Snapshot returns the current values of all registered stats and histograms.
+// Unlike Metrics() it does not clear the timings of timing stats, so it can
+// be read independently of the inputs.internal plugin.
+func Snapshot() []Sample {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	var samples []Sample
+	for _, stats := range registry.stats {
+		for _, stat := range stats {
+			v := Sample{
+				Measurement: stat.Name(),
+				Field:       stat.FieldName(),
+				Tags:        stat.Tags(),
+			}
+			if t, ok := stat.(*timingStat); ok {
+				v.Value = t.peek()
+			} else {
+				v.Value = stat.Get()
+			}
+			samples = append(samples, v)
+		}
+	}
+	for _, histograms := range registry.histograms {
+		for _, h := range histograms {
+			hv := h.Get()
+			samples = append(samples, Sample{
+				Measurement: h.Name(),
+				Field:       h.FieldName(),
+				Tags:        h.Tags(),
+				Histogram:   &hv,
+			})
+		}
+	}
+	return samples
+}
+
 type Registry struct {
-	stats map[uint64]map[string]Stat
-	mu    sync.Mutex
+	stats      map[uint64]map[string]Stat
+	histograms map[uint64]map[string]Histogram
+	mu         sync.Mutex
 }
 
 func (r *Registry) register(measurement, field string, tags map[string]string) Stat {
@@ -160,6 +243,53 @@ func (r *Registry) registerTiming(measurement, field string, tags map[string]str
 	return s
 }
 
+func (r *Registry) registerHistogram(measurement, field string, tags map[string]string, buckets []float64) Histogram {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := key(measurement, tags)
+	if h, ok := r.histograms[key][field]; ok {
+		return h
+	}
+
+	t := make(map[string]string, len(tags))
+	for k, v := range tags {
+		t[k] = v
+	}
+
+	if len(buckets) == 0 {
+		buckets = DurationBuckets
+	}
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+
+	h := &histogram{
+		measurement: measurement,
+		field:       field,
+		tags:        t,
+		buckets:     b,
+		counts:      make([]uint64, len(b)),
+	}
+	if r.histograms == nil {
+		r.histograms = make(map[uint64]map[string]Histogram)
+	}
+	if _, ok := r.histograms[key]; !ok {
+		r.histograms[key] = make(map[string]Histogram)
+	}
+	r.histograms[key][field] = h
+	return h
+}
+
+func (r *Registry) unregister(measurement string, tags map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := key(measurement, tags)
+	delete(r.stats, key)
+	delete(r.histograms, key)
+}
+
 func (r *Registry) get(key uint64, field string) (Stat, bool) {
 	if _, ok := r.stats[key]; !ok {
 		return nil, false
@@ -202,6 +332,7 @@ func key(measurement string, tags map[string]string) uint64 {
 
 func init() {
 	registry = &Registry{
-		stats: make(map[uint64]map[string]Stat),
+		stats:      make(map[uint64]map[string]Stat),
+		histograms: make(map[uint64]map[string]Histogram),
 	}
 }
@@ -1,8 +1,10 @@
 package selfstat
 
 import (
+	"sort"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/influxdata/telegraf/testutil"
 	"github.com/stretchr/testify/assert"
@@ -19,7 +21,8 @@ var (
 // testCleanup resets the global registry for test cleanup & unlocks the test lock
 func testCleanup() {
 	registry = &Registry{
-		stats: make(map[uint64]map[string]Stat),
+		stats:      make(map[uint64]map[string]Stat),
+		histograms: make(map[uint64]map[string]Histogram),
 	}
 	testLock.Unlock()
 }
@@ -211,3 +214,78 @@ func TestRegisterCopy(t *testing.T) {
 	tags["new"] = "value"
 	require.NotEqual(t, tags, stat.Tags())
 }
+
+func TestHistogram(t *testing.T) {
+	testLock.Lock()
+	defer testCleanup()
+
+	h := RegisterHistogram("test", "duration_seconds", map[string]string{"test": "foo"}, 1, 0.1)
+	require.Equal(t, h, RegisterHistogram("test", "duration_seconds", map[string]string{"test": "foo"}))
+
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.ObserveDuration(500 * time.Millisecond)
+	h.Observe(2)
+
+	require.Equal(t, HistogramValue{
+		Buckets: []float64{0.1, 1},
+		Counts:  []uint64{2, 3},
+		Count:   4,
+		Sum:     2.65,
+	}, h.Get())
+
+	s := Register("test", "field", map[string]string{"test": "foo"})
+	s.Set(3)
+
+	acc := testutil.Accumulator{}
+	acc.AddMetrics(Metrics())
+	acc.AssertContainsTaggedFields(t, "internal_test",
+		map[string]interface{}{
+			"field":                  int64(3),
+			"duration_seconds_count": int64(4),
+			"duration_seconds_sum":   2.65,
+		},
+		map[string]string{"test": "foo"},
+	)
+}
+
+func TestSnapshot(t *testing.T) {
+	testLock.Lock()
+	defer testCleanup()
+
+	timing := RegisterTiming("test", "time_ns", map[string]string{})
+	timing.Incr(10)
+	timing.Incr(20)
+	RegisterHistogram("test", "duration_seconds", map[string]string{}).Observe(1)
+
+	samples := Snapshot()
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Field < samples[j].Field })
+	require.Len(t, samples, 2)
+	require.Equal(t, "internal_test", samples[0].Measurement)
+	require.Equal(t, "duration_seconds", samples[0].Field)
+	require.Equal(t, uint64(1), samples[0].Histogram.Count)
+	require.Equal(t, "time_ns", samples[1].Field)
+	require.Equal(t, int64(15), samples[1].Value)
+
+	// the snapshot leaves the timings to Metrics()
+	require.Equal(t, int64(15), timing.Get())
+}
+
+func TestUnregister(t *testing.T) {
+	testLock.Lock()
+	defer testCleanup()
+
+	tags := map[string]string{"test": "foo"}
+	Register("test", "field", tags).Set(3)
+	RegisterHistogram("test", "duration_seconds", tags).Observe(1)
+	Register("test", "field", map[string]string{"test": "bar"}).Set(5)
+
+	Unregister("test", tags)
+
+	samples := Snapshot()
+	require.Len(t, samples, 1)
+	require.Equal(t, map[string]string{"test": "bar"}, samples[0].Tags)
+
+	// registering again starts from scratch
+	require.Equal(t, int64(0), Register("test", "field", tags).Get())
+}